@@ -1,12 +1,15 @@
 package canvas
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"io"
+	"math"
 	"os"
 	"reflect"
 	"sort"
+	"sync"
 )
 
 // const mmPerPx = 25.4 / 96.0
@@ -42,6 +45,34 @@ func (res Resolution) DPI() float64 {
 // DefaultResolution is the default resolution used for font PPEMs and is set to 96 DPI.
 const DefaultResolution = Resolution(96.0 * inchPerMm)
 
+// Unit is a unit of length expressed in millimeters, the canvas's native unit.
+type Unit float64
+
+// Units of length, pixels follow the CSS definition of 96 pixels per inch.
+const (
+	UnitMillimeter Unit = 1.0
+	UnitCentimeter Unit = 10.0
+	UnitInch       Unit = mmPerInch
+	UnitPoint      Unit = mmPerPt
+	UnitPica       Unit = mmPerInch / 6.0
+	UnitPixel      Unit = mmPerInch / 96.0
+)
+
+// ToMM converts a length in the unit to millimeters.
+func (unit Unit) ToMM(v float64) float64 {
+	return v * float64(unit)
+}
+
+// FromMM converts a length in millimeters to the unit.
+func (unit Unit) FromMM(v float64) float64 {
+	return v / float64(unit)
+}
+
+// Convert converts a length in the unit to another unit.
+func (unit Unit) Convert(v float64, to Unit) float64 {
+	return v * float64(unit) / float64(to)
+}
+
 // Size defines a size (width and height).
 type Size struct {
 	W, H float64
@@ -151,6 +182,7 @@ type Style struct {
 	DashOffset   float64
 	Dashes       []float64
 	FillRule     // TODO: test for all renderers
+	BlendMode    // supported by the rasterizer, PDF, and SVG renderers
 }
 
 // HasFill returns true if the style has a fill
@@ -180,6 +212,33 @@ var DefaultStyle = Style{
 	FillRule:     NonZero,
 }
 
+// BlendMode is the separable blend mode that determines how a drawn color (source) is mixed with the color underneath (backdrop) before compositing. See https://www.w3.org/TR/compositing-1/#blending.
+type BlendMode int
+
+// See BlendMode.
+const (
+	BlendNormal BlendMode = iota
+	BlendMultiply
+	BlendScreen
+	BlendDarken
+	BlendLighten
+)
+
+// Blend returns the blended color component for a backdrop and source color component, both in the range [0,1] and without premultiplied alpha.
+func (mode BlendMode) Blend(backdrop, source float64) float64 {
+	switch mode {
+	case BlendMultiply:
+		return backdrop * source
+	case BlendScreen:
+		return backdrop + source - backdrop*source
+	case BlendDarken:
+		return math.Min(backdrop, source)
+	case BlendLighten:
+		return math.Max(backdrop, source)
+	}
+	return source
+}
+
 // Renderer is an interface that renderers implement. It defines the size of the target (in mm) and functions to render paths, text objects and images.
 type Renderer interface {
 	Size() (float64, float64)
@@ -188,6 +247,18 @@ type Renderer interface {
 	RenderImage(img image.Image, m Matrix)
 }
 
+// GroupRenderer is implemented by renderers that can composite a group of drawing operations as a unit. An isolated group is drawn on a transparent layer so that blend modes within the group only mix with other operations of the group, after which the layer is composited onto the backdrop.
+type GroupRenderer interface {
+	BeginGroup(isolate bool)
+	EndGroup()
+}
+
+// AlphaGroupRenderer is implemented by group renderers that can composite an isolated group at a reduced opacity, so that overlapping operations within the group are not darkened twice as they would be when drawn with a reduced opacity each. The group is ended by EndGroup.
+type AlphaGroupRenderer interface {
+	GroupRenderer
+	BeginAlphaGroup(alpha float64)
+}
+
 ////////////////////////////////////////////////////////////////
 
 // CoordSystem is the coordinate system, which can be either of the four cartesian quadrants. Most useful are the I'th and IV'th quadrants. CartesianI is the default quadrant with the zero-point in the bottom-left (the default for mathematics). The CartesianII has its zero-point in the bottom-right, CartesianIII in the top-right, and CartesianIV in the top-left (often used as default for printing devices). See https://en.wikipedia.org/wiki/Cartesian_coordinate_system#Quadrants_and_octants for an explanation.
@@ -457,6 +528,25 @@ func (c *Context) SetFillRule(rule FillRule) {
 	c.Style.FillRule = rule
 }
 
+// SetBlendMode sets the blend mode to be used for drawing paths.
+func (c *Context) SetBlendMode(mode BlendMode) {
+	c.Style.BlendMode = mode
+}
+
+// BeginGroup starts a group of drawing operations that is composited as a unit when the renderer is a GroupRenderer.
+func (c *Context) BeginGroup(isolate bool) {
+	if gr, ok := c.Renderer.(GroupRenderer); ok {
+		gr.BeginGroup(isolate)
+	}
+}
+
+// EndGroup ends the last group of drawing operations.
+func (c *Context) EndGroup() {
+	if gr, ok := c.Renderer.(GroupRenderer); ok {
+		gr.EndGroup()
+	}
+}
+
 // ResetStyle resets the draw state to its default (colors, stroke widths, dashes, ...).
 func (c *Context) ResetStyle() {
 	c.Style = DefaultStyle
@@ -720,13 +810,23 @@ type layer struct {
 
 	m     Matrix
 	style Style // only for path
+
+	group *groupLayer // marks the start or end of a group
+}
+
+type groupLayer struct {
+	begin, isolate bool
+	alpha          float64
 }
 
 // Canvas stores all drawing operations as layers that can be re-rendered to other renderers.
 type Canvas struct {
-	layers map[int][]layer
-	zindex int
-	W, H   float64
+	layers       map[int][]layer
+	zindex       int
+	groups       []int // z-indices of the open groups
+	background   color.RGBA
+	transparency float64 // one minus the global alpha, so that the zero value is opaque
+	W, H         float64
 }
 
 // New returns a new canvas with width and height in millimeters, that records all drawing operations into layers. The canvas can then be rendered to any other renderer.
@@ -751,27 +851,85 @@ func (c *Canvas) Size() (float64, float64) {
 // RenderPath renders a path to the canvas using a style and a transformation matrix.
 func (c *Canvas) RenderPath(path *Path, style Style, m Matrix) {
 	path = path.Copy()
-	c.layers[c.zindex] = append(c.layers[c.zindex], layer{path: path, m: m, style: style})
+	c.add(layer{path: path, m: m, style: style})
 }
 
 // RenderText renders a text object to the canvas using a transformation matrix.
 func (c *Canvas) RenderText(text *Text, m Matrix) {
-	c.layers[c.zindex] = append(c.layers[c.zindex], layer{text: text, m: m})
+	c.add(layer{text: text, m: m})
 }
 
 // RenderImage renders an image to the canvas using a transformation matrix.
 func (c *Canvas) RenderImage(img image.Image, m Matrix) {
-	c.layers[c.zindex] = append(c.layers[c.zindex], layer{img: img, m: m})
+	c.add(layer{img: img, m: m})
+}
+
+// BeginGroup starts a group of drawing operations that is composited as a unit, see GroupRenderer. Drawing operations within a group are recorded in the z-index of the outermost group in drawing order, so that the group is not split by SetZIndex.
+func (c *Canvas) BeginGroup(isolate bool) {
+	c.add(layer{group: &groupLayer{begin: true, isolate: isolate}})
+	c.groups = append(c.groups, c.zindex)
+}
+
+// BeginAlphaGroup starts an isolated group of drawing operations that is composited at the given opacity in the range (0,1], see AlphaGroupRenderer and BeginGroup.
+func (c *Canvas) BeginAlphaGroup(alpha float64) {
+	c.add(layer{group: &groupLayer{begin: true, isolate: true, alpha: alpha}})
+	c.groups = append(c.groups, c.zindex)
+}
+
+// EndGroup ends the last group of drawing operations.
+func (c *Canvas) EndGroup() {
+	c.add(layer{group: &groupLayer{}})
+	if 0 < len(c.groups) {
+		c.groups = c.groups[:len(c.groups)-1]
+	}
+}
+
+// add records a layer in the current z-index, or in the z-index of the outermost open group.
+func (c *Canvas) add(l layer) {
+	zindex := c.zindex
+	if 0 < len(c.groups) {
+		zindex = c.groups[0]
+	}
+	c.layers[zindex] = append(c.layers[zindex], l)
 }
 
 // Empty return true if the canvas is empty.
 func (c *Canvas) Empty() bool {
-	return len(c.layers) == 0
+	for _, layers := range c.layers {
+		if len(layers) != 0 {
+			return false
+		}
+	}
+	return true
 }
 
-// Reset empties the canvas.
+// Reset empties the canvas and resets the global alpha.
 func (c *Canvas) Reset() {
 	c.layers = map[int][]layer{}
+	c.groups = c.groups[:0]
+	c.transparency = 0.0
+}
+
+// Clear empties the canvas and resets the z-index, so that the canvas can be reused for drawing such as for each frame of an animation. Unlike Reset, the memory of the display list is kept to avoid allocations when drawing again. The size, background, and global alpha of the canvas are kept.
+func (c *Canvas) Clear() {
+	for zindex, layers := range c.layers {
+		for i := range layers {
+			layers[i] = layer{} // release paths, texts, and images
+		}
+		c.layers[zindex] = layers[:0]
+	}
+	c.zindex = 0
+	c.groups = c.groups[:0]
+}
+
+// SetBackground sets the background color that fills the canvas before any drawing operations are rendered. By default the background is transparent, which is kept for raster output with an alpha channel.
+func (c *Canvas) SetBackground(col color.Color) {
+	c.background = rgbaColor(col)
+}
+
+// SetGlobalAlpha sets the opacity in the range [0,1] with which the canvas is rendered, such as for fade animations. The canvas including its background is rendered as an isolated group that is composited at the given opacity as a whole, so that overlapping drawing operations are not darkened twice. It requires the renderer to be an AlphaGroupRenderer, otherwise the opacity is ignored. By default the opacity is one.
+func (c *Canvas) SetGlobalAlpha(alpha float64) {
+	c.transparency = 1.0 - math.Max(0.0, math.Min(1.0, alpha))
 }
 
 // SetZIndex sets the z-index.
@@ -790,12 +948,35 @@ func (c *Canvas) Clip(rect Rect) {
 	c.H = rect.H
 }
 
+// MirrorAxis specifies how a canvas is mirrored, see Canvas.Mirror. MirrorHorizontal flips the left and right sides and MirrorVertical flips the top and bottom sides.
+type MirrorAxis int
+
+// See MirrorAxis.
+const (
+	MirrorHorizontal MirrorAxis = iota
+	MirrorVertical
+)
+
+// Mirror flips the elements of the canvas horizontally or vertically about its center, such as for printing on transfer paper. Text is mirrored as a whole, its glyphs are shaped, laid out, and grid-fitted as for unmirrored text. Elements drawn afterwards are not mirrored.
+func (c *Canvas) Mirror(axis MirrorAxis) {
+	m := Identity.ReflectXAbout(c.W / 2.0)
+	if axis == MirrorVertical {
+		m = Identity.ReflectYAbout(c.H / 2.0)
+	}
+	for _, layers := range c.layers {
+		for i := range layers {
+			layers[i].m = m.Mul(layers[i].m)
+		}
+	}
+}
+
 // Fit shrinks the canvas' size that so all elements fit with a given margin in millimeters.
 func (c *Canvas) Fit(margin float64) {
 	rect := Rect{}
+	first := true
 	// TODO: slow when we have many paths (see Graph example)
 	for _, layers := range c.layers {
-		for i, l := range layers {
+		for _, l := range layers {
 			bounds := Rect{}
 			if l.path != nil {
 				bounds = l.path.Bounds()
@@ -810,10 +991,13 @@ func (c *Canvas) Fit(margin float64) {
 			} else if l.img != nil {
 				size := l.img.Bounds().Size()
 				bounds = Rect{0.0, 0.0, float64(size.X), float64(size.Y)}
+			} else {
+				continue
 			}
 			bounds = bounds.Transform(l.m)
-			if i == 0 {
+			if first {
 				rect = bounds
+				first = false
 			} else {
 				rect = rect.Add(bounds)
 			}
@@ -826,31 +1010,116 @@ func (c *Canvas) Fit(margin float64) {
 	c.Clip(rect)
 }
 
-// RenderTo renders the accumulated canvas drawing operations to another renderer.
-func (c *Canvas) RenderTo(r Renderer) {
-	c.RenderViewTo(r, Identity)
+// DrawCommand is a recorded drawing operation of a canvas, it is either a PathCmd, TextCmd, ImageCmd, or GroupCmd.
+type DrawCommand interface {
+	Render(Renderer, Matrix)
 }
 
-// RenderViewTo transforms and renders the accumulated canvas drawing operations to another renderer.
-func (c *Canvas) RenderViewTo(r Renderer, view Matrix) {
+// PathCmd is a recorded path drawing operation.
+type PathCmd struct {
+	ZIndex int
+	Path   *Path
+	Style  Style
+	Matrix Matrix
+}
+
+// Render renders the path to a renderer with the given view.
+func (cmd PathCmd) Render(r Renderer, view Matrix) {
+	r.RenderPath(cmd.Path, cmd.Style, view.Mul(cmd.Matrix))
+}
+
+// TextCmd is a recorded text drawing operation.
+type TextCmd struct {
+	ZIndex int
+	Text   *Text
+	Matrix Matrix
+}
+
+// Render renders the text to a renderer with the given view.
+func (cmd TextCmd) Render(r Renderer, view Matrix) {
+	r.RenderText(cmd.Text, view.Mul(cmd.Matrix))
+}
+
+// ImageCmd is a recorded image drawing operation.
+type ImageCmd struct {
+	ZIndex int
+	Image  image.Image
+	Matrix Matrix
+}
+
+// Render renders the image to a renderer with the given view.
+func (cmd ImageCmd) Render(r Renderer, view Matrix) {
+	r.RenderImage(cmd.Image, view.Mul(cmd.Matrix))
+}
+
+// GroupCmd is a recorded start or end of a group.
+type GroupCmd struct {
+	ZIndex  int
+	Begin   bool
+	Isolate bool
+	Alpha   float64 // opacity of an isolated group, zero for groups started by BeginGroup which are opaque
+}
+
+// Render starts or ends the group if the renderer is a GroupRenderer. Groups with an opacity are started as an isolated group without opacity if the renderer is not an AlphaGroupRenderer.
+func (cmd GroupCmd) Render(r Renderer, view Matrix) {
+	if gr, ok := r.(GroupRenderer); ok {
+		if agr, ok := r.(AlphaGroupRenderer); ok && cmd.Begin && cmd.Alpha != 0.0 {
+			agr.BeginAlphaGroup(cmd.Alpha)
+		} else if cmd.Begin {
+			gr.BeginGroup(cmd.Isolate)
+		} else {
+			gr.EndGroup()
+		}
+	}
+}
+
+// Commands returns the display list of recorded drawing operations in the order they are rendered, that is sorted by z-index and then by drawing order. The commands can be inspected, filtered, or replayed to any renderer.
+func (c *Canvas) Commands() []DrawCommand {
 	zindices := []int{}
 	for zindex := range c.layers {
 		zindices = append(zindices, zindex)
 	}
 	sort.Ints(zindices)
 
+	cmds := []DrawCommand{}
 	for _, zindex := range zindices {
 		for _, l := range c.layers[zindex] {
-			m := view.Mul(l.m)
 			if l.path != nil {
-				r.RenderPath(l.path, l.style, m)
+				cmds = append(cmds, PathCmd{zindex, l.path, l.style, l.m})
 			} else if l.text != nil {
-				r.RenderText(l.text, m)
+				cmds = append(cmds, TextCmd{zindex, l.text, l.m})
 			} else if l.img != nil {
-				r.RenderImage(l.img, m)
+				cmds = append(cmds, ImageCmd{zindex, l.img, l.m})
+			} else if l.group != nil {
+				cmds = append(cmds, GroupCmd{zindex, l.group.begin, l.group.isolate, l.group.alpha})
 			}
 		}
 	}
+	return cmds
+}
+
+// RenderTo renders the accumulated canvas drawing operations to another renderer. Operations are replayed in order of z-index, and in drawing order within the same z-index, so that the same canvas can be rendered to any renderer such as a rasterizer, SVG, or PDF.
+func (c *Canvas) RenderTo(r Renderer) {
+	c.RenderViewTo(r, Identity)
+}
+
+// RenderViewTo transforms and renders the accumulated canvas drawing operations to another renderer.
+func (c *Canvas) RenderViewTo(r Renderer, view Matrix) {
+	alpha := 1.0 - c.transparency
+	if alpha == 0.0 {
+		return
+	} else if agr, ok := r.(AlphaGroupRenderer); ok && alpha < 1.0 {
+		agr.BeginAlphaGroup(alpha)
+		defer agr.EndGroup()
+	}
+	if c.background.A != 0 {
+		style := DefaultStyle
+		style.Fill = Paint{Color: c.background}
+		r.RenderPath(Rectangle(c.W, c.H), style, view)
+	}
+	for _, cmd := range c.Commands() {
+		cmd.Render(r, view)
+	}
 }
 
 // Writer can write a canvas to a writer.
@@ -869,3 +1138,58 @@ func (c *Canvas) WriteFile(filename string, w Writer) error {
 	}
 	return f.Close()
 }
+
+var rasterize func(*Canvas, Resolution, ColorSpace) *image.RGBA
+
+// RegisterRasterizer registers the function used by Canvas.Rasterize. It is called upon importing the github.com/tdewolff/canvas/renderers/rasterizer package, which cannot be imported by this package directly.
+func RegisterRasterizer(f func(*Canvas, Resolution, ColorSpace) *image.RGBA) {
+	rasterize = f
+}
+
+// Rasterize returns the rendered image of the canvas at the given resolution using the default color space, which can be used as input for another canvas, for example using Context.DrawImage. It uses the raster renderer and thus requires the github.com/tdewolff/canvas/renderers/rasterizer package to be imported, otherwise it returns an error.
+func (c *Canvas) Rasterize(resolution Resolution) (*image.RGBA, error) {
+	if rasterize == nil {
+		return nil, fmt.Errorf("rasterizer not registered, import github.com/tdewolff/canvas/renderers/rasterizer")
+	}
+	return rasterize(c, resolution, DefaultColorSpace), nil
+}
+
+// Image returns an image.Image adapter of the canvas at the given resolution, so that the canvas can be passed to functions that accept an image.Image. The canvas is rasterized upon the first call to At or Bounds and the result is cached, so that later changes to the canvas are not reflected. It requires the github.com/tdewolff/canvas/renderers/rasterizer package to be imported, otherwise the image is empty.
+func (c *Canvas) Image(resolution Resolution) image.Image {
+	return &canvasImage{c: c, resolution: resolution}
+}
+
+type canvasImage struct {
+	c          *Canvas
+	resolution Resolution
+
+	once sync.Once
+	img  *image.RGBA
+	err  error
+}
+
+// rasterize returns the rasterized canvas, or an empty image if the canvas could not be rasterized.
+func (img *canvasImage) rasterize() *image.RGBA {
+	img.once.Do(func() {
+		img.img, img.err = img.c.Rasterize(img.resolution)
+	})
+	if img.img == nil {
+		return &image.RGBA{}
+	}
+	return img.img
+}
+
+// ColorModel returns the color model of the rasterized canvas.
+func (img *canvasImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+// Bounds returns the bounds of the rasterized canvas.
+func (img *canvasImage) Bounds() image.Rectangle {
+	return img.rasterize().Bounds()
+}
+
+// At returns the color of the rasterized canvas at the given pixel.
+func (img *canvasImage) At(x, y int) color.Color {
+	return img.rasterize().At(x, y)
+}
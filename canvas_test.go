@@ -2,6 +2,7 @@ package canvas
 
 import (
 	"image"
+	"image/color"
 	"testing"
 
 	"github.com/tdewolff/test"
@@ -74,4 +75,161 @@ func TestCanvasFit(t *testing.T) {
 
 	test.Float(t, c.W, 20)
 	test.Float(t, c.H, 20)
+
+	// the first layer of each z-index may be a group
+	c = New(100, 100)
+	c.BeginGroup(true)
+	c.RenderPath(Rectangle(10.0, 10.0), DefaultStyle, Identity.Translate(20.0, 30.0))
+	c.EndGroup()
+	c.SetZIndex(1)
+	c.BeginGroup(false)
+	c.RenderPath(Rectangle(10.0, 10.0), DefaultStyle, Identity.Translate(40.0, 30.0))
+	c.EndGroup()
+	c.Fit(0.0)
+	test.Float(t, c.W, 30.0)
+	test.Float(t, c.H, 10.0)
+}
+
+func TestCanvasGroup(t *testing.T) {
+	c := New(100, 100)
+	c.BeginGroup(true)
+	c.RenderPath(Rectangle(10.0, 10.0), DefaultStyle, Identity)
+	c.SetZIndex(-1)
+	c.RenderPath(Circle(5.0), DefaultStyle, Identity)
+	c.EndGroup()
+	c.RenderPath(Rectangle(20.0, 20.0), DefaultStyle, Identity)
+
+	// the group is kept whole in the z-index it was started in
+	cmds := c.Commands()
+	test.T(t, len(cmds), 5)
+	test.T(t, cmds[0].(PathCmd).Path, Rectangle(20.0, 20.0))
+	test.T(t, cmds[0].(PathCmd).ZIndex, -1)
+	test.T(t, cmds[1], DrawCommand(GroupCmd{ZIndex: 0, Begin: true, Isolate: true}))
+	test.T(t, cmds[2].(PathCmd).Path, Rectangle(10.0, 10.0))
+	test.T(t, cmds[3].(PathCmd).Path, Circle(5.0))
+	test.T(t, cmds[3].(PathCmd).ZIndex, 0)
+	test.T(t, cmds[4], DrawCommand(GroupCmd{ZIndex: 0}))
+}
+
+type recordingRenderer struct {
+	ops []string
+}
+
+func (r *recordingRenderer) Size() (float64, float64) {
+	return 100.0, 100.0
+}
+
+func (r *recordingRenderer) RenderPath(path *Path, style Style, m Matrix) {
+	r.ops = append(r.ops, "path "+path.Transform(m).String())
+}
+
+func (r *recordingRenderer) RenderText(text *Text, m Matrix) {
+	r.ops = append(r.ops, "text "+text.String()+" "+m.String())
+}
+
+func (r *recordingRenderer) RenderImage(img image.Image, m Matrix) {
+	r.ops = append(r.ops, "image "+m.String())
+}
+
+func TestCanvasRenderTo(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(10.0, Black, FontRegular, FontNormal)
+
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.SetZIndex(1)
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.SetZIndex(0)
+	ctx.DrawText(10.0, 10.0, NewTextLine(face, "Text", Left))
+	ctx.DrawImage(20.0, 20.0, image.NewRGBA(image.Rect(0, 0, 2, 2)), 1.0)
+
+	// render directly
+	r := &recordingRenderer{}
+	c.RenderTo(r)
+	test.T(t, len(r.ops), 3)
+	test.String(t, r.ops[0][:9], "text Text")
+	test.String(t, r.ops[1][:5], "image")
+	test.String(t, r.ops[2], "path M0 0L10 0L10 10L0 10z")
+
+	// render through another canvas
+	c2 := New(100, 100)
+	c.RenderTo(c2)
+	r2 := &recordingRenderer{}
+	c2.RenderTo(r2)
+	test.T(t, r2.ops, r.ops)
+}
+
+func TestCanvasRasterizeUnregistered(t *testing.T) {
+	// the rasterizer package is not imported by this package
+	c := New(10.0, 10.0)
+	_, err := c.Rasterize(DPMM(2.0))
+	test.That(t, err != nil, "rasterizing without a registered rasterizer must fail")
+
+	img := c.Image(DPMM(2.0))
+	test.T(t, img.Bounds(), image.Rectangle{})
+	test.T(t, img.At(0, 0), color.RGBA{})
+	test.T(t, img.Bounds(), image.Rectangle{})
+}
+
+func TestCanvasClear(t *testing.T) {
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.SetZIndex(1)
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.SetZIndex(0)
+	ctx.DrawPath(0.0, 0.0, Circle(5.0))
+	test.That(t, !c.Empty())
+
+	c.Clear()
+	test.That(t, c.Empty())
+	test.T(t, len(c.Commands()), 0)
+
+	c.RenderPath(Rectangle(20.0, 20.0), DefaultStyle, Identity)
+	test.That(t, !c.Empty())
+	r := &recordingRenderer{}
+	c.RenderTo(r)
+	test.T(t, r.ops, []string{"path M0 0L20 0L20 20L0 20z"})
+
+	cmds := c.Commands()
+	test.T(t, len(cmds), 1)
+	test.T(t, cmds[0].(PathCmd).ZIndex, 0)
+}
+
+func TestCanvasCommands(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.SetZIndex(-1)
+	ctx.DrawImage(20.0, 20.0, img, 1.0)
+	ctx.SetZIndex(0)
+	ctx.SetFillColor(Red)
+	ctx.DrawPath(5.0, 5.0, Circle(5.0))
+
+	cmds := c.Commands()
+	test.T(t, len(cmds), 3)
+
+	imageCmd, ok := cmds[0].(ImageCmd)
+	test.That(t, ok)
+	test.T(t, imageCmd.ZIndex, -1)
+	test.T(t, imageCmd.Image, image.Image(img))
+
+	pathCmd, ok := cmds[1].(PathCmd)
+	test.That(t, ok)
+	test.T(t, pathCmd.Path, Rectangle(10.0, 10.0))
+	test.T(t, pathCmd.Style.Fill.Color, Black)
+
+	pathCmd, ok = cmds[2].(PathCmd)
+	test.That(t, ok)
+	test.T(t, pathCmd.Matrix, Identity.Translate(5.0, 5.0))
+	test.T(t, pathCmd.Style.Fill.Color, Red)
+
+	// replay a subset
+	c2 := New(100, 100)
+	cmds[1].Render(c2, Identity)
+	test.T(t, len(c2.Commands()), 1)
 }
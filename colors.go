@@ -71,6 +71,30 @@ type Gradient interface {
 	At(float64, float64) color.RGBA
 }
 
+// Spread is the method of extending a gradient beyond its start and end, that is for offsets outside of [0,1], corresponding to SVG's spreadMethod. SpreadPad extends the colors of the first and last stops, SpreadRepeat repeats the gradient, and SpreadReflect repeats the gradient while reversing every other repetition.
+type Spread int
+
+// See Spread.
+const (
+	SpreadPad Spread = iota
+	SpreadRepeat
+	SpreadReflect
+)
+
+// apply maps the offset into [0,1] for repeating and reflecting gradients. Offsets of padded gradients are returned unchanged.
+func (spread Spread) apply(t float64) float64 {
+	switch spread {
+	case SpreadRepeat:
+		return t - math.Floor(t)
+	case SpreadReflect:
+		t = math.Abs(math.Mod(t, 2.0))
+		if 1.0 < t {
+			t = 2.0 - t
+		}
+	}
+	return t
+}
+
 // Stop is a color and offset for gradient patterns.
 type Stop struct {
 	Offset float64
@@ -114,6 +138,52 @@ func (stops Stops) At(t float64) color.RGBA {
 	return stops[len(stops)-1].Color
 }
 
+// At64 returns the color at position t ∈ [0,1] with 16-bit precision, which is used for dithering.
+func (stops Stops) At64(t float64) color.RGBA64 {
+	if len(stops) == 0 {
+		return color.RGBA64{}
+	} else if t <= 0.0 || len(stops) == 1 {
+		return color.RGBA64Model.Convert(stops[0].Color).(color.RGBA64)
+	} else if 1.0 <= t {
+		return color.RGBA64Model.Convert(stops[len(stops)-1].Color).(color.RGBA64)
+	}
+	for i, stop := range stops[1:] {
+		if t < stop.Offset {
+			t = (t - stops[i].Offset) / (stop.Offset - stops[i].Offset)
+			return colorLerp64(stops[i].Color, stop.Color, t)
+		}
+	}
+	return color.RGBA64Model.Convert(stops[len(stops)-1].Color).(color.RGBA64)
+}
+
+// Ramp returns n colors sampled at evenly spaced positions over [0,1], where the first and last colors are at positions 0 and 1 respectively. It can be used as a lookup table to speed up evaluating the colors of a gradient with many stops over a large area.
+func (stops Stops) Ramp(n int) []color.RGBA {
+	ramp := make([]color.RGBA, n)
+	for i := range ramp {
+		t := 0.0
+		if 1 < n {
+			t = float64(i) / float64(n-1)
+		}
+		ramp[i] = stops.At(t)
+	}
+	return ramp
+}
+
+func colorLerp64(c0, c1 color.RGBA, t float64) color.RGBA64 {
+	r0, g0, b0, a0 := c0.RGBA()
+	r1, g1, b1, a1 := c1.RGBA()
+	return color.RGBA64{
+		lerp64(r0, r1, t),
+		lerp64(g0, g1, t),
+		lerp64(b0, b1, t),
+		lerp64(a0, a1, t),
+	}
+}
+
+func lerp64(a, b uint32, t float64) uint16 {
+	return uint16((1.0-t)*float64(a) + t*float64(b) + 0.5)
+}
+
 func colorLerp(c0, c1 color.RGBA, t float64) color.RGBA {
 	r0, g0, b0, a0 := c0.RGBA()
 	r1, g1, b1, a1 := c1.RGBA()
@@ -133,6 +203,7 @@ func lerp(a, b uint32, t float64) uint8 {
 type LinearGradient struct {
 	Start, End Point
 	Stops
+	Spread
 
 	d  Point
 	d2 float64
@@ -177,20 +248,32 @@ func (g *LinearGradient) SetColorSpace(colorSpace ColorSpace) Gradient {
 	return &gradient
 }
 
+func (g *LinearGradient) offset(x, y float64) float64 {
+	p := Point{x, y}.Sub(g.Start)
+	if Equal(g.d.Y, 0.0) && !Equal(g.d.X, 0.0) {
+		return p.X / g.d.X // horizontal
+	} else if !Equal(g.d.Y, 0.0) && Equal(g.d.X, 0.0) {
+		return p.Y / g.d.Y // vertical
+	}
+	return p.Dot(g.d) / g.d2
+}
+
+// Offset returns the position along the gradient of the color at position (x,y) after applying the spread method, which is not clamped to [0,1] for padded gradients. The boolean is always true.
+func (g *LinearGradient) Offset(x, y float64) (float64, bool) {
+	return g.Spread.apply(g.offset(x, y)), true
+}
+
 // At returns the color at position (x,y).
 func (g *LinearGradient) At(x, y float64) color.RGBA {
 	if len(g.Stops) == 0 {
 		return Transparent
 	}
+	return g.Stops.At(g.Spread.apply(g.offset(x, y)))
+}
 
-	p := Point{x, y}.Sub(g.Start)
-	if Equal(g.d.Y, 0.0) && !Equal(g.d.X, 0.0) {
-		return g.Stops.At(p.X / g.d.X) // horizontal
-	} else if !Equal(g.d.Y, 0.0) && Equal(g.d.X, 0.0) {
-		return g.Stops.At(p.Y / g.d.Y) // vertical
-	}
-	t := p.Dot(g.d) / g.d2
-	return g.Stops.At(t)
+// At64 returns the color at position (x,y) with 16-bit precision.
+func (g *LinearGradient) At64(x, y float64) color.RGBA64 {
+	return g.Stops.At64(g.Spread.apply(g.offset(x, y)))
 }
 
 // RadialGradient is a radial gradient pattern between two circles defined by their center points and radii. Color stop at offset 0 corresponds to the first circle and offset 1 to the second circle.
@@ -198,6 +281,7 @@ type RadialGradient struct {
 	C0, C1 Point
 	R0, R1 float64
 	Stops
+	Spread
 
 	cd    Point
 	dr, a float64
@@ -246,12 +330,7 @@ func (g *RadialGradient) SetColorSpace(colorSpace ColorSpace) Gradient {
 	return &gradient
 }
 
-// At returns the color at position (x,y).
-func (g *RadialGradient) At(x, y float64) color.RGBA {
-	if len(g.Stops) == 0 {
-		return Transparent
-	}
-
+func (g *RadialGradient) offset(x, y float64) (float64, bool) {
 	// see reference implementation of pixman-radial-gradient
 	// https://github.com/servo/pixman/blob/master/pixman/pixman-radial-gradient.c#L161
 	pd := Point{x, y}.Sub(g.C0)
@@ -259,13 +338,198 @@ func (g *RadialGradient) At(x, y float64) color.RGBA {
 	c := pd.Dot(pd) - g.R0*g.R0
 	t0, t1 := solveQuadraticFormula(g.a, -2.0*b, c)
 	if !math.IsNaN(t1) {
-		return g.Stops.At(t1)
+		return t1, true
 	} else if !math.IsNaN(t0) {
-		return g.Stops.At(t0)
+		return t0, true
+	}
+	return 0.0, false
+}
+
+// Offset returns the position along the gradient of the color at position (x,y) after applying the spread method, which is not clamped to [0,1] for padded gradients. The boolean is false if no circle of the gradient passes through the position, where the gradient is transparent.
+func (g *RadialGradient) Offset(x, y float64) (float64, bool) {
+	t, ok := g.offset(x, y)
+	return g.Spread.apply(t), ok
+}
+
+// At returns the color at position (x,y).
+func (g *RadialGradient) At(x, y float64) color.RGBA {
+	if len(g.Stops) == 0 {
+		return Transparent
+	} else if t, ok := g.offset(x, y); ok {
+		return g.Stops.At(g.Spread.apply(t))
+	}
+	return Transparent
+}
+
+// At64 returns the color at position (x,y) with 16-bit precision.
+func (g *RadialGradient) At64(x, y float64) color.RGBA64 {
+	if t, ok := g.offset(x, y); ok {
+		return g.Stops.At64(g.Spread.apply(t))
+	}
+	return color.RGBA64{}
+}
+
+// CoonsPatch is a patch of a mesh gradient bounded by four cubic Bézier curves, with colors defined at its four corners. The twelve control points are ordered as for PDF shading type 6: the boundary starts at the corner Points[0] and runs through the sides Points[0:4], Points[3:7], Points[6:10], and Points[9:12] followed by Points[0]. The corner colors correspond to the corners Points[0], Points[3], Points[6], and Points[9] respectively.
+type CoonsPatch struct {
+	Points [12]Point
+	Colors [4]color.RGBA
+}
+
+// pos returns the position at parameters (u,v) ∈ [0,1]x[0,1] and its partial derivatives with respect to u and v.
+func (p *CoonsPatch) pos(u, v float64) (Point, Point, Point) {
+	// the curves C1 (v=0) and C2 (v=1) run along u, and D1 (u=0) and D2 (u=1) run along v
+	q := &p.Points
+	c1 := cubicBezierPos(q[0], q[11], q[10], q[9], u)
+	c2 := cubicBezierPos(q[3], q[4], q[5], q[6], u)
+	d1 := cubicBezierPos(q[0], q[1], q[2], q[3], v)
+	d2 := cubicBezierPos(q[9], q[8], q[7], q[6], v)
+	dc1 := cubicBezierDeriv(q[0], q[11], q[10], q[9], u)
+	dc2 := cubicBezierDeriv(q[3], q[4], q[5], q[6], u)
+	dd1 := cubicBezierDeriv(q[0], q[1], q[2], q[3], v)
+	dd2 := cubicBezierDeriv(q[9], q[8], q[7], q[6], v)
+
+	// corners p00, p03, p33, and p30
+	b0 := q[0].Mul(1.0 - u).Add(q[9].Mul(u))
+	b1 := q[3].Mul(1.0 - u).Add(q[6].Mul(u))
+	s := c1.Mul(1.0 - v).Add(c2.Mul(v)).Add(d1.Mul(1.0 - u)).Add(d2.Mul(u)).Sub(b0.Mul(1.0 - v)).Sub(b1.Mul(v))
+	du := dc1.Mul(1.0 - v).Add(dc2.Mul(v)).Sub(d1).Add(d2).Sub(q[9].Sub(q[0]).Mul(1.0 - v)).Sub(q[6].Sub(q[3]).Mul(v))
+	dv := c2.Sub(c1).Add(dd1.Mul(1.0 - u)).Add(dd2.Mul(u)).Sub(b1).Add(b0)
+	return s, du, dv
+}
+
+// param returns the parameters (u,v) of the patch at position (x,y) by solving for them using Newton's method. If the patch folds over itself, the parameters with the largest v and then u are returned, following the PDF specification.
+func (p *CoonsPatch) param(x, y float64) (float64, float64, bool) {
+	target := Point{x, y}
+	found := false
+	var uFound, vFound float64
+	for _, start := range [][2]float64{{0.5, 0.5}, {0.25, 0.25}, {0.75, 0.25}, {0.25, 0.75}, {0.75, 0.75}} {
+		u, v := start[0], start[1]
+		for i := 0; i < 20; i++ {
+			s, du, dv := p.pos(u, v)
+			d := target.Sub(s)
+			if d.Length() < 1e-6 {
+				if -Epsilon <= u && u <= 1.0+Epsilon && -Epsilon <= v && v <= 1.0+Epsilon {
+					u = math.Min(math.Max(u, 0.0), 1.0)
+					v = math.Min(math.Max(v, 0.0), 1.0)
+					if !found || vFound < v || Equal(vFound, v) && uFound < u {
+						found, uFound, vFound = true, u, v
+					}
+				}
+				break
+			}
+
+			det := du.PerpDot(dv)
+			if Equal(det, 0.0) {
+				break
+			}
+			u += d.PerpDot(dv) / det
+			v += du.PerpDot(d) / det
+			if math.Abs(u) > 4.0 || math.Abs(v) > 4.0 {
+				break // diverging
+			}
+		}
+	}
+	return uFound, vFound, found
+}
+
+// at returns the color at parameters (u,v) as bilinear interpolation of the corner colors, with components in [0,1].
+func (p *CoonsPatch) at(u, v float64) [4]float64 {
+	var c [4]float64
+	w := [4]float64{(1.0 - u) * (1.0 - v), (1.0 - u) * v, u * v, u * (1.0 - v)}
+	for i, col := range p.Colors {
+		c[0] += w[i] * float64(col.R) / 255.0
+		c[1] += w[i] * float64(col.G) / 255.0
+		c[2] += w[i] * float64(col.B) / 255.0
+		c[3] += w[i] * float64(col.A) / 255.0
+	}
+	return c
+}
+
+// MeshGradient is a mesh gradient pattern consisting of Coons patches, similar to PDF shading type 6. The color within a patch is interpolated bilinearly between its corner colors, where later patches are painted over earlier patches. Outside of the patches the gradient is transparent.
+type MeshGradient struct {
+	Patches []CoonsPatch
+}
+
+// NewMeshGradient returns a new mesh gradient pattern.
+func NewMeshGradient() *MeshGradient {
+	return &MeshGradient{}
+}
+
+// Add adds a Coons patch given by its twelve control points and four corner colors, see CoonsPatch for their order.
+func (g *MeshGradient) Add(points [12]Point, colors [4]color.RGBA) {
+	g.Patches = append(g.Patches, CoonsPatch{points, colors})
+}
+
+// AddRect adds a rectangular Coons patch at (x,y) with width w and height h. The corner colors are for the bottom-left, top-left, top-right, and bottom-right corners respectively.
+func (g *MeshGradient) AddRect(x, y, w, h float64, colors [4]color.RGBA) {
+	var points [12]Point
+	corners := [4]Point{{x, y}, {x, y + h}, {x + w, y + h}, {x + w, y}}
+	for i := 0; i < 4; i++ {
+		p0, p1 := corners[i], corners[(i+1)%4]
+		points[3*i] = p0
+		points[3*i+1] = p0.Interpolate(p1, 1.0/3.0)
+		points[3*i+2] = p0.Interpolate(p1, 2.0/3.0)
+	}
+	g.Add(points, colors)
+}
+
+// SetView sets the view. Automatically called by Canvas for coordinate system transformations.
+func (g *MeshGradient) SetView(view Matrix) Gradient {
+	if view == Identity {
+		return g
+	}
+
+	gradient := &MeshGradient{make([]CoonsPatch, len(g.Patches))}
+	for i, patch := range g.Patches {
+		for j := range patch.Points {
+			patch.Points[j] = view.Dot(patch.Points[j])
+		}
+		gradient.Patches[i] = patch
+	}
+	return gradient
+}
+
+// SetColorSpace sets the color space. Automatically called by the rasterizer.
+func (g *MeshGradient) SetColorSpace(colorSpace ColorSpace) Gradient {
+	if _, ok := colorSpace.(LinearColorSpace); ok {
+		return g
+	}
+
+	gradient := &MeshGradient{make([]CoonsPatch, len(g.Patches))}
+	for i, patch := range g.Patches {
+		for j := range patch.Colors {
+			patch.Colors[j] = colorSpace.ToLinear(patch.Colors[j])
+		}
+		gradient.Patches[i] = patch
+	}
+	return gradient
+}
+
+func (g *MeshGradient) color(x, y float64) ([4]float64, bool) {
+	for i := len(g.Patches) - 1; 0 <= i; i-- {
+		if u, v, ok := g.Patches[i].param(x, y); ok {
+			return g.Patches[i].at(u, v), true
+		}
+	}
+	return [4]float64{}, false
+}
+
+// At returns the color at position (x,y).
+func (g *MeshGradient) At(x, y float64) color.RGBA {
+	if c, ok := g.color(x, y); ok {
+		return color.RGBA{uint8(c[0]*255.0 + 0.5), uint8(c[1]*255.0 + 0.5), uint8(c[2]*255.0 + 0.5), uint8(c[3]*255.0 + 0.5)}
 	}
 	return Transparent
 }
 
+// At64 returns the color at position (x,y) with 16-bit precision.
+func (g *MeshGradient) At64(x, y float64) color.RGBA64 {
+	if c, ok := g.color(x, y); ok {
+		return color.RGBA64{uint16(c[0]*65535.0 + 0.5), uint16(c[1]*65535.0 + 0.5), uint16(c[2]*65535.0 + 0.5), uint16(c[3]*65535.0 + 0.5)}
+	}
+	return color.RGBA64{}
+}
+
 // ImagePattern is an image tiling pattern of an image drawn from an origin with a certain resolution. Higher resolution will give smaller tilings.
 //type ImagePattern struct {
 //	img    *image.RGBA
@@ -337,7 +601,7 @@ type ColorSpace interface {
 	FromLinear(color.Color) color.RGBA
 }
 
-// DefaultColorSpace is set to LinearColorSpace to match other renderers.
+// DefaultColorSpace is set to LinearColorSpace to match other renderers. Set it to SRGBColorSpace to enable gamma-correct blending in linear light for all rasterizers that don't specify a color space.
 var DefaultColorSpace ColorSpace = LinearColorSpace{}
 
 // LinearColorSpace is the default color space that does not do color space conversion for blending purposes. This is only correct if the input colors and output images are assumed to be in the linear color space so that blending is in linear space as well. In general though, we assume that input colors and output images are using the sRGB color space almost ubiquitously, resulting in blending in sRGB space which is wrong! Even though it is technically incorrect, many PDF viewers and browsers do this anyway.
@@ -7,7 +7,11 @@ import (
 	"math"
 	"os/exec"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/adrg/sysfont"
 	"github.com/tdewolff/canvas/font"
@@ -64,6 +68,18 @@ func (style FontStyle) CSS() int {
 	return 400
 }
 
+// FontWeight returns the font style weight nearest to the given CSS font-weight, such as the weight class of a font, see SFNT.WeightClass. Weights of 350 and 450 map to FontBook and FontRegular respectively.
+func FontWeight(weight int) FontStyle {
+	weights := []FontStyle{FontExtraLight, FontLight, FontBook, FontRegular, FontMedium, FontSemibold, FontBold, FontBlack, FontExtraBlack}
+	i := (weight - 50) / 100
+	if i < 0 {
+		i = 0
+	} else if len(weights) <= i {
+		i = len(weights) - 1
+	}
+	return weights[i]
+}
+
 // FontVariant defines the font variant to be used for the font, such as subscript or smallcaps.
 type FontVariant int
 
@@ -138,14 +154,18 @@ func FindLocalFont(name string, style FontStyle) string {
 	return font.Filename
 }
 
-// Font defines an SFNT font such as TTF or OTF.
+// Font defines an SFNT font such as TTF or OTF. A font is safe for concurrent use by multiple goroutines, changing its features or variations only affects text that is shaped afterwards.
 type Font struct {
 	*font.SFNT
-	name       string
-	style      FontStyle
-	shaper     text.Shaper
+	name   string
+	style  FontStyle
+	shaper text.Shaper
+
+	mu         sync.RWMutex // guards variations and features
 	variations string
 	features   string
+
+	shapingFeatures []string // default features implemented by the font
 }
 
 // LoadLocalFont loads a font from the system's fonts.
@@ -171,7 +191,10 @@ func LoadFontCollection(filename string, index int, style FontStyle) (*Font, err
 	return LoadFont(b, index, style)
 }
 
-var nonameFonts = 0
+var nonameFonts = struct {
+	n int
+	m sync.Mutex
+}{}
 
 // LoadFont loads a font from memory.
 func LoadFont(b []byte, index int, style FontStyle) (*Font, error) {
@@ -194,21 +217,40 @@ NameLoop:
 		}
 	}
 	if name == "" {
-		name = fmt.Sprintf("f%d", nonameFonts)
-		nonameFonts++
+		nonameFonts.m.Lock()
+		name = fmt.Sprintf("f%d", nonameFonts.n)
+		nonameFonts.n++
+		nonameFonts.m.Unlock()
 	}
 
 	font := &Font{
-		SFNT:   SFNT,
-		name:   name,
-		style:  style,
-		shaper: shaper,
+		SFNT:            SFNT,
+		name:            name,
+		style:           style,
+		shaper:          shaper,
+		shapingFeatures: shapingFeatures(SFNT),
 	}
 	return font, nil
 }
 
+// NewFontFromMetrics returns a font without glyph outlines from a metrics table, such as web font metrics that were obtained separately. It can be used to lay out and measure text, but characters are mapped to their advances without shaping or kerning and converting glyphs to paths returns an error.
+func NewFontFromMetrics(name string, metrics font.MetricsTable, style FontStyle) (*Font, error) {
+	SFNT, err := font.NewSFNTFromMetrics(metrics)
+	if err != nil {
+		return nil, err
+	}
+	return &Font{
+		SFNT:  SFNT,
+		name:  name,
+		style: style,
+	}, nil
+}
+
 // Destroy should be called when using HarfBuzz to free the C resources.
 func (f *Font) Destroy() {
+	if !f.HasOutlines() {
+		return
+	}
 	f.shaper.Destroy()
 }
 
@@ -225,13 +267,87 @@ func (f *Font) Style() FontStyle {
 // SetVariations sets the font variations (not yet supported).
 func (f *Font) SetVariations(variations string) {
 	// TODO: support font variations
+	f.mu.Lock()
 	f.variations = variations
+	f.mu.Unlock()
 }
 
-// SetFeatures sets the font features (not yet supported).
+// SetFeatures sets the font features, separated by commas in HarfBuzz syntax such as "dlig,-kern". Use FontFace.Features to set features for a span of text only.
 func (f *Font) SetFeatures(features string) {
-	// TODO: support font features
+	f.mu.Lock()
 	f.features = features
+	f.mu.Unlock()
+}
+
+// resolveFeatures returns the features passed to the shaper, which are the font's features followed by the face's features, adjusted to the writing direction and without those that disable a feature required by the script. If the script is not given it is detected from the text as the shaper would.
+func (f *Font) resolveFeatures(s string, direction text.Direction, script text.Script, faceFeatures string) string {
+	f.mu.RLock()
+	features := f.features
+	f.mu.RUnlock()
+	if features == "" {
+		features = faceFeatures
+	} else if faceFeatures != "" {
+		features += "," + faceFeatures
+	}
+	features = writingModeFeatures(features, direction)
+	if script == text.ScriptInvalid || script == text.ScriptCommon || script == text.ScriptInherited || script == text.ScriptUnknown {
+		for _, r := range s {
+			if rscript := text.LookupScript(r); rscript != text.ScriptCommon && rscript != text.ScriptInherited && rscript != text.ScriptUnknown {
+				script = rscript
+				break
+			}
+		}
+	}
+	return requiredFeatures(features, script)
+}
+
+// shape shapes the text using a snapshot of the font's features and variations, the face's features are applied after the font's features.
+func (f *Font) shape(s string, ppem uint16, direction text.Direction, script text.Script, lang, faceFeatures string) ([]text.Glyph, text.Direction) {
+	features := f.resolveFeatures(s, direction, script, faceFeatures)
+	f.mu.RLock()
+	variations := f.variations
+	f.mu.RUnlock()
+	var glyphs []text.Glyph
+	if f.HasOutlines() {
+		glyphs, direction = f.shaper.Shape(s, ppem, direction, script, lang, features, variations)
+	} else {
+		glyphs, direction = f.shapeMetrics(s, direction)
+	}
+
+	// zero-width and other default ignorable characters that were not consumed by the font, such as a variation selector without a variant, should not advance nor render, even if the font maps them to a visible glyph or to .notdef
+	for i := range glyphs {
+		if text.IsDefaultIgnorable(glyphs[i].Text) {
+			glyphs[i].ID = 0
+			glyphs[i].Empty = true
+			glyphs[i].XAdvance = 0
+			glyphs[i].YAdvance = 0
+			glyphs[i].XOffset = 0
+			glyphs[i].YOffset = 0
+		}
+	}
+	return glyphs, direction
+}
+
+// shapeMetrics maps each character to a glyph and its advance for fonts without shaping tables.
+func (f *Font) shapeMetrics(s string, direction text.Direction) ([]text.Glyph, text.Direction) {
+	glyphs := make([]text.Glyph, 0, len(s))
+	for i, r := range s {
+		glyphID := f.GlyphIndex(r)
+		glyphs = append(glyphs, text.Glyph{
+			ID:       glyphID,
+			Cluster:  uint32(i),
+			XAdvance: int32(f.GlyphAdvance(glyphID)),
+			Text:     r,
+		})
+	}
+	if direction == text.DirectionInvalid {
+		direction = text.LeftToRight
+	} else if direction == text.RightToLeft {
+		for i, j := 0, len(glyphs)-1; i < j; i, j = i+1, j-1 {
+			glyphs[i], glyphs[j] = glyphs[j], glyphs[i]
+		}
+	}
+	return glyphs, direction
 }
 
 // Face gets the font face given by the font size in points and its style. Fill can be any of Paint, color.Color, or canvas.Pattern.
@@ -257,6 +373,11 @@ func (f *Font) Face(size float64, ifill interface{}, deco ...FontDecorator) *Fon
 	return face
 }
 
+// FaceWithUnit returns a new FontFace like Face but with the font size given in the specified unit instead of in points.
+func (f *Font) FaceWithUnit(size float64, unit Unit, ifill interface{}, deco ...FontDecorator) *FontFace {
+	return f.Face(unit.Convert(size, UnitPoint), ifill, deco...)
+}
+
 ////////////////////////////////////////////////////////////////
 
 // FontFamily contains a family of fonts (bold, italic, ...). Allowing to select an italic style as the native italic font or to use faux italic if not present.
@@ -265,6 +386,51 @@ type FontFamily struct {
 	fonts map[FontStyle]*Font
 }
 
+// NearestStyle returns the loaded font style that best matches the given style, following the font matching algorithm of CSS. The italic style is matched first, after which for weights below 400 lighter weights are preferred, for weights above 500 heavier weights are preferred, and for 400 and 500 the other weight of the two is tried first. It returns false if the family has no fonts.
+func (family *FontFamily) NearestStyle(style FontStyle) (FontStyle, bool) {
+	italics := []FontStyle{style & FontItalic, style&FontItalic ^ FontItalic}
+	for _, italic := range italics {
+		best, bestWeight, found := FontRegular, 0, false
+		desired := style.CSS()
+		for candidate := range family.fonts {
+			if candidate&FontItalic != italic {
+				continue
+			}
+			weight := candidate.CSS()
+			if !found || fontWeightPreferred(desired, weight, bestWeight) {
+				best, bestWeight, found = candidate, weight, true
+			}
+		}
+		if found {
+			return best, true
+		}
+	}
+	return style, false
+}
+
+// fontWeightPreferred returns true if weight a is a better match than weight b for the desired weight.
+func fontWeightPreferred(desired, a, b int) bool {
+	rank := func(weight int) (int, int) {
+		if weight == desired {
+			return 0, 0
+		} else if desired == 400 && weight == 500 || desired == 500 && weight == 400 {
+			return 1, 0
+		}
+		if weight < desired {
+			if desired <= 500 {
+				return 2, desired - weight
+			}
+			return 3, desired - weight
+		} else if 500 < desired {
+			return 2, weight - desired
+		}
+		return 3, weight - desired
+	}
+	ra, da := rank(a)
+	rb, db := rank(b)
+	return ra < rb || ra == rb && da < db
+}
+
 // NewFontFamily returns a new font family.
 func NewFontFamily(name string) *FontFamily {
 	return &FontFamily{
@@ -292,7 +458,7 @@ func (family *FontFamily) SetVariations(variations string) {
 	}
 }
 
-// SetFeatures sets the font features (not yet supported).
+// SetFeatures sets the font features, see Font.SetFeatures.
 func (family *FontFamily) SetFeatures(features string) {
 	for _, font := range family.fonts {
 		font.SetFeatures(features)
@@ -354,6 +520,16 @@ func (family *FontFamily) LoadFont(b []byte, index int, style FontStyle) error {
 	return nil
 }
 
+// LoadFontFromMetrics loads a font without glyph outlines from a metrics table, see NewFontFromMetrics.
+func (family *FontFamily) LoadFontFromMetrics(metrics font.MetricsTable, style FontStyle) error {
+	font, err := NewFontFromMetrics(family.name, metrics, style)
+	if err != nil {
+		return err
+	}
+	family.fonts[style] = font
+	return nil
+}
+
 // MustLoadFont loads a font from memory. It panics on error.
 func (family *FontFamily) MustLoadFont(b []byte, index int, style FontStyle) {
 	if err := family.LoadFont(b, index, style); err != nil {
@@ -361,7 +537,7 @@ func (family *FontFamily) MustLoadFont(b []byte, index int, style FontStyle) {
 	}
 }
 
-// Face gets the font face given by the font size in points. Other arguments that can be passed: Paint/Pattern/color.Color (=Black), FontStyle (=FontRegular), FontVariant (=FontNormal), multiple FontDecorator, and Hinting (=VerticalHinting).
+// Face gets the font face given by the font size in points. Other arguments that can be passed: Paint/Pattern/color.Color (=Black), FontStyle (=FontRegular), FontVariant (=FontNormal), multiple FontDecorator, and Hinting (=VerticalHinting, or BytecodeHinting to grid-fit TrueType outlines when rendering to a raster).
 func (family *FontFamily) Face(size float64, args ...interface{}) *FontFace {
 	face := &FontFace{
 		Fill:    Paint{Color: Black},
@@ -472,6 +648,11 @@ func (family *FontFamily) Face(size float64, args ...interface{}) *FontFace {
 	return face
 }
 
+// FaceWithUnit returns a new FontFace like Face but with the font size given in the specified unit instead of in points.
+func (family *FontFamily) FaceWithUnit(size float64, unit Unit, args ...interface{}) *FontFace {
+	return family.Face(unit.Convert(size, UnitPoint), args...)
+}
+
 ////////////////////////////////////////////////////////////////
 
 // FontFace defines a font face from a given font. It specifies the font size, color, faux styles and font decorations.
@@ -486,20 +667,68 @@ type FontFace struct {
 	Deco    []FontDecorator
 	Hinting font.Hinting
 
+	// stroke of the glyph outlines with round joins, set Fill to Transparent for hollow text
+	Stroke      Paint
+	StrokeWidth float64 // in mm
+
 	// faux styles for bold, italic, and sub- and superscript
 	FauxBold, FauxItalic float64
 	XOffset, YOffset     int32
 
+	// Embolden dilates the glyph outlines by the given amount in em on each side, like FauxBold, but also widens the advances by twice the amount so that glyphs do not run into each other. This allows semi-bold effects from a regular font, such as 0.01 or 0.02.
+	Embolden float64
+
+	// BaselineShift shifts the baseline of the text vertically in millimeters, positive is upwards, such as for chemical or mathematical notation. Unlike YOffset it is taken into account for the line height. Use SetBaselineShiftEm to set the shift relative to the font size.
+	BaselineShift float64
+
 	Language  string
 	Script    text.Script
 	Direction text.Direction // TODO: really needed here?
 
-	// letter spacing
-	// stroke and stroke color
-	// line height
+	// Features are OpenType features applied on top of the font's features, separated by commas in HarfBuzz syntax, such as "dlig" to enable discretionary ligatures or "-calt" to disable contextual alternates.
+	Features string
+
+	// ProportionalCJK enables the palt feature for horizontal and the vpal feature for vertical text, which replace the full-width advances of CJK punctuation and kana by proportional ones for tighter typesetting
+	ProportionalCJK bool
+
+	// FastASCII maps text of only ASCII characters directly to glyphs and advances using the font's cmap and hmtx tables without shaping, which is faster for large amounts of plain text such as logs or source code. Text is still shaped if the font substitutes or positions glyphs by default, such as for kerning or ligatures, unless those features are disabled by the font's or face's features, such as "-kern,-liga"
+	FastASCII bool
+
+	// rendering of glyphs missing from the font
+	MissingGlyph MissingGlyph
+	FallbackPath *Path // used for FallbackGlyph, in millimeters relative to the glyph origin
+
+	// EmojiFace is used by RichText for character sequences with emoji presentation, such as a face of a color emoji font, see text.EmojiSequence. Color glyph tables are not supported, so the glyph outlines of the emoji font are rendered
+	EmojiFace *FontFace
+
+	// ControlChars specifies the handling of control and format characters such as the bell character, see text.IsControl
+	ControlChars ControlChars
+
+	// DottedCircle inserts U+25CC DOTTED CIRCLE before combining marks without a base character, such as at the start of the text or after a line break, so that they are displayed on a placeholder as recommended by Unicode instead of floating
+	DottedCircle bool
+
+	// NormalizeWinding orients the glyph contours of GlyphsToPath so that outer contours are counter clockwise and holes are clockwise, regardless of the font format's convention
+	NormalizeWinding bool
+
+	// StemDarkening emboldens the glyph outlines at small sizes when rendering to a raster, so that thin stems keep enough coverage to stay legible, see StemDarkeningPPEM
+	StemDarkening bool
+
+	// SubpixelGrid snaps the horizontal glyph positions to multiples of the given fraction of a pixel when rendering to a raster, such as 1.0/3.0 for subpixel (LCD) rendering or 1.0 for whole pixels, zero keeps the exact positions
+	SubpixelGrid float64
+
+	// LetterSpacing is the extra space in millimeters added between the glyphs of each line, such as to increase the tracking of all-caps headings. It is not added after the last glyph of a line nor to glyphs without an advance such as combining marks
+	LetterSpacing float64
+
+	// WordSpacing is the extra space in millimeters added to the word separators, such as to widen the gaps between the words of justified text
+	WordSpacing float64
+
+	// TightLineHeight computes the ascent and descent of lines from the bounds of the glyph outlines instead of the font's metrics and without line gap, so that lines fit their content tightly. Spans without visible glyphs, such as spaces or empty lines, use the font's metrics
+	TightLineHeight bool
+
 	// shadow
 
-	mmPerEm float64 // millimeters per EM unit!
+	mmPerEm        float64 // millimeters per EM unit!
+	overrideScript bool    // Script overrides the detected script, see RichText.AddWithLang
 }
 
 // Equals returns true when two font face are equal.
@@ -507,6 +736,16 @@ func (face *FontFace) Equals(other *FontFace) bool {
 	return reflect.DeepEqual(face, other)
 }
 
+// HasStroke returns true if the glyph outlines are stroked.
+func (face *FontFace) HasStroke() bool {
+	return face.Stroke.Has() && 0.0 < face.StrokeWidth
+}
+
+// SetBaselineShiftEm sets the baseline shift relative to the font size, i.e. in em units. Positive is upwards.
+func (face *FontFace) SetBaselineShiftEm(em float64) {
+	face.BaselineShift = em * face.Size
+}
+
 // Name returns the name of the underlying font.
 func (face *FontFace) Name() string {
 	return face.Font.name
@@ -557,6 +796,28 @@ func (face *FontFace) PPEM(resolution Resolution) uint16 {
 	return uint16(resolution.DPMM() * face.mmPerEm * float64(face.Font.Head.UnitsPerEm))
 }
 
+// StemDarkeningPPEM is the size in pixels-per-EM below which stem darkening is applied. The darkening is at its maximum for sizes up to half this value and decreases linearly to zero from there.
+var StemDarkeningPPEM = 24.0
+
+// StemDarkeningAmount is the maximum amount in pixels by which stems are widened by stem darkening.
+var StemDarkeningAmount = 0.5
+
+// stemDarkening returns the distance in millimeters by which the glyph outlines are offset for stem darkening at the given resolution.
+func (face *FontFace) stemDarkening(resolution Resolution) float64 {
+	if !face.StemDarkening || resolution == 0.0 {
+		return 0.0
+	}
+	ppem := resolution.DPMM() * face.mmPerEm * float64(face.Font.Head.UnitsPerEm)
+	if StemDarkeningPPEM <= ppem {
+		return 0.0
+	}
+	amount := StemDarkeningAmount
+	if half := StemDarkeningPPEM / 2.0; half < ppem {
+		amount *= (StemDarkeningPPEM - ppem) / half
+	}
+	return amount / 2.0 / resolution.DPMM() // half on either side of the stem
+}
+
 // LineHeight returns the height (ascent+descent) of a line.
 func (face *FontFace) LineHeight() float64 {
 	metrics := face.Metrics()
@@ -566,10 +827,111 @@ func (face *FontFace) LineHeight() float64 {
 // TextWidth returns the width of a given string in millimeters.
 func (face *FontFace) TextWidth(s string) float64 {
 	ppem := face.PPEM(DefaultResolution)
-	glyphs, _ := face.Font.shaper.Shape(s, ppem, face.Direction, face.Script, face.Language, face.Font.features, face.Font.variations)
+	glyphs, _ := face.shape(s, ppem, face.Direction, face.Script)
 	return face.textWidth(glyphs)
 }
 
+// WrapText breaks the string into lines that fit the given width in millimeters using the same line breaker as NewTextBox, and returns the logical text of each line. Trailing whitespace and line breaks are removed from each line, and a line that breaks at a soft hyphen ends in a hyphen.
+func (face *FontFace) WrapText(s string, width float64) []string {
+	t := NewTextBox(face, s, width, 0.0, Left, Top, 0.0, 0.0)
+	starts := make([]int, len(t.lines))
+	for j, line := range t.lines {
+		starts[j] = -1
+		for _, span := range line.spans {
+			for _, glyph := range span.Glyphs {
+				if starts[j] == -1 || int(glyph.Cluster) < starts[j] {
+					starts[j] = int(glyph.Cluster)
+				}
+			}
+		}
+	}
+
+	lines := make([]string, len(t.lines))
+	end := len(t.text)
+	for j := len(t.lines) - 1; 0 <= j; j-- {
+		if starts[j] == -1 {
+			continue // empty line
+		}
+		line := strings.TrimRightFunc(t.text[starts[j]:end], unicode.IsSpace)
+		if strings.HasSuffix(line, "\u00AD") {
+			line = strings.TrimSuffix(line, "\u00AD") + "-"
+		}
+		lines[j] = line
+		end = starts[j]
+	}
+	return lines
+}
+
+// TextMetrics contains the dimensions of a single line of text in millimeters, similar to the TextMetrics object of the HTML Canvas API. The bounding box distances are measured from the origin of the text on the baseline, and are positive towards the left, right, top, and bottom respectively.
+type TextMetrics struct {
+	Width                                             float64 // advance width
+	ActualBoundingBoxLeft, ActualBoundingBoxRight     float64 // ink bounds
+	ActualBoundingBoxAscent, ActualBoundingBoxDescent float64
+	FontBoundingBoxAscent, FontBoundingBoxDescent     float64 // ascent and descent of the font
+}
+
+// MeasureText shapes a single line of text and returns its advance width, ink bounds, and font ascent and descent, similar to measureText of the HTML Canvas API. The ink bounds include the faux styles and stroke of the face. For fonts without glyph outlines the ink bounds are those of the advance width and the font's ascent and descent.
+func (face *FontFace) MeasureText(s string) TextMetrics {
+	ppem := face.PPEM(DefaultResolution)
+	glyphs, _ := face.shape(s, ppem, face.Direction, face.Script)
+	fontMetrics := face.Metrics()
+	metrics := TextMetrics{
+		Width:                    face.textWidth(glyphs),
+		ActualBoundingBoxRight:   face.textWidth(glyphs),
+		ActualBoundingBoxAscent:  fontMetrics.Ascent,
+		ActualBoundingBoxDescent: fontMetrics.Descent,
+		FontBoundingBoxAscent:    fontMetrics.Ascent,
+		FontBoundingBoxDescent:   fontMetrics.Descent,
+	}
+
+	p, _, err := face.toPath(glyphs, ppem, font.NoHinting)
+	if err != nil || p.Empty() {
+		if err == nil {
+			metrics.ActualBoundingBoxRight = 0.0
+			metrics.ActualBoundingBoxAscent = 0.0
+			metrics.ActualBoundingBoxDescent = 0.0
+		}
+		return metrics
+	}
+
+	bounds := p.Bounds()
+	if face.HasStroke() {
+		d := face.StrokeWidth / 2.0
+		bounds = Rect{bounds.X - d, bounds.Y - d, bounds.W + 2.0*d, bounds.H + 2.0*d}
+	}
+	metrics.ActualBoundingBoxLeft = -bounds.X
+	metrics.ActualBoundingBoxRight = bounds.X + bounds.W
+	metrics.ActualBoundingBoxAscent = bounds.Y + bounds.H
+	metrics.ActualBoundingBoxDescent = -bounds.Y
+	return metrics
+}
+
+// DecimalOffsets returns the horizontal offsets in millimeters for a column of numbers so that their decimal separators align, such as '.' or ','. Numbers without a decimal separator align on the position after their last digit. Numbers are measured as they are drawn by the face, so that digits only line up as well when the font has digits of equal width or when the face enables tabular figures with the "tnum" feature. The smallest offset is zero.
+func (face *FontFace) DecimalOffsets(numbers []string, decimal rune) []float64 {
+	ppem := face.PPEM(DefaultResolution)
+	offsets := make([]float64, len(numbers))
+	maxWidth := 0.0
+	for i, number := range numbers {
+		n := strings.IndexRune(number, decimal)
+		if n == -1 {
+			n = strings.LastIndexAny(number, "0123456789")
+			if n == -1 {
+				n = len(number)
+			} else {
+				n++
+			}
+		}
+
+		glyphs, _ := face.shape(number[:n], ppem, face.Direction, face.Script)
+		offsets[i] = face.textWidth(glyphs)
+		maxWidth = math.Max(maxWidth, offsets[i])
+	}
+	for i := range offsets {
+		offsets[i] = maxWidth - offsets[i]
+	}
+	return offsets
+}
+
 func (face *FontFace) textWidth(glyphs []text.Glyph) float64 {
 	w := int32(0)
 	for _, glyph := range glyphs {
@@ -610,25 +972,85 @@ func (face *FontFace) Decorate(width float64) *Path {
 // ToPath converts a string to its glyph paths.
 func (face *FontFace) ToPath(s string) (*Path, float64, error) {
 	ppem := face.PPEM(DefaultResolution)
-	glyphs, _ := face.Font.shaper.Shape(s, ppem, face.Direction, face.Script, face.Language, face.Font.features, face.Font.variations)
-	return face.toPath(glyphs, ppem)
+	glyphs, _ := face.shape(s, ppem, face.Direction, face.Script)
+	return face.toPath(glyphs, ppem, font.NoHinting)
+}
+
+// GlyphsToPath converts shaped glyphs to their glyph paths, which are positioned by their advances starting at the origin. The ppem (pixels-per-EM) is used for hinting only when Hinting is BytecodeHinting and may be zero. It returns for each glyph the index of its first subpath in the path, a glyph's subpaths continue up to the first subpath of the next glyph. Contours are normalized when NormalizeWinding is set.
+func (face *FontFace) GlyphsToPath(glyphs []text.Glyph, ppem uint16) (*Path, []int, error) {
+	hinting := font.NoHinting
+	if face.Hinting == font.BytecodeHinting {
+		hinting = font.BytecodeHinting
+	}
+
+	p := &Path{}
+	indices := make([]int, len(glyphs))
+	n := 0
+	x, y := int32(0), int32(0)
+	for i, glyph := range glyphs {
+		q, _, err := face.toPath([]text.Glyph{glyph}, ppem, hinting)
+		if err != nil {
+			return nil, nil, err
+		}
+		if face.NormalizeWinding {
+			q = normalizeWinding(q)
+		}
+
+		indices[i] = n
+		if !q.Empty() {
+			n += len(q.Split())
+		}
+		dx, dy := face.mmPerEm*float64(x), face.mmPerEm*float64(y)
+		p = p.Append(q.Translate(dx+face.FauxItalic*dy, dy)) // faux italic shears the vertical advance as well
+		x += glyph.XAdvance
+		y += glyph.YAdvance
+	}
+	return p, indices, nil
+}
+
+// normalizeWinding orients the subpaths so that filled subpaths are counter clockwise and holes are clockwise, assuming the subpaths do not intersect.
+func normalizeWinding(p *Path) *Path {
+	if p.Empty() {
+		return p
+	}
+	filling := p.Filling(NonZero)
+	q := &Path{}
+	for i, pi := range p.Split() {
+		if pi.CCW() != filling[i] {
+			pi = pi.Reverse()
+		}
+		q = q.Append(pi)
+	}
+	return q
+}
+
+func (face *FontFace) toPath(glyphs []text.Glyph, ppem uint16, hinting font.Hinting) (*Path, float64, error) {
+	return face.toSnappedPath(glyphs, ppem, hinting, 0.0, 0.0)
 }
 
-func (face *FontFace) toPath(glyphs []text.Glyph, ppem uint16) (*Path, float64, error) {
+// toSnappedPath is like toPath but rounds the horizontal glyph positions to multiples of grid (in millimeters), where x0 is the position of the origin relative to the grid. A zero grid keeps the exact positions.
+func (face *FontFace) toSnappedPath(glyphs []text.Glyph, ppem uint16, hinting font.Hinting, x0, grid float64) (*Path, float64, error) {
 	p := &Path{}
 	f := face.mmPerEm
 	x, y := face.XOffset, face.YOffset
 	for _, glyph := range glyphs {
-		err := face.Font.GlyphPath(p, glyph.ID, ppem, f*float64(x+glyph.XOffset), f*float64(y+glyph.YOffset), f, font.NoHinting)
-		if err != nil {
+		gx, gy := f*float64(x+glyph.XOffset), f*float64(y+glyph.YOffset)
+		if grid != 0.0 {
+			gx = math.Round((x0+gx)/grid)*grid - x0
+		}
+		if glyph.Empty {
+			// no outline
+		} else if glyph.ID == 0 && (face.MissingGlyph != NotdefGlyph || face.isHexControl(glyph)) {
+			p = p.Append(face.missingGlyphPath(glyph, gx, gy))
+		} else if err := face.Font.GlyphPath(p, glyph.ID, ppem, gx, gy, f, hinting); err != nil {
 			return p, 0.0, err
 		}
 		x += glyph.XAdvance
 		y += glyph.YAdvance
 	}
 
-	if face.FauxBold != 0.0 {
-		p = p.Offset(face.FauxBold*face.Size, NonZero, Tolerance)
+	if bold := face.FauxBold + face.Embolden; bold != 0.0 {
+		p = p.Offset(bold*face.Size, NonZero, Tolerance)
 	}
 	if face.FauxItalic != 0.0 {
 		p = p.Transform(Identity.Shear(face.FauxItalic, 0.0))
@@ -636,6 +1058,487 @@ func (face *FontFace) toPath(glyphs []text.Glyph, ppem uint16) (*Path, float64,
 	return p, face.mmPerEm * float64(x), nil
 }
 
+// itemScript returns the script used for an itemized run of text, which is the face's script if it was set by RichText.AddWithLang.
+func (face *FontFace) itemScript(script text.Script) text.Script {
+	if face.overrideScript && face.Script != text.ScriptInvalid {
+		return face.Script
+	}
+	return script
+}
+
+// baseScript returns the horizontal baselines of the script from the font's BASE table, it returns false if the font has no BASE table.
+func (face *FontFace) baseScript(script text.Script) (*font.BaseScript, bool) {
+	if face.Font.SFNT.Base == nil {
+		return nil, false
+	}
+	for _, tag := range openTypeScriptTags(script) {
+		if baseScript, ok := face.Font.SFNT.Base.Get(tag, false); ok {
+			return baseScript, true
+		}
+	}
+	return face.Font.SFNT.Base.Get(font.DefaultScript, false)
+}
+
+// openTypeScriptTags returns the OpenType script tags for a script in order of preference, most are the lowercase ISO 15924 tag.
+func openTypeScriptTags(script text.Script) []font.ScriptTag {
+	iso := []byte{byte(script >> 24), byte(script >> 16), byte(script >> 8), byte(script)}
+	for i, c := range iso {
+		if 'A' <= c && c <= 'Z' {
+			iso[i] = c - 'A' + 'a'
+		}
+	}
+	tag := font.ScriptTag(iso)
+	switch tag {
+	case "zyyy", "zinh", "zzzz":
+		return nil
+	case "hira":
+		return []font.ScriptTag{"kana"}
+	case "deva", "beng", "guru", "gujr", "orya", "taml", "telu", "knda", "mlym", "mymr":
+		// Indic scripts have a second version
+		v2 := map[font.ScriptTag]font.ScriptTag{"deva": "dev2", "beng": "bng2", "guru": "gur2", "gujr": "gjr2", "orya": "ory2", "taml": "tml2", "telu": "tel2", "knda": "knd2", "mlym": "mlm2", "mymr": "mym2"}
+		return []font.ScriptTag{v2[tag], tag}
+	}
+	return []font.ScriptTag{tag}
+}
+
+// MissingGlyph specifies how glyphs that are missing from the font are rendered. This only applies when text is rendered as paths, such as by the rasterizer.
+type MissingGlyph int
+
+// see MissingGlyph
+const (
+	NotdefGlyph   MissingGlyph = iota // render the font's .notdef glyph
+	TofuGlyph                         // render a box with the hexadecimal codepoint
+	FallbackGlyph                     // render FontFace.FallbackPath
+)
+
+// ControlChars specifies how control and format characters are handled, see text.IsControl. They are removed or replaced before shaping so that they do not interrupt kerning and ligatures. Tabs, paragraph separators, and zero-width characters are handled by the layout and are not affected.
+type ControlChars int
+
+// see ControlChars
+const (
+	KeepControlChars    ControlChars = iota // render the glyph the font maps the character to
+	DropControlChars                        // remove the character, it has no advance and does not render
+	ReplaceControlChars                     // render the replacement character U+FFFD
+	HexControlChars                         // render a box with the hexadecimal codepoint, for debugging
+)
+
+// DefaultLanguage is the BCP 47 language tag used for shaping and smart typography of font faces that have no Language set, such as "tr" for Turkish. By default it is empty, which selects the default language system of the font without language-specific forms.
+var DefaultLanguage = ""
+
+// language returns the face's language, or DefaultLanguage if unset.
+func (face *FontFace) language() string {
+	if face.Language == "" {
+		return DefaultLanguage
+	}
+	return face.Language
+}
+
+// shape shapes the text with the font face's language and features, and handles control characters according to the face's ControlChars. The letter spacing is not added after the last glyph, see shapeRun.
+func (face *FontFace) shape(s string, ppem uint16, direction text.Direction, script text.Script) ([]text.Glyph, text.Direction) {
+	glyphs, direction := face.shapeRun(s, ppem, direction, script)
+	for i := len(glyphs) - 1; 0 <= i; i-- {
+		if face.trimLetterSpacing(&glyphs[i]) != 0.0 || glyphs[i].XAdvance != 0 || glyphs[i].YAdvance != 0 {
+			break
+		}
+	}
+	return glyphs, direction
+}
+
+// shapeRun is like shape but adds the letter spacing after every glyph, for runs that may be followed by other runs on the same line. The letter spacing at the end of a line is removed by trimLetterSpacing.
+func (face *FontFace) shapeRun(s string, ppem uint16, direction text.Direction, script text.Script) ([]text.Glyph, text.Direction) {
+	var clusters []uint32
+	if face.ControlChars == DropControlChars || face.ControlChars == ReplaceControlChars {
+		s, clusters = face.replaceControlChars(s)
+	}
+	if face.DottedCircle {
+		var dotted []uint32
+		if s, dotted = insertDottedCircles(s); dotted != nil && clusters != nil {
+			for i := range dotted {
+				dotted[i] = clusters[dotted[i]]
+			}
+		}
+		if dotted != nil {
+			clusters = dotted
+		}
+	}
+	var glyphs []text.Glyph
+	if face.skipShaping(s, direction, script) {
+		glyphs, direction = face.Font.shapeMetrics(s, direction)
+	} else {
+		glyphs, direction = face.Font.shape(s, ppem, direction, script, face.language(), face.features(direction))
+	}
+	if clusters != nil {
+		for i := range glyphs {
+			glyphs[i].Cluster = clusters[glyphs[i].Cluster]
+		}
+	}
+	if face.ControlChars != HexControlChars {
+		return face.space(face.embolden(glyphs, direction), direction), direction
+	}
+
+	// render the .notdef glyph, which is drawn as a box with the hexadecimal codepoint
+	vertical := direction == text.TopToBottom || direction == text.BottomToTop
+	for i := range glyphs {
+		if !text.IsControl(glyphs[i].Text) {
+			continue
+		}
+		glyphs[i].ID = 0
+		glyphs[i].Empty = false
+		glyphs[i].XAdvance, glyphs[i].YAdvance = 0, 0
+		glyphs[i].XOffset, glyphs[i].YOffset = 0, 0
+		if vertical {
+			glyphs[i].YAdvance = -int32(face.Font.SFNT.GlyphVerticalAdvance(0))
+		} else {
+			glyphs[i].XAdvance = int32(face.Font.GlyphAdvance(0))
+		}
+	}
+	return face.space(face.embolden(glyphs, direction), direction), direction
+}
+
+// replaceControlChars removes the control characters of the text for DropControlChars, or replaces them by U+FFFD for ReplaceControlChars. It returns the byte offset into the original text for each byte of the new text and for its end, or nil if the text has no control characters.
+func (face *FontFace) replaceControlChars(s string) (string, []uint32) {
+	n := 0
+	for _, r := range s {
+		if text.IsControl(r) {
+			n++
+		}
+	}
+	if n == 0 {
+		return s, nil
+	}
+
+	sb := strings.Builder{}
+	sb.Grow(len(s) + n*utf8.RuneLen('\uFFFD'))
+	clusters := make([]uint32, 0, len(s)+n*utf8.RuneLen('\uFFFD')+1)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !text.IsControl(r) {
+			sb.WriteString(s[i : i+size])
+			for j := 0; j < size; j++ {
+				clusters = append(clusters, uint32(i+j))
+			}
+		} else if face.ControlChars == ReplaceControlChars {
+			sb.WriteRune('\uFFFD')
+			for j := 0; j < utf8.RuneLen('\uFFFD'); j++ {
+				clusters = append(clusters, uint32(i))
+			}
+		}
+		i += size
+	}
+	clusters = append(clusters, uint32(len(s)))
+	return sb.String(), clusters
+}
+
+// space widens the advances of the glyphs by the face's letter spacing, and of the word separators by the face's word spacing. Glyphs without an advance, such as combining marks, are not widened. The glyphs are in visual order so that the spacing is between the glyphs for both left-to-right and right-to-left text.
+func (face *FontFace) space(glyphs []text.Glyph, direction text.Direction) []text.Glyph {
+	if face.LetterSpacing == 0.0 && face.WordSpacing == 0.0 {
+		return glyphs
+	}
+	letter := int32(math.Round(face.LetterSpacing / face.mmPerEm))
+	word := int32(math.Round(face.WordSpacing / face.mmPerEm))
+	vertical := direction == text.TopToBottom || direction == text.BottomToTop
+
+	for i := range glyphs {
+		d := letter
+		if glyphs[i].Text == ' ' || glyphs[i].Text == '\u00A0' {
+			d += word
+		}
+		if vertical && glyphs[i].YAdvance != 0 {
+			glyphs[i].YAdvance -= d
+		} else if !vertical && glyphs[i].XAdvance != 0 {
+			glyphs[i].XAdvance += d
+		}
+	}
+	return glyphs
+}
+
+// trimLetterSpacing removes the letter spacing that space added to the advance of the glyph, such as at the end of a line. It returns the removed width in millimeters, which is zero for glyphs without an advance.
+func (face *FontFace) trimLetterSpacing(glyph *text.Glyph) float64 {
+	letter := int32(math.Round(face.LetterSpacing / face.mmPerEm))
+	if letter == 0 {
+		return 0.0
+	} else if glyph.YAdvance != 0 {
+		glyph.YAdvance += letter
+	} else if glyph.XAdvance != 0 {
+		glyph.XAdvance -= letter
+	} else {
+		return 0.0
+	}
+	return float64(letter) * face.mmPerEm
+}
+
+// embolden widens the advances of the glyphs by twice the face's emboldening, and shifts the glyphs by the emboldening so that their dilated outlines keep their side bearings. Glyphs without an advance, such as combining marks, are only shifted.
+func (face *FontFace) embolden(glyphs []text.Glyph, direction text.Direction) []text.Glyph {
+	if face.Embolden == 0.0 {
+		return glyphs
+	}
+	d := int32(math.Round(face.Embolden * float64(face.Font.Head.UnitsPerEm)))
+	vertical := direction == text.TopToBottom || direction == text.BottomToTop
+	for i := range glyphs {
+		if vertical {
+			glyphs[i].YOffset -= d
+			if glyphs[i].YAdvance != 0 {
+				glyphs[i].YAdvance -= 2 * d
+			}
+		} else {
+			glyphs[i].XOffset += d
+			if glyphs[i].XAdvance != 0 {
+				glyphs[i].XAdvance += 2 * d
+			}
+		}
+	}
+	return glyphs
+}
+
+// defaultShapingFeatures are the features that are enabled by default when shaping horizontal text.
+var defaultShapingFeatures = []string{"abvm", "blwm", "calt", "ccmp", "clig", "curs", "dist", "kern", "liga", "locl", "mark", "mkmk", "rclt", "rlig"}
+
+// shapingFeatures returns the default features that the font implements in its GSUB or GPOS tables, and the kern feature if it has a kern table.
+func shapingFeatures(sfnt *font.SFNT) []string {
+	var gsub, gpos map[font.FeatureTag][]uint16
+	if sfnt.Gsub != nil {
+		gsub = sfnt.Gsub.Features()
+	}
+	if sfnt.Gpos != nil {
+		gpos = sfnt.Gpos.Features()
+	}
+
+	var features []string
+	for _, tag := range defaultShapingFeatures {
+		if _, ok := gsub[font.FeatureTag(tag)]; ok {
+			features = append(features, tag)
+		} else if _, ok := gpos[font.FeatureTag(tag)]; ok {
+			features = append(features, tag)
+		} else if tag == "kern" && sfnt.Kern != nil {
+			features = append(features, tag)
+		}
+	}
+	return features
+}
+
+// skipShaping returns true if the text can be mapped to glyphs without shaping, see FontFace.FastASCII. The features are resolved as for shaping, so that features required by the script cannot be disabled.
+func (face *FontFace) skipShaping(s string, direction text.Direction, script text.Script) bool {
+	if !face.FastASCII || !face.Font.HasOutlines() || direction != text.LeftToRight && direction != text.DirectionInvalid {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if 0x80 <= s[i] {
+			return false
+		}
+	}
+
+	features := face.Font.resolveFeatures(s, direction, script, face.features(direction))
+	disabled := map[string]bool{}
+	for _, feature := range strings.Split(features, ",") {
+		sign, tag, rest := splitFeature(feature)
+		if tag == "" {
+			continue
+		} else if sign != "-" && !strings.HasSuffix(rest, "=0") && !strings.HasSuffix(rest, "=off") && !strings.HasSuffix(rest, "=false") {
+			return false // feature is enabled explicitly
+		}
+		disabled[tag] = true
+	}
+	for _, tag := range face.Font.shapingFeatures {
+		if !disabled[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+// features returns the face's features for shaping in the given direction.
+func (face *FontFace) features(direction text.Direction) string {
+	if !face.ProportionalCJK {
+		return face.Features
+	}
+	feature := "palt"
+	if direction == text.TopToBottom || direction == text.BottomToTop {
+		feature = "vpal"
+	}
+	if face.Features == "" {
+		return feature
+	}
+	return feature + "," + face.Features // explicit features take precedence
+}
+
+// verticalFeatures maps features that apply only to horizontal text to their counterpart for vertical text.
+var verticalFeatures = map[string]string{
+	"halt": "vhal",
+	"hkna": "vkna",
+	"kern": "vkrn",
+	"palt": "vpal",
+}
+
+// writingModeFeatures returns the features for shaping in the given direction. Vertical text enables the vertical alternates features vert and vrt2 and replaces horizontal-only features by their vertical counterpart, while horizontal text drops vertical-only features, so that features apply only in the writing mode they were designed for.
+func writingModeFeatures(features string, direction text.Direction) string {
+	vertical := direction == text.TopToBottom || direction == text.BottomToTop
+	if !vertical && features == "" {
+		return ""
+	}
+
+	var adjusted []string
+	if vertical {
+		adjusted = append(adjusted, "vert", "vrt2")
+	}
+	for _, feature := range strings.Split(features, ",") {
+		sign, tag, rest := splitFeature(feature)
+		if vertical {
+			if verticalTag, ok := verticalFeatures[tag]; ok {
+				tag = verticalTag
+			}
+		} else if tag == "vert" || tag == "vrt2" || tag == "vrtr" || tag == "valt" || tag == "vhal" || tag == "vkna" || tag == "vkrn" || tag == "vpal" {
+			continue
+		}
+		if tag != "" {
+			adjusted = append(adjusted, sign+tag+rest)
+		}
+	}
+	return strings.Join(adjusted, ",")
+}
+
+// requiredFeatures returns the features without those that disable a feature required by the script, so that text is always shaped correctly even if the features disable all others.
+func requiredFeatures(features string, script text.Script) string {
+	if features == "" {
+		return ""
+	}
+
+	required := map[string]bool{}
+	for _, tag := range text.RequiredFeatures(script) {
+		required[tag] = true
+	}
+	var kept []string
+	for _, feature := range strings.Split(features, ",") {
+		sign, tag, rest := splitFeature(feature)
+		if required[tag] && (sign == "-" || strings.HasSuffix(rest, "=0") || strings.HasSuffix(rest, "=off") || strings.HasSuffix(rest, "=false")) {
+			continue
+		} else if tag != "" {
+			kept = append(kept, sign+tag+rest)
+		}
+	}
+	return strings.Join(kept, ",")
+}
+
+// splitFeature splits a feature in HarfBuzz syntax into its sign, tag, and the remaining range and value, such as "-", "liga", and "[3:5]" for -liga[3:5].
+func splitFeature(feature string) (string, string, string) {
+	feature = strings.TrimSpace(feature)
+	sign := ""
+	if strings.HasPrefix(feature, "+") || strings.HasPrefix(feature, "-") {
+		sign, feature = feature[:1], feature[1:]
+	}
+	if 4 < len(feature) {
+		return sign, feature[:4], feature[4:]
+	}
+	return sign, feature, ""
+}
+
+// insertDottedCircles inserts U+25CC DOTTED CIRCLE before combining marks that have no base character. It returns the new string and a mapping from its byte offsets to those of s, where the dotted circle maps to its combining mark. If nothing is inserted, the mapping is nil.
+func insertDottedCircles(s string) (string, []uint32) {
+	isOrphan := func(i int, r rune) bool {
+		if !unicode.Is(unicode.M, r) || text.IsDefaultIgnorable(r) {
+			return false
+		} else if i == 0 {
+			return true
+		}
+		prev, _ := utf8.DecodeLastRuneInString(s[:i])
+		return text.IsParagraphSeparator(prev) || text.IsControl(prev)
+	}
+
+	n := 0
+	for i, r := range s {
+		if isOrphan(i, r) {
+			n++
+		}
+	}
+	if n == 0 {
+		return s, nil
+	}
+
+	sb := strings.Builder{}
+	sb.Grow(len(s) + n*utf8.RuneLen('\u25CC'))
+	clusters := make([]uint32, 0, len(s)+n*utf8.RuneLen('\u25CC')+1)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if isOrphan(i, r) {
+			sb.WriteRune('\u25CC')
+			for j := 0; j < utf8.RuneLen('\u25CC'); j++ {
+				clusters = append(clusters, uint32(i))
+			}
+		}
+		sb.WriteString(s[i : i+size])
+		for j := 0; j < size; j++ {
+			clusters = append(clusters, uint32(i+j))
+		}
+		i += size
+	}
+	clusters = append(clusters, uint32(len(s)))
+	return sb.String(), clusters
+}
+
+// hexSegments are the seven-segment display encodings of the hexadecimal digits, bit 0 to 6 are the segments a to g.
+var hexSegments = [16]uint8{0x3F, 0x06, 0x5B, 0x4F, 0x66, 0x6D, 0x7D, 0x07, 0x7F, 0x6F, 0x77, 0x7C, 0x39, 0x5E, 0x79, 0x71}
+
+// segments a to g as line segments in a unit square
+var segmentLines = [7][4]float64{
+	{0.0, 1.0, 1.0, 1.0}, // a
+	{1.0, 1.0, 1.0, 0.5}, // b
+	{1.0, 0.5, 1.0, 0.0}, // c
+	{0.0, 0.0, 1.0, 0.0}, // d
+	{0.0, 0.0, 0.0, 0.5}, // e
+	{0.0, 0.5, 0.0, 1.0}, // f
+	{0.0, 0.5, 1.0, 0.5}, // g
+}
+
+func (face *FontFace) isHexControl(glyph text.Glyph) bool {
+	return face.ControlChars == HexControlChars && text.IsControl(glyph.Text)
+}
+
+func (face *FontFace) missingGlyphPath(glyph text.Glyph, x, y float64) *Path {
+	if face.MissingGlyph == FallbackGlyph && !face.isHexControl(glyph) {
+		if face.FallbackPath == nil {
+			return nil
+		}
+		return face.FallbackPath.Translate(x, y)
+	}
+
+	// tofu: a box with the codepoint in hexadecimal notation in two rows
+	w := face.mmPerEm * float64(glyph.XAdvance)
+	if glyph.Vertical || w <= 0.0 {
+		w = 0.6 * face.Size
+	}
+	h := face.Metrics().CapHeight
+	if h <= 0.0 {
+		h = 0.7 * face.Size
+	}
+	margin := 0.05 * face.Size
+	boxWidth := 0.04 * face.Size
+	w -= 2.0 * margin
+
+	box := Rectangle(w, h).Stroke(boxWidth, ButtCap, MiterJoin, Tolerance)
+
+	digits := fmt.Sprintf("%04X", glyph.Text)
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+	cols := len(digits) / 2
+	cellWidth, cellHeight := (w-2.0*boxWidth)/float64(cols), (h-2.0*boxWidth)/2.0
+	digitWidth, digitHeight := 0.6*cellWidth, 0.7*cellHeight
+	segments := &Path{}
+	for i, digit := range digits {
+		v, _ := strconv.ParseUint(string(digit), 16, 8)
+		dx := boxWidth + (float64(i%cols)+0.2)*cellWidth
+		dy := boxWidth + (float64(1-i/cols)+0.15)*cellHeight
+		for j, line := range segmentLines {
+			if hexSegments[v]&(1<<j) != 0 {
+				segments.MoveTo(dx+line[0]*digitWidth, dy+line[1]*digitHeight)
+				segments.LineTo(dx+line[2]*digitWidth, dy+line[3]*digitHeight)
+			}
+		}
+	}
+	segmentWidth := 0.15 * math.Min(digitWidth, digitHeight/2.0)
+	segments = segments.Stroke(segmentWidth, SquareCap, MiterJoin, Tolerance)
+	return box.Append(segments).Translate(x+margin, y)
+}
+
 ////////////////////////////////////////////////////////////////
 
 // FontDecorator is an interface that returns a path given a font face and a width in millimeters.
@@ -826,6 +1729,140 @@ func (dashedUnderline) String() string {
 	return "DashedUnderline"
 }
 
+// DecorationLine is the placement of the line of a FontDecoration.
+type DecorationLine int
+
+// see DecorationLine
+const (
+	UnderlineDecoration DecorationLine = iota
+	OverlineDecoration
+	LineThroughDecoration
+)
+
+// DecorationStyle is the style of the line of a FontDecoration, similar to CSS's text-decoration-style.
+type DecorationStyle int
+
+// see DecorationStyle
+const (
+	SolidDecoration DecorationStyle = iota
+	DoubleDecoration
+	DottedDecoration
+	DashedDecoration
+)
+
+// FontDecoration is a font decoration that draws a line under, over, or through the text in the given style, such as a dashed strikethrough. Dotted and dashed lines are dashed along the line and stroked, where the dash pattern is stretched so that the line starts and ends with a dash.
+type FontDecoration struct {
+	Line   DecorationLine
+	Style  DecorationStyle
+	Dashes []float64 // dash pattern for DashedDecoration in units of the line thickness, defaults to 3
+}
+
+func (deco FontDecoration) Decorate(face *FontFace, w float64) *Path {
+	// y is the center of the line
+	var r, y float64
+	switch deco.Line {
+	case UnderlineDecoration:
+		r = face.Size * underlineThickness
+		y = -face.Size * underlineDistance
+		if face.Font.Post.UnderlineThickness != 0 {
+			r = face.mmPerEm * float64(face.Font.Post.UnderlineThickness)
+		}
+		if face.Font.Post.UnderlinePosition != 0 {
+			y = face.mmPerEm * float64(face.Font.Post.UnderlinePosition)
+		}
+		y -= r
+	case OverlineDecoration:
+		r = face.Size * underlineThickness
+		y = face.Metrics().Ascent
+		if face.Font.Post.UnderlineThickness != 0 {
+			r = face.mmPerEm * float64(face.Font.Post.UnderlineThickness)
+		}
+		y -= 0.5 * r
+	case LineThroughDecoration:
+		r = face.Size * underlineThickness
+		y = face.Metrics().XHeight / 2.0
+		if face.Font.OS2.YStrikeoutSize != 0 {
+			r = face.mmPerEm * float64(face.Font.OS2.YStrikeoutSize)
+		}
+		if face.Font.OS2.YStrikeoutPosition != 0 {
+			y = face.mmPerEm * float64(face.Font.OS2.YStrikeoutPosition)
+		}
+		y += 0.5 * r
+	}
+
+	line := func(y float64) *Path {
+		dx := 0.0
+		if deco.Line != UnderlineDecoration {
+			dx = face.FauxItalic * y
+		}
+		p := &Path{}
+		p.MoveTo(dx, y)
+		p.LineTo(w+dx, y)
+		return p
+	}
+
+	p := line(y)
+	switch deco.Style {
+	case DoubleDecoration:
+		if deco.Line == UnderlineDecoration {
+			p = p.Append(line(y - 1.5*r))
+		} else if deco.Line == OverlineDecoration {
+			p = p.Append(line(y + 1.5*r))
+		} else {
+			p = line(y + 0.75*r).Append(line(y - 0.75*r))
+		}
+	case DottedDecoration:
+		// place round dots in the middle of dashes as long as the thickness
+		dots := &Path{}
+		for _, dash := range p.Dash(0.0, fitDashes(w, r, []float64{1.0, 1.0})...).Split() {
+			if pos := dash.Pos(); !dash.Empty() {
+				start := dash.StartPos()
+				dots = dots.Append(Circle(r/2.0).Translate((start.X+pos.X)/2.0, (start.Y+pos.Y)/2.0))
+			}
+		}
+		return dots
+	case DashedDecoration:
+		dashes := deco.Dashes
+		if len(dashes) == 0 {
+			dashes = []float64{3.0}
+		}
+		p = p.Dash(0.0, fitDashes(w, r, dashes)...)
+	}
+	return p.Stroke(r, ButtCap, BevelJoin, Tolerance)
+}
+
+func (deco FontDecoration) String() string {
+	styles := []string{"", "Double", "Dotted", "Dashed"}
+	lines := []string{"Underline", "Overline", "LineThrough"}
+	if deco.Style < 0 || len(styles) <= int(deco.Style) || deco.Line < 0 || len(lines) <= int(deco.Line) {
+		return "Invalid"
+	}
+	return styles[deco.Style] + lines[deco.Line]
+}
+
+// fitDashes returns the dash pattern in units of the thickness r, scaled so that a line of length w starts and ends with a full dash. It returns no dashes, a solid line, if not even two dashes fit.
+func fitDashes(w, r float64, dashes []float64) []float64 {
+	if len(dashes)%2 == 1 {
+		dashes = append(dashes, dashes...)
+	}
+	period := 0.0
+	for _, d := range dashes {
+		period += d * r
+	}
+	first := dashes[0] * r
+	n := math.Floor((w-first)/period + 0.5)
+	if n < 1.0 || period <= 0.0 {
+		return nil
+	}
+
+	scale := w / (n*period + first)
+	scaled := make([]float64, len(dashes))
+	for i, d := range dashes {
+		scaled[i] = d * r * scale
+	}
+	return scaled
+}
+
 // FontWavyUnderline is a font decoration that draws a wavy path under the text.
 var FontWavyUnderline FontDecorator = wavyUnderline{}
 
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/text/encoding"
@@ -25,13 +27,14 @@ type Pather interface {
 	Close()
 }
 
-// Hinting specifies the type of hinting to use (none supported yes).
+// Hinting specifies the type of hinting to use.
 type Hinting int
 
 // see Hinting
 const (
-	NoHinting Hinting = iota
-	VerticalHinting
+	NoHinting       Hinting = iota
+	VerticalHinting         // align the baseline to the pixel grid
+	BytecodeHinting         // execute the TrueType instructions of the font to grid-fit glyphs, falls back to VerticalHinting for CFF fonts
 )
 
 // SFNT is a parsed OpenType font.
@@ -67,10 +70,28 @@ type SFNT struct {
 	Gsub *gposgsubTable
 	Jsft *jsftTable
 	//Gasp *gaspTable // TODO
-	//Base *baseTable // TODO
-	//Prep *baseTable // TODO
-	//Fpgm *baseTable // TODO
-	//Cvt *baseTable // TODO
+	Base *baseTable
+	Math *mathTable
+
+	// color glyphs, see sfnt_color.go
+	Colr *colrTable
+	Cpal *cpalTable
+	Sbix *sbixTable
+	Cbdt *cbdtTable
+
+	// variable fonts, see sfnt_variations.go
+	Fvar *fvarTable
+	Avar *avarTable
+
+	// TrueType instructions, see sfnt_hinting.go
+	hinterOnce sync.Once
+	hinterPool sync.Pool // of *hinter, one per concurrent caller
+	hinterErr  error
+
+	// advance cache, see GlyphAdvance
+	advancesOnce sync.Once
+	advances     []uint32 // advance width plus one, or zero if not yet cached
+	advanceMiss  uint64   // number of lookups in hmtx
 }
 
 // NumGlyphs returns the number of glyphs the font contains.
@@ -91,16 +112,30 @@ func (sfnt *SFNT) GlyphName(glyphID uint16) string {
 // GlyphPath draws the glyph's contour as a path to the pather interface. It will use the specified ppem (pixels-per-EM) for hinting purposes. The path is draws to the (x,y) coordinate and scaled using the given scale factor.
 func (sfnt *SFNT) GlyphPath(p Pather, glyphID, ppem uint16, x, y, scale float64, hinting Hinting) error {
 	if sfnt.IsTrueType {
+		if hinting == BytecodeHinting && ppem != 0 && sfnt.hintedGlyphPath(p, glyphID, ppem, x, y, scale) {
+			return nil
+		}
 		return sfnt.Glyf.ToPath(p, glyphID, ppem, x, y, scale, hinting)
 	} else if sfnt.IsCFF {
 		return sfnt.CFF.ToPath(p, glyphID, ppem, x, y, scale, hinting)
 	}
-	return fmt.Errorf("only TrueType and CFF are supported")
+	return fmt.Errorf("font has no TrueType or CFF glyph outlines")
 }
 
-// GlyphAdvance returns the (horizontal) advance width of the glyph.
+// GlyphAdvance returns the (horizontal) advance width of the glyph. Advances are cached on first use so that measuring text does not look up the hmtx table for every glyph, and the cache is shared by all faces of the font and safe for concurrent use.
 func (sfnt *SFNT) GlyphAdvance(glyphID uint16) uint16 {
-	return sfnt.Hmtx.Advance(glyphID)
+	sfnt.advancesOnce.Do(func() {
+		sfnt.advances = make([]uint32, sfnt.Maxp.NumGlyphs)
+	})
+	if len(sfnt.advances) <= int(glyphID) {
+		return sfnt.Hmtx.Advance(glyphID)
+	} else if advance := atomic.LoadUint32(&sfnt.advances[glyphID]); advance != 0 {
+		return uint16(advance - 1)
+	}
+	atomic.AddUint64(&sfnt.advanceMiss, 1)
+	advance := sfnt.Hmtx.Advance(glyphID)
+	atomic.StoreUint32(&sfnt.advances[glyphID], uint32(advance)+1)
+	return advance
 }
 
 // GlyphVerticalAdvance returns the vertical advance width of the glyph.
@@ -184,6 +219,22 @@ func (sfnt *SFNT) Kerning(left, right uint16) int16 {
 	return sfnt.Kern.Get(left, right)
 }
 
+// WeightClass returns the visual weight of the font from the OS/2 table, ranging from 1 to 1000 like CSS's font-weight, where 400 is regular and 700 is bold. It returns 400 if the font has no OS/2 table.
+func (sfnt *SFNT) WeightClass() int {
+	if sfnt.OS2 == nil {
+		return 400
+	}
+	return int(sfnt.OS2.UsWeightClass)
+}
+
+// WidthClass returns the relative width of the font from the OS/2 table, ranging from 1 (ultra-condensed) to 9 (ultra-expanded) like CSS's font-stretch, where 5 is normal. It returns 5 if the font has no OS/2 table.
+func (sfnt *SFNT) WidthClass() int {
+	if sfnt.OS2 == nil {
+		return 5
+	}
+	return int(sfnt.OS2.UsWidthClass)
+}
+
 // ParseSFNT parses an OpenType file format (TTF, OTF, TTC). The index is used for font collections to select a single font.
 func ParseSFNT(b []byte, index int) (*SFNT, error) {
 	return parseSFNT(b, index, false)
@@ -345,12 +396,24 @@ func parseSFNT(b []byte, index int, embedded bool) (*SFNT, error) {
 	for _, tableName := range tableNames {
 		var err error
 		switch tableName {
+		case "avar":
+			err = sfnt.parseAvar()
+		case "BASE":
+			err = sfnt.parseBASE()
+		case "CBLC":
+			err = sfnt.parseCBDT()
 		case "CFF ":
 			err = sfnt.parseCFF()
 		case "CFF2":
 			err = sfnt.parseCFF2()
 		case "cmap":
 			err = sfnt.parseCmap()
+		case "COLR":
+			err = sfnt.parseCOLR()
+		case "CPAL":
+			err = sfnt.parseCPAL()
+		case "fvar":
+			err = sfnt.parseFvar()
 		case "glyf":
 			err = sfnt.parseGlyf()
 		case "GPOS":
@@ -361,12 +424,16 @@ func parseSFNT(b []byte, index int, embedded bool) (*SFNT, error) {
 			err = sfnt.parseHmtx()
 		case "kern":
 			err = sfnt.parseKern()
+		case "MATH":
+			err = sfnt.parseMATH()
 		case "name":
 			err = sfnt.parseName()
 		case "OS/2":
 			err = sfnt.parseOS2()
 		case "post":
 			err = sfnt.parsePost()
+		case "sbix":
+			err = sfnt.parseSbix()
 		case "vhea":
 			err = sfnt.parseVhea()
 		case "vmtx":
@@ -387,7 +454,8 @@ func parseSFNT(b []byte, index int, embedded bool) (*SFNT, error) {
 type cmapFormat0 struct {
 	GlyphIdArray [256]uint8
 
-	UnicodeMap map[uint16]rune
+	UnicodeMap  map[uint16]rune
+	unicodeOnce sync.Once
 }
 
 func (subtable *cmapFormat0) Get(r rune) (uint16, bool) {
@@ -400,12 +468,13 @@ func (subtable *cmapFormat0) Get(r rune) (uint16, bool) {
 func (subtable *cmapFormat0) ToUnicode(glyphID uint16) (rune, bool) {
 	if 256 <= glyphID {
 		return 0, false
-	} else if subtable.UnicodeMap == nil {
+	}
+	subtable.unicodeOnce.Do(func() {
 		subtable.UnicodeMap = make(map[uint16]rune, 256)
 		for r, id := range subtable.GlyphIdArray {
 			subtable.UnicodeMap[uint16(id)] = rune(r)
 		}
-	}
+	})
 	r, ok := subtable.UnicodeMap[glyphID]
 	return r, ok
 }
@@ -417,7 +486,8 @@ type cmapFormat4 struct {
 	IdRangeOffset []uint16
 	GlyphIdArray  []uint16
 
-	UnicodeMap map[uint16]rune
+	UnicodeMap  map[uint16]rune
+	unicodeOnce sync.Once
 }
 
 func (subtable *cmapFormat4) Get(r rune) (uint16, bool) {
@@ -442,7 +512,7 @@ func (subtable *cmapFormat4) Get(r rune) (uint16, bool) {
 }
 
 func (subtable *cmapFormat4) ToUnicode(glyphID uint16) (rune, bool) {
-	if subtable.UnicodeMap == nil {
+	subtable.unicodeOnce.Do(func() {
 		subtable.UnicodeMap = map[uint16]rune{}
 		n := len(subtable.StartCode)
 		for i := 0; i < n; i++ {
@@ -461,7 +531,7 @@ func (subtable *cmapFormat4) ToUnicode(glyphID uint16) (rune, bool) {
 				subtable.UnicodeMap[id] = rune(r)
 			}
 		}
-	}
+	})
 	r, ok := subtable.UnicodeMap[glyphID]
 	return r, ok
 }
@@ -492,7 +562,8 @@ type cmapFormat12 struct {
 	EndCharCode   []uint32
 	StartGlyphID  []uint32
 
-	UnicodeMap map[uint16]rune
+	UnicodeMap  map[uint16]rune
+	unicodeOnce sync.Once
 }
 
 func (subtable *cmapFormat12) Get(r rune) (uint16, bool) {
@@ -508,7 +579,7 @@ func (subtable *cmapFormat12) Get(r rune) (uint16, bool) {
 }
 
 func (subtable *cmapFormat12) ToUnicode(glyphID uint16) (rune, bool) {
-	if subtable.UnicodeMap == nil {
+	subtable.unicodeOnce.Do(func() {
 		subtable.UnicodeMap = map[uint16]rune{}
 		for i := 0; i < len(subtable.StartCharCode); i++ {
 			for r := subtable.StartCharCode[i]; r < subtable.EndCharCode[i]; r++ {
@@ -516,7 +587,7 @@ func (subtable *cmapFormat12) ToUnicode(glyphID uint16) (rune, bool) {
 				subtable.UnicodeMap[id] = rune(r)
 			}
 		}
-	}
+	})
 	r, ok := subtable.UnicodeMap[glyphID]
 	return r, ok
 }
@@ -1238,6 +1309,8 @@ func (record nameRecord) String() string {
 		decoder = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder()
 	} else if record.Platform == PlatformMacintosh && record.Encoding == EncodingMacintoshRoman {
 		decoder = charmap.Macintosh.NewDecoder()
+	} else {
+		return string(record.Value)
 	}
 	s, _, err := transform.String(decoder, string(record.Value))
 	if err == nil {
@@ -1274,6 +1347,68 @@ func (t *nameTable) Get(name NameID) []nameRecord {
 	return records
 }
 
+// NameRecord is a record of the naming table with its string decoded.
+type NameRecord struct {
+	Platform    PlatformID
+	Encoding    EncodingID
+	Language    uint16 // platform-specific, e.g. 0x0409 is English (United States) for Windows and 0 is English for Macintosh
+	LanguageTag string // IETF BCP 47 language tag for language IDs of 0x8000 and up
+	Name        NameID
+	Value       string
+}
+
+// Names returns the records of the naming table, such as the font family, subfamily, full name, and PostScript name, with their strings decoded from the platform's encoding.
+func (sfnt *SFNT) Names() []NameRecord {
+	if sfnt.Name == nil {
+		return nil
+	}
+	records := make([]NameRecord, len(sfnt.Name.NameRecord))
+	for i, record := range sfnt.Name.NameRecord {
+		records[i] = NameRecord{
+			Platform: record.Platform,
+			Encoding: record.Encoding,
+			Language: record.Language,
+			Name:     record.Name,
+			Value:    record.String(),
+		}
+		if 0x8000 <= record.Language && int(record.Language-0x8000) < len(sfnt.Name.LangTag) {
+			records[i].LanguageTag = sfnt.Name.LangTag[record.Language-0x8000].String()
+		}
+	}
+	return records
+}
+
+// FindName returns the string of the given name ID. It prefers records for the Windows platform in the given Windows language ID, such as 0x0409 for English (United States), followed by records in English, and then by any other record. It returns false if the font has no such name.
+func (sfnt *SFNT) FindName(name NameID, language uint16) (string, bool) {
+	if sfnt.Name == nil {
+		return "", false
+	}
+
+	best, bestScore := -1, -1
+	for i, record := range sfnt.Name.NameRecord {
+		if record.Name != name {
+			continue
+		}
+		score := 0
+		if record.Platform == PlatformWindows && record.Language == language {
+			score = 4
+		} else if record.Platform == PlatformWindows && record.Language&0x3FF == 0x09 {
+			score = 3 // any English
+		} else if record.Platform == PlatformUnicode {
+			score = 2 // no language
+		} else if record.Platform == PlatformMacintosh && record.Language == 0 {
+			score = 1 // English
+		}
+		if bestScore < score {
+			best, bestScore = i, score
+		}
+	}
+	if best == -1 {
+		return "", false
+	}
+	return sfnt.Name.NameRecord[best].String(), true
+}
+
 func (sfnt *SFNT) parseName() error {
 	b, ok := sfnt.Tables["name"]
 	if !ok {
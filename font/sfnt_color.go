@@ -0,0 +1,461 @@
+package font
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+)
+
+// ColorLayer is a layer of a color glyph, which is the outline of another glyph filled with a color from the palette. Layers are drawn from bottom to top.
+type ColorLayer struct {
+	GlyphID      uint16
+	PaletteIndex uint16 // ForegroundPaletteIndex uses the text color
+}
+
+// ForegroundPaletteIndex is the palette index of layers that are drawn with the text color.
+const ForegroundPaletteIndex = 0xFFFF
+
+type colrBaseGlyph struct {
+	GlyphID         uint16
+	FirstLayerIndex uint16
+	NumLayers       uint16
+}
+
+type colrTable struct {
+	BaseGlyphs []colrBaseGlyph // sorted by glyph ID
+	Layers     []ColorLayer
+}
+
+// Get returns the layers of a color glyph. It returns nil if the glyph has no color layers.
+func (colr *colrTable) Get(glyphID uint16) []ColorLayer {
+	i := sort.Search(len(colr.BaseGlyphs), func(i int) bool {
+		return glyphID <= colr.BaseGlyphs[i].GlyphID
+	})
+	if i == len(colr.BaseGlyphs) || colr.BaseGlyphs[i].GlyphID != glyphID {
+		return nil
+	}
+	baseGlyph := colr.BaseGlyphs[i]
+	return colr.Layers[baseGlyph.FirstLayerIndex : baseGlyph.FirstLayerIndex+baseGlyph.NumLayers]
+}
+
+func (sfnt *SFNT) parseCOLR() error {
+	// only the base glyph and layer records of version 0 are supported, version 1 paint graphs are ignored
+	b, ok := sfnt.Tables["COLR"]
+	if !ok {
+		return fmt.Errorf("COLR: missing table")
+	} else if len(b) < 14 {
+		return fmt.Errorf("COLR: bad table")
+	}
+
+	r := NewBinaryReader(b)
+	version := r.ReadUint16()
+	if 1 < version {
+		return fmt.Errorf("COLR: bad version %d", version)
+	}
+	numBaseGlyphRecords := r.ReadUint16()
+	baseGlyphRecordsOffset := r.ReadUint32()
+	layerRecordsOffset := r.ReadUint32()
+	numLayerRecords := r.ReadUint16()
+	if uint32(len(b)) < baseGlyphRecordsOffset || uint32(len(b))-baseGlyphRecordsOffset < 6*uint32(numBaseGlyphRecords) {
+		return fmt.Errorf("COLR: bad base glyph records")
+	} else if uint32(len(b)) < layerRecordsOffset || uint32(len(b))-layerRecordsOffset < 4*uint32(numLayerRecords) {
+		return fmt.Errorf("COLR: bad layer records")
+	}
+
+	sfnt.Colr = &colrTable{
+		BaseGlyphs: make([]colrBaseGlyph, numBaseGlyphRecords),
+		Layers:     make([]ColorLayer, numLayerRecords),
+	}
+	r.Seek(baseGlyphRecordsOffset)
+	for i := range sfnt.Colr.BaseGlyphs {
+		sfnt.Colr.BaseGlyphs[i].GlyphID = r.ReadUint16()
+		sfnt.Colr.BaseGlyphs[i].FirstLayerIndex = r.ReadUint16()
+		sfnt.Colr.BaseGlyphs[i].NumLayers = r.ReadUint16()
+		if 0 < i && sfnt.Colr.BaseGlyphs[i].GlyphID <= sfnt.Colr.BaseGlyphs[i-1].GlyphID {
+			return fmt.Errorf("COLR: base glyph records must be in ascending order")
+		} else if numLayerRecords < sfnt.Colr.BaseGlyphs[i].FirstLayerIndex || numLayerRecords-sfnt.Colr.BaseGlyphs[i].FirstLayerIndex < sfnt.Colr.BaseGlyphs[i].NumLayers {
+			return fmt.Errorf("COLR: bad layers for base glyph record %d", i)
+		}
+	}
+	r.Seek(layerRecordsOffset)
+	for i := range sfnt.Colr.Layers {
+		sfnt.Colr.Layers[i].GlyphID = r.ReadUint16()
+		sfnt.Colr.Layers[i].PaletteIndex = r.ReadUint16()
+		if sfnt.Maxp.NumGlyphs <= sfnt.Colr.Layers[i].GlyphID {
+			return fmt.Errorf("COLR: bad glyph ID for layer record %d", i)
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type cpalTable struct {
+	Palettes [][]color.RGBA // premultiplied colors
+}
+
+// Get returns the color of a palette entry. It returns false if the palette or the entry does not exist.
+func (cpal *cpalTable) Get(palette int, index uint16) (color.RGBA, bool) {
+	if palette < 0 || len(cpal.Palettes) <= palette || len(cpal.Palettes[palette]) <= int(index) {
+		return color.RGBA{}, false
+	}
+	return cpal.Palettes[palette][index], true
+}
+
+func (sfnt *SFNT) parseCPAL() error {
+	b, ok := sfnt.Tables["CPAL"]
+	if !ok {
+		return fmt.Errorf("CPAL: missing table")
+	} else if len(b) < 12 {
+		return fmt.Errorf("CPAL: bad table")
+	}
+
+	r := NewBinaryReader(b)
+	version := r.ReadUint16()
+	if 1 < version {
+		return fmt.Errorf("CPAL: bad version %d", version)
+	}
+	numPaletteEntries := r.ReadUint16()
+	numPalettes := r.ReadUint16()
+	numColorRecords := r.ReadUint16()
+	colorRecordsArrayOffset := r.ReadUint32()
+	if r.Len() < 2*uint32(numPalettes) {
+		return fmt.Errorf("CPAL: bad table")
+	} else if uint32(len(b)) < colorRecordsArrayOffset || uint32(len(b))-colorRecordsArrayOffset < 4*uint32(numColorRecords) {
+		return fmt.Errorf("CPAL: bad color records")
+	}
+
+	colorRecordIndices := make([]uint16, numPalettes)
+	for i := range colorRecordIndices {
+		colorRecordIndices[i] = r.ReadUint16()
+		if numColorRecords < colorRecordIndices[i] || numColorRecords-colorRecordIndices[i] < numPaletteEntries {
+			return fmt.Errorf("CPAL: bad color record index for palette %d", i)
+		}
+	}
+
+	sfnt.Cpal = &cpalTable{
+		Palettes: make([][]color.RGBA, numPalettes),
+	}
+	for i, colorRecordIndex := range colorRecordIndices {
+		r.Seek(colorRecordsArrayOffset + 4*uint32(colorRecordIndex))
+		sfnt.Cpal.Palettes[i] = make([]color.RGBA, numPaletteEntries)
+		for j := range sfnt.Cpal.Palettes[i] {
+			blue := uint32(r.ReadUint8())
+			green := uint32(r.ReadUint8())
+			red := uint32(r.ReadUint8())
+			alpha := uint32(r.ReadUint8())
+			sfnt.Cpal.Palettes[i][j] = color.RGBA{
+				R: uint8((red*alpha + 127) / 255),
+				G: uint8((green*alpha + 127) / 255),
+				B: uint8((blue*alpha + 127) / 255),
+				A: uint8(alpha),
+			}
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+// GlyphBitmap is the image of a bitmap glyph, such as a color emoji.
+type GlyphBitmap struct {
+	Format string // graphic type, such as "png " or "jpg "
+	Data   []byte
+	PPEM   uint16 // pixels per em of the image
+	X, Y   int16  // offset of the image's bottom-left corner from the glyph origin in pixels
+}
+
+type sbixStrike struct {
+	PPEM uint16
+	PPI  uint16
+	data []byte
+}
+
+type sbixTable struct {
+	Strikes []sbixStrike
+}
+
+// Get returns the bitmap of a glyph from the strike with the largest ppem. It returns false if the glyph has no bitmap.
+func (sbix *sbixTable) Get(glyphID uint16) (GlyphBitmap, bool) {
+	var strike *sbixStrike
+	for i := range sbix.Strikes {
+		if strike == nil || strike.PPEM < sbix.Strikes[i].PPEM {
+			strike = &sbix.Strikes[i]
+		}
+	}
+	if strike == nil {
+		return GlyphBitmap{}, false
+	}
+
+	for dupe := 0; dupe < 2; dupe++ {
+		r := NewBinaryReader(strike.data)
+		r.Seek(4 + 4*uint32(glyphID))
+		start := r.ReadUint32()
+		end := r.ReadUint32()
+		if r.EOF() || end < start+8 || uint32(len(strike.data)) < end {
+			return GlyphBitmap{}, false
+		}
+
+		r.Seek(start)
+		bitmap := GlyphBitmap{
+			PPEM: strike.PPEM,
+			X:    r.ReadInt16(),
+			Y:    r.ReadInt16(),
+		}
+		bitmap.Format = r.ReadString(4)
+		bitmap.Data = r.ReadBytes(end - start - 8)
+		if bitmap.Format != "dupe" {
+			return bitmap, true
+		} else if len(bitmap.Data) < 2 {
+			break
+		}
+		glyphID = uint16(bitmap.Data[0])<<8 | uint16(bitmap.Data[1])
+	}
+	return GlyphBitmap{}, false
+}
+
+func (sfnt *SFNT) parseSbix() error {
+	b, ok := sfnt.Tables["sbix"]
+	if !ok {
+		return fmt.Errorf("sbix: missing table")
+	} else if len(b) < 8 {
+		return fmt.Errorf("sbix: bad table")
+	}
+
+	r := NewBinaryReader(b)
+	version := r.ReadUint16()
+	if version != 1 {
+		return fmt.Errorf("sbix: bad version %d", version)
+	}
+	_ = r.ReadUint16() // flags
+	numStrikes := r.ReadUint32()
+	if r.Len()/4 < numStrikes {
+		return fmt.Errorf("sbix: bad table")
+	}
+
+	sfnt.Sbix = &sbixTable{
+		Strikes: make([]sbixStrike, numStrikes),
+	}
+	for i := range sfnt.Sbix.Strikes {
+		offset := r.ReadUint32()
+		if uint32(len(b)) < offset || uint32(len(b))-offset < 4+4*(uint32(sfnt.Maxp.NumGlyphs)+1) {
+			return fmt.Errorf("sbix: bad strike %d", i)
+		}
+		sfnt.Sbix.Strikes[i].PPEM = uint16(b[offset])<<8 | uint16(b[offset+1])
+		sfnt.Sbix.Strikes[i].PPI = uint16(b[offset+2])<<8 | uint16(b[offset+3])
+		sfnt.Sbix.Strikes[i].data = b[offset:]
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type cblcIndexSubtable struct {
+	FirstGlyphIndex uint16
+	LastGlyphIndex  uint16
+	offset          uint32 // offset of the index subtable in the CBLC table
+}
+
+type cblcStrike struct {
+	PPEM      uint8
+	Subtables []cblcIndexSubtable
+}
+
+type cbdtTable struct {
+	Strikes []cblcStrike
+	cblc    []byte
+	cbdt    []byte
+}
+
+// Get returns the bitmap of a glyph from the strike with the largest ppem. Only PNG images, i.e. image formats 17, 18, and 19, are supported. It returns false if the glyph has no bitmap.
+func (cbdt *cbdtTable) Get(glyphID uint16) (GlyphBitmap, bool) {
+	var strike *cblcStrike
+	for i := range cbdt.Strikes {
+		if strike == nil || strike.PPEM < cbdt.Strikes[i].PPEM {
+			strike = &cbdt.Strikes[i]
+		}
+	}
+	if strike == nil {
+		return GlyphBitmap{}, false
+	}
+
+	for _, subtable := range strike.Subtables {
+		if glyphID < subtable.FirstGlyphIndex || subtable.LastGlyphIndex < glyphID {
+			continue
+		}
+
+		r := NewBinaryReader(cbdt.cblc)
+		r.Seek(subtable.offset)
+		indexFormat := r.ReadUint16()
+		imageFormat := r.ReadUint16()
+		imageDataOffset := r.ReadUint32()
+
+		// find the offset and length of the glyph's image data and the big glyph metrics if present
+		i := uint32(glyphID - subtable.FirstGlyphIndex)
+		var start, end uint32
+		var metrics []byte
+		switch indexFormat {
+		case 1, 3:
+			size := uint32(4)
+			if indexFormat == 3 {
+				size = 2
+			}
+			r.Seek(r.Pos() + size*i)
+			if size == 4 {
+				start, end = r.ReadUint32(), r.ReadUint32()
+			} else {
+				start, end = uint32(r.ReadUint16()), uint32(r.ReadUint16())
+			}
+		case 2:
+			imageSize := r.ReadUint32()
+			metrics = r.ReadBytes(8)
+			start = imageSize * i
+			end = start + imageSize
+		case 4:
+			numGlyphs := r.ReadUint32()
+			for j := uint32(0); j < numGlyphs && !r.EOF(); j++ {
+				id := r.ReadUint16()
+				offset := uint32(r.ReadUint16())
+				if id == glyphID {
+					_ = r.ReadUint16() // next glyph ID
+					start, end = offset, uint32(r.ReadUint16())
+					break
+				}
+			}
+		case 5:
+			imageSize := r.ReadUint32()
+			metrics = r.ReadBytes(8)
+			numGlyphs := r.ReadUint32()
+			found := false
+			for j := uint32(0); j < numGlyphs && !r.EOF(); j++ {
+				if r.ReadUint16() == glyphID {
+					start = imageSize * j
+					end = start + imageSize
+					found = true
+					break
+				}
+			}
+			if !found {
+				return GlyphBitmap{}, false
+			}
+		default:
+			return GlyphBitmap{}, false
+		}
+		if r.EOF() || end <= start || uint32(len(cbdt.cbdt)) < imageDataOffset || uint32(len(cbdt.cbdt))-imageDataOffset < end {
+			return GlyphBitmap{}, false
+		}
+
+		r = NewBinaryReader(cbdt.cbdt[imageDataOffset+start : imageDataOffset+end])
+		switch imageFormat {
+		case 17:
+			metrics = r.ReadBytes(5)
+		case 18:
+			metrics = r.ReadBytes(8)
+		case 19:
+			// metrics are in the index subtable
+		default:
+			return GlyphBitmap{}, false
+		}
+		dataLen := r.ReadUint32()
+		data := r.ReadBytes(dataLen)
+		if r.EOF() || len(metrics) < 5 {
+			return GlyphBitmap{}, false
+		}
+
+		// small and big glyph metrics start with height, width, bearingX, and bearingY, where bearingY is the distance from the baseline to the top of the image
+		height, bearingX, bearingY := int16(metrics[0]), int16(int8(metrics[2])), int16(int8(metrics[3]))
+		return GlyphBitmap{
+			Format: "png ",
+			Data:   data,
+			PPEM:   uint16(strike.PPEM),
+			X:      bearingX,
+			Y:      bearingY - height,
+		}, true
+	}
+	return GlyphBitmap{}, false
+}
+
+func (sfnt *SFNT) parseCBDT() error {
+	cblc, ok := sfnt.Tables["CBLC"]
+	if !ok {
+		return fmt.Errorf("CBLC: missing table")
+	} else if len(cblc) < 8 {
+		return fmt.Errorf("CBLC: bad table")
+	}
+
+	r := NewBinaryReader(cblc)
+	majorVersion := r.ReadUint16()
+	_ = r.ReadUint16() // minorVersion
+	if majorVersion != 3 {
+		return fmt.Errorf("CBLC: bad version %d", majorVersion)
+	}
+	numSizes := r.ReadUint32()
+	if r.Len()/48 < numSizes {
+		return fmt.Errorf("CBLC: bad table")
+	}
+
+	sfnt.Cbdt = &cbdtTable{
+		Strikes: make([]cblcStrike, numSizes),
+		cblc:    cblc,
+		cbdt:    sfnt.Tables["CBDT"],
+	}
+	for i := range sfnt.Cbdt.Strikes {
+		indexSubtableListOffset := r.ReadUint32()
+		_ = r.ReadUint32() // indexSubtableListSize
+		numberOfIndexSubtables := r.ReadUint32()
+		_ = r.ReadUint32()  // colorRef
+		_ = r.ReadBytes(24) // hori and vert line metrics
+		_ = r.ReadUint16()  // startGlyphIndex
+		_ = r.ReadUint16()  // endGlyphIndex
+		_ = r.ReadUint8()   // ppemX
+		sfnt.Cbdt.Strikes[i].PPEM = r.ReadUint8()
+		_ = r.ReadUint8() // bitDepth
+		_ = r.ReadInt8()  // flags
+		if uint32(len(cblc)) < indexSubtableListOffset || (uint32(len(cblc))-indexSubtableListOffset)/8 < numberOfIndexSubtables {
+			return fmt.Errorf("CBLC: bad index subtables for strike %d", i)
+		}
+
+		sfnt.Cbdt.Strikes[i].Subtables = make([]cblcIndexSubtable, numberOfIndexSubtables)
+		s := NewBinaryReader(cblc[indexSubtableListOffset:])
+		for j := range sfnt.Cbdt.Strikes[i].Subtables {
+			sfnt.Cbdt.Strikes[i].Subtables[j].FirstGlyphIndex = s.ReadUint16()
+			sfnt.Cbdt.Strikes[i].Subtables[j].LastGlyphIndex = s.ReadUint16()
+			sfnt.Cbdt.Strikes[i].Subtables[j].offset = indexSubtableListOffset + s.ReadUint32()
+			if uint32(len(cblc)) < sfnt.Cbdt.Strikes[i].Subtables[j].offset+8 {
+				return fmt.Errorf("CBLC: bad index subtable %d for strike %d", j, i)
+			}
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+// GlyphLayers returns the color layers of the glyph from the COLR table. It returns nil if the glyph is not a color glyph.
+func (sfnt *SFNT) GlyphLayers(glyphID uint16) []ColorLayer {
+	if sfnt.Colr == nil {
+		return nil
+	}
+	return sfnt.Colr.Get(glyphID)
+}
+
+// PaletteColor returns the color of a palette entry from the CPAL table. It returns false if the palette or entry does not exist.
+func (sfnt *SFNT) PaletteColor(palette int, index uint16) (color.RGBA, bool) {
+	if sfnt.Cpal == nil {
+		return color.RGBA{}, false
+	}
+	return sfnt.Cpal.Get(palette, index)
+}
+
+// GlyphBitmap returns the image of a bitmap glyph from the sbix or CBDT tables, using the strike with the largest ppem. It returns false if the glyph has no bitmap.
+func (sfnt *SFNT) GlyphBitmap(glyphID uint16) (GlyphBitmap, bool) {
+	if sfnt.Sbix != nil {
+		if bitmap, ok := sfnt.Sbix.Get(glyphID); ok {
+			return bitmap, true
+		}
+	}
+	if sfnt.Cbdt != nil {
+		return sfnt.Cbdt.Get(glyphID)
+	}
+	return GlyphBitmap{}, false
+}
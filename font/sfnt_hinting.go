@@ -0,0 +1,1361 @@
+package font
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// TrueType bytecode interpreter, see https://learn.microsoft.com/en-us/typography/opentype/spec/tt_instructions. Coordinates and distances are in 26.6 fixed point pixels, vectors are kept as unit vectors in floating point.
+
+const hintMaxSteps = 1000000 // maximum number of instructions executed per program
+
+const (
+	hintTouchedX = 0x01
+	hintTouchedY = 0x02
+)
+
+type hintRound int
+
+const (
+	hintRoundToGrid hintRound = iota
+	hintRoundToHalfGrid
+	hintRoundToDoubleGrid
+	hintRoundDownToGrid
+	hintRoundUpToGrid
+	hintRoundOff
+	hintRoundSuper
+)
+
+type hintPoint struct {
+	X, Y int32
+}
+
+type hintVector struct {
+	X, Y float64
+}
+
+func newHintVector(x, y float64) hintVector {
+	length := math.Hypot(x, y)
+	if length == 0.0 {
+		return hintVector{1.0, 0.0}
+	}
+	return hintVector{x / length, y / length}
+}
+
+type hintZone struct {
+	cur, orig []hintPoint
+	units     []hintPoint // original points in font units, nil for the twilight zone
+	touched   []uint8
+	onCurve   []bool
+	endPoints []uint16
+}
+
+func newHintZone(n int) hintZone {
+	return hintZone{
+		cur:     make([]hintPoint, n),
+		orig:    make([]hintPoint, n),
+		touched: make([]uint8, n),
+		onCurve: make([]bool, n),
+	}
+}
+
+type hintGraphicsState struct {
+	pv, fv, dv                    hintVector // projection, freedom, and dual projection vectors
+	rp                            [3]int32   // reference points
+	zp                            [3]int32   // zone pointers
+	loop                          int32
+	round                         hintRound
+	period, phase, threshold      int32 // for super rounding
+	minDist, cvtCutIn             int32
+	singleWidthCutIn, singleWidth int32
+	deltaBase, deltaShift         int32
+	autoFlip                      bool
+	instructControl               int32
+}
+
+var hintDefaultGraphicsState = hintGraphicsState{
+	pv:         hintVector{1.0, 0.0},
+	fv:         hintVector{1.0, 0.0},
+	dv:         hintVector{1.0, 0.0},
+	zp:         [3]int32{1, 1, 1},
+	loop:       1,
+	round:      hintRoundToGrid,
+	period:     64,
+	minDist:    64,
+	cvtCutIn:   68, // 17/16 pixel
+	deltaBase:  9,
+	deltaShift: 3,
+	autoFlip:   true,
+}
+
+// hinter executes the TrueType instructions of a font to grid-fit glyph outlines for a given ppem. The font program is executed once, the control value program once per ppem, and the glyph program for every glyph.
+type hinter struct {
+	sfnt  *SFNT
+	ppem  uint16
+	scale float64 // 26.6 pixels per font unit
+
+	prepErr   error
+	stack     []int32
+	storage   []int32
+	cvt       []int32
+	functions map[int32][]byte
+	idefs     map[uint8][]byte
+
+	gs, defaultGS hintGraphicsState
+	zones         [2]hintZone // twilight and glyph zone
+	depth, steps  int
+	err           error
+	dummy         hintPoint
+}
+
+func newHinter(sfnt *SFNT) (*hinter, error) {
+	h := &hinter{
+		sfnt:      sfnt,
+		stack:     make([]int32, 0, int(sfnt.Maxp.MaxStackElements)+32),
+		functions: map[int32][]byte{},
+		idefs:     map[uint8][]byte{},
+		gs:        hintDefaultGraphicsState,
+	}
+	if err := h.execute(sfnt.Tables["fpgm"]); err != nil {
+		return nil, fmt.Errorf("fpgm: %w", err)
+	}
+	return h, nil
+}
+
+// setPPEM scales the control values and executes the control value program for the given ppem.
+func (h *hinter) setPPEM(ppem uint16) error {
+	if h.ppem == ppem && h.cvt != nil {
+		return h.prepErr
+	}
+	h.ppem = ppem
+	h.scale = 64.0 * float64(ppem) / float64(h.sfnt.Head.UnitsPerEm)
+
+	b := h.sfnt.Tables["cvt "]
+	h.cvt = make([]int32, len(b)/2)
+	for i := range h.cvt {
+		h.cvt[i] = h.scaleValue(int32(int16(binary.BigEndian.Uint16(b[2*i:]))))
+	}
+	h.storage = make([]int32, h.sfnt.Maxp.MaxStorage)
+	h.zones[0] = newHintZone(int(h.sfnt.Maxp.MaxTwilightPoints))
+	h.zones[1] = hintZone{}
+
+	h.gs = hintDefaultGraphicsState
+	h.prepErr = h.execute(h.sfnt.Tables["prep"])
+	if h.prepErr != nil {
+		h.prepErr = fmt.Errorf("prep: %w", h.prepErr)
+	}
+	// the control value program cannot change the vectors, reference points, zone pointers, and loop
+	h.defaultGS = h.gs
+	h.defaultGS.pv = hintDefaultGraphicsState.pv
+	h.defaultGS.fv = hintDefaultGraphicsState.fv
+	h.defaultGS.dv = hintDefaultGraphicsState.dv
+	h.defaultGS.rp = hintDefaultGraphicsState.rp
+	h.defaultGS.zp = hintDefaultGraphicsState.zp
+	h.defaultGS.loop = hintDefaultGraphicsState.loop
+	if h.gs.instructControl&0x02 != 0 {
+		// use the default graphics state for glyph programs
+		h.defaultGS = hintDefaultGraphicsState
+		h.defaultGS.instructControl = h.gs.instructControl
+	}
+	return h.prepErr
+}
+
+func (h *hinter) scaleValue(v int32) int32 {
+	return int32(math.Round(float64(v) * h.scale))
+}
+
+func (h *hinter) execute(code []byte) error {
+	h.stack = h.stack[:0]
+	h.depth, h.steps = 0, 0
+	h.err = nil
+	if err := h.run(code); err != nil {
+		return err
+	}
+	return h.err
+}
+
+// glyph returns the hinted glyph zone of a glyph, where the last four points are the phantom points.
+func (h *hinter) glyph(glyphID uint16, level int) (hintZone, error) {
+	b := h.sfnt.Glyf.Get(glyphID)
+	if b == nil {
+		return hintZone{}, fmt.Errorf("glyf: bad glyphID %v", glyphID)
+	} else if 10 <= len(b) && int16(binary.BigEndian.Uint16(b)) < 0 {
+		return h.compositeGlyph(glyphID, b, level)
+	}
+
+	contour, err := h.sfnt.Glyf.Contour(glyphID, level)
+	if err != nil {
+		return hintZone{}, err
+	}
+	n := len(contour.XCoordinates)
+	z := newHintZone(n + 4)
+	z.units = make([]hintPoint, n+4)
+	for i := 0; i < n; i++ {
+		z.units[i] = hintPoint{int32(contour.XCoordinates[i]), int32(contour.YCoordinates[i])}
+		z.orig[i] = hintPoint{h.scaleValue(z.units[i].X), h.scaleValue(z.units[i].Y)}
+	}
+	copy(z.onCurve, contour.OnCurve)
+	z.endPoints = contour.EndPoints
+	h.setPhantomPoints(&z, glyphID, contour.XMin, true)
+	return z, h.hintGlyph(z, contour.Instructions)
+}
+
+func (h *hinter) compositeGlyph(glyphID uint16, b []byte, level int) (hintZone, error) {
+	if 7 < level {
+		return hintZone{}, fmt.Errorf("glyf: compound glyphs too deeply nested")
+	}
+
+	r := NewBinaryReader(b)
+	_ = r.ReadInt16()
+	xMin := r.ReadInt16()
+	_ = r.ReadBytes(6)
+
+	z := hintZone{}
+	hasInstructions := false
+	var metrics []hintPoint // phantom points of the component whose metrics are used
+	for {
+		if r.Len() < 4 {
+			return hintZone{}, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+		}
+		flags := r.ReadUint16()
+		subGlyphID := r.ReadUint16()
+		length, more := glyfCompositeLength(flags)
+		if r.Len() < length-4 {
+			return hintZone{}, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+		} else if flags&0x0002 == 0 { // ARGS_ARE_XY_VALUES
+			return hintZone{}, fmt.Errorf("glyf: composite glyph not supported")
+		}
+
+		var dx, dy int16
+		if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+			dx = r.ReadInt16()
+			dy = r.ReadInt16()
+		} else {
+			dx = int16(r.ReadInt8())
+			dy = int16(r.ReadInt8())
+		}
+		txx, txy, tyx, tyy := 1.0, 0.0, 0.0, 1.0
+		if flags&0x0008 != 0 { // WE_HAVE_A_SCALE
+			txx = float64(r.ReadInt16()) / (1 << 14)
+			tyy = txx
+		} else if flags&0x0040 != 0 { // WE_HAVE_AN_X_AND_Y_SCALE
+			txx = float64(r.ReadInt16()) / (1 << 14)
+			tyy = float64(r.ReadInt16()) / (1 << 14)
+		} else if flags&0x0080 != 0 { // WE_HAVE_A_TWO_BY_TWO
+			txx = float64(r.ReadInt16()) / (1 << 14)
+			txy = float64(r.ReadInt16()) / (1 << 14)
+			tyx = float64(r.ReadInt16()) / (1 << 14)
+			tyy = float64(r.ReadInt16()) / (1 << 14)
+		}
+		if flags&0x0100 != 0 { // WE_HAVE_INSTRUCTIONS
+			hasInstructions = true
+		}
+
+		sub, err := h.glyph(subGlyphID, level+1)
+		if err != nil {
+			return hintZone{}, err
+		}
+
+		ox, oy := h.scaleValue(int32(dx)), h.scaleValue(int32(dy))
+		if flags&0x0004 != 0 { // ROUND_XY_TO_GRID
+			ox, oy = hintRoundGrid(ox), hintRoundGrid(oy)
+		}
+		offset := uint16(len(z.cur))
+		n := len(sub.cur) - 4
+		for i := 0; i < n; i++ {
+			p := sub.cur[i]
+			if flags&0x00C8 != 0 { // has transformation
+				x, y := float64(p.X), float64(p.Y)
+				p.X = int32(math.Round(x*txx + y*tyx))
+				p.Y = int32(math.Round(x*txy + y*tyy))
+			}
+			p.X += ox
+			p.Y += oy
+			z.cur = append(z.cur, p)
+		}
+		if flags&0x0200 != 0 { // USE_MY_METRICS
+			metrics = sub.cur[n:]
+		}
+		z.onCurve = append(z.onCurve, sub.onCurve[:n]...)
+		for _, endPoint := range sub.endPoints {
+			z.endPoints = append(z.endPoints, offset+endPoint)
+		}
+		if !more {
+			break
+		}
+	}
+
+	var instructions []byte
+	if hasInstructions && 2 <= r.Len() {
+		instructionLength := r.ReadUint16()
+		if r.Len() < uint32(instructionLength) {
+			return hintZone{}, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+		}
+		instructions = r.ReadBytes(uint32(instructionLength))
+	}
+
+	// the hinted points of the components are the original points of the composite glyph
+	n := len(z.cur)
+	z.cur = append(z.cur, make([]hintPoint, 4)...)
+	z.orig = make([]hintPoint, n+4)
+	z.touched = make([]uint8, n+4)
+	z.onCurve = append(z.onCurve, make([]bool, 4)...)
+	copy(z.orig, z.cur)
+	if metrics != nil {
+		copy(z.orig[n:], metrics)
+		copy(z.cur[n:], metrics)
+	} else {
+		h.setPhantomPoints(&z, glyphID, xMin, 0 < len(instructions))
+	}
+	return z, h.hintGlyph(z, instructions)
+}
+
+// setPhantomPoints sets the four phantom points at the end of the zone: the origin and advance width, and the vertical origin and advance height (which are zero). If adjust is set, the points are shifted so that the origin lies on the pixel grid.
+func (h *hinter) setPhantomPoints(z *hintZone, glyphID uint16, xMin int16, adjust bool) {
+	n := len(z.orig) - 4
+	xUnits := int32(xMin) - int32(h.sfnt.Hmtx.LeftSideBearing(glyphID))
+	advanceUnits := int32(h.sfnt.Hmtx.Advance(glyphID))
+	if z.units != nil {
+		z.units[n] = hintPoint{xUnits, 0}
+		z.units[n+1] = hintPoint{xUnits + advanceUnits, 0}
+	}
+
+	x, advance := h.scaleValue(xUnits), h.scaleValue(advanceUnits)
+	z.orig[n] = hintPoint{x, 0}
+	z.orig[n+1] = hintPoint{x + advance, 0}
+	z.orig[n+2] = hintPoint{}
+	z.orig[n+3] = hintPoint{}
+
+	if dx := hintRoundGrid(x) - x; adjust && dx != 0 {
+		for i := range z.orig {
+			z.orig[i].X += dx
+		}
+	}
+	copy(z.cur, z.orig)
+	z.cur[n+1].X = hintRoundGrid(z.cur[n+1].X)
+}
+
+func (h *hinter) hintGlyph(z hintZone, instructions []byte) error {
+	h.zones[1] = z
+	h.gs = h.defaultGS
+	if len(instructions) == 0 || h.gs.instructControl&0x01 != 0 {
+		return nil
+	}
+	return h.execute(instructions)
+}
+
+////////////////////////////////////////////////////////////////
+
+func (h *hinter) push(v int32) {
+	h.stack = append(h.stack, v)
+}
+
+func (h *hinter) pop() int32 {
+	if len(h.stack) == 0 {
+		if h.err == nil {
+			h.err = fmt.Errorf("stack underflow")
+		}
+		return 0
+	}
+	v := h.stack[len(h.stack)-1]
+	h.stack = h.stack[:len(h.stack)-1]
+	return v
+}
+
+// nextLoop returns whether an instruction that repeats for the loop variable needs another iteration, and resets the loop variable when it does not. Each iteration counts as an executed instruction, and an error ends the loop.
+func (h *hinter) nextLoop() bool {
+	if h.gs.loop <= 0 || h.err != nil {
+		h.gs.loop = 1
+		return false
+	}
+	h.steps++
+	if hintMaxSteps < h.steps {
+		h.err = fmt.Errorf("too many instructions")
+		h.gs.loop = 1
+		return false
+	}
+	h.gs.loop--
+	return true
+}
+
+func (h *hinter) zone(zp int32) *hintZone {
+	return &h.zones[h.gs.zp[zp]]
+}
+
+func (h *hinter) valid(zp, i int32) bool {
+	if i < 0 || int(i) >= len(h.zone(zp).cur) {
+		if h.err == nil {
+			h.err = fmt.Errorf("bad point %v in zone %v", i, h.gs.zp[zp])
+		}
+		return false
+	}
+	return true
+}
+
+func (h *hinter) cur(zp, i int32) *hintPoint {
+	if !h.valid(zp, i) {
+		return &h.dummy
+	}
+	return &h.zone(zp).cur[i]
+}
+
+func (h *hinter) orig(zp, i int32) *hintPoint {
+	if !h.valid(zp, i) {
+		return &h.dummy
+	}
+	return &h.zone(zp).orig[i]
+}
+
+func (h *hinter) project(p, q hintPoint) int32 {
+	return int32(math.Round(float64(p.X-q.X)*h.gs.pv.X + float64(p.Y-q.Y)*h.gs.pv.Y))
+}
+
+func (h *hinter) dualProject(p, q hintPoint) int32 {
+	return int32(math.Round(float64(p.X-q.X)*h.gs.dv.X + float64(p.Y-q.Y)*h.gs.dv.Y))
+}
+
+// origDistance returns the distance between the original points p in zp1 and q in zp0 along the dual projection vector. For the glyph zone it is measured in font units before scaling, like FreeType.
+func (h *hinter) origDistance(zp1, p, zp0, q int32) int32 {
+	if h.gs.zp[zp1] == 1 && h.gs.zp[zp0] == 1 && h.zones[1].units != nil && h.valid(zp1, p) && h.valid(zp0, q) {
+		return h.scaleValue(h.dualProject(h.zones[1].units[p], h.zones[1].units[q]))
+	}
+	return h.dualProject(*h.orig(zp1, p), *h.orig(zp0, q))
+}
+
+// move moves a point by a distance d along the freedom vector, where d is measured along the projection vector.
+func (h *hinter) move(zp, i int32, d int32, touch bool) {
+	if !h.valid(zp, i) {
+		return
+	}
+	dot := h.gs.fv.X*h.gs.pv.X + h.gs.fv.Y*h.gs.pv.Y
+	if math.Abs(dot) < 1.0/16.0 {
+		dot = 1.0
+	}
+	h.shift(zp, i, float64(d)*h.gs.fv.X/dot, float64(d)*h.gs.fv.Y/dot, touch)
+}
+
+func (h *hinter) shift(zp, i int32, dx, dy float64, touch bool) {
+	if !h.valid(zp, i) {
+		return
+	}
+	z := h.zone(zp)
+	if h.gs.fv.X != 0.0 {
+		z.cur[i].X += int32(math.Round(dx))
+		if touch {
+			z.touched[i] |= hintTouchedX
+		}
+	}
+	if h.gs.fv.Y != 0.0 {
+		z.cur[i].Y += int32(math.Round(dy))
+		if touch {
+			z.touched[i] |= hintTouchedY
+		}
+	}
+}
+
+// displacement returns the displacement of the reference point used by SHP, SHC, and SHZ along the freedom vector.
+func (h *hinter) displacement(op byte) (int32, int32, float64, float64) {
+	zp, rp := int32(1), h.gs.rp[2]
+	if op&0x01 != 0 {
+		zp, rp = 0, h.gs.rp[1]
+	}
+	d := h.project(*h.cur(zp, rp), *h.orig(zp, rp))
+	dot := h.gs.fv.X*h.gs.pv.X + h.gs.fv.Y*h.gs.pv.Y
+	if math.Abs(dot) < 1.0/16.0 {
+		dot = 1.0
+	}
+	return zp, rp, float64(d) * h.gs.fv.X / dot, float64(d) * h.gs.fv.Y / dot
+}
+
+func hintRoundGrid(d int32) int32 {
+	if d < 0 {
+		return -((-d + 32) &^ 63)
+	}
+	return (d + 32) &^ 63
+}
+
+func (h *hinter) round(d int32) int32 {
+	neg := d < 0
+	if neg {
+		d = -d
+	}
+	switch h.gs.round {
+	case hintRoundToGrid:
+		d = (d + 32) &^ 63
+	case hintRoundToHalfGrid:
+		d = d&^63 + 32
+	case hintRoundToDoubleGrid:
+		d = (d + 16) &^ 31
+	case hintRoundDownToGrid:
+		d = d &^ 63
+	case hintRoundUpToGrid:
+		d = (d + 63) &^ 63
+	case hintRoundSuper:
+		d = (d-h.gs.phase+h.gs.threshold)/h.gs.period*h.gs.period + h.gs.phase
+		if d < 0 {
+			d = h.gs.phase
+		}
+	}
+	if neg {
+		return -d
+	}
+	return d
+}
+
+func (h *hinter) superRound(n int32, gridPeriod int32) {
+	switch (n >> 6) & 0x03 {
+	case 0:
+		h.gs.period = gridPeriod / 2
+	case 2:
+		h.gs.period = gridPeriod * 2
+	default:
+		h.gs.period = gridPeriod
+	}
+	h.gs.phase = h.gs.period * ((n >> 4) & 0x03) / 4
+	if n&0x0F == 0 {
+		h.gs.threshold = h.gs.period - 1
+	} else {
+		h.gs.threshold = ((n & 0x0F) - 4) * h.gs.period / 8
+	}
+	h.gs.round = hintRoundSuper
+}
+
+// vectorFromLine returns the vector along the line from point p2 in zp2 to p1 in zp1, or perpendicular to it when rotated.
+func (h *hinter) vectorFromLine(p1, p2 int32, rotate, original bool) hintVector {
+	var a, b hintPoint
+	if original {
+		a, b = *h.orig(1, p1), *h.orig(2, p2)
+	} else {
+		a, b = *h.cur(1, p1), *h.cur(2, p2)
+	}
+	x, y := float64(a.X-b.X), float64(a.Y-b.Y)
+	if rotate {
+		x, y = -y, x
+	}
+	return newHintVector(x, y)
+}
+
+// interpolate interpolates the points between the touched points p1 and p2 along an axis. The position is interpolated linearly in font units if available, and points outside the range of p1 and p2 are shifted like the nearest touched point.
+func (h *hinter) interpolate(axis uint8, z *hintZone, p1, p2 int, indices []int) {
+	coord := func(p hintPoint) int32 {
+		if axis == hintTouchedX {
+			return p.X
+		}
+		return p.Y
+	}
+	units := z.units
+	if units == nil {
+		units = z.orig
+	}
+	u1, u2 := coord(units[p1]), coord(units[p2])
+	if u2 < u1 {
+		u1, u2 = u2, u1
+		p1, p2 = p2, p1
+	}
+	o1, o2 := coord(z.orig[p1]), coord(z.orig[p2])
+	c1, c2 := coord(z.cur[p1]), coord(z.cur[p2])
+
+	var scale int64 // in 16.16 fixed point
+	if u1 != u2 {
+		scale = hintMulDiv(int64(c2-c1), 0x10000, int64(u2-u1))
+	}
+	for _, i := range indices {
+		o := coord(z.orig[i])
+		var c int32
+		if o <= o1 {
+			c = o + c1 - o1
+		} else if o2 <= o || u1 == u2 {
+			c = o + c2 - o2
+		} else {
+			c = c1 + int32(hintMulDiv(int64(coord(units[i])-u1), scale, 0x10000))
+		}
+		if axis == hintTouchedX {
+			z.cur[i].X = c
+		} else {
+			z.cur[i].Y = c
+		}
+	}
+}
+
+// iup interpolates the untouched points of each contour in the glyph zone between the touched points.
+func (h *hinter) iup(axis uint8) {
+	z := &h.zones[1]
+	start := 0
+	for _, endPoint := range z.endPoints {
+		end := int(endPoint)
+		if len(z.cur) <= end {
+			break
+		}
+		touched := []int{}
+		for i := start; i <= end; i++ {
+			if z.touched[i]&axis != 0 {
+				touched = append(touched, i)
+			}
+		}
+		for k, t1 := range touched {
+			t2 := touched[(k+1)%len(touched)]
+			indices := []int{}
+			for i := t1 + 1; ; i++ {
+				if end < i {
+					i = start
+				}
+				if i == t2 {
+					break
+				}
+				indices = append(indices, i)
+			}
+			h.interpolate(axis, z, t1, t2, indices)
+		}
+		start = end + 1
+	}
+}
+
+////////////////////////////////////////////////////////////////
+
+// hintInstructionLength returns the length of the instruction at pc, including its inline data.
+func hintInstructionLength(code []byte, pc int) int {
+	op := code[pc]
+	switch {
+	case op == 0x40: // NPUSHB
+		if pc+1 < len(code) {
+			return 2 + int(code[pc+1])
+		}
+	case op == 0x41: // NPUSHW
+		if pc+1 < len(code) {
+			return 2 + 2*int(code[pc+1])
+		}
+	case 0xB0 <= op && op <= 0xB7: // PUSHB
+		return 2 + int(op-0xB0)
+	case 0xB8 <= op && op <= 0xBF: // PUSHW
+		return 3 + 2*int(op-0xB8)
+	}
+	return 1
+}
+
+// skip returns the position after the matching ELSE or EIF instruction starting at pc, or after the matching ENDF.
+func hintSkip(code []byte, pc int, endf, stopAtElse bool) (int, error) {
+	level := 0
+	for pc < len(code) {
+		op := code[pc]
+		pc += hintInstructionLength(code, pc)
+		switch {
+		case endf && op == 0x2D: // ENDF
+			return pc, nil
+		case endf && (op == 0x2C || op == 0x89): // FDEF, IDEF
+			return pc, fmt.Errorf("nested function definition")
+		case !endf && op == 0x58: // IF
+			level++
+		case !endf && op == 0x1B && level == 0 && stopAtElse: // ELSE
+			return pc, nil
+		case !endf && op == 0x59: // EIF
+			if level == 0 {
+				return pc, nil
+			}
+			level--
+		}
+	}
+	return pc, fmt.Errorf("unexpected end of instructions")
+}
+
+func (h *hinter) call(code []byte) error {
+	if 64 <= h.depth {
+		return fmt.Errorf("call stack overflow")
+	}
+	h.depth++
+	err := h.run(code)
+	h.depth--
+	return err
+}
+
+func (h *hinter) run(code []byte) error {
+	for pc := 0; pc < len(code); {
+		h.steps++
+		if hintMaxSteps < h.steps {
+			return fmt.Errorf("too many instructions")
+		} else if pc < 0 {
+			return fmt.Errorf("bad jump")
+		} else if len(code) < pc+hintInstructionLength(code, pc) {
+			return fmt.Errorf("unexpected end of instructions")
+		}
+
+		op := code[pc]
+		opPC := pc
+		pc += hintInstructionLength(code, pc)
+		switch op {
+		case 0x00, 0x01: // SVTCA
+			v := hintVector{0.0, 1.0}
+			if op == 0x01 {
+				v = hintVector{1.0, 0.0}
+			}
+			h.gs.pv, h.gs.dv, h.gs.fv = v, v, v
+		case 0x02, 0x03: // SPVTCA
+			h.gs.pv = hintVector{0.0, 1.0}
+			if op == 0x03 {
+				h.gs.pv = hintVector{1.0, 0.0}
+			}
+			h.gs.dv = h.gs.pv
+		case 0x04, 0x05: // SFVTCA
+			h.gs.fv = hintVector{0.0, 1.0}
+			if op == 0x05 {
+				h.gs.fv = hintVector{1.0, 0.0}
+			}
+		case 0x06, 0x07: // SPVTL
+			p2, p1 := h.pop(), h.pop()
+			h.gs.pv = h.vectorFromLine(p1, p2, op == 0x07, false)
+			h.gs.dv = h.gs.pv
+		case 0x08, 0x09: // SFVTL
+			p2, p1 := h.pop(), h.pop()
+			h.gs.fv = h.vectorFromLine(p1, p2, op == 0x09, false)
+		case 0x0A, 0x0B: // SPVFS, SFVFS
+			y, x := h.pop(), h.pop()
+			v := newHintVector(float64(int16(x)), float64(int16(y)))
+			if op == 0x0A {
+				h.gs.pv, h.gs.dv = v, v
+			} else {
+				h.gs.fv = v
+			}
+		case 0x0C, 0x0D: // GPV, GFV
+			v := h.gs.pv
+			if op == 0x0D {
+				v = h.gs.fv
+			}
+			h.push(int32(math.Round(v.X * 0x4000)))
+			h.push(int32(math.Round(v.Y * 0x4000)))
+		case 0x0E: // SFVTPV
+			h.gs.fv = h.gs.pv
+		case 0x0F: // ISECT
+			b1, b0, a1, a0, p := h.pop(), h.pop(), h.pop(), h.pop(), h.pop()
+			pa0, pa1 := *h.cur(1, a0), *h.cur(1, a1)
+			pb0, pb1 := *h.cur(0, b0), *h.cur(0, b1)
+			dax, day := float64(pa1.X-pa0.X), float64(pa1.Y-pa0.Y)
+			dbx, dby := float64(pb1.X-pb0.X), float64(pb1.Y-pb0.Y)
+			q := h.cur(2, p)
+			if det := dax*dby - day*dbx; math.Abs(det) < 1e-6 {
+				q.X = (pa0.X + pa1.X + pb0.X + pb1.X) / 4
+				q.Y = (pa0.Y + pa1.Y + pb0.Y + pb1.Y) / 4
+			} else {
+				t := (float64(pb0.X-pa0.X)*dby - float64(pb0.Y-pa0.Y)*dbx) / det
+				q.X = pa0.X + int32(math.Round(t*dax))
+				q.Y = pa0.Y + int32(math.Round(t*day))
+			}
+			if h.valid(2, p) {
+				h.zone(2).touched[p] |= hintTouchedX | hintTouchedY
+			}
+		case 0x10, 0x11, 0x12: // SRP0, SRP1, SRP2
+			h.gs.rp[op-0x10] = h.pop()
+		case 0x13, 0x14, 0x15, 0x16: // SZP0, SZP1, SZP2, SZPS
+			zp := h.pop()
+			if zp != 0 && zp != 1 {
+				return fmt.Errorf("bad zone %v", zp)
+			} else if op == 0x16 {
+				h.gs.zp = [3]int32{zp, zp, zp}
+			} else {
+				h.gs.zp[op-0x13] = zp
+			}
+		case 0x17: // SLOOP
+			if h.gs.loop = h.pop(); h.gs.loop < 0 {
+				return fmt.Errorf("bad loop %v", h.gs.loop)
+			}
+		case 0x18: // RTG
+			h.gs.round = hintRoundToGrid
+		case 0x19: // RTHG
+			h.gs.round = hintRoundToHalfGrid
+		case 0x1A: // SMD
+			h.gs.minDist = h.pop()
+		case 0x1B: // ELSE
+			var err error
+			if pc, err = hintSkip(code, pc, false, false); err != nil {
+				return err
+			}
+		case 0x1C: // JMPR
+			pc = opPC + int(h.pop())
+		case 0x1D: // SCVTCI
+			h.gs.cvtCutIn = h.pop()
+		case 0x1E: // SSWCI
+			h.gs.singleWidthCutIn = h.pop()
+		case 0x1F: // SSW
+			h.gs.singleWidth = h.scaleValue(h.pop())
+		case 0x20: // DUP
+			v := h.pop()
+			h.push(v)
+			h.push(v)
+		case 0x21: // POP
+			h.pop()
+		case 0x22: // CLEAR
+			h.stack = h.stack[:0]
+		case 0x23: // SWAP
+			b, a := h.pop(), h.pop()
+			h.push(b)
+			h.push(a)
+		case 0x24: // DEPTH
+			h.push(int32(len(h.stack)))
+		case 0x25, 0x26: // CINDEX, MINDEX
+			k := int(h.pop())
+			if k <= 0 || len(h.stack) < k {
+				return fmt.Errorf("bad stack index %v", k)
+			}
+			i := len(h.stack) - k
+			v := h.stack[i]
+			if op == 0x26 {
+				h.stack = append(h.stack[:i], h.stack[i+1:]...)
+			}
+			h.push(v)
+		case 0x27: // ALIGNPTS
+			p2, p1 := h.pop(), h.pop()
+			d := h.project(*h.cur(0, p2), *h.cur(1, p1)) / 2
+			h.move(1, p1, d, true)
+			h.move(0, p2, -d, true)
+		case 0x29: // UTP
+			p := h.pop()
+			if h.valid(0, p) {
+				if h.gs.fv.X != 0.0 {
+					h.zone(0).touched[p] &^= hintTouchedX
+				}
+				if h.gs.fv.Y != 0.0 {
+					h.zone(0).touched[p] &^= hintTouchedY
+				}
+			}
+		case 0x2A, 0x2B: // LOOPCALL, CALL
+			f := h.pop()
+			count := int32(1)
+			if op == 0x2A {
+				count = h.pop()
+			}
+			function, ok := h.functions[f]
+			if !ok {
+				return fmt.Errorf("undefined function %v", f)
+			}
+			for ; 0 < count; count-- {
+				if err := h.call(function); err != nil {
+					return err
+				}
+			}
+		case 0x2C: // FDEF
+			f := h.pop()
+			start := pc
+			var err error
+			if pc, err = hintSkip(code, pc, true, false); err != nil {
+				return err
+			}
+			h.functions[f] = code[start : pc-1]
+		case 0x2D: // ENDF
+			return fmt.Errorf("unexpected ENDF")
+		case 0x2E, 0x2F: // MDAP
+			p := h.pop()
+			d := int32(0)
+			if op == 0x2F {
+				cur := h.project(*h.cur(0, p), hintPoint{})
+				d = h.round(cur) - cur
+			}
+			h.move(0, p, d, true)
+			h.gs.rp[0], h.gs.rp[1] = p, p
+		case 0x30, 0x31: // IUP
+			if op == 0x31 {
+				h.iup(hintTouchedX)
+			} else {
+				h.iup(hintTouchedY)
+			}
+		case 0x32, 0x33: // SHP
+			_, _, dx, dy := h.displacement(op)
+			for h.nextLoop() {
+				h.shift(2, h.pop(), dx, dy, true)
+			}
+		case 0x34, 0x35: // SHC
+			c := h.pop()
+			zp, rp, dx, dy := h.displacement(op)
+			z := h.zone(2)
+			if c < 0 || len(z.endPoints) <= int(c) {
+				return fmt.Errorf("bad contour %v", c)
+			}
+			start := int32(0)
+			if 0 < c {
+				start = int32(z.endPoints[c-1]) + 1
+			}
+			for i := start; i <= int32(z.endPoints[c]); i++ {
+				if i != rp || h.gs.zp[zp] != h.gs.zp[2] {
+					h.shift(2, i, dx, dy, true)
+				}
+			}
+		case 0x36, 0x37: // SHZ
+			e := h.pop()
+			if e != 0 && e != 1 {
+				return fmt.Errorf("bad zone %v", e)
+			}
+			zp, rp, dx, dy := h.displacement(op)
+			zp2 := h.gs.zp[2]
+			h.gs.zp[2] = e
+			n := len(h.zones[e].cur)
+			if e == 1 {
+				n -= 4 // phantom points
+			}
+			for i := int32(0); i < int32(n); i++ {
+				if i != rp || h.gs.zp[zp] != e {
+					h.shift(2, i, dx, dy, false)
+				}
+			}
+			h.gs.zp[2] = zp2
+		case 0x38: // SHPIX
+			d := float64(h.pop())
+			for h.nextLoop() {
+				h.shift(2, h.pop(), d*h.gs.fv.X, d*h.gs.fv.Y, true)
+			}
+		case 0x39: // IP
+			rp1, rp2 := h.gs.rp[1], h.gs.rp[2]
+			origRange := h.origDistance(1, rp2, 0, rp1)
+			curRange := h.project(*h.cur(1, rp2), *h.cur(0, rp1))
+			for h.nextLoop() {
+				p := h.pop()
+				origDist := h.origDistance(2, p, 0, rp1)
+				curDist := h.project(*h.cur(2, p), *h.cur(0, rp1))
+				newDist := origDist
+				if origRange != 0 {
+					newDist = int32(math.Round(float64(origDist) * float64(curRange) / float64(origRange)))
+				}
+				h.move(2, p, newDist-curDist, true)
+			}
+		case 0x3A, 0x3B: // MSIRP
+			d, p := h.pop(), h.pop()
+			rp0 := h.gs.rp[0]
+			if h.gs.zp[1] == 0 && h.valid(1, p) {
+				ref := *h.orig(0, rp0)
+				q := hintPoint{ref.X + int32(math.Round(float64(d)*h.gs.fv.X)), ref.Y + int32(math.Round(float64(d)*h.gs.fv.Y))}
+				*h.orig(1, p), *h.cur(1, p) = q, q
+			}
+			curDist := h.project(*h.cur(1, p), *h.cur(0, rp0))
+			h.move(1, p, d-curDist, true)
+			h.gs.rp[1], h.gs.rp[2] = rp0, p
+			if op == 0x3B {
+				h.gs.rp[0] = p
+			}
+		case 0x3C: // ALIGNRP
+			rp0 := h.gs.rp[0]
+			for h.nextLoop() {
+				p := h.pop()
+				h.move(1, p, -h.project(*h.cur(1, p), *h.cur(0, rp0)), true)
+			}
+		case 0x3D: // RTDG
+			h.gs.round = hintRoundToDoubleGrid
+		case 0x3E, 0x3F: // MIAP
+			n, p := h.pop(), h.pop()
+			if n < 0 || len(h.cvt) <= int(n) {
+				return fmt.Errorf("bad control value %v", n)
+			}
+			d := h.cvt[n]
+			if h.gs.zp[0] == 0 && h.valid(0, p) {
+				q := hintPoint{int32(math.Round(float64(d) * h.gs.fv.X)), int32(math.Round(float64(d) * h.gs.fv.Y))}
+				*h.orig(0, p), *h.cur(0, p) = q, q
+			}
+			origDist := h.project(*h.cur(0, p), hintPoint{})
+			if op == 0x3F {
+				if h.gs.cvtCutIn < hintAbs(d-origDist) {
+					d = origDist
+				}
+				d = h.round(d)
+			}
+			h.move(0, p, d-origDist, true)
+			h.gs.rp[0], h.gs.rp[1] = p, p
+		case 0x40, 0x41, 0xB0, 0xB1, 0xB2, 0xB3, 0xB4, 0xB5, 0xB6, 0xB7, 0xB8, 0xB9, 0xBA, 0xBB, 0xBC, 0xBD, 0xBE, 0xBF: // NPUSHB, NPUSHW, PUSHB, PUSHW
+			data := code[opPC+1 : pc]
+			if op == 0x40 || op == 0x41 {
+				data = data[1:]
+			}
+			if op == 0x40 || 0xB0 <= op && op <= 0xB7 {
+				for _, v := range data {
+					h.push(int32(v))
+				}
+			} else {
+				for i := 0; i+1 < len(data); i += 2 {
+					h.push(int32(int16(binary.BigEndian.Uint16(data[i:]))))
+				}
+			}
+		case 0x42: // WS
+			v, i := h.pop(), h.pop()
+			if 0 <= i && int(i) < len(h.storage) {
+				h.storage[i] = v
+			}
+		case 0x43: // RS
+			i := h.pop()
+			v := int32(0)
+			if 0 <= i && int(i) < len(h.storage) {
+				v = h.storage[i]
+			}
+			h.push(v)
+		case 0x44, 0x70: // WCVTP, WCVTF
+			v, i := h.pop(), h.pop()
+			if op == 0x70 {
+				v = h.scaleValue(v)
+			}
+			if 0 <= i && int(i) < len(h.cvt) {
+				h.cvt[i] = v
+			}
+		case 0x45: // RCVT
+			i := h.pop()
+			v := int32(0)
+			if 0 <= i && int(i) < len(h.cvt) {
+				v = h.cvt[i]
+			}
+			h.push(v)
+		case 0x46, 0x47: // GC
+			p := h.pop()
+			if op == 0x46 {
+				h.push(h.project(*h.cur(2, p), hintPoint{}))
+			} else {
+				h.push(h.dualProject(*h.orig(2, p), hintPoint{}))
+			}
+		case 0x48: // SCFS
+			k, p := h.pop(), h.pop()
+			h.move(2, p, k-h.project(*h.cur(2, p), hintPoint{}), true)
+			if h.gs.zp[2] == 0 {
+				*h.orig(2, p) = *h.cur(2, p)
+			}
+		case 0x49, 0x4A: // MD
+			p2, p1 := h.pop(), h.pop()
+			if op == 0x49 {
+				h.push(h.project(*h.cur(0, p1), *h.cur(1, p2)))
+			} else {
+				h.push(h.origDistance(0, p1, 1, p2))
+			}
+		case 0x4B, 0x4C: // MPPEM, MPS
+			h.push(int32(h.ppem))
+		case 0x4D: // FLIPON
+			h.gs.autoFlip = true
+		case 0x4E: // FLIPOFF
+			h.gs.autoFlip = false
+		case 0x4F: // DEBUG
+			h.pop()
+		case 0x50, 0x51, 0x52, 0x53, 0x54, 0x55: // LT, LTEQ, GT, GTEQ, EQ, NEQ
+			b, a := h.pop(), h.pop()
+			var v bool
+			switch op {
+			case 0x50:
+				v = a < b
+			case 0x51:
+				v = a <= b
+			case 0x52:
+				v = a > b
+			case 0x53:
+				v = a >= b
+			case 0x54:
+				v = a == b
+			case 0x55:
+				v = a != b
+			}
+			h.push(hintBool(v))
+		case 0x56, 0x57: // ODD, EVEN
+			v := h.round(h.pop())&127 == 64
+			h.push(hintBool(v == (op == 0x56)))
+		case 0x58: // IF
+			if h.pop() == 0 {
+				var err error
+				if pc, err = hintSkip(code, pc, false, true); err != nil {
+					return err
+				}
+			}
+		case 0x59: // EIF
+		case 0x5A: // AND
+			b, a := h.pop(), h.pop()
+			h.push(hintBool(a != 0 && b != 0))
+		case 0x5B: // OR
+			b, a := h.pop(), h.pop()
+			h.push(hintBool(a != 0 || b != 0))
+		case 0x5C: // NOT
+			h.push(hintBool(h.pop() == 0))
+		case 0x5D, 0x71, 0x72, 0x73, 0x74, 0x75: // DELTAP1, DELTAP2, DELTAP3, DELTAC1, DELTAC2, DELTAC3
+			var base int32
+			switch op {
+			case 0x71, 0x74:
+				base = 16
+			case 0x72, 0x75:
+				base = 32
+			}
+			n := h.pop()
+			for ; 0 < n; n-- {
+				i, arg := h.pop(), h.pop()
+				if h.gs.deltaBase+base+((arg>>4)&0x0F) != int32(h.ppem) {
+					continue
+				}
+				step := arg&0x0F - 8
+				if 0 <= step {
+					step++
+				}
+				d := step * 64 / (1 << uint(h.gs.deltaShift))
+				if op < 0x73 {
+					h.move(0, i, d, true)
+				} else if 0 <= i && int(i) < len(h.cvt) {
+					h.cvt[i] += d
+				}
+			}
+		case 0x5E: // SDB
+			h.gs.deltaBase = h.pop()
+		case 0x5F: // SDS
+			h.gs.deltaShift = h.pop()
+			if h.gs.deltaShift < 0 || 6 < h.gs.deltaShift {
+				return fmt.Errorf("bad delta shift %v", h.gs.deltaShift)
+			}
+		case 0x60: // ADD
+			b, a := h.pop(), h.pop()
+			h.push(a + b)
+		case 0x61: // SUB
+			b, a := h.pop(), h.pop()
+			h.push(a - b)
+		case 0x62: // DIV
+			b, a := h.pop(), h.pop()
+			if b == 0 {
+				return fmt.Errorf("division by zero")
+			}
+			h.push(int32(int64(a) * 64 / int64(b)))
+		case 0x63: // MUL
+			b, a := h.pop(), h.pop()
+			h.push(int32(int64(a) * int64(b) / 64))
+		case 0x64: // ABS
+			h.push(hintAbs(h.pop()))
+		case 0x65: // NEG
+			h.push(-h.pop())
+		case 0x66: // FLOOR
+			h.push(h.pop() &^ 63)
+		case 0x67: // CEILING
+			h.push((h.pop() + 63) &^ 63)
+		case 0x68, 0x69, 0x6A, 0x6B: // ROUND
+			h.push(h.round(h.pop()))
+		case 0x6C, 0x6D, 0x6E, 0x6F: // NROUND
+			// no engine compensation, the value is left on the stack
+		case 0x76, 0x77: // SROUND, S45ROUND
+			gridPeriod := int32(64)
+			if op == 0x77 {
+				gridPeriod = 45 // 64/sqrt(2)
+			}
+			h.superRound(h.pop(), gridPeriod)
+		case 0x78, 0x79: // JROT, JROF
+			e, offset := h.pop(), h.pop()
+			if (e != 0) == (op == 0x78) {
+				pc = opPC + int(offset)
+			}
+		case 0x7A: // ROFF
+			h.gs.round = hintRoundOff
+		case 0x7C: // RUTG
+			h.gs.round = hintRoundUpToGrid
+		case 0x7D: // RDTG
+			h.gs.round = hintRoundDownToGrid
+		case 0x7E, 0x7F: // SANGW, AA
+			h.pop()
+		case 0x80: // FLIPPT
+			for h.nextLoop() {
+				p := h.pop()
+				if h.valid(0, p) {
+					h.zone(0).onCurve[p] = !h.zone(0).onCurve[p]
+				}
+			}
+		case 0x81, 0x82: // FLIPRGON, FLIPRGOFF
+			hi, lo := h.pop(), h.pop()
+			for p := lo; p <= hi; p++ {
+				if h.valid(0, p) {
+					h.zone(0).onCurve[p] = op == 0x81
+				}
+			}
+		case 0x85: // SCANCTRL
+			h.pop()
+		case 0x86, 0x87: // SDPVTL
+			p2, p1 := h.pop(), h.pop()
+			h.gs.pv = h.vectorFromLine(p1, p2, op == 0x87, false)
+			h.gs.dv = h.vectorFromLine(p1, p2, op == 0x87, true)
+		case 0x88: // GETINFO
+			selector := h.pop()
+			v := int32(0)
+			if selector&0x01 != 0 {
+				v |= 35 // FreeType's v35 interpreter
+			}
+			if selector&0x20 != 0 {
+				v |= 1 << 12 // grayscale rendering
+			}
+			h.push(v)
+		case 0x89: // IDEF
+			i := h.pop()
+			start := pc
+			var err error
+			if pc, err = hintSkip(code, pc, true, false); err != nil {
+				return err
+			}
+			h.idefs[uint8(i)] = code[start : pc-1]
+		case 0x8A: // ROLL
+			c, b, a := h.pop(), h.pop(), h.pop()
+			h.push(b)
+			h.push(c)
+			h.push(a)
+		case 0x8B: // MAX
+			b, a := h.pop(), h.pop()
+			if a < b {
+				a = b
+			}
+			h.push(a)
+		case 0x8C: // MIN
+			b, a := h.pop(), h.pop()
+			if b < a {
+				a = b
+			}
+			h.push(a)
+		case 0x8D: // SCANTYPE
+			h.pop()
+		case 0x8E: // INSTCTRL
+			s, v := h.pop(), h.pop()
+			if 1 <= s && s <= 3 {
+				mask := int32(1) << uint(s-1)
+				h.gs.instructControl = h.gs.instructControl&^mask | v&mask
+			}
+		default:
+			if 0xC0 <= op { // MDRP, MIRP
+				h.mirp(op)
+			} else if function, ok := h.idefs[op]; ok {
+				if err := h.call(function); err != nil {
+					return err
+				}
+			} else {
+				return fmt.Errorf("unknown instruction 0x%02X", op)
+			}
+		}
+		if h.err != nil {
+			return h.err
+		}
+	}
+	return nil
+}
+
+// mirp executes the MDRP (0xC0-0xDF) and MIRP (0xE0-0xFF) instructions, which move a point relative to reference point rp0 by its original distance or by a control value respectively.
+func (h *hinter) mirp(op byte) {
+	indirect := op&0x20 != 0
+	var cvt int32
+	if indirect {
+		n := h.pop()
+		if 0 <= n && int(n) < len(h.cvt) {
+			cvt = h.cvt[n]
+		}
+	}
+	p := h.pop()
+	rp0 := h.gs.rp[0]
+
+	if indirect {
+		if hintAbs(cvt-h.gs.singleWidth) < h.gs.singleWidthCutIn {
+			if cvt < 0 {
+				cvt = -h.gs.singleWidth
+			} else {
+				cvt = h.gs.singleWidth
+			}
+		}
+		if h.gs.zp[1] == 0 && h.valid(1, p) {
+			ref := *h.orig(0, rp0)
+			q := hintPoint{ref.X + int32(math.Round(float64(cvt)*h.gs.fv.X)), ref.Y + int32(math.Round(float64(cvt)*h.gs.fv.Y))}
+			*h.orig(1, p), *h.cur(1, p) = q, q
+		}
+	}
+
+	origDist := h.dualProject(*h.orig(1, p), *h.orig(0, rp0))
+	if !indirect {
+		origDist = h.origDistance(1, p, 0, rp0)
+	}
+	curDist := h.project(*h.cur(1, p), *h.cur(0, rp0))
+
+	d := origDist
+	if indirect {
+		d = cvt
+		if h.gs.autoFlip && (origDist^cvt) < 0 {
+			d = -d
+		}
+	} else if hintAbs(d-h.gs.singleWidth) < h.gs.singleWidthCutIn {
+		if d < 0 {
+			d = -h.gs.singleWidth
+		} else {
+			d = h.gs.singleWidth
+		}
+	}
+	if op&0x04 != 0 { // round
+		if indirect && h.gs.zp[0] == h.gs.zp[1] && h.gs.cvtCutIn < hintAbs(d-origDist) {
+			d = origDist
+		}
+		d = h.round(d)
+	}
+	if op&0x08 != 0 { // keep minimum distance
+		if 0 <= origDist {
+			if d < h.gs.minDist {
+				d = h.gs.minDist
+			}
+		} else if -h.gs.minDist < d {
+			d = -h.gs.minDist
+		}
+	}
+	h.move(1, p, d-curDist, true)
+
+	h.gs.rp[1], h.gs.rp[2] = rp0, p
+	if op&0x10 != 0 {
+		h.gs.rp[0] = p
+	}
+}
+
+// hintMulDiv returns x*y/z rounded to the nearest integer.
+func hintMulDiv(x, y, z int64) int64 {
+	xy := x * y
+	if z < 0 {
+		xy, z = -xy, -z
+	}
+	if 0 <= xy {
+		xy += z / 2
+	} else {
+		xy -= z / 2
+	}
+	return xy / z
+}
+
+func hintAbs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func hintBool(v bool) int32 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// hintedGlyphPath draws the glyph's contour after executing its TrueType instructions for the given ppem. It returns false if the instructions fail, in which case the glyph should be drawn unhinted.
+func (sfnt *SFNT) hintedGlyphPath(p Pather, glyphID, ppem uint16, x, y, scale float64) bool {
+	sfnt.hinterOnce.Do(func() {
+		var h *hinter
+		if h, sfnt.hinterErr = newHinter(sfnt); sfnt.hinterErr == nil {
+			sfnt.hinterPool.Put(h)
+		}
+	})
+	if sfnt.hinterErr != nil {
+		return false
+	}
+
+	// every caller executes the instructions with its own hinter state
+	h, _ := sfnt.hinterPool.Get().(*hinter)
+	if h == nil {
+		var err error
+		if h, err = newHinter(sfnt); err != nil {
+			return false
+		}
+	}
+	defer sfnt.hinterPool.Put(h)
+	if err := h.setPPEM(ppem); err != nil {
+		return false
+	}
+
+	z, err := h.glyph(glyphID, 0)
+	if err != nil {
+		return false
+	}
+
+	// the hinted origin is the first phantom point
+	n := len(z.cur) - 4
+	origin := z.cur[n]
+	xs, ys := make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		xs[i] = float64(z.cur[i].X-origin.X) / h.scale
+		ys[i] = float64(z.cur[i].Y) / h.scale
+	}
+	glyfPath(p, z.endPoints, z.onCurve[:n], xs, ys, x, y, scale)
+	return true
+}
@@ -1,6 +1,9 @@
 package font
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type langSys struct {
 	requiredFeatureIndex uint16
@@ -169,7 +172,7 @@ type coverageFormat1 struct {
 
 func (table *coverageFormat1) Index(glyphID uint16) (uint16, bool) {
 	for i, coverageGlyphID := range table.glyphArray {
-		if coverageGlyphID < glyphID {
+		if glyphID < coverageGlyphID {
 			break
 		} else if coverageGlyphID == glyphID {
 			return uint16(i), true
@@ -186,9 +189,9 @@ type coverageFormat2 struct {
 
 func (table *coverageFormat2) Index(glyphID uint16) (uint16, bool) {
 	for i := 0; i < len(table.startGlyphID); i++ {
-		if table.endGlyphID[i] < glyphID {
+		if glyphID < table.startGlyphID[i] {
 			break
-		} else if table.startGlyphID[i] <= glyphID {
+		} else if glyphID <= table.endGlyphID[i] {
 			return table.startCoverageIndex[i] + glyphID - table.startGlyphID[i], true
 		}
 	}
@@ -759,6 +762,22 @@ func (table *gposgsubTable) GetLookups(script ScriptTag, language LanguageTag, f
 	return tables, nil
 }
 
+// Features returns the lookup indices of each feature of the table in increasing order, combined for all scripts and languages.
+func (table *gposgsubTable) Features() map[FeatureTag][]uint16 {
+	features := map[FeatureTag][]uint16{}
+	for i, tag := range table.featureList.tag {
+		lookups := features[tag]
+		for _, lookup := range table.featureList.feature[i] {
+			j := sort.Search(len(lookups), func(j int) bool { return lookup <= lookups[j] })
+			if j == len(lookups) || lookups[j] != lookup {
+				lookups = append(lookups[:j], append([]uint16{lookup}, lookups[j:]...)...)
+			}
+		}
+		features[tag] = lookups
+	}
+	return features
+}
+
 type subtableMap map[uint16]func([]byte) (interface{}, error)
 
 func (sfnt *SFNT) parseGPOS() error {
@@ -875,3 +894,127 @@ func (sfnt *SFNT) parseJSFT() error {
 	// TODO
 	return nil
 }
+
+////////////////////////////////////////////////////////////////
+
+// BaseScript holds the baseline coordinates of a script.
+type BaseScript struct {
+	DefaultBaseline string           // baseline tag such as romn, hang, ideo, ...
+	Coords          map[string]int16 // baseline tag to coordinate in font units
+}
+
+type baseAxis map[ScriptTag]*BaseScript
+
+type baseTable struct {
+	Horiz, Vert baseAxis // can be nil
+}
+
+// Get returns the baseline coordinates for the given script for the horizontal or vertical axis. It returns false if the script is not defined.
+func (base *baseTable) Get(script ScriptTag, vertical bool) (*BaseScript, bool) {
+	axis := base.Horiz
+	if vertical {
+		axis = base.Vert
+	}
+	baseScript, ok := axis[script]
+	return baseScript, ok
+}
+
+func (sfnt *SFNT) parseBaseAxis(b []byte) (baseAxis, error) {
+	r := NewBinaryReader(b)
+	baseTagListOffset := r.ReadUint16()
+	baseScriptListOffset := r.ReadUint16()
+	if baseTagListOffset == 0 || baseScriptListOffset == 0 {
+		return nil, nil
+	}
+
+	r.Seek(uint32(baseTagListOffset))
+	baseTagCount := r.ReadUint16()
+	baselineTags := make([]string, baseTagCount)
+	for i := 0; i < int(baseTagCount); i++ {
+		baselineTags[i] = r.ReadString(4)
+	}
+
+	r.Seek(uint32(baseScriptListOffset))
+	baseScriptCount := r.ReadUint16()
+	axis := make(baseAxis, baseScriptCount)
+	r2 := NewBinaryReader(b)
+	for i := 0; i < int(baseScriptCount); i++ {
+		baseScriptTag := ScriptTag(r.ReadString(4))
+		baseScriptOffset := uint32(baseScriptListOffset) + uint32(r.ReadUint16())
+
+		r2.Seek(baseScriptOffset)
+		baseValuesOffset := r2.ReadUint16()
+		if baseValuesOffset == 0 {
+			continue
+		}
+		// TODO: parse MinMax and BaseLangSys tables
+
+		baseValuesOffset32 := baseScriptOffset + uint32(baseValuesOffset)
+		r2.Seek(baseValuesOffset32)
+		defaultBaselineIndex := r2.ReadUint16()
+		baseCoordCount := r2.ReadUint16()
+		if int(defaultBaselineIndex) >= len(baselineTags) || int(baseCoordCount) != len(baselineTags) {
+			return nil, fmt.Errorf("bad baseline count")
+		}
+
+		baseScript := &BaseScript{
+			DefaultBaseline: baselineTags[defaultBaselineIndex],
+			Coords:          make(map[string]int16, baseCoordCount),
+		}
+		r3 := NewBinaryReader(b)
+		for j := 0; j < int(baseCoordCount); j++ {
+			baseCoordOffset := r2.ReadUint16()
+			r3.Seek(baseValuesOffset32 + uint32(baseCoordOffset))
+			baseCoordFormat := r3.ReadUint16()
+			if baseCoordFormat < 1 || 3 < baseCoordFormat {
+				return nil, fmt.Errorf("bad base coord format")
+			}
+			baseScript.Coords[baselineTags[j]] = r3.ReadInt16() // formats 2 and 3 add hinting data
+		}
+		if r2.EOF() || r3.EOF() {
+			return nil, fmt.Errorf("bad base script")
+		}
+		axis[baseScriptTag] = baseScript
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad base script list")
+	}
+	return axis, nil
+}
+
+func (sfnt *SFNT) parseBASE() error {
+	b, ok := sfnt.Tables["BASE"]
+	if !ok {
+		return fmt.Errorf("BASE: missing table")
+	} else if len(b) < 8 {
+		return fmt.Errorf("BASE: bad table")
+	}
+
+	r := NewBinaryReader(b)
+	majorVersion := r.ReadUint16()
+	minorVersion := r.ReadUint16()
+	if majorVersion != 1 || minorVersion != 0 && minorVersion != 1 {
+		return fmt.Errorf("BASE: bad version")
+	}
+	horizAxisOffset := r.ReadUint16()
+	vertAxisOffset := r.ReadUint16()
+	// TODO: item variation store for version 1.1
+
+	var err error
+	sfnt.Base = &baseTable{}
+	if horizAxisOffset != 0 {
+		if int(horizAxisOffset) >= len(b) {
+			return fmt.Errorf("BASE: bad horizontal axis offset")
+		} else if sfnt.Base.Horiz, err = sfnt.parseBaseAxis(b[horizAxisOffset:]); err != nil {
+			return fmt.Errorf("BASE: %w", err)
+		}
+	}
+	if vertAxisOffset != 0 {
+		if int(vertAxisOffset) >= len(b) {
+			return fmt.Errorf("BASE: bad vertical axis offset")
+		} else if sfnt.Base.Vert, err = sfnt.parseBaseAxis(b[vertAxisOffset:]); err != nil {
+			return fmt.Errorf("BASE: %w", err)
+		}
+	}
+	return nil
+}
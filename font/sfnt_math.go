@@ -0,0 +1,407 @@
+package font
+
+import (
+	"fmt"
+	"math"
+)
+
+// MathConstants holds the global constants of the MATH table used for positioning math elements, see https://learn.microsoft.com/en-us/typography/opentype/spec/math#mathconstants-table. All values are in font units except the percentages.
+type MathConstants struct {
+	ScriptPercentScaleDown                   int16
+	ScriptScriptPercentScaleDown             int16
+	DelimitedSubFormulaMinHeight             uint16
+	DisplayOperatorMinHeight                 uint16
+	MathLeading                              int16
+	AxisHeight                               int16
+	AccentBaseHeight                         int16
+	FlattenedAccentBaseHeight                int16
+	SubscriptShiftDown                       int16
+	SubscriptTopMax                          int16
+	SubscriptBaselineDropMin                 int16
+	SuperscriptShiftUp                       int16
+	SuperscriptShiftUpCramped                int16
+	SuperscriptBottomMin                     int16
+	SuperscriptBaselineDropMax               int16
+	SubSuperscriptGapMin                     int16
+	SuperscriptBottomMaxWithSubscript        int16
+	SpaceAfterScript                         int16
+	UpperLimitGapMin                         int16
+	UpperLimitBaselineRiseMin                int16
+	LowerLimitGapMin                         int16
+	LowerLimitBaselineDropMin                int16
+	StackTopShiftUp                          int16
+	StackTopDisplayStyleShiftUp              int16
+	StackBottomShiftDown                     int16
+	StackBottomDisplayStyleShiftDown         int16
+	StackGapMin                              int16
+	StackDisplayStyleGapMin                  int16
+	StretchStackTopShiftUp                   int16
+	StretchStackBottomShiftDown              int16
+	StretchStackGapAboveMin                  int16
+	StretchStackGapBelowMin                  int16
+	FractionNumeratorShiftUp                 int16
+	FractionNumeratorDisplayStyleShiftUp     int16
+	FractionDenominatorShiftDown             int16
+	FractionDenominatorDisplayStyleShiftDown int16
+	FractionNumeratorGapMin                  int16
+	FractionNumDisplayStyleGapMin            int16
+	FractionRuleThickness                    int16
+	FractionDenominatorGapMin                int16
+	FractionDenomDisplayStyleGapMin          int16
+	SkewedFractionHorizontalGap              int16
+	SkewedFractionVerticalGap                int16
+	OverbarVerticalGap                       int16
+	OverbarRuleThickness                     int16
+	OverbarExtraAscender                     int16
+	UnderbarVerticalGap                      int16
+	UnderbarRuleThickness                    int16
+	UnderbarExtraDescender                   int16
+	RadicalVerticalGap                       int16
+	RadicalDisplayStyleVerticalGap           int16
+	RadicalRuleThickness                     int16
+	RadicalExtraAscender                     int16
+	RadicalKernBeforeDegree                  int16
+	RadicalKernAfterDegree                   int16
+	RadicalDegreeBottomRaisePercent          int16
+}
+
+// MathGlyphVariant is a pre-designed larger version of a glyph and its advance along the direction of stretching.
+type MathGlyphVariant struct {
+	GlyphID uint16
+	Advance uint16
+}
+
+// MathGlyphPart is a part of a glyph assembly. Extenders may be repeated zero or more times to reach the desired size.
+type MathGlyphPart struct {
+	GlyphID              uint16
+	StartConnectorLength uint16
+	EndConnectorLength   uint16
+	FullAdvance          uint16
+	Extender             bool
+}
+
+// MathGlyphConstruction holds the variants and the glyph assembly of a stretchable glyph.
+type MathGlyphConstruction struct {
+	Variants          []MathGlyphVariant // in increasing size
+	ItalicsCorrection int16              // of the glyph assembly
+	Parts             []MathGlyphPart    // from bottom to top or from left to right, can be nil
+}
+
+// MathStretchedGlyph is a glyph of a stretched glyph with its offset along the direction of stretching in font units.
+type MathStretchedGlyph struct {
+	GlyphID uint16
+	Offset  int32
+}
+
+type mathTable struct {
+	Constants           MathConstants
+	MinConnectorOverlap uint16
+
+	italicsCorrection   map[uint16]int16
+	topAccentAttachment map[uint16]int16
+	extendedShape       coverageTable
+	vertConstruction    map[uint16]*MathGlyphConstruction
+	horizConstruction   map[uint16]*MathGlyphConstruction
+}
+
+// ItalicsCorrection returns the italics correction of a glyph. It returns false if the glyph has none.
+func (m *mathTable) ItalicsCorrection(glyphID uint16) (int16, bool) {
+	v, ok := m.italicsCorrection[glyphID]
+	return v, ok
+}
+
+// TopAccentAttachment returns the horizontal position where accents above the glyph should be centered. It returns false if the glyph has none, in which case the accent should be centered on the glyph's advance.
+func (m *mathTable) TopAccentAttachment(glyphID uint16) (int16, bool) {
+	v, ok := m.topAccentAttachment[glyphID]
+	return v, ok
+}
+
+// IsExtendedShape returns true if the glyph is an extended shape, such as a tall delimiter, that needs special handling for the placement of scripts.
+func (m *mathTable) IsExtendedShape(glyphID uint16) bool {
+	if m.extendedShape == nil {
+		return false
+	}
+	_, ok := m.extendedShape.Index(glyphID)
+	return ok
+}
+
+// Construction returns the vertical or horizontal variants and glyph assembly of a glyph. It returns nil if the glyph is not stretchable in that direction.
+func (m *mathTable) Construction(glyphID uint16, vertical bool) *MathGlyphConstruction {
+	if vertical {
+		return m.vertConstruction[glyphID]
+	}
+	return m.horizConstruction[glyphID]
+}
+
+// Stretch returns the glyphs that together form a version of the given glyph of at least the given size in font units along the vertical or horizontal direction. It selects the smallest variant that is large enough or otherwise builds the glyph assembly by repeating the extenders, with glyph offsets from the bottom or left. The total size is returned as well, which may be smaller than requested if no variant or assembly is large enough.
+func (m *mathTable) Stretch(glyphID uint16, size int32, vertical bool) ([]MathStretchedGlyph, int32) {
+	construction := m.Construction(glyphID, vertical)
+	if construction == nil {
+		return []MathStretchedGlyph{{glyphID, 0}}, 0
+	}
+
+	variant := MathGlyphVariant{glyphID, 0}
+	for _, variant = range construction.Variants {
+		if size <= int32(variant.Advance) {
+			return []MathStretchedGlyph{{variant.GlyphID, 0}}, int32(variant.Advance)
+		}
+	}
+	if len(construction.Parts) == 0 {
+		return []MathStretchedGlyph{{variant.GlyphID, 0}}, int32(variant.Advance)
+	}
+
+	// find the minimum number of extender repetitions so that the assembly is large enough when using the minimum connector overlap
+	hasExtenders := false
+	for _, part := range construction.Parts {
+		if part.Extender {
+			hasExtenders = true
+		}
+	}
+	parts := construction.Parts
+	if hasExtenders {
+		for repeat := 1; ; repeat++ {
+			parts = parts[:0:0]
+			for _, part := range construction.Parts {
+				n := 1
+				if part.Extender {
+					n = repeat
+				}
+				for i := 0; i < n; i++ {
+					parts = append(parts, part)
+				}
+			}
+			if max, _ := m.assemblySize(parts); size <= max || 1000 < len(parts) {
+				break
+			}
+		}
+	}
+
+	// distribute the excess size over the connector overlaps
+	max, flex := m.assemblySize(parts)
+	t := 0.0
+	if size < max && 0 < flex {
+		t = math.Min(1.0, float64(max-size)/float64(flex))
+	}
+
+	glyphs := make([]MathStretchedGlyph, 0, len(parts))
+	offset := int32(0)
+	for i, part := range parts {
+		if 0 < i {
+			minOverlap, maxOverlap := m.connectorOverlap(parts[i-1], part)
+			offset -= minOverlap + int32(t*float64(maxOverlap-minOverlap)+0.5)
+		}
+		glyphs = append(glyphs, MathStretchedGlyph{part.GlyphID, offset})
+		offset += int32(part.FullAdvance)
+	}
+	return glyphs, offset
+}
+
+// connectorOverlap returns the minimum and maximum overlap between two consecutive parts.
+func (m *mathTable) connectorOverlap(a, b MathGlyphPart) (int32, int32) {
+	maxOverlap := int32(a.EndConnectorLength)
+	if int32(b.StartConnectorLength) < maxOverlap {
+		maxOverlap = int32(b.StartConnectorLength)
+	}
+	minOverlap := int32(m.MinConnectorOverlap)
+	if maxOverlap < minOverlap {
+		minOverlap = maxOverlap
+	}
+	return minOverlap, maxOverlap
+}
+
+// assemblySize returns the maximum size of the assembled parts and how much it can shrink by increasing the overlaps.
+func (m *mathTable) assemblySize(parts []MathGlyphPart) (int32, int32) {
+	size, flex := int32(0), int32(0)
+	for i, part := range parts {
+		size += int32(part.FullAdvance)
+		if 0 < i {
+			minOverlap, maxOverlap := m.connectorOverlap(parts[i-1], part)
+			size -= minOverlap
+			flex += maxOverlap - minOverlap
+		}
+	}
+	return size, flex
+}
+
+func (sfnt *SFNT) parseMathValueRecords(b []byte) (map[uint16]int16, error) {
+	r := NewBinaryReader(b)
+	coverageOffset := r.ReadUint16()
+	count := r.ReadUint16()
+	if int(coverageOffset) >= len(b) {
+		return nil, fmt.Errorf("bad coverage offset")
+	}
+	coverage, err := sfnt.parseCoverageTable(b[coverageOffset:])
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]int16, count)
+	for i := 0; i < int(count); i++ {
+		values[i] = r.ReadInt16()
+		_ = r.ReadUint16() // device table offset
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad math value records")
+	}
+
+	// map glyph IDs to the values using the coverage table
+	records := make(map[uint16]int16, count)
+	for glyphID := uint16(0); glyphID < sfnt.NumGlyphs(); glyphID++ {
+		if i, ok := coverage.Index(glyphID); ok && int(i) < len(values) {
+			records[glyphID] = values[i]
+		}
+	}
+	return records, nil
+}
+
+func (sfnt *SFNT) parseMathGlyphConstructions(b []byte, coverageOffset uint16, offsets []uint16) (map[uint16]*MathGlyphConstruction, error) {
+	if coverageOffset == 0 {
+		return nil, nil
+	} else if int(coverageOffset) >= len(b) {
+		return nil, fmt.Errorf("bad coverage offset")
+	}
+	coverage, err := sfnt.parseCoverageTable(b[coverageOffset:])
+	if err != nil {
+		return nil, err
+	}
+
+	constructions := make([]*MathGlyphConstruction, len(offsets))
+	for i, offset := range offsets {
+		r := NewBinaryReader(b)
+		r.Seek(uint32(offset))
+		glyphAssemblyOffset := r.ReadUint16()
+		variantCount := r.ReadUint16()
+		construction := &MathGlyphConstruction{
+			Variants: make([]MathGlyphVariant, variantCount),
+		}
+		for j := 0; j < int(variantCount); j++ {
+			construction.Variants[j].GlyphID = r.ReadUint16()
+			construction.Variants[j].Advance = r.ReadUint16()
+		}
+		if glyphAssemblyOffset != 0 {
+			r.Seek(uint32(offset) + uint32(glyphAssemblyOffset))
+			construction.ItalicsCorrection = r.ReadInt16()
+			_ = r.ReadUint16() // device table offset
+			partCount := r.ReadUint16()
+			construction.Parts = make([]MathGlyphPart, partCount)
+			for j := 0; j < int(partCount); j++ {
+				construction.Parts[j].GlyphID = r.ReadUint16()
+				construction.Parts[j].StartConnectorLength = r.ReadUint16()
+				construction.Parts[j].EndConnectorLength = r.ReadUint16()
+				construction.Parts[j].FullAdvance = r.ReadUint16()
+				construction.Parts[j].Extender = r.ReadUint16()&0x0001 != 0
+			}
+		}
+		if r.EOF() {
+			return nil, fmt.Errorf("bad glyph construction")
+		}
+		constructions[i] = construction
+	}
+
+	m := make(map[uint16]*MathGlyphConstruction, len(constructions))
+	for glyphID := uint16(0); glyphID < sfnt.NumGlyphs(); glyphID++ {
+		if i, ok := coverage.Index(glyphID); ok && int(i) < len(constructions) {
+			m[glyphID] = constructions[i]
+		}
+	}
+	return m, nil
+}
+
+func (sfnt *SFNT) parseMATH() error {
+	b, ok := sfnt.Tables["MATH"]
+	if !ok {
+		return fmt.Errorf("MATH: missing table")
+	} else if len(b) < 10 {
+		return fmt.Errorf("MATH: bad table")
+	}
+
+	r := NewBinaryReader(b)
+	majorVersion := r.ReadUint16()
+	minorVersion := r.ReadUint16()
+	if majorVersion != 1 || minorVersion != 0 {
+		return fmt.Errorf("MATH: bad version")
+	}
+	mathConstantsOffset := r.ReadUint16()
+	mathGlyphInfoOffset := r.ReadUint16()
+	mathVariantsOffset := r.ReadUint16()
+	if int(mathConstantsOffset) >= len(b) || int(mathGlyphInfoOffset) >= len(b) || int(mathVariantsOffset) >= len(b) {
+		return fmt.Errorf("MATH: bad offset")
+	}
+
+	var err error
+	sfnt.Math = &mathTable{}
+
+	// MathConstants
+	c := &sfnt.Math.Constants
+	r.Seek(uint32(mathConstantsOffset))
+	c.ScriptPercentScaleDown = r.ReadInt16()
+	c.ScriptScriptPercentScaleDown = r.ReadInt16()
+	c.DelimitedSubFormulaMinHeight = r.ReadUint16()
+	c.DisplayOperatorMinHeight = r.ReadUint16()
+	for _, v := range []*int16{&c.MathLeading, &c.AxisHeight, &c.AccentBaseHeight, &c.FlattenedAccentBaseHeight, &c.SubscriptShiftDown, &c.SubscriptTopMax, &c.SubscriptBaselineDropMin, &c.SuperscriptShiftUp, &c.SuperscriptShiftUpCramped, &c.SuperscriptBottomMin, &c.SuperscriptBaselineDropMax, &c.SubSuperscriptGapMin, &c.SuperscriptBottomMaxWithSubscript, &c.SpaceAfterScript, &c.UpperLimitGapMin, &c.UpperLimitBaselineRiseMin, &c.LowerLimitGapMin, &c.LowerLimitBaselineDropMin, &c.StackTopShiftUp, &c.StackTopDisplayStyleShiftUp, &c.StackBottomShiftDown, &c.StackBottomDisplayStyleShiftDown, &c.StackGapMin, &c.StackDisplayStyleGapMin, &c.StretchStackTopShiftUp, &c.StretchStackBottomShiftDown, &c.StretchStackGapAboveMin, &c.StretchStackGapBelowMin, &c.FractionNumeratorShiftUp, &c.FractionNumeratorDisplayStyleShiftUp, &c.FractionDenominatorShiftDown, &c.FractionDenominatorDisplayStyleShiftDown, &c.FractionNumeratorGapMin, &c.FractionNumDisplayStyleGapMin, &c.FractionRuleThickness, &c.FractionDenominatorGapMin, &c.FractionDenomDisplayStyleGapMin, &c.SkewedFractionHorizontalGap, &c.SkewedFractionVerticalGap, &c.OverbarVerticalGap, &c.OverbarRuleThickness, &c.OverbarExtraAscender, &c.UnderbarVerticalGap, &c.UnderbarRuleThickness, &c.UnderbarExtraDescender, &c.RadicalVerticalGap, &c.RadicalDisplayStyleVerticalGap, &c.RadicalRuleThickness, &c.RadicalExtraAscender, &c.RadicalKernBeforeDegree, &c.RadicalKernAfterDegree} {
+		*v = r.ReadInt16()
+		_ = r.ReadUint16() // device table offset
+	}
+	c.RadicalDegreeBottomRaisePercent = r.ReadInt16()
+	if r.EOF() {
+		return fmt.Errorf("MATH: bad math constants")
+	}
+
+	// MathGlyphInfo
+	r.Seek(uint32(mathGlyphInfoOffset))
+	italicsCorrectionInfoOffset := r.ReadUint16()
+	topAccentAttachmentOffset := r.ReadUint16()
+	extendedShapeCoverageOffset := r.ReadUint16()
+	_ = r.ReadUint16() // TODO: MathKernInfo
+	if r.EOF() {
+		return fmt.Errorf("MATH: bad math glyph info")
+	}
+	bGlyphInfo := b[mathGlyphInfoOffset:]
+	if italicsCorrectionInfoOffset != 0 {
+		if int(italicsCorrectionInfoOffset) >= len(bGlyphInfo) {
+			return fmt.Errorf("MATH: bad italics correction info offset")
+		} else if sfnt.Math.italicsCorrection, err = sfnt.parseMathValueRecords(bGlyphInfo[italicsCorrectionInfoOffset:]); err != nil {
+			return fmt.Errorf("MATH: %w", err)
+		}
+	}
+	if topAccentAttachmentOffset != 0 {
+		if int(topAccentAttachmentOffset) >= len(bGlyphInfo) {
+			return fmt.Errorf("MATH: bad top accent attachment offset")
+		} else if sfnt.Math.topAccentAttachment, err = sfnt.parseMathValueRecords(bGlyphInfo[topAccentAttachmentOffset:]); err != nil {
+			return fmt.Errorf("MATH: %w", err)
+		}
+	}
+	if extendedShapeCoverageOffset != 0 {
+		if int(extendedShapeCoverageOffset) >= len(bGlyphInfo) {
+			return fmt.Errorf("MATH: bad extended shape coverage offset")
+		} else if sfnt.Math.extendedShape, err = sfnt.parseCoverageTable(bGlyphInfo[extendedShapeCoverageOffset:]); err != nil {
+			return fmt.Errorf("MATH: %w", err)
+		}
+	}
+
+	// MathVariants
+	r.Seek(uint32(mathVariantsOffset))
+	sfnt.Math.MinConnectorOverlap = r.ReadUint16()
+	vertGlyphCoverageOffset := r.ReadUint16()
+	horizGlyphCoverageOffset := r.ReadUint16()
+	vertGlyphCount := r.ReadUint16()
+	horizGlyphCount := r.ReadUint16()
+	vertGlyphConstructionOffsets := make([]uint16, vertGlyphCount)
+	for i := 0; i < int(vertGlyphCount); i++ {
+		vertGlyphConstructionOffsets[i] = r.ReadUint16()
+	}
+	horizGlyphConstructionOffsets := make([]uint16, horizGlyphCount)
+	for i := 0; i < int(horizGlyphCount); i++ {
+		horizGlyphConstructionOffsets[i] = r.ReadUint16()
+	}
+	if r.EOF() {
+		return fmt.Errorf("MATH: bad math variants")
+	}
+	bVariants := b[mathVariantsOffset:]
+	if sfnt.Math.vertConstruction, err = sfnt.parseMathGlyphConstructions(bVariants, vertGlyphCoverageOffset, vertGlyphConstructionOffsets); err != nil {
+		return fmt.Errorf("MATH: %w", err)
+	} else if sfnt.Math.horizConstruction, err = sfnt.parseMathGlyphConstructions(bVariants, horizGlyphCoverageOffset, horizGlyphConstructionOffsets); err != nil {
+		return fmt.Errorf("MATH: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package font
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MetricsTable contains the metrics of a font in font units, which suffices to lay out and measure text without the glyph outlines. This allows measuring text on a server using font metrics that were obtained separately.
+type MetricsTable struct {
+	UnitsPerEm                   uint16
+	Ascender, Descender, LineGap int16 // descender is negative
+	XHeight, CapHeight           int16
+	Advances                     map[rune]uint16 // advance widths per character
+	DefaultAdvance               uint16          // advance width of characters not in Advances
+}
+
+// NewSFNTFromMetrics returns a font from a metrics table that has no glyph outlines. Layout and measurement work as usual, but GlyphPath returns an error.
+func NewSFNTFromMetrics(metrics MetricsTable) (*SFNT, error) {
+	if metrics.UnitsPerEm == 0 {
+		return nil, fmt.Errorf("metrics: bad unitsPerEm")
+	} else if 0xFFFF <= len(metrics.Advances) {
+		return nil, fmt.Errorf("metrics: too many glyphs")
+	}
+
+	runes := make([]rune, 0, len(metrics.Advances))
+	for r := range metrics.Advances {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	// glyph zero is .notdef and the characters are numbered consecutively after it
+	cmap := &cmapFormat12{}
+	hmtx := &hmtxTable{
+		HMetrics: []hmtxLongHorMetric{{AdvanceWidth: metrics.DefaultAdvance}},
+	}
+	advanceMax := metrics.DefaultAdvance
+	for i, r := range runes {
+		glyphID := uint32(i + 1)
+		if n := len(cmap.StartCharCode); 0 < n && cmap.EndCharCode[n-1]+1 == uint32(r) && cmap.StartGlyphID[n-1]+uint32(r)-cmap.StartCharCode[n-1] == glyphID {
+			cmap.EndCharCode[n-1] = uint32(r)
+		} else {
+			cmap.StartCharCode = append(cmap.StartCharCode, uint32(r))
+			cmap.EndCharCode = append(cmap.EndCharCode, uint32(r))
+			cmap.StartGlyphID = append(cmap.StartGlyphID, glyphID)
+		}
+
+		advance := metrics.Advances[r]
+		hmtx.HMetrics = append(hmtx.HMetrics, hmtxLongHorMetric{AdvanceWidth: advance})
+		if advanceMax < advance {
+			advanceMax = advance
+		}
+	}
+	numGlyphs := uint16(len(hmtx.HMetrics))
+
+	sfnt := &SFNT{
+		Tables: map[string][]byte{},
+		Cmap: &cmapTable{
+			EncodingRecords: []cmapEncodingRecord{{PlatformID: 3, EncodingID: 10, Format: 12}},
+			Subtables:       []cmapSubtable{cmap},
+		},
+		Head: &headTable{
+			UnitsPerEm: metrics.UnitsPerEm,
+			YMin:       metrics.Descender,
+			XMax:       int16(advanceMax),
+			YMax:       metrics.Ascender,
+		},
+		Hhea: &hheaTable{
+			Ascender:         metrics.Ascender,
+			Descender:        metrics.Descender,
+			LineGap:          metrics.LineGap,
+			AdvanceWidthMax:  advanceMax,
+			NumberOfHMetrics: numGlyphs,
+		},
+		Hmtx: hmtx,
+		Maxp: &maxpTable{NumGlyphs: numGlyphs},
+		Name: &nameTable{},
+		OS2: &os2Table{
+			UsWeightClass: 400,
+			UsWidthClass:  5,
+			SxHeight:      metrics.XHeight,
+			SCapHeight:    metrics.CapHeight,
+		},
+		Post: &postTable{},
+	}
+	return sfnt, nil
+}
+
+// HasOutlines returns true if the font contains glyph outlines, which is false for fonts created from a metrics table.
+func (sfnt *SFNT) HasOutlines() bool {
+	return sfnt.IsTrueType || sfnt.IsCFF
+}
@@ -1,7 +1,12 @@
 package font
 
 import (
+	"image/color"
 	"io/ioutil"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/tdewolff/test"
@@ -28,6 +33,32 @@ func TestSFNTDejaVuSerifTTF(t *testing.T) {
 	test.Error(t, err)
 	test.T(t, contour.GlyphID, id)
 	test.T(t, len(contour.XCoordinates), 0)
+
+	test.T(t, sfnt.WeightClass(), 400)
+	test.T(t, sfnt.WidthClass(), 5)
+}
+
+func TestSFNTNames(t *testing.T) {
+	b, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	sfnt, err := ParseSFNT(b, 0)
+	test.Error(t, err)
+
+	names := sfnt.Names()
+	test.T(t, len(names), 26)
+	test.T(t, names[1], NameRecord{Platform: PlatformMacintosh, Encoding: EncodingMacintoshRoman, Language: 0, Name: NameFontFamily, Value: "DejaVu Serif"})
+	test.T(t, names[19], NameRecord{Platform: PlatformWindows, Encoding: EncodingWindowsUnicodeBMP, Language: 0x0409, Name: NamePostScript, Value: "DejaVuSerif"}) // UTF-16BE
+
+	name, ok := sfnt.FindName(NamePostScript, 0x0409)
+	test.That(t, ok)
+	test.T(t, name, "DejaVuSerif")
+	name, _ = sfnt.FindName(NameFontFamily, 0x0407) // falls back to English
+	test.T(t, name, "DejaVu Serif")
+	name, _ = sfnt.FindName(NameFontSubfamily, 0x0409)
+	test.T(t, name, "Book")
+	_, ok = sfnt.FindName(NameDesigner, 0x0409)
+	test.That(t, !ok)
 }
 
 func TestSFNTWrite(t *testing.T) {
@@ -68,3 +99,384 @@ func TestSFNTSubset(t *testing.T) {
 
 	//ioutil.WriteFile("out.otf", subset, 0644)
 }
+
+func TestSFNTCoverageTable(t *testing.T) {
+	sfnt := &SFNT{}
+	var tests = []struct {
+		b     []byte
+		index map[uint16]uint16
+		miss  []uint16
+	}{
+		{[]byte{0, 1, 0, 3, 0, 3, 0, 5, 0, 7}, map[uint16]uint16{3: 0, 5: 1, 7: 2}, []uint16{2, 4, 8}},
+		{[]byte{0, 2, 0, 2, 0, 3, 0, 5, 0, 0, 0, 10, 0, 12, 0, 3}, map[uint16]uint16{3: 0, 5: 2, 10: 3, 12: 5}, []uint16{2, 6, 9, 13}},
+	}
+	for _, tt := range tests {
+		coverage, err := sfnt.parseCoverageTable(tt.b)
+		test.Error(t, err)
+		for glyphID, index := range tt.index {
+			i, ok := coverage.Index(glyphID)
+			test.That(t, ok, glyphID)
+			test.T(t, i, index, glyphID)
+		}
+		for _, glyphID := range tt.miss {
+			_, ok := coverage.Index(glyphID)
+			test.That(t, !ok, glyphID)
+		}
+	}
+}
+
+func TestSFNTBase(t *testing.T) {
+	b, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	sfnt, err := ParseSFNT(b, 0)
+	test.Error(t, err)
+	test.That(t, sfnt.Base == nil)
+
+	// horizontal axis with hang and romn baselines for deva and latn
+	sfnt.Tables["BASE"], err = ioutil.ReadFile("../resources/BASE.bin")
+	test.Error(t, err)
+	test.Error(t, sfnt.parseBASE())
+	test.That(t, sfnt.Base.Vert == nil)
+
+	baseScript, ok := sfnt.Base.Get("latn", false)
+	test.That(t, ok)
+	test.T(t, baseScript.DefaultBaseline, "romn")
+	test.T(t, baseScript.Coords, map[string]int16{"hang": 1400, "romn": 0})
+
+	baseScript, ok = sfnt.Base.Get("deva", false)
+	test.That(t, ok)
+	test.T(t, baseScript.DefaultBaseline, "hang")
+	test.T(t, baseScript.Coords, map[string]int16{"hang": 1600, "romn": 100})
+
+	_, ok = sfnt.Base.Get("arab", false)
+	test.That(t, !ok)
+
+	sfnt.Tables["BASE"] = sfnt.Tables["BASE"][:20]
+	test.That(t, sfnt.parseBASE() != nil)
+}
+
+func TestSFNTMath(t *testing.T) {
+	b, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	sfnt, err := ParseSFNT(b, 0)
+	test.Error(t, err)
+	test.That(t, sfnt.Math != nil)
+	test.T(t, sfnt.Math.Constants.AxisHeight, int16(642))
+	test.T(t, sfnt.Math.Constants.FractionRuleThickness, int16(90))
+
+	// small integral uses a pre-designed variant
+	integral := sfnt.GlyphIndex('∫')
+	glyphs, size := sfnt.Math.Stretch(integral, 2000, true)
+	test.T(t, len(glyphs), 1)
+	test.T(t, size, int32(2718))
+
+	// large integral is assembled from its parts
+	glyphs, size = sfnt.Math.Stretch(integral, 6000, true)
+	test.T(t, len(glyphs), 3)
+	test.That(t, 6000 <= size, "size", size)
+
+	ymin, ymax := int32(math.MaxInt32), int32(math.MinInt32)
+	for _, glyph := range glyphs {
+		_, glyphYMin, _, glyphYMax, err := sfnt.GlyphBounds(glyph.GlyphID)
+		test.Error(t, err)
+		if v := glyph.Offset + int32(glyphYMin); v < ymin {
+			ymin = v
+		}
+		if v := glyph.Offset + int32(glyphYMax); ymax < v {
+			ymax = v
+		}
+	}
+	test.That(t, 6000 <= ymax-ymin, "height", ymax-ymin)
+
+	// parentheses repeat their extender
+	glyphs, size = sfnt.Math.Stretch(sfnt.GlyphIndex('('), 8000, true)
+	test.That(t, 3 < len(glyphs))
+	test.That(t, 8000 <= size, "size", size)
+	test.That(t, glyphs[1].GlyphID == glyphs[2].GlyphID)
+
+	// not stretchable
+	glyphs, size = sfnt.Math.Stretch(sfnt.GlyphIndex('a'), 8000, true)
+	test.T(t, glyphs, []MathStretchedGlyph{{sfnt.GlyphIndex('a'), 0}})
+	test.T(t, size, int32(0))
+}
+
+type pointPather struct {
+	points [][2]float64
+}
+
+func (p *pointPather) MoveTo(x, y float64) {
+	p.points = append(p.points, [2]float64{x, y})
+}
+
+func (p *pointPather) LineTo(x, y float64) {
+	p.points = append(p.points, [2]float64{x, y})
+}
+
+func (p *pointPather) QuadTo(cpx, cpy, x, y float64) {
+	p.points = append(p.points, [2]float64{cpx, cpy}, [2]float64{x, y})
+}
+
+func (p *pointPather) CubeTo(cpx1, cpy1, cpx2, cpy2, x, y float64) {
+	p.points = append(p.points, [2]float64{cpx1, cpy1}, [2]float64{cpx2, cpy2}, [2]float64{x, y})
+}
+
+func (p *pointPather) Close() {}
+
+func TestSFNTVariations(t *testing.T) {
+	b, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	sfnt, err := ParseSFNT(b, 0)
+	test.Error(t, err)
+	test.That(t, sfnt.NormalizeVariations([]float64{700.0}) == nil)
+
+	// wght axis from 100 to 900 with default 400
+	sfnt.Tables["fvar"] = []byte{
+		0, 1, 0, 0, 0, 16, 0, 2, // header
+		0, 1, 0, 20, 0, 1, 0, 8,
+		'w', 'g', 'h', 't', 0, 100, 0, 0, 1, 0x90, 0, 0, 3, 0x84, 0, 0, 0, 0, 1, 0, // axis
+		1, 1, 0, 0, 2, 0xBC, 0, 0, // instance at 700
+	}
+	test.Error(t, sfnt.parseFvar())
+	test.T(t, sfnt.VariationAxes(), []string{"wght"})
+	test.T(t, sfnt.Fvar.Instances[0].Coordinates, []float64{700.0})
+	test.T(t, sfnt.NormalizeVariations([]float64{250.0}), []float64{-0.5})
+	test.T(t, sfnt.NormalizeVariations([]float64{650.0}), []float64{0.5})
+	test.T(t, sfnt.NormalizeVariations([]float64{1000.0}), []float64{1.0})
+	test.T(t, sfnt.NormalizeVariations(nil), []float64{0.0})
+
+	// remap 0.5 to 0.25
+	sfnt.Tables["avar"] = []byte{
+		0, 1, 0, 0, 0, 0, 0, 1, // header
+		0, 4, 0xC0, 0, 0xC0, 0, 0, 0, 0, 0, 0x20, 0, 0x10, 0, 0x40, 0, 0x40, 0, // segment map
+	}
+	test.Error(t, sfnt.parseAvar())
+	test.T(t, sfnt.NormalizeVariations([]float64{250.0}), []float64{-0.5})
+	test.T(t, sfnt.NormalizeVariations([]float64{650.0}), []float64{0.25})
+	test.T(t, sfnt.NormalizeVariations([]float64{775.0}), []float64{0.625})
+	test.T(t, sfnt.NormalizeVariations([]float64{900.0}), []float64{1.0})
+
+	sfnt.Tables["avar"] = sfnt.Tables["avar"][:20]
+	test.That(t, sfnt.parseAvar() != nil)
+}
+
+func TestSFNTBytecodeHinting(t *testing.T) {
+	b, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	sfnt, err := ParseSFNT(b, 0)
+	test.Error(t, err)
+
+	// glyph outline in pixels at 16 pixels per em
+	id := sfnt.GlyphIndex('l')
+	scale := 16.0 / float64(sfnt.Head.UnitsPerEm)
+
+	p := &pointPather{}
+	test.Error(t, sfnt.GlyphPath(p, id, 16, 0.0, 0.0, scale, NoHinting))
+	test.That(t, p.points[1][0] != math.Round(p.points[1][0]), "unhinted outline must not be grid-fitted")
+
+	p = &pointPather{}
+	test.Error(t, sfnt.GlyphPath(p, id, 16, 0.0, 0.0, scale, BytecodeHinting))
+	test.T(t, p.points, [][2]float64{{3, 1}, {4, 1}, {4, 0}, {1, 0}, {1, 1}, {2, 1}, {2, 11}, {1, 11}, {1, 12}, {3, 12}})
+}
+
+func TestSFNTBytecodeHintingLoop(t *testing.T) {
+	b, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	sfnt, err := ParseSFNT(b, 0)
+	test.Error(t, err)
+
+	h, err := newHinter(sfnt)
+	test.Error(t, err)
+	test.Error(t, h.setPPEM(16))
+	h.zones[1], err = h.glyph(sfnt.GlyphIndex('l'), 0)
+	test.Error(t, err)
+
+	// set the loop variable to nearly 2^31 and shift two points with SHP, which must stop when the stack underflows
+	code := []byte{0xB8, 0x7F, 0xFF, 0x20, 0x63, 0xB8, 0x20, 0x00, 0x63, 0x17, 0xB8, 0x00, 0x00, 0xB8, 0x00, 0x01, 0x32}
+	err = h.execute(code)
+	test.That(t, err != nil, "loop must stop at stack underflow")
+	test.T(t, err.Error(), "stack underflow")
+	test.T(t, h.gs.loop, int32(1))
+	test.That(t, h.steps < 100, "loop must stop at stack underflow")
+
+	// a negative loop variable
+	err = h.execute([]byte{0xB8, 0xFF, 0xFF, 0x17})
+	test.That(t, err != nil, "negative loop must fail")
+
+	// the loop iterations count as executed instructions
+	h.err = nil
+	h.steps = hintMaxSteps - 1
+	h.gs.loop = 4
+	test.That(t, h.nextLoop())
+	test.That(t, !h.nextLoop(), "loop must stop after the maximum number of instructions")
+	test.T(t, h.gs.loop, int32(1))
+	test.That(t, h.err != nil)
+}
+
+func TestSFNTGlyphAdvanceCache(t *testing.T) {
+	b, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	sfnt, err := ParseSFNT(b, 0)
+	test.Error(t, err)
+
+	id := sfnt.GlyphIndex('a')
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if sfnt.GlyphAdvance(id) != sfnt.Hmtx.Advance(id) {
+					t.Error("cached advance must match hmtx")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	test.That(t, atomic.LoadUint64(&sfnt.advanceMiss) <= 8, "advance must be looked up at most once per goroutine")
+	test.T(t, sfnt.GlyphAdvance(sfnt.NumGlyphs()), sfnt.Hmtx.Advance(sfnt.NumGlyphs())) // out of range
+}
+
+func TestSFNTColor(t *testing.T) {
+	sfnt := &SFNT{
+		Tables: map[string][]byte{},
+		Maxp:   &maxpTable{NumGlyphs: 4},
+	}
+
+	// glyph 1 has a layer of glyph 2 in the palette color and a layer of glyph 3 in the foreground color
+	colr := NewBinaryWriter([]byte{})
+	colr.WriteUint16(0)  // version
+	colr.WriteUint16(1)  // numBaseGlyphRecords
+	colr.WriteUint32(14) // baseGlyphRecordsOffset
+	colr.WriteUint32(20) // layerRecordsOffset
+	colr.WriteUint16(2)  // numLayerRecords
+	colr.WriteUint16(1)  // glyphID
+	colr.WriteUint16(0)  // firstLayerIndex
+	colr.WriteUint16(2)  // numLayers
+	colr.WriteUint16(2)  // glyphID
+	colr.WriteUint16(0)  // paletteIndex
+	colr.WriteUint16(3)  // glyphID
+	colr.WriteUint16(ForegroundPaletteIndex)
+	sfnt.Tables["COLR"] = colr.Bytes()
+	test.Error(t, sfnt.parseCOLR())
+	test.T(t, sfnt.GlyphLayers(1), []ColorLayer{{2, 0}, {3, ForegroundPaletteIndex}})
+	test.T(t, len(sfnt.GlyphLayers(2)), 0)
+
+	cpal := NewBinaryWriter([]byte{})
+	cpal.WriteUint16(0)  // version
+	cpal.WriteUint16(1)  // numPaletteEntries
+	cpal.WriteUint16(1)  // numPalettes
+	cpal.WriteUint16(1)  // numColorRecords
+	cpal.WriteUint32(14) // colorRecordsArrayOffset
+	cpal.WriteUint16(0)  // colorRecordIndices
+	cpal.WriteBytes([]byte{0, 0, 255, 128})
+	sfnt.Tables["CPAL"] = cpal.Bytes()
+	test.Error(t, sfnt.parseCPAL())
+	c, ok := sfnt.PaletteColor(0, 0)
+	test.That(t, ok)
+	test.T(t, c, color.RGBA{128, 0, 0, 128})
+	_, ok = sfnt.PaletteColor(0, 1)
+	test.That(t, !ok)
+
+	// glyph 1 has a PNG image and glyph 2 is a duplicate of glyph 1
+	sbix := NewBinaryWriter([]byte{})
+	sbix.WriteUint16(1)  // version
+	sbix.WriteUint16(1)  // flags
+	sbix.WriteUint32(1)  // numStrikes
+	sbix.WriteUint32(12) // strikeOffsets
+	sbix.WriteUint16(64) // ppem
+	sbix.WriteUint16(72) // ppi
+	for _, offset := range []uint32{24, 24, 35, 45, 45} {
+		sbix.WriteUint32(offset) // glyphDataOffsets
+	}
+	sbix.WriteInt16(1)  // originOffsetX
+	sbix.WriteInt16(-2) // originOffsetY
+	sbix.WriteString("png abc")
+	sbix.WriteInt16(0)
+	sbix.WriteInt16(0)
+	sbix.WriteString("dupe")
+	sbix.WriteUint16(1)
+	sfnt.Tables["sbix"] = sbix.Bytes()
+	test.Error(t, sfnt.parseSbix())
+	bitmap, ok := sfnt.GlyphBitmap(1)
+	test.That(t, ok)
+	test.T(t, bitmap, GlyphBitmap{"png ", []byte("abc"), 64, 1, -2})
+	bitmap, ok = sfnt.GlyphBitmap(2)
+	test.That(t, ok)
+	test.T(t, bitmap, GlyphBitmap{"png ", []byte("abc"), 64, 1, -2})
+	_, ok = sfnt.GlyphBitmap(3)
+	test.That(t, !ok)
+
+	// glyph 3 has a PNG image with small glyph metrics
+	cblc := NewBinaryWriter([]byte{})
+	cblc.WriteUint16(3)  // majorVersion
+	cblc.WriteUint16(0)  // minorVersion
+	cblc.WriteUint32(1)  // numSizes
+	cblc.WriteUint32(56) // indexSubtableListOffset
+	cblc.WriteUint32(24) // indexSubtableListSize
+	cblc.WriteUint32(1)  // numberOfIndexSubtables
+	cblc.WriteUint32(0)  // colorRef
+	cblc.WriteBytes(make([]byte, 24))
+	cblc.WriteUint16(3)  // startGlyphIndex
+	cblc.WriteUint16(3)  // endGlyphIndex
+	cblc.WriteUint8(109) // ppemX
+	cblc.WriteUint8(109) // ppemY
+	cblc.WriteUint8(32)  // bitDepth
+	cblc.WriteInt8(1)    // flags
+	cblc.WriteUint16(3)  // firstGlyphIndex
+	cblc.WriteUint16(3)  // lastGlyphIndex
+	cblc.WriteUint32(8)  // additionalOffsetToIndexSubtable
+	cblc.WriteUint16(1)  // indexFormat
+	cblc.WriteUint16(17) // imageFormat
+	cblc.WriteUint32(4)  // imageDataOffset
+	cblc.WriteUint32(0)  // sbitOffsets
+	cblc.WriteUint32(12) // sbitOffsets
+	cbdt := NewBinaryWriter([]byte{})
+	cbdt.WriteUint16(3) // majorVersion
+	cbdt.WriteUint16(0) // minorVersion
+	cbdt.WriteBytes([]byte{10, 12, 1, 8, 12})
+	cbdt.WriteUint32(3) // dataLen
+	cbdt.WriteString("xyz")
+	sfnt.Sbix = nil
+	sfnt.Tables["CBLC"] = cblc.Bytes()
+	sfnt.Tables["CBDT"] = cbdt.Bytes()
+	test.Error(t, sfnt.parseCBDT())
+	bitmap, ok = sfnt.GlyphBitmap(3)
+	test.That(t, ok)
+	test.T(t, bitmap, GlyphBitmap{"png ", []byte("xyz"), 109, 1, -2})
+	_, ok = sfnt.GlyphBitmap(1)
+	test.That(t, !ok)
+}
+
+func BenchmarkSFNTGlyphAdvance(b *testing.B) {
+	data, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	sfnt, err := ParseSFNT(data, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	words := strings.Fields("The quick brown fox jumps over the lazy dog while measuring thousands of strings of proportional text")
+	b.ResetTimer()
+	glyphs := 0
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 1000; j++ {
+			width := 0
+			for _, r := range words[j%len(words)] {
+				width += int(sfnt.GlyphAdvance(sfnt.GlyphIndex(r)))
+				glyphs++
+			}
+			if width == 0 {
+				b.Fatal("zero width")
+			}
+		}
+	}
+	b.ReportMetric(float64(sfnt.advanceMiss)/float64(glyphs), "hmtx/glyph")
+}
@@ -337,8 +337,20 @@ func (glyf *glyfTable) ToPath(p Pather, glyphID, ppem uint16, x, y, f float64, h
 		return err
 	}
 
+	xs := make([]float64, len(contour.XCoordinates))
+	ys := make([]float64, len(contour.YCoordinates))
+	for i := range xs {
+		xs[i] = float64(contour.XCoordinates[i])
+		ys[i] = float64(contour.YCoordinates[i])
+	}
+	glyfPath(p, contour.EndPoints, contour.OnCurve, xs, ys, x, y, f)
+	return nil
+}
+
+// glyfPath draws quadratic contours given by their end points and on-curve flags, with coordinates in font units.
+func glyfPath(p Pather, endPoints []uint16, onCurve []bool, xs, ys []float64, x, y, f float64) {
 	var i uint16
-	for _, endPoint := range contour.EndPoints {
+	for _, endPoint := range endPoints {
 		j := i
 		first := true
 		firstOff := false
@@ -346,9 +358,9 @@ func (glyf *glyfTable) ToPath(p Pather, glyphID, ppem uint16, x, y, f float64, h
 		startX, startY := 0.0, 0.0
 		for ; i <= endPoint; i++ {
 			if first {
-				if contour.OnCurve[i] {
-					startX = float64(contour.XCoordinates[i])
-					startY = float64(contour.YCoordinates[i])
+				if onCurve[i] {
+					startX = xs[i]
+					startY = ys[i]
 					p.MoveTo(x+f*startX, y+f*startY)
 					first = false
 				} else if !prevOff {
@@ -357,43 +369,42 @@ func (glyf *glyfTable) ToPath(p Pather, glyphID, ppem uint16, x, y, f float64, h
 					prevOff = true
 				} else {
 					// first and second point are off
-					startX = float64(contour.XCoordinates[i-1]+contour.XCoordinates[i]) / 2.0
-					startY = float64(contour.YCoordinates[i-1]+contour.YCoordinates[i]) / 2.0
+					startX = (xs[i-1] + xs[i]) / 2.0
+					startY = (ys[i-1] + ys[i]) / 2.0
 					p.MoveTo(x+f*startX, y+f*startY)
 					first = false
 				}
 			} else if !prevOff {
-				if contour.OnCurve[i] {
-					p.LineTo(x+f*float64(contour.XCoordinates[i]), y+f*float64(contour.YCoordinates[i]))
+				if onCurve[i] {
+					p.LineTo(x+f*xs[i], y+f*ys[i])
 				} else {
 					prevOff = true
 				}
 			} else {
-				if contour.OnCurve[i] {
-					p.QuadTo(x+f*float64(contour.XCoordinates[i-1]), y+f*float64(contour.YCoordinates[i-1]), x+f*float64(contour.XCoordinates[i]), y+f*float64(contour.YCoordinates[i]))
+				if onCurve[i] {
+					p.QuadTo(x+f*xs[i-1], y+f*ys[i-1], x+f*xs[i], y+f*ys[i])
 					prevOff = false
 				} else {
-					midX := float64(contour.XCoordinates[i-1]+contour.XCoordinates[i]) / 2.0
-					midY := float64(contour.YCoordinates[i-1]+contour.YCoordinates[i]) / 2.0
-					p.QuadTo(x+f*float64(contour.XCoordinates[i-1]), y+f*float64(contour.YCoordinates[i-1]), x+f*midX, y+f*midY)
+					midX := (xs[i-1] + xs[i]) / 2.0
+					midY := (ys[i-1] + ys[i]) / 2.0
+					p.QuadTo(x+f*xs[i-1], y+f*ys[i-1], x+f*midX, y+f*midY)
 				}
 			}
 		}
 		if firstOff {
 			if prevOff {
-				midX := float64(contour.XCoordinates[i-1]+contour.XCoordinates[j]) / 2.0
-				midY := float64(contour.YCoordinates[i-1]+contour.YCoordinates[j]) / 2.0
-				p.QuadTo(x+f*float64(contour.XCoordinates[i-1]), y+f*float64(contour.YCoordinates[i-1]), x+f*midX, y+f*midY)
-				p.QuadTo(x+f*float64(contour.XCoordinates[j]), y+f*float64(contour.YCoordinates[j]), x+f*startX, y+f*startY)
+				midX := (xs[i-1] + xs[j]) / 2.0
+				midY := (ys[i-1] + ys[j]) / 2.0
+				p.QuadTo(x+f*xs[i-1], y+f*ys[i-1], x+f*midX, y+f*midY)
+				p.QuadTo(x+f*xs[j], y+f*ys[j], x+f*startX, y+f*startY)
 			} else {
-				p.QuadTo(x+f*float64(contour.XCoordinates[j]), y+f*float64(contour.YCoordinates[j]), x+f*startX, y+f*startY)
+				p.QuadTo(x+f*xs[j], y+f*ys[j], x+f*startX, y+f*startY)
 			}
 		} else if prevOff {
-			p.QuadTo(x+f*float64(contour.XCoordinates[i-1]), y+f*float64(contour.YCoordinates[i-1]), x+f*startX, y+f*startY)
+			p.QuadTo(x+f*xs[i-1], y+f*ys[i-1], x+f*startX, y+f*startY)
 		}
 		p.Close()
 	}
-	return nil
 }
 
 func (sfnt *SFNT) parseGlyf() error {
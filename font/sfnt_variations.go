@@ -0,0 +1,206 @@
+package font
+
+import (
+	"fmt"
+	"math"
+)
+
+type fvarAxis struct {
+	Tag               string
+	Min, Default, Max float64
+	Flags             uint16
+	AxisNameID        NameID
+}
+
+type fvarInstance struct {
+	SubfamilyNameID  NameID
+	Flags            uint16
+	Coordinates      []float64
+	PostScriptNameID NameID
+}
+
+type fvarTable struct {
+	Axes      []fvarAxis
+	Instances []fvarInstance
+}
+
+// Normalize returns the normalized coordinates in the range [-1,1] for the given user-space coordinates, with the default value of each axis mapping to zero. Coordinates are given in the order of the axes and missing coordinates take the axis' default value.
+func (fvar *fvarTable) Normalize(coords []float64) []float64 {
+	norm := make([]float64, len(fvar.Axes))
+	for i, axis := range fvar.Axes {
+		if len(coords) <= i {
+			continue
+		}
+		v := math.Max(axis.Min, math.Min(axis.Max, coords[i]))
+		if v < axis.Default {
+			norm[i] = -(axis.Default - v) / (axis.Default - axis.Min)
+		} else if axis.Default < v {
+			norm[i] = (v - axis.Default) / (axis.Max - axis.Default)
+		}
+		norm[i] = roundF2Dot14(norm[i])
+	}
+	return norm
+}
+
+func (sfnt *SFNT) parseFvar() error {
+	b, ok := sfnt.Tables["fvar"]
+	if !ok {
+		return fmt.Errorf("fvar: missing table")
+	} else if len(b) < 16 {
+		return fmt.Errorf("fvar: bad table")
+	}
+
+	sfnt.Fvar = &fvarTable{}
+	r := NewBinaryReader(b)
+	majorVersion := r.ReadUint16()
+	minorVersion := r.ReadUint16()
+	if majorVersion != 1 || minorVersion != 0 {
+		return fmt.Errorf("fvar: bad version")
+	}
+	axesArrayOffset := r.ReadUint16()
+	_ = r.ReadUint16() // reserved
+	axisCount := r.ReadUint16()
+	axisSize := r.ReadUint16()
+	instanceCount := r.ReadUint16()
+	instanceSize := r.ReadUint16()
+	if axisSize != 20 || instanceSize != 4+4*axisCount && instanceSize != 6+4*axisCount {
+		return fmt.Errorf("fvar: bad record size")
+	} else if uint32(len(b)) < uint32(axesArrayOffset)+uint32(axisCount)*uint32(axisSize)+uint32(instanceCount)*uint32(instanceSize) {
+		return fmt.Errorf("fvar: bad table")
+	}
+
+	r.Seek(uint32(axesArrayOffset))
+	sfnt.Fvar.Axes = make([]fvarAxis, axisCount)
+	for i := 0; i < int(axisCount); i++ {
+		sfnt.Fvar.Axes[i].Tag = r.ReadString(4)
+		sfnt.Fvar.Axes[i].Min = float64(r.ReadInt32()) / (1 << 16)
+		sfnt.Fvar.Axes[i].Default = float64(r.ReadInt32()) / (1 << 16)
+		sfnt.Fvar.Axes[i].Max = float64(r.ReadInt32()) / (1 << 16)
+		sfnt.Fvar.Axes[i].Flags = r.ReadUint16()
+		sfnt.Fvar.Axes[i].AxisNameID = NameID(r.ReadUint16())
+		if sfnt.Fvar.Axes[i].Default < sfnt.Fvar.Axes[i].Min || sfnt.Fvar.Axes[i].Max < sfnt.Fvar.Axes[i].Default {
+			return fmt.Errorf("fvar: bad axis range")
+		}
+	}
+
+	sfnt.Fvar.Instances = make([]fvarInstance, instanceCount)
+	for i := 0; i < int(instanceCount); i++ {
+		sfnt.Fvar.Instances[i].SubfamilyNameID = NameID(r.ReadUint16())
+		sfnt.Fvar.Instances[i].Flags = r.ReadUint16()
+		sfnt.Fvar.Instances[i].Coordinates = make([]float64, axisCount)
+		for j := 0; j < int(axisCount); j++ {
+			sfnt.Fvar.Instances[i].Coordinates[j] = float64(r.ReadInt32()) / (1 << 16)
+		}
+		if instanceSize == 6+4*axisCount {
+			sfnt.Fvar.Instances[i].PostScriptNameID = NameID(r.ReadUint16())
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type avarAxisValueMap struct {
+	From, To float64
+}
+
+type avarTable struct {
+	SegmentMaps [][]avarAxisValueMap
+}
+
+// Map remaps normalized coordinates using the piecewise linear segment maps of each axis. Axes without a segment map are left unchanged.
+func (avar *avarTable) Map(coords []float64) []float64 {
+	mapped := make([]float64, len(coords))
+	copy(mapped, coords)
+	for i, segmentMap := range avar.SegmentMaps {
+		if len(coords) <= i || len(segmentMap) == 0 {
+			continue
+		}
+		v := coords[i]
+		if v <= segmentMap[0].From {
+			mapped[i] = v + segmentMap[0].To - segmentMap[0].From
+			continue
+		}
+		k := 1
+		for k < len(segmentMap) && segmentMap[k].From < v {
+			k++
+		}
+		if k == len(segmentMap) {
+			last := segmentMap[len(segmentMap)-1]
+			mapped[i] = v + last.To - last.From
+			continue
+		}
+		a, b := segmentMap[k-1], segmentMap[k]
+		mapped[i] = roundF2Dot14(a.To + (b.To-a.To)*(v-a.From)/(b.From-a.From))
+	}
+	return mapped
+}
+
+func (sfnt *SFNT) parseAvar() error {
+	b, ok := sfnt.Tables["avar"]
+	if !ok {
+		return fmt.Errorf("avar: missing table")
+	} else if len(b) < 8 {
+		return fmt.Errorf("avar: bad table")
+	}
+
+	sfnt.Avar = &avarTable{}
+	r := NewBinaryReader(b)
+	majorVersion := r.ReadUint16()
+	minorVersion := r.ReadUint16()
+	if majorVersion != 1 || minorVersion != 0 {
+		return fmt.Errorf("avar: bad version")
+	}
+	_ = r.ReadUint16() // reserved
+	axisCount := r.ReadUint16()
+	sfnt.Avar.SegmentMaps = make([][]avarAxisValueMap, axisCount)
+	for i := 0; i < int(axisCount); i++ {
+		if r.Len() < 2 {
+			return fmt.Errorf("avar: bad table")
+		}
+		positionMapCount := r.ReadUint16()
+		if r.Len() < 4*uint32(positionMapCount) {
+			return fmt.Errorf("avar: bad table")
+		}
+		sfnt.Avar.SegmentMaps[i] = make([]avarAxisValueMap, positionMapCount)
+		for j := 0; j < int(positionMapCount); j++ {
+			sfnt.Avar.SegmentMaps[i][j].From = float64(r.ReadInt16()) / (1 << 14)
+			sfnt.Avar.SegmentMaps[i][j].To = float64(r.ReadInt16()) / (1 << 14)
+			if 0 < j && sfnt.Avar.SegmentMaps[i][j].From < sfnt.Avar.SegmentMaps[i][j-1].From {
+				return fmt.Errorf("avar: segment map must be sorted")
+			}
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+// NormalizeVariations returns the normalized coordinates for the variation axes of the fvar table given their user-space coordinates, such as 700 for the wght axis. The coordinates are remapped by the avar table if present, as is required before applying variation deltas. It returns nil for fonts that are not variable fonts.
+func (sfnt *SFNT) NormalizeVariations(coords []float64) []float64 {
+	if sfnt.Fvar == nil {
+		return nil
+	}
+	norm := sfnt.Fvar.Normalize(coords)
+	if sfnt.Avar != nil {
+		norm = sfnt.Avar.Map(norm)
+	}
+	return norm
+}
+
+// VariationAxes returns the tags of the variation axes of the fvar table in order, such as wght for the weight axis.
+func (sfnt *SFNT) VariationAxes() []string {
+	if sfnt.Fvar == nil {
+		return nil
+	}
+	tags := make([]string, len(sfnt.Fvar.Axes))
+	for i, axis := range sfnt.Fvar.Axes {
+		tags[i] = axis.Tag
+	}
+	return tags
+}
+
+// roundF2Dot14 rounds to the precision of the F2DOT14 format, as normalized coordinates are specified to be.
+func roundF2Dot14(f float64) float64 {
+	return math.Round(f*(1<<14)) / (1 << 14)
+}
@@ -1,8 +1,13 @@
 package canvas
 
 import (
+	"math"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/tdewolff/canvas/font"
+	"github.com/tdewolff/canvas/text"
 	"github.com/tdewolff/test"
 )
 
@@ -28,6 +33,40 @@ func TestFontFamily(t *testing.T) {
 	//test.T(t, face.Style.CSS(), 1000)
 }
 
+func TestFontWeight(t *testing.T) {
+	test.T(t, FontWeight(100), FontExtraLight)
+	test.T(t, FontWeight(400), FontRegular)
+	test.T(t, FontWeight(449), FontRegular)
+	test.T(t, FontWeight(680), FontBold)
+	test.T(t, FontWeight(1000), FontExtraBlack)
+	test.T(t, FontWeight(FontSemibold.CSS()), FontSemibold)
+
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	test.T(t, FontWeight(font.WeightClass()), FontRegular)
+
+	family := NewFontFamily("dejavu-serif")
+	family.fonts[FontLight] = font
+	family.fonts[FontMedium] = font
+	family.fonts[FontBold] = font
+	family.fonts[FontBlack|FontItalic] = font
+	var tests = []struct {
+		style, nearest FontStyle
+	}{
+		{FontRegular, FontMedium},
+		{FontBook, FontLight},
+		{FontExtraLight, FontLight},
+		{FontSemibold, FontBold},
+		{FontExtraBlack, FontBold},
+		{FontRegular | FontItalic, FontBlack | FontItalic},
+	}
+	for _, tt := range tests {
+		style, ok := family.NearestStyle(tt.style)
+		test.That(t, ok)
+		test.T(t, style, tt.nearest, tt.style.CSS())
+	}
+}
+
 func TestFontFace(t *testing.T) {
 	family := NewFontFamily("dejavu-serif")
 	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
@@ -87,3 +126,532 @@ func TestFontDecoration(t *testing.T) {
 	test.T(t, face.Decorate(809.0), MustParseSVGPath("M0 -265L809 -265L809 -175L0 -175z"))
 	test.T(t, face.Decorate(810.0), MustParseSVGPath("M0 -265L270 -265L270 -175L0 -175zM540 -265L810 -265L810 -175L540 -175z"))
 }
+
+func TestFontDashedDecoration(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	pt := ptPerMm * float64(family.fonts[FontRegular].Head.UnitsPerEm)
+
+	// underline thickness is 90 centered at y=-220, dashes of 270 are stretched to end with a dash
+	face := family.Face(pt, Black, FontRegular, FontNormal, FontDecoration{Line: UnderlineDecoration, Style: DashedDecoration})
+	p := face.Decorate(1000.0)
+	test.T(t, len(p.Split()), 2)
+	test.That(t, p.Fills(100.0, -220.0, NonZero), "dash must be filled")
+	test.That(t, !p.Fills(500.0, -220.0, NonZero), "gap must not be filled")
+	test.T(t, p.Bounds(), Rect{0.0, -265.0, 1000.0, 90.0})
+	test.T(t, face.Decorate(500.0), MustParseSVGPath("M0 -265L500 -265L500 -175L0 -175z"))
+
+	face = family.Face(pt, Black, FontRegular, FontNormal, FontDecoration{Line: LineThroughDecoration, Style: DashedDecoration, Dashes: []float64{1.0, 2.0}})
+	p = face.Decorate(1000.0)
+	test.T(t, len(p.Split()), 4)
+	test.T(t, p.Bounds(), Rect{0.0, 530.0, 1000.0, 102.0})
+
+	face = family.Face(pt, Black, FontRegular, FontNormal, FontDecoration{Line: OverlineDecoration, Style: DottedDecoration})
+	p = face.Decorate(270.0)
+	test.T(t, len(p.Split()), 2)
+	test.T(t, p.Bounds(), Rect{0.0, 1811.0, 270.0, 90.0})
+
+	face = family.Face(pt, Black, FontRegular, FontNormal, FontDecoration{Line: UnderlineDecoration, Style: DoubleDecoration})
+	test.T(t, face.Decorate(10.0), MustParseSVGPath("M0 -265L10 -265L10 -175L0 -175zM0 -400L10 -400L10 -310L0 -310z"))
+	test.T(t, FontDecoration{Line: LineThroughDecoration, Style: DashedDecoration}.String(), "DashedLineThrough")
+}
+
+func TestFontMissingGlyph(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	pt := ptPerMm * float64(family.fonts[FontRegular].Head.UnitsPerEm)
+	face := family.Face(pt, Black, FontRegular, FontNormal)
+
+	face.MissingGlyph = TofuGlyph
+	p, width, err := face.ToPath("\uE000")
+	test.Error(t, err)
+	test.That(t, !p.Empty())
+	bounds := p.Bounds()
+	test.That(t, 0.0 < bounds.X && bounds.X+bounds.W < width+0.04*face.Size)
+	test.Float(t, bounds.H, face.Metrics().CapHeight+0.04*face.Size)
+
+	face.MissingGlyph = FallbackGlyph
+	face.FallbackPath = Rectangle(100.0, 200.0)
+	p, _, err = face.ToPath("\uE000")
+	test.Error(t, err)
+	test.T(t, p.Bounds(), Rect{0.0, 0.0, 100.0, 200.0})
+}
+
+func TestFontControlChars(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	pt := ptPerMm * float64(family.fonts[FontRegular].Head.UnitsPerEm)
+	face := family.Face(pt, Black, FontRegular, FontNormal)
+	width := face.TextWidth("ab")
+
+	face.ControlChars = DropControlChars
+	test.Float(t, face.TextWidth("a\u0007b"), width)
+	p, _, err := face.ToPath("a\u0007b")
+	test.Error(t, err)
+	q, _, _ := face.ToPath("ab")
+	test.T(t, p, q)
+
+	// dropped characters are removed before shaping and do not interrupt ligatures and kerning
+	for _, s := range []string{"fi", "AV", "To"} {
+		glyphs, _ := face.shape(s[:1]+"\u0007"+s[1:], face.PPEM(DefaultResolution), face.Direction, face.Script)
+		ref, _ := face.shape(s, face.PPEM(DefaultResolution), face.Direction, face.Script)
+		test.T(t, len(glyphs), len(ref), s)
+		for i := range ref {
+			test.T(t, glyphs[i].ID, ref[i].ID, s)
+			test.T(t, glyphs[i].XAdvance, ref[i].XAdvance, s)
+		}
+	}
+	glyphs, _ := face.shape("\u0007a\u0007", face.PPEM(DefaultResolution), face.Direction, face.Script)
+	test.T(t, len(glyphs), 1)
+	test.T(t, glyphs[0].Cluster, uint32(1))
+
+	face.ControlChars = ReplaceControlChars
+	test.Float(t, face.TextWidth("a\u0007b"), width+face.TextWidth("\uFFFD"))
+	glyphs, _ = face.shape("a\u0007b", face.PPEM(DefaultResolution), face.Direction, face.Script)
+	test.T(t, len(glyphs), 3)
+	test.T(t, glyphs[1].Cluster, uint32(1))
+	test.T(t, glyphs[2].Cluster, uint32(2))
+
+	face.ControlChars = HexControlChars
+	p, _, err = face.ToPath("\u0007")
+	test.Error(t, err)
+	test.That(t, !p.Empty())
+}
+
+func TestFontStemDarkening(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(6.0, Black, FontRegular, FontNormal) // 6ppem at 72 DPI
+	test.Float(t, face.stemDarkening(DPI(72.0)), 0.0)
+
+	face.StemDarkening = true
+	test.Float(t, face.stemDarkening(0.0), 0.0)
+	test.Float(t, face.stemDarkening(DPI(72.0)), StemDarkeningAmount/2.0/DPI(72.0).DPMM())
+	test.Float(t, face.stemDarkening(DPI(72.0*3.0)), StemDarkeningAmount/4.0/DPI(72.0*3.0).DPMM()) // 18ppem
+	test.Float(t, face.stemDarkening(DPI(72.0*4.0)), 0.0)                                          // 24ppem
+}
+
+func TestFontFastASCII(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	face.FastASCII = true
+	test.That(t, !face.skipShaping("AV fi", text.LeftToRight, text.ScriptInvalid)) // kerning and ligatures
+
+	face.Features = "-ccmp,-kern,-liga,-locl,-mark,-mkmk"
+	test.That(t, face.skipShaping("AV fi", text.LeftToRight, text.ScriptInvalid))
+	test.That(t, face.skipShaping("AV fi", text.LeftToRight, text.Latin))
+	test.That(t, !face.skipShaping("AV fi", text.LeftToRight, text.Arabic)) // required features cannot be disabled
+	test.That(t, !face.skipShaping("AV fi", text.RightToLeft, text.ScriptInvalid))
+	test.That(t, !face.skipShaping("AV fé", text.LeftToRight, text.ScriptInvalid))
+
+	fast, _ := face.shape("AV fi", 0, text.LeftToRight, text.Latin)
+	face.FastASCII = false
+	shaped, _ := face.shape("AV fi", 0, text.LeftToRight, text.Latin)
+	test.T(t, fast, shaped)
+}
+
+func TestFontEmbolden(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	regular, width, err := face.ToPath("l")
+	test.Error(t, err)
+
+	bold := *face
+	bold.Embolden = 0.02
+	emboldened, boldWidth, err := bold.ToPath("l")
+	test.Error(t, err)
+
+	// the stem is dilated on both sides and the advance widens accordingly
+	d := 0.02 * face.Size
+	dAdvance := face.mmPerEm * math.Round(0.02*float64(face.Font.Head.UnitsPerEm)) // advances are in font units
+	test.Float(t, boldWidth, width+2.0*dAdvance)
+	test.Float(t, bold.TextWidth("ll"), face.TextWidth("ll")+4.0*dAdvance)
+	test.Float(t, emboldened.Bounds().W, regular.Bounds().W+2.0*d)
+	test.Float(t, emboldened.Bounds().X, regular.Bounds().X+dAdvance-d)
+}
+
+func TestFontSpacing(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	spaced := *face
+	spaced.LetterSpacing = 1.0
+	spaced.WordSpacing = 2.0
+	letter := face.mmPerEm * math.Round(1.0/face.mmPerEm) // advances are in font units
+	word := face.mmPerEm * math.Round(2.0/face.mmPerEm)
+	test.Float(t, spaced.TextWidth("A"), face.TextWidth("A"))
+	test.Float(t, spaced.TextWidth("ABC"), face.TextWidth("ABC")+2.0*letter)
+	test.Float(t, spaced.TextWidth("AB CD"), face.TextWidth("AB CD")+4.0*letter+word)
+
+	// right-to-left glyphs are in visual order, the logically first glyph is last
+	rtl := *face
+	rtl.Direction = text.RightToLeft
+	spaced.Direction = text.RightToLeft
+	glyphs, _ := spaced.shape("ABC", 0, text.RightToLeft, text.Latin)
+	test.T(t, len(glyphs), 3)
+	test.T(t, glyphs[2].Text, 'A')
+	shaped, _ := rtl.shape("ABC", 0, text.RightToLeft, text.Latin)
+	test.T(t, glyphs[2].XAdvance, shaped[2].XAdvance)
+	test.T(t, glyphs[0].XAdvance, shaped[0].XAdvance+int32(math.Round(1.0/face.mmPerEm)))
+	test.Float(t, spaced.TextWidth("ABC"), rtl.TextWidth("ABC")+2.0*letter)
+}
+
+func TestFontGlyphsToPath(t *testing.T) {
+	for _, filename := range []string{"resources/DejaVuSerif.ttf", "resources/EBGaramond12-Regular.otf"} {
+		t.Run(filename, func(t *testing.T) {
+			family := NewFontFamily("family")
+			if err := family.LoadFontFile(filename, FontRegular); err != nil {
+				test.Error(t, err)
+			}
+			face := family.Face(12.0, Black, FontRegular, FontNormal)
+			face.NormalizeWinding = true
+
+			glyphs, _ := face.shape("oo", 0, face.Direction, face.Script)
+			p, indices, err := face.GlyphsToPath(glyphs, 0)
+			test.Error(t, err)
+			test.T(t, indices, []int{0, 2})
+
+			ps := p.Split()
+			test.T(t, len(ps), 4)
+			outer, counter := ps[2], ps[3]
+			if outer.Bounds().W < counter.Bounds().W {
+				outer, counter = counter, outer
+			}
+			test.That(t, outer.CCW(), "outer contour must be counter clockwise")
+			test.That(t, !counter.CCW(), "counter must be clockwise")
+
+			// the counter is a hole for either fill rule
+			bounds := counter.Bounds()
+			center := Point{bounds.X + bounds.W/2.0, bounds.Y + bounds.H/2.0}
+			test.That(t, !p.Fills(center.X, center.Y, NonZero), "counter must not be filled")
+			test.That(t, !p.Fills(center.X, center.Y, EvenOdd), "counter must not be filled")
+			test.That(t, p.Fills(bounds.X-0.05*face.Size, center.Y, NonZero), "stem must be filled")
+		})
+	}
+}
+
+func TestFontConcurrency(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+	width := face.TextWidth("concurrent text")
+
+	var wg sync.WaitGroup
+	widths := make([]float64, 16)
+	for i := range widths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 0 {
+				font.SetFeatures("")
+			}
+			text := NewTextLine(face, "concurrent text", Left)
+			widths[i] = text.lines[0].spans[0].Width
+			_, _, err := face.ToPath("concurrent text")
+			test.Error(t, err)
+			font.SFNT.Cmap.ToUnicode(font.SFNT.GlyphIndex('c'))
+		}(i)
+	}
+	wg.Wait()
+	for _, w := range widths {
+		test.Float(t, w, width)
+	}
+}
+
+func TestFontFaceWithUnit(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+
+	test.Float(t, font.FaceWithUnit(12.0, UnitPoint, Black).Size, font.Face(12.0, Black).Size)
+	test.Float(t, font.FaceWithUnit(12.0, UnitPoint, Black).Size, 12.0*25.4/72.0)
+	test.Float(t, font.FaceWithUnit(12.0, UnitPixel, Black).Size, 12.0*25.4/96.0)
+	test.Float(t, font.FaceWithUnit(5.0, UnitMillimeter, Black).Size, 5.0)
+
+	test.Float(t, UnitInch.Convert(1.0, UnitPoint), 72.0)
+	test.Float(t, UnitPica.Convert(1.0, UnitPoint), 12.0)
+	test.Float(t, UnitCentimeter.ToMM(2.0), 20.0)
+	test.Float(t, UnitPixel.FromMM(25.4), 96.0)
+}
+
+func TestFontZeroWidth(t *testing.T) {
+	family := NewFontFamily("eb-garamond")
+	if err := family.LoadFontFile("resources/EBGaramond12-Regular.otf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	face.MissingGlyph = TofuGlyph
+
+	width := face.TextWidth("ab")
+	for _, s := range []string{"a\u200Cb", "a\u200Db", "a\uFEFFb", "\uFEFFab"} {
+		test.Float(t, face.TextWidth(s), width)
+
+		p, _, err := face.ToPath(s)
+		test.Error(t, err)
+		q, _, _ := face.ToPath("ab")
+		test.T(t, p.Bounds(), q.Bounds())
+	}
+
+	text := NewTextLine(face, "a\u200Cb", Left)
+	test.Float(t, text.lines[0].spans[0].Width, width)
+}
+
+func TestFontDottedCircle(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	ppem := face.PPEM(DefaultResolution)
+	dottedCircle := face.Font.GlyphIndex('\u25CC')
+	test.That(t, dottedCircle != 0, "font must have a dotted circle")
+
+	glyphs, _ := face.shape("\u0301a", ppem, face.Direction, face.Script)
+	test.That(t, glyphs[0].ID != dottedCircle)
+	width := face.TextWidth("\u0301a")
+
+	face.DottedCircle = true
+	glyphs, _ = face.shape("\u0301a", ppem, face.Direction, face.Script)
+	test.T(t, len(glyphs), 3)
+	test.T(t, glyphs[0].ID, dottedCircle)
+	test.T(t, glyphs[0].Cluster, uint32(0))
+	test.T(t, glyphs[1].Cluster, uint32(0))
+	test.T(t, glyphs[2].Cluster, uint32(2))
+	test.That(t, width < face.TextWidth("\u0301a"))
+
+	// marks with a base are unchanged
+	glyphs, _ = face.shape("a\u0301\u0301", ppem, face.Direction, face.Script)
+	for _, glyph := range glyphs {
+		test.That(t, glyph.ID != dottedCircle)
+	}
+	glyphs, _ = face.shape("a\n\u0301", ppem, face.Direction, face.Script)
+	test.T(t, glyphs[2].ID, dottedCircle)
+	test.T(t, glyphs[2].Cluster, uint32(2))
+	test.T(t, glyphs[3].Cluster, uint32(2))
+}
+
+func TestFontProportionalCJK(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	test.String(t, face.features(text.LeftToRight), "")
+
+	face.ProportionalCJK = true
+	test.String(t, face.features(text.LeftToRight), "palt")
+	test.String(t, face.features(text.DirectionInvalid), "palt")
+	test.String(t, face.features(text.TopToBottom), "vpal")
+
+	face.Features = "-palt,kern"
+	test.String(t, face.features(text.LeftToRight), "palt,-palt,kern")
+	test.Float(t, face.TextWidth("（a）"), family.Face(12.0, Black, FontRegular, FontNormal).TextWidth("（a）")) // font has no palt
+}
+
+func TestFontWritingModeFeatures(t *testing.T) {
+	test.String(t, writingModeFeatures("", text.LeftToRight), "")
+	test.String(t, writingModeFeatures("", text.TopToBottom), "vert,vrt2")
+	test.String(t, writingModeFeatures("vert,liga,-vkrn", text.LeftToRight), "liga")
+	test.String(t, writingModeFeatures("vert", text.DirectionInvalid), "")
+	test.String(t, writingModeFeatures("palt, -kern,halt=0,liga", text.TopToBottom), "vert,vrt2,vpal,-vkrn,vhal=0,liga")
+	test.String(t, writingModeFeatures("-vert", text.BottomToTop), "vert,vrt2,-vert") // explicit features take precedence
+
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	face.Features = "vert,vrt2"
+	test.Float(t, face.TextWidth("AV"), family.Face(12.0, Black, FontRegular, FontNormal).TextWidth("AV"))
+}
+
+func TestFontRequiredFeatures(t *testing.T) {
+	test.String(t, requiredFeatures("-liga,-ccmp,mark=0,kern", text.Latin), "-liga,-ccmp,mark=0,kern")
+	test.String(t, requiredFeatures("-liga,-ccmp,mark=0,kern", text.Arabic), "-liga,kern")
+	test.String(t, requiredFeatures("-ccmp,-mkmk,-rvrn", text.Devanagari), "")
+	test.String(t, requiredFeatures("-init,-medi,-fina,-isol,-rlig,-calt", text.Arabic), "-calt")
+	test.String(t, requiredFeatures("-init,+rlig", text.Latin), "-init,+rlig")
+	test.String(t, requiredFeatures("-blwf,half[2:3]=off", text.Devanagari), "")
+
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	glyphs, _ := face.shape("j\u0301fi", 0, text.DirectionInvalid, text.ScriptInvalid)
+
+	// glyph composition and mark positioning are not required for Latin
+	face.Features = "-ccmp,-mark,-mkmk,-liga"
+	minimal, _ := face.shape("j\u0301fi", 0, text.DirectionInvalid, text.ScriptInvalid)
+	test.T(t, len(glyphs), 3)
+	test.T(t, len(minimal), 4)
+	test.T(t, minimal[0].ID, face.Font.SFNT.GlyphIndex('j'))
+}
+
+func TestFontWrapText(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	s := "The quick brown fox jumps over the lazy dog, and then it runs away into the woods.\nThe end."
+	width := 40.0
+	lines := face.WrapText(s, width)
+	test.That(t, 3 < len(lines))
+	words := []string{}
+	for _, line := range lines {
+		test.That(t, face.TextWidth(line) <= width, line)
+		test.That(t, !strings.HasSuffix(line, " "), line)
+		words = append(words, strings.Fields(line)...)
+	}
+	test.T(t, words, strings.Fields(s))
+	test.String(t, lines[len(lines)-1], "The end.")
+
+	lines = face.WrapText("abc\u00ADdef", face.TextWidth("abc"))
+	test.T(t, lines, []string{"abc-", "def"})
+}
+
+func TestFontDefaultIgnorable(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	width := face.TextWidth("a")
+	for _, s := range []string{"a\uFE0F", "a\uFE0E", "a\u00AD", "a\u034F", "a\U000E0101"} {
+		test.Float(t, face.TextWidth(s), width)
+	}
+
+	glyphs, _ := face.Font.shape("a\uFE0F", face.PPEM(DefaultResolution), face.Direction, face.Script, face.Language, "")
+	test.T(t, len(glyphs), 2)
+	test.T(t, glyphs[1].XAdvance, int32(0))
+
+	test.That(t, text.IsDefaultIgnorable('\uFE0F'))
+	test.That(t, text.IsDefaultIgnorable('\U000E0001'))
+	test.That(t, !text.IsDefaultIgnorable('a'))
+	test.That(t, !text.IsDefaultIgnorable(' '))
+}
+
+func TestFontDefaultIgnorableWithoutSpace(t *testing.T) {
+	fontDejaVu, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	sfnt := fontDejaVu.SFNT
+	subset, _ := sfnt.Subset([]uint16{0, sfnt.GlyphIndex('a'), sfnt.GlyphIndex('b')}, font.WriteMinTables)
+	fontNoSpace, err := LoadFont(subset, 0, FontRegular)
+	test.Error(t, err)
+	test.T(t, fontNoSpace.GlyphIndex(' '), uint16(0))
+	face := fontNoSpace.Face(12.0, Black)
+
+	// zero-width and default ignorable characters have no outline, also when the font has no space glyph
+	q, _, err := face.ToPath("ab")
+	test.Error(t, err)
+	for _, s := range []string{"a\u200Cb", "a\u200Db", "a\uFEFFb", "a\uFE0Fb", "a\U000E0101b"} {
+		p, _, err := face.ToPath(s)
+		test.Error(t, err)
+		test.That(t, p.Equals(q), "must not render .notdef for", []rune(s)[1])
+
+		text := NewTextLine(face, s, Left)
+		test.T(t, text.UsedGlyphs()[fontNoSpace], []uint16{1, 2})
+	}
+}
+
+func TestFontFaceDecimalOffsets(t *testing.T) {
+	fontDejaVu, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := fontDejaVu.Face(12.0, Black)
+
+	numbers := []string{"1.5", "12.25", "100", "1,000.5", "2%"}
+	offsets := face.DecimalOffsets(numbers, '.')
+	test.T(t, len(offsets), len(numbers))
+	test.Float(t, offsets[3], 0.0)
+
+	// the decimal separators are drawn at the same position
+	point := offsets[3] + face.TextWidth("1,000")
+	test.Float(t, offsets[0]+face.TextWidth("1"), point)
+	test.Float(t, offsets[1]+face.TextWidth("12"), point)
+	test.Float(t, offsets[2]+face.TextWidth("100"), point)
+	test.Float(t, offsets[4]+face.TextWidth("2"), point)
+
+	// decimal comma
+	offsets = face.DecimalOffsets([]string{"1,5", "12,25"}, ',')
+	test.Float(t, offsets[0], face.TextWidth("1"))
+	test.Float(t, offsets[1], 0.0)
+
+	// proportional figures are measured as drawn
+	fontGaramond, err := LoadFontFile("resources/EBGaramond12-Regular.otf", FontRegular)
+	test.Error(t, err)
+	face = fontGaramond.Face(12.0, Black)
+	offsets = face.DecimalOffsets([]string{"1.5", "10.5", "84.5"}, '.')
+	test.Float(t, offsets[0]+face.TextWidth("1"), offsets[1]+face.TextWidth("10"))
+	test.Float(t, offsets[2]+face.TextWidth("84"), offsets[1]+face.TextWidth("10"))
+}
+
+func TestFontFromMetrics(t *testing.T) {
+	family := NewFontFamily("metrics")
+	err := family.LoadFontFromMetrics(font.MetricsTable{
+		UnitsPerEm:     1000,
+		Ascender:       800,
+		Descender:      -200,
+		XHeight:        450,
+		Advances:       map[rune]uint16{'a': 500, 'b': 600, 'c': 400, ' ': 250},
+		DefaultAdvance: 700,
+	}, FontRegular)
+	test.Error(t, err)
+	face := family.Face(ptPerMm*1000.0, Black) // one millimeter per font unit
+
+	metrics := face.Metrics()
+	test.Float(t, metrics.LineHeight, 1000.0)
+	test.Float(t, metrics.Ascent, 800.0)
+	test.Float(t, metrics.XHeight, 450.0)
+	test.Float(t, face.TextWidth("abc"), 1500.0)
+	test.Float(t, face.TextWidth("ax"), 1200.0) // missing character uses the default advance
+
+	text := NewTextBox(face, "abc abc", 2000.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 2)
+	test.Float(t, text.lines[1].y, 1800.0)
+	test.Float(t, text.Bounds().W, 1500.0)
+
+	_, _, err = face.ToPath("abc")
+	test.That(t, err != nil, "must fail to render without glyph outlines")
+
+	_, err = NewFontFromMetrics("metrics", font.MetricsTable{}, FontRegular)
+	test.That(t, err != nil, "must fail without units per EM")
+}
+
+func TestFontFaceMeasureText(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(ptPerMm*float64(font.Head.UnitsPerEm), Black) // one millimeter per font unit
+
+	metrics := face.MeasureText("Hg")
+	test.Float(t, metrics.Width, face.TextWidth("Hg"))
+	test.Float(t, metrics.FontBoundingBoxAscent, 1901.0)
+	test.Float(t, metrics.FontBoundingBoxDescent, 483.0)
+	test.Float(t, metrics.ActualBoundingBoxAscent, 1493.0) // cap height of H
+	test.That(t, 0.0 < metrics.ActualBoundingBoxDescent && metrics.ActualBoundingBoxDescent < metrics.FontBoundingBoxDescent, "descender of g", metrics.ActualBoundingBoxDescent)
+	test.That(t, metrics.ActualBoundingBoxLeft < 0.0, "left side bearing of H", metrics.ActualBoundingBoxLeft)
+	test.That(t, metrics.ActualBoundingBoxRight < metrics.Width, "right side bearing of g", metrics.ActualBoundingBoxRight)
+
+	metrics = face.MeasureText(" ")
+	test.Float(t, metrics.Width, face.TextWidth(" "))
+	test.Float(t, metrics.ActualBoundingBoxAscent, 0.0)
+	test.Float(t, metrics.ActualBoundingBoxRight, 0.0)
+}
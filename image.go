@@ -3,9 +3,12 @@ package canvas
 import (
 	"bytes"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"sort"
 )
 
 // ImageEncoding defines whether the embedded image shall be embedded as lossless (typically PNG) or lossy (typically JPG).
@@ -45,3 +48,125 @@ func newImage(mimetype string, decode func(io.Reader) (image.Image, error), r io
 		Mimetype: mimetype,
 	}, err
 }
+
+type colorCount struct {
+	c     [4]uint8
+	count int
+}
+
+type colorBox []colorCount
+
+// channelRange returns the channel with the largest range of values and the size of the range.
+func (box colorBox) channelRange() (int, int) {
+	ch, size := 0, -1
+	for i := 0; i < 4; i++ {
+		min, max := uint8(255), uint8(0)
+		for _, cc := range box {
+			if cc.c[i] < min {
+				min = cc.c[i]
+			}
+			if max < cc.c[i] {
+				max = cc.c[i]
+			}
+		}
+		if size < int(max)-int(min) {
+			ch, size = i, int(max)-int(min)
+		}
+	}
+	return ch, size
+}
+
+// average returns the weighted average color of the box.
+func (box colorBox) average() color.RGBA {
+	var sum [4]int
+	n := 0
+	for _, cc := range box {
+		for i := 0; i < 4; i++ {
+			sum[i] += cc.count * int(cc.c[i])
+		}
+		n += cc.count
+	}
+	return color.RGBA{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n), uint8((sum[2] + n/2) / n), uint8((sum[3] + n/2) / n)}
+}
+
+// QuantizeImage reduces the colors of an image to at most maxColors (up to 256) using the median-cut algorithm, which is useful for indexed image formats such as GIF and paletted PNG. If dither is set, Floyd-Steinberg error diffusion is used to map the image to the palette.
+func QuantizeImage(img image.Image, maxColors int, dither bool) *image.Paletted {
+	if maxColors < 1 {
+		maxColors = 1
+	} else if 256 < maxColors {
+		maxColors = 256
+	}
+
+	// build histogram
+	bounds := img.Bounds()
+	histogram := map[[4]uint8]int{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			histogram[[4]uint8{c.R, c.G, c.B, c.A}]++
+		}
+	}
+	box := make(colorBox, 0, len(histogram))
+	for c, count := range histogram {
+		box = append(box, colorCount{c, count})
+	}
+	sort.Slice(box, func(i, j int) bool {
+		// deterministic order
+		a, b := box[i].c, box[j].c
+		return uint32(a[0])<<24|uint32(a[1])<<16|uint32(a[2])<<8|uint32(a[3]) < uint32(b[0])<<24|uint32(b[1])<<16|uint32(b[2])<<8|uint32(b[3])
+	})
+
+	// split the box with the largest channel range along its weighted median until we have enough boxes
+	boxes := []colorBox{}
+	if 0 < len(box) {
+		boxes = append(boxes, box)
+	}
+	for len(boxes) < maxColors {
+		k, ch, size := -1, 0, 0
+		for i, box := range boxes {
+			if 1 < len(box) {
+				if boxCh, boxSize := box.channelRange(); size < boxSize {
+					k, ch, size = i, boxCh, boxSize
+				}
+			}
+		}
+		if k == -1 {
+			break
+		}
+
+		box := boxes[k]
+		sort.SliceStable(box, func(i, j int) bool {
+			return box[i].c[ch] < box[j].c[ch]
+		})
+		n := 0
+		for _, cc := range box {
+			n += cc.count
+		}
+		i, m := 0, 0
+		for i < len(box)-1 {
+			m += box[i].count
+			i++
+			if n <= 2*m {
+				break
+			}
+		}
+		boxes[k] = box[:i]
+		boxes = append(boxes, box[i:])
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		palette[i] = box.average()
+	}
+	if len(palette) == 0 {
+		palette = append(palette, color.RGBA{})
+	}
+
+	dst := image.NewPaletted(bounds, palette)
+	if dither {
+		draw.FloydSteinberg.Draw(dst, bounds, img, bounds.Min)
+	} else {
+		draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+	}
+	return dst
+}
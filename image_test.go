@@ -0,0 +1,45 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/tdewolff/test"
+)
+
+func TestQuantizeImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 256; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(255 - x), uint8(y * 16), 255})
+		}
+	}
+
+	for _, dither := range []bool{false, true} {
+		dst := QuantizeImage(img, 16, dither)
+		test.T(t, len(dst.Palette), 16)
+		test.T(t, dst.Bounds(), img.Bounds())
+
+		diff := 0.0
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 256; x++ {
+				c0 := img.RGBAAt(x, y)
+				c1 := color.RGBAModel.Convert(dst.At(x, y)).(color.RGBA)
+				diff += math.Abs(float64(c0.R)-float64(c1.R)) + math.Abs(float64(c0.G)-float64(c1.G)) + math.Abs(float64(c0.B)-float64(c1.B))
+			}
+		}
+		diff /= 3.0 * 256.0 * 16.0
+		test.That(t, diff < 32.0, "mean error per channel too large:", diff)
+	}
+
+	// fewer colors than the maximum
+	img = image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, Red)
+	img.Set(1, 0, Blue)
+	dst := QuantizeImage(img, 16, false)
+	test.T(t, len(dst.Palette), 2)
+	test.T(t, dst.At(0, 0), color.Color(Red))
+	test.T(t, dst.At(1, 0), color.Color(Blue))
+}
@@ -69,11 +69,27 @@ import (
 var preamble = `\nopagenumbers
 
 \def\frac#1#2{{{#1}\over{#2}}}
+\def\color#1{\special{color push #1}\aftergroup\endcolor}
+\def\endcolor{\special{color pop}}
+\def\textcolor#1#2{{\color{#1}#2}}
+\def\textbf#1{\hbox{\bf #1}}
+\def\mathbf#1{{\bf #1}}
+\def\mathrm#1{{\rm #1}}
+\def\mathbb#1{{\special{canvas font push msbm}\rm #1\special{canvas font pop}}}
 `
 
 // ParseLaTeX parse a LaTeX formula (that what is between $...$) and returns a path.
 func ParseLaTeX(formula string) (*Path, error) {
-	r := strings.NewReader(fmt.Sprintf(`%s $%s$`, preamble, formula))
+	f, err := ParseLaTeXFormula(formula, DefaultLaTeXOptions)
+	if err != nil {
+		return nil, err
+	}
+	return f.Path(), nil
+}
+
+// ParseLaTeXFormula parses a LaTeX formula (that what is between $...$) and returns the formula using the given fill color and font size. Besides the plain TeX macros it supports \color{name}, \textcolor{name}{...}, \textbf, \mathbf, \mathrm, and \mathbb, where colors can be CSS color names.
+func ParseLaTeXFormula(formula string, opts LaTeXOptions) (*LaTeXFormula, error) {
+	r := strings.NewReader(fmt.Sprintf(`%s \leavevmode\special{canvas origin}$%s$`, preamble, formula))
 	w := &bytes.Buffer{}
 	stdout := &bytes.Buffer{}
 	engine := tex.NewEngine(stdout, bytes.NewReader([]byte{}))
@@ -82,12 +98,23 @@ func ParseLaTeX(formula string) (*Path, error) {
 		return nil, err
 	}
 
-	p, err := DVI2Path(w.Bytes(), newFonts())
+	fonts := newFonts()
+	f, err := dvi2Formula(w.Bytes(), fonts, opts.Color)
 	if err != nil {
 		fmt.Println(stdout.String())
 		return nil, err
 	}
-	return p, nil
+
+	// the math axis is given by the MATH table of the math font
+	fontSize := 10.0
+	if opts.FontSize != 0.0 && opts.FontSize != 10.0 {
+		fontSize = opts.FontSize
+		f.Transform(Identity.Scale(fontSize/10.0, fontSize/10.0))
+	}
+	if mathFont, ok := fonts.Get("cmex10", 1.0).(*dviFont); ok && mathFont.sfnt.Math != nil {
+		f.Axis = fontSize * mmPerPt * float64(mathFont.sfnt.Math.Constants.AxisHeight) / float64(mathFont.sfnt.Head.UnitsPerEm)
+	}
+	return f, nil
 }
 
 type dviFonts struct {
@@ -97,10 +124,17 @@ type dviFonts struct {
 type dviFont struct {
 	sfnt   *canvasFont.SFNT
 	cmap   map[uint32]rune
+	boxes  map[uint32]dviBox
 	size   float64
 	italic bool
 }
 
+// dviBox is the height and depth in em of a character that must fill its box vertically, such as delimiters, radicals, and big operators. Pieces of extensible delimiters are stretched to fit.
+type dviBox struct {
+	height, depth float64
+	piece         bool
+}
+
 func newFonts() *dviFonts {
 	return &dviFonts{
 		font: map[string]*dviFont{},
@@ -119,6 +153,7 @@ func (fs *dviFonts) Get(name string, scale float64) DVIFont {
 	}
 
 	cmap := cmapCMR
+	var boxes map[uint32]dviBox
 	f, ok := fs.font[name]
 	if !ok {
 		var fontSizes map[float64][]byte
@@ -157,6 +192,7 @@ func (fs *dviFonts) Get(name string, scale float64) DVIFont {
 			}
 		case "cmex":
 			cmap = cmapCMEX
+			boxes = cmexBoxes
 			fontSizes = map[float64][]byte{
 				fontsize: lmmath.TTF,
 			}
@@ -266,6 +302,11 @@ func (fs *dviFonts) Get(name string, scale float64) DVIFont {
 			fontSizes = map[float64][]byte{
 				10.0: lmromanunsl10regular.TTF,
 			}
+		case "msbm":
+			cmap = cmapMSBM
+			fontSizes = map[float64][]byte{
+				fontsize: lmmath.TTF,
+			}
 		//case "cmvtt":
 		//cmap = cmapCTT
 		default:
@@ -294,7 +335,7 @@ func (fs *dviFonts) Get(name string, scale float64) DVIFont {
 		isItalic := 0 < len(fontname) && fontname[len(fontname)-1] == 'i'
 		fsizeCorr := 1.0
 
-		f = &dviFont{sfnt, cmap, fsizeCorr * fsize, isItalic}
+		f = &dviFont{sfnt, cmap, boxes, fsizeCorr * fsize, isItalic}
 		fs.font[name] = f
 	}
 	return f
@@ -306,10 +347,133 @@ func (f *dviFont) Draw(p canvasFont.Pather, x, y float64, cid uint32) float64 {
 	if f.italic {
 		x -= f.size * float64(f.sfnt.OS2.SxHeight) / 2.0 * math.Tan(-f.sfnt.Post.ItalicAngle*math.Pi/180.0)
 	}
+	if box, ok := f.boxes[cid]; ok {
+		return f.drawBox(p, x, y, gid, box)
+	}
 	_ = f.sfnt.GlyphPath(p, gid, 0, x, y, f.size, canvasFont.NoHinting)
 	return f.size * float64(f.sfnt.GlyphAdvance(gid)) // in mm
 }
 
+// drawBox draws a glyph vertically centered in its box. The glyph variant or glyph assembly from the MATH table that matches the box height is used, or the glyph is stretched if it is a piece of an extensible delimiter.
+func (f *dviFont) drawBox(p canvasFont.Pather, x, y float64, gid uint16, box dviBox) float64 {
+	em := float64(f.sfnt.Head.UnitsPerEm)
+	height := (box.height + box.depth) * em // in font units
+	glyphs := []canvasFont.MathStretchedGlyph{{GlyphID: gid}}
+	if f.sfnt.Math != nil && !box.piece {
+		// allow a small shortfall since glyph variants are slightly smaller than the TeX boxes
+		glyphs, _ = f.sfnt.Math.Stretch(gid, int32(0.98*height), true)
+	}
+
+	ymin, ymax, advance := math.Inf(1), math.Inf(-1), 0.0
+	for _, glyph := range glyphs {
+		if _, glyphYMin, _, glyphYMax, err := f.sfnt.GlyphBounds(glyph.GlyphID); err == nil {
+			ymin = math.Min(ymin, float64(glyph.Offset)+float64(glyphYMin))
+			ymax = math.Max(ymax, float64(glyph.Offset)+float64(glyphYMax))
+		}
+		advance = math.Max(advance, float64(f.sfnt.GlyphAdvance(glyph.GlyphID)))
+	}
+	if ymax <= ymin {
+		return f.size * advance
+	}
+
+	yc := y + f.size*em*(box.height-box.depth)/2.0
+	if box.piece {
+		p = &dviStretchPather{p, yc, height / (ymax - ymin)}
+	}
+	for _, glyph := range glyphs {
+		yGlyph := yc + f.size*(float64(glyph.Offset)-(ymin+ymax)/2.0)
+		_ = f.sfnt.GlyphPath(p, glyph.GlyphID, 0, x, yGlyph, f.size, canvasFont.NoHinting)
+	}
+	return f.size * advance // in mm
+}
+
+// dviStretchPather scales the path vertically around y.
+type dviStretchPather struct {
+	canvasFont.Pather
+	y, scale float64
+}
+
+func (p *dviStretchPather) MoveTo(x, y float64) {
+	p.Pather.MoveTo(x, p.y+p.scale*(y-p.y))
+}
+
+func (p *dviStretchPather) LineTo(x, y float64) {
+	p.Pather.LineTo(x, p.y+p.scale*(y-p.y))
+}
+
+func (p *dviStretchPather) QuadTo(cpx, cpy, x, y float64) {
+	p.Pather.QuadTo(cpx, p.y+p.scale*(cpy-p.y), x, p.y+p.scale*(y-p.y))
+}
+
+func (p *dviStretchPather) CubeTo(cpx1, cpy1, cpx2, cpy2, x, y float64) {
+	p.Pather.CubeTo(cpx1, p.y+p.scale*(cpy1-p.y), cpx2, p.y+p.scale*(cpy2-p.y), x, p.y+p.scale*(y-p.y))
+}
+
+// cmexBoxes holds the heights and depths of the vertically sized characters of the cmex10 font as given by its TFM file.
+var cmexBoxes = map[uint32]dviBox{
+	// delimiters
+	0x00: {0.04, 1.16, false}, 0x01: {0.04, 1.16, false}, 0x02: {0.04, 1.16, false}, 0x03: {0.04, 1.16, false},
+	0x04: {0.04, 1.16, false}, 0x05: {0.04, 1.16, false}, 0x06: {0.04, 1.16, false}, 0x07: {0.04, 1.16, false},
+	0x08: {0.04, 1.16, false}, 0x09: {0.04, 1.16, false}, 0x0A: {0.04, 1.16, false}, 0x0B: {0.04, 1.16, false},
+	0x0E: {0.04, 1.16, false}, 0x0F: {0.04, 1.16, false},
+	0x10: {0.04, 1.76, false}, 0x11: {0.04, 1.76, false},
+	0x12: {0.04, 2.36, false}, 0x13: {0.04, 2.36, false}, 0x14: {0.04, 2.36, false}, 0x15: {0.04, 2.36, false},
+	0x16: {0.04, 2.36, false}, 0x17: {0.04, 2.36, false}, 0x18: {0.04, 2.36, false}, 0x19: {0.04, 2.36, false},
+	0x1A: {0.04, 2.36, false}, 0x1B: {0.04, 2.36, false}, 0x1C: {0.04, 2.36, false}, 0x1D: {0.04, 2.36, false},
+	0x1E: {0.04, 2.36, false}, 0x1F: {0.04, 2.36, false},
+	0x20: {0.04, 2.96, false}, 0x21: {0.04, 2.96, false}, 0x22: {0.04, 2.96, false}, 0x23: {0.04, 2.96, false},
+	0x24: {0.04, 2.96, false}, 0x25: {0.04, 2.96, false}, 0x26: {0.04, 2.96, false}, 0x27: {0.04, 2.96, false},
+	0x28: {0.04, 2.96, false}, 0x29: {0.04, 2.96, false}, 0x2A: {0.04, 2.96, false}, 0x2B: {0.04, 2.96, false},
+	0x2C: {0.04, 2.96, false}, 0x2D: {0.04, 2.96, false},
+	0x2E: {0.04, 1.76, false}, 0x2F: {0.04, 1.76, false},
+	0x44: {0.04, 1.76, false}, 0x45: {0.04, 1.76, false},
+	0x68: {0.04, 1.76, false}, 0x69: {0.04, 1.76, false}, 0x6A: {0.04, 1.76, false}, 0x6B: {0.04, 1.76, false},
+	0x6C: {0.04, 1.76, false}, 0x6D: {0.04, 1.76, false}, 0x6E: {0.04, 1.76, false}, 0x6F: {0.04, 1.76, false},
+
+	// radicals
+	0x70: {0.04, 1.16, false}, 0x71: {0.04, 1.76, false}, 0x72: {0.04, 2.36, false}, 0x73: {0.04, 2.96, false},
+
+	// big operators in text and display style
+	0x46: {0.0, 1.0, false}, 0x47: {0.1, 1.5, false}, 0x48: {0.0, 1.1111, false}, 0x49: {0.0, 2.2222, false},
+	0x4A: {0.0, 1.0, false}, 0x4B: {0.1, 1.5, false}, 0x4C: {0.0, 1.0, false}, 0x4D: {0.1, 1.5, false},
+	0x4E: {0.0, 1.0, false}, 0x4F: {0.1, 1.5, false}, 0x50: {0.0, 1.0, false}, 0x51: {0.0, 1.0, false},
+	0x52: {0.0, 1.1111, false}, 0x53: {0.0, 1.0, false}, 0x54: {0.0, 1.0, false}, 0x55: {0.0, 1.0, false},
+	0x56: {0.0, 1.0, false}, 0x57: {0.0, 1.0, false}, 0x58: {0.1, 1.5, false}, 0x59: {0.1, 1.5, false},
+	0x5A: {0.0, 2.2222, false}, 0x5B: {0.1, 1.5, false}, 0x5C: {0.1, 1.5, false}, 0x5D: {0.1, 1.5, false},
+	0x5E: {0.1, 1.5, false}, 0x5F: {0.1, 1.5, false}, 0x60: {0.0, 1.0, false}, 0x61: {0.1, 1.5, false},
+
+	// pieces of extensible delimiters
+	0x0C: {0.0, 0.6, true}, 0x0D: {0.0, 0.6, true},
+	0x30: {0.04, 1.76, true}, 0x31: {0.04, 1.76, true}, 0x32: {0.04, 1.76, true}, 0x33: {0.04, 1.76, true},
+	0x34: {0.04, 1.76, true}, 0x35: {0.04, 1.76, true}, 0x36: {0.0, 0.6, true}, 0x37: {0.0, 0.6, true},
+	0x38: {0.0, 0.9, true}, 0x39: {0.0, 0.9, true}, 0x3A: {0.0, 0.9, true}, 0x3B: {0.0, 0.9, true},
+	0x3C: {0.0, 1.8, true}, 0x3D: {0.0, 1.8, true}, 0x3E: {0.0, 0.3, true}, 0x3F: {0.0, 0.6, true},
+	0x40: {0.04, 1.76, true}, 0x41: {0.04, 1.76, true}, 0x42: {0.0, 0.6, true}, 0x43: {0.0, 0.6, true},
+	0x74: {0.0, 1.8, true}, 0x75: {0.0, 0.6, true}, 0x76: {0.04, 0.56, true}, 0x77: {0.0, 0.6, true},
+	0x78: {0.0, 0.6, true}, 0x79: {0.0, 0.6, true}, 0x7E: {0.0, 0.6, true}, 0x7F: {0.0, 0.6, true},
+}
+
+// cmapMSBM maps the Latin letters and digits to their double-struck counterparts, since TeX does not have the msbm font we draw \mathbb characters of the cmr font using this mapping.
+var cmapMSBM = func() map[uint32]rune {
+	cmap := map[uint32]rune{}
+	for i := uint32(0); i < 26; i++ {
+		cmap['A'+i] = 0x1D538 + rune(i)
+		cmap['a'+i] = 0x1D552 + rune(i)
+	}
+	for i := uint32(0); i < 10; i++ {
+		cmap['0'+i] = 0x1D7D8 + rune(i)
+	}
+	// letters in the Letterlike Symbols block
+	cmap['C'] = 0x2102
+	cmap['H'] = 0x210D
+	cmap['N'] = 0x2115
+	cmap['P'] = 0x2119
+	cmap['Q'] = 0x211A
+	cmap['R'] = 0x211D
+	cmap['Z'] = 0x2124
+	return cmap
+}()
+
 var cmapCMR = map[uint32]rune{
 	0x00: '\u0393',
 	0x01: '\u0394',
@@ -752,26 +916,26 @@ var cmapCMEX = map[uint32]rune{
 	0x2D: '\u2216',
 	0x2E: '\u002F',
 	0x2F: '\u2216',
-	0x30: '\u0028',
-	0x31: '\u0029',
-	0x32: '\u005B',
-	0x33: '\u005D',
-	0x34: '\u005B',
-	0x35: '\u005D',
-	0x36: '\u005B',
-	0x37: '\u005D',
-	0x38: '\u007B',
-	0x39: '\u007D',
-	0x3A: '\u007B',
-	0x3B: '\u007D',
-	0x3C: '\u007B',
-	0x3D: '\u007D',
-	0x3E: '\u007B',
+	0x30: '\u239B',
+	0x31: '\u239E',
+	0x32: '\u23A1',
+	0x33: '\u23A4',
+	0x34: '\u23A3',
+	0x35: '\u23A6',
+	0x36: '\u23A2',
+	0x37: '\u23A5',
+	0x38: '\u23A7',
+	0x39: '\u23AB',
+	0x3A: '\u23A9',
+	0x3B: '\u23AD',
+	0x3C: '\u23A8',
+	0x3D: '\u23AC',
+	0x3E: '\u23AA',
 	0x3F: '\u2191',
-	0x40: '\u0028',
-	0x41: '\u0029',
-	0x42: '\u0028',
-	0x43: '\u0029',
+	0x40: '\u239D',
+	0x41: '\u23A0',
+	0x42: '\u239C',
+	0x43: '\u239F',
 	0x44: '\u2329',
 	0x45: '\u232A',
 	0x46: '\u2294',
@@ -820,9 +984,9 @@ var cmapCMEX = map[uint32]rune{
 	0x71: '\u221A',
 	0x72: '\u221A',
 	0x73: '\u221A',
-	0x74: '\u221A',
-	0x75: '\u221A',
-	0x76: '\u221A',
+	0x74: '\u23B7',
+	0x75: '\u23D0',
+	0x76: '\u23D0',
 	0x77: '\u21D1',
 	0x78: '\u2191',
 	0x79: '\u2193',
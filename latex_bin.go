@@ -9,6 +9,7 @@ import (
 	"crypto/md5"
 	"errors"
 	"fmt"
+	"image/color"
 	"io"
 	"os"
 	"os/exec"
@@ -166,3 +167,21 @@ func ParseLaTeX(s string) (*Path, error) {
 		}
 	}
 }
+
+// ParseLaTeXFormula parses a LaTeX formatted string into a formula using the given fill color and font size. Colors set in LaTeX are not supported and the formula is filled with a single color.
+func ParseLaTeXFormula(s string, opts LaTeXOptions) (*LaTeXFormula, error) {
+	p, err := ParseLaTeX(s)
+	if err != nil {
+		return nil, err
+	}
+	fontSize := 10.0
+	if opts.FontSize != 0.0 && opts.FontSize != 10.0 {
+		fontSize = opts.FontSize
+		p = p.Scale(fontSize/10.0, fontSize/10.0)
+	}
+	return &LaTeXFormula{
+		Paths:  []*Path{p},
+		Colors: []color.RGBA{opts.Color},
+		Axis:   0.25 * fontSize * mmPerPt, // axis height of the cmsy10 font
+	}, nil
+}
@@ -3,10 +3,75 @@ package canvas
 import (
 	"encoding/binary"
 	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
 
 	canvasFont "github.com/tdewolff/canvas/font"
 )
 
+// LaTeXOptions are the options for parsing LaTeX formulas.
+type LaTeXOptions struct {
+	Color    color.RGBA // fill color of the formula, which can be changed by \color and \textcolor
+	FontSize float64    // in points
+}
+
+// DefaultLaTeXOptions are the default options for parsing LaTeX formulas.
+var DefaultLaTeXOptions = LaTeXOptions{
+	Color:    Black,
+	FontSize: 10.0,
+}
+
+// LaTeXFormula is a parsed LaTeX formula that consists of a path for each of its fill colors. The origin is on the baseline at the start of the formula.
+type LaTeXFormula struct {
+	Paths  []*Path
+	Colors []color.RGBA
+	Axis   float64 // height of the math axis above the baseline, which is the vertical center of fractions and operators
+}
+
+func (f *LaTeXFormula) path(col color.RGBA) *Path {
+	for i, c := range f.Colors {
+		if c == col {
+			return f.Paths[i]
+		}
+	}
+	f.Paths = append(f.Paths, &Path{})
+	f.Colors = append(f.Colors, col)
+	return f.Paths[len(f.Paths)-1]
+}
+
+// Path returns the formula as a single path, dropping the colors.
+func (f *LaTeXFormula) Path() *Path {
+	p := &Path{}
+	for _, q := range f.Paths {
+		p = p.Append(q)
+	}
+	return p
+}
+
+// Bounds returns the bounding box of the formula.
+func (f *LaTeXFormula) Bounds() Rect {
+	return f.Path().Bounds()
+}
+
+// Transform transforms the formula.
+func (f *LaTeXFormula) Transform(m Matrix) *LaTeXFormula {
+	for i := range f.Paths {
+		f.Paths[i] = f.Paths[i].Transform(m)
+	}
+	return f
+}
+
+// RenderTo renders the formula to a renderer.
+func (f *LaTeXFormula) RenderTo(r Renderer, m Matrix) {
+	for i, p := range f.Paths {
+		style := DefaultStyle
+		style.Fill.Color = f.Colors[i]
+		r.RenderPath(p, style, m)
+	}
+}
+
 // DVIFonts gets a font according to its font name and font size in points. Font names include:
 //
 //	cmr: Roman (5--10pt)
@@ -42,21 +107,54 @@ type state struct {
 
 // DVI2Path parses a DVI file (output from TeX) and returns a path.
 func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
+	formula, err := dvi2Formula(b, fonts, Black)
+	if err != nil {
+		return nil, err
+	}
+	return formula.Path(), nil
+}
+
+// dvi2Formula parses a DVI file and returns a formula with paths for each color. It supports the color specials "color push <color>" and "color pop", where the color is "rgb r g b", "gray g", "cmyk c m y k", or a CSS color name. The special "canvas origin" sets the origin of the formula, otherwise the baseline of the first character is used. The specials "canvas font push <name>" and "canvas font pop" override the font for the characters in between, which is used for fonts that TeX cannot load.
+func dvi2Formula(b []byte, fonts DVIFonts, col color.RGBA) (*LaTeXFormula, error) {
 	// state
 	var fnt uint32 // font index
 	s := state{}
 	stack := []state{}
 
-	f := 1.0                     // scale factor in mm/units
-	mag := uint32(1000)          // is set explicitly in preamble
-	fnts := map[uint32]DVIFont{} // selected fonts for indices
+	f := 1.0                        // scale factor in mm/units
+	mag := uint32(1000)             // is set explicitly in preamble
+	fnts := map[uint32]DVIFont{}    // selected fonts for indices
+	fntNames := map[uint32]string{} // font names for indices
+	fntScales := map[uint32]float64{}
 
 	// first position of baseline which will be the path's origin
 	firstChar := true
 	h0 := int32(0)
 	v0 := int32(0)
 
-	p := &Path{}
+	formula := &LaTeXFormula{}
+	colors := []color.RGBA{col}
+	overrides := []string{}
+	overrideFnts := map[string]DVIFont{}
+	font := func(fnt uint32) (DVIFont, bool) {
+		if 0 < len(overrides) {
+			// use the font size of the current font
+			name := fntNames[fnt]
+			i := len(name)
+			for 0 < i && '0' <= name[i-1] && name[i-1] <= '9' {
+				i--
+			}
+			name = overrides[len(overrides)-1] + name[i:]
+			if _, ok := overrideFnts[name]; !ok {
+				overrideFnts[name] = fonts.Get(name, fntScales[fnt])
+			}
+			return overrideFnts[name], true
+		}
+		dviFont, ok := fnts[fnt]
+		return dviFont, ok
+	}
+
+	p := formula.path(col)
 	r := &dviReader{b, 0}
 	for 0 < r.len() {
 		cmd := r.readByte()
@@ -67,10 +165,11 @@ func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
 				firstChar = false
 			}
 			c := uint32(cmd)
-			if _, ok := fnts[fnt]; !ok {
+			dviFont, ok := font(fnt)
+			if !ok {
 				return nil, fmt.Errorf("bad command: font %v undefined at position %v", fnt, r.i)
 			}
-			w := int32(fnts[fnt].Draw(p, f*float64(s.h), -f*float64(s.v), c) / f)
+			w := int32(dviFont.Draw(p, f*float64(s.h), -f*float64(s.v), c) / f)
 			s.h += w
 		} else if 128 <= cmd && cmd <= 131 {
 			// set
@@ -83,10 +182,11 @@ func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
 				return nil, fmt.Errorf("bad command: %v at position %v", cmd, r.i)
 			}
 			c := r.readUint32N(n)
-			if _, ok := fnts[fnt]; !ok {
+			dviFont, ok := font(fnt)
+			if !ok {
 				return nil, fmt.Errorf("bad command: font %v undefined at position %v", fnt, r.i)
 			}
-			s.h += int32(fnts[fnt].Draw(p, f*float64(s.h), -f*float64(s.v), c) / f)
+			s.h += int32(dviFont.Draw(p, f*float64(s.h), -f*float64(s.v), c) / f)
 		} else if cmd == 132 {
 			// set_rule
 			height := r.readInt32()
@@ -110,10 +210,11 @@ func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
 				return nil, fmt.Errorf("bad command: %v at position %v", cmd, r.i)
 			}
 			c := r.readUint32N(n)
-			if _, ok := fnts[fnt]; !ok {
+			dviFont, ok := font(fnt)
+			if !ok {
 				return nil, fmt.Errorf("bad command: font %v undefined at position %v", fnt, r.i)
 			}
-			fnts[fnt].Draw(p, f*float64(s.h), -f*float64(s.v), c)
+			dviFont.Draw(p, f*float64(s.h), -f*float64(s.v), c)
 		} else if cmd == 137 {
 			// put_rule
 			height := r.readInt32()
@@ -193,7 +294,7 @@ func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
 			if cmd == 161 {
 				s.v += s.y
 			} else {
-				n := int(cmd - 152)
+				n := int(cmd - 161)
 				if r.len() < n {
 					return nil, fmt.Errorf("bad command: %v at position %v", cmd, r.i)
 				}
@@ -217,7 +318,7 @@ func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
 		} else if 171 <= cmd && cmd <= 234 {
 			// fnt_num
 			fnt = uint32(cmd - 171)
-		} else if 235 <= cmd && cmd <= 242 {
+		} else if 235 <= cmd && cmd <= 238 {
 			// fnt
 			n := int(cmd - 234)
 			if r.len() < n {
@@ -226,7 +327,7 @@ func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
 			fnt = r.readUint32N(n)
 		} else if 239 <= cmd && cmd <= 242 {
 			// xxx
-			n := int(cmd - 242)
+			n := int(cmd - 238)
 			if r.len() < n {
 				return nil, fmt.Errorf("bad command: %v at position %v", cmd, r.i)
 			}
@@ -234,7 +335,24 @@ func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
 			if r.len() < k {
 				return nil, fmt.Errorf("bad command: %v at position %v", cmd, r.i)
 			}
-			_ = r.readBytes(k)
+			special := strings.Fields(r.readString(k))
+			if 2 <= len(special) && special[0] == "color" {
+				if special[1] == "push" {
+					colors = append(colors, parseDVIColor(special[2:]))
+				} else if special[1] == "pop" && 1 < len(colors) {
+					colors = colors[:len(colors)-1]
+				}
+				p = formula.path(colors[len(colors)-1])
+			} else if len(special) == 2 && special[0] == "canvas" && special[1] == "origin" {
+				h0, v0 = s.h, s.v
+				firstChar = false
+			} else if 3 <= len(special) && special[0] == "canvas" && special[1] == "font" {
+				if special[2] == "push" && 4 <= len(special) {
+					overrides = append(overrides, special[3])
+				} else if special[2] == "pop" && 0 < len(overrides) {
+					overrides = overrides[:len(overrides)-1]
+				}
+			}
 		} else if 243 <= cmd && cmd <= 246 {
 			// fnt_def
 			n := int(cmd - 242)
@@ -252,7 +370,9 @@ func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
 			}
 			_ = r.readString(int(a)) // area
 			name := r.readString(int(l))
-			fnts[k] = fonts.Get(name, float64(mag)*float64(size)/1000.0/float64(design))
+			fntNames[k] = name
+			fntScales[k] = float64(mag) * float64(size) / 1000.0 / float64(design)
+			fnts[k] = fonts.Get(name, fntScales[k])
 		} else if cmd == 247 {
 			// pre
 			_ = r.readByte() // version
@@ -283,8 +403,40 @@ func DVI2Path(b []byte, fonts DVIFonts) (*Path, error) {
 			return nil, fmt.Errorf("bad command: %v at position %v", cmd, r.i)
 		}
 	}
-	p = p.Translate(-f*float64(h0), f*float64(v0))
-	return p, nil
+	formula.Transform(Identity.Translate(-f*float64(h0), f*float64(v0)))
+	return formula, nil
+}
+
+func parseDVIColor(spec []string) color.RGBA {
+	if len(spec) == 0 {
+		return Black
+	}
+	comps := make([]float64, len(spec)-1)
+	for i := range comps {
+		comps[i], _ = strconv.ParseFloat(spec[i+1], 64)
+		comps[i] = math.Max(0.0, math.Min(1.0, comps[i]))
+	}
+	switch spec[0] {
+	case "rgb":
+		if len(comps) == 3 {
+			return color.RGBA{uint8(comps[0]*255.0 + 0.5), uint8(comps[1]*255.0 + 0.5), uint8(comps[2]*255.0 + 0.5), 255}
+		}
+	case "gray":
+		if len(comps) == 1 {
+			v := uint8(comps[0]*255.0 + 0.5)
+			return color.RGBA{v, v, v, 255}
+		}
+	case "cmyk":
+		if len(comps) == 4 {
+			k := 1.0 - comps[3]
+			return color.RGBA{uint8((1.0-comps[0])*k*255.0 + 0.5), uint8((1.0-comps[1])*k*255.0 + 0.5), uint8((1.0-comps[2])*k*255.0 + 0.5), 255}
+		}
+	default:
+		if col, ok := cssColors[strings.ToLower(spec[0])]; ok && len(spec) == 1 {
+			return col
+		}
+	}
+	return Black
 }
 
 type dviReader struct {
@@ -0,0 +1,54 @@
+package canvas
+
+import (
+	"fmt"
+	"image/color"
+	"testing"
+
+	canvasFont "github.com/tdewolff/canvas/font"
+	"github.com/tdewolff/test"
+)
+
+type dviTestFont struct {
+	name  string
+	draws *[]string
+}
+
+func (f dviTestFont) Draw(p canvasFont.Pather, x, y float64, c uint32) float64 {
+	*f.draws = append(*f.draws, fmt.Sprintf("%s %c %g %g", f.name, rune(c), x, y))
+	p.MoveTo(x, y)
+	p.LineTo(x+1.0, y)
+	p.LineTo(x+1.0, y+1.0)
+	p.Close()
+	return 1.0
+}
+
+type dviTestFonts struct {
+	draws []string
+}
+
+func (fonts *dviTestFonts) Get(name string, scale float64) DVIFont {
+	return dviTestFont{name, &fonts.draws}
+}
+
+func TestDVI2Formula(t *testing.T) {
+	b := []byte{
+		247, 2, 0, 0, 0x27, 0x10, 0, 0, 0, 1, 0, 0, 0x03, 0xE8, 0, // pre with one unit per millimeter
+		243, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 3, 'c', 'm', 'r', // fnt_def1 0
+		243, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 4, 'c', 'm', 'm', 'i', // fnt_def1 1
+		171,       // fnt_num_0
+		'a',       // set_char
+		163, 0, 5, // y2
+		'b',       // set_char
+		236, 0, 1, // fnt2
+		239, 19, // xxx1
+	}
+	b = append(b, "color push gray 0.5"...)
+	b = append(b, 'c') // set_char
+
+	fonts := &dviTestFonts{}
+	formula, err := dvi2Formula(b, fonts, Black)
+	test.Error(t, err)
+	test.T(t, fonts.draws, []string{"cmr a 0 0", "cmr b 1 -5", "cmmi c 2 -5"})
+	test.T(t, formula.Colors, []color.RGBA{Black, {128, 128, 128, 255}})
+}
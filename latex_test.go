@@ -0,0 +1,105 @@
+//go:build !latex
+// +build !latex
+
+package canvas
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/tdewolff/test"
+)
+
+func TestParseLaTeXDelimiters(t *testing.T) {
+	p, err := ParseLaTeX(`\left(\frac{a}{b}\right)`)
+	test.Error(t, err)
+
+	// the parentheses are the leftmost and rightmost subpaths, the fraction is in between
+	ps := p.Split()
+	left, right := ps[0].Bounds(), ps[0].Bounds()
+	for _, pi := range ps[1:] {
+		if bounds := pi.Bounds(); bounds.X < left.X {
+			left = bounds
+		} else if right.X+right.W < bounds.X+bounds.W {
+			right = bounds
+		}
+	}
+	frac := Rect{}
+	for _, pi := range ps {
+		if bounds := pi.Bounds(); left.X+left.W <= bounds.X && bounds.X+bounds.W <= right.X {
+			if frac.W == 0.0 {
+				frac = bounds
+			} else {
+				frac = frac.Add(bounds)
+			}
+		}
+	}
+	test.That(t, 0.0 < frac.H)
+	for _, paren := range []Rect{left, right} {
+		test.That(t, paren.Y-0.1 <= frac.Y && frac.Y+frac.H <= paren.Y+paren.H+0.1, "parenthesis", paren, "does not enclose fraction", frac)
+		test.That(t, paren.H < 1.5*frac.H, "parenthesis", paren, "much larger than fraction", frac)
+	}
+}
+
+func TestParseLaTeXFormula(t *testing.T) {
+	f, err := ParseLaTeXFormula(`x + \color{red} y + \textcolor{rgb 0 0 1}{z}`, LaTeXOptions{Color: Green, FontSize: 10.0})
+	test.Error(t, err)
+	test.T(t, f.Colors, []color.RGBA{Green, Red, Blue})
+	for _, p := range f.Paths {
+		test.That(t, !p.Empty())
+	}
+
+	// font size
+	small, err := ParseLaTeXFormula(`x^2`, DefaultLaTeXOptions)
+	test.Error(t, err)
+	large, err := ParseLaTeXFormula(`x^2`, LaTeXOptions{Color: Black, FontSize: 20.0})
+	test.Error(t, err)
+	test.Float(t, large.Bounds().H, 2.0*small.Bounds().H)
+
+	// styles
+	f, err = ParseLaTeXFormula(`\mathbb{R} \mathbf{x} \textbf{a}`, DefaultLaTeXOptions)
+	test.Error(t, err)
+	test.T(t, f.Colors, []color.RGBA{Black})
+	test.That(t, !f.Paths[0].Empty())
+}
+
+func TestRichTextAddLaTeX(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	f, err := ParseLaTeXFormula(`x^2`, DefaultLaTeXOptions)
+	test.Error(t, err)
+	test.Float(t, f.Axis, 0.25*10.0*mmPerPt)
+	bounds := f.Bounds()
+	test.That(t, -0.1 < bounds.Y && bounds.Y < 0.0, "formula does not sit on the baseline", bounds)
+
+	rt := NewRichText(face)
+	rt.WriteString("a ")
+	test.Error(t, rt.AddLaTeX(`\frac{a}{b}`))
+	rt.WriteString(" b")
+	text := rt.ToText(100.0, 100.0, Left, Top, 0.0, 0.0)
+
+	baselines := []float64{}
+	text.WalkSpans(func(x, y float64, span TextSpan) {
+		if span.IsText() {
+			baselines = append(baselines, y)
+		} else {
+			for _, obj := range span.Objects {
+				// the formula's baseline is at the depth of its canvas
+				test.That(t, 0.0 < obj.Depth)
+				_, objY := obj.View(x, y, span.Face).Pos()
+				baselines = append(baselines, objY+obj.Depth)
+			}
+		}
+	})
+	test.T(t, len(baselines), 3)
+	test.Float(t, baselines[1], baselines[0])
+	test.Float(t, baselines[2], baselines[0])
+
+	// the line includes the depth of the fraction
+	_, _, descent, _ := text.lines[0].Heights(HorizontalTB)
+	test.That(t, face.Metrics().Descent < descent)
+}
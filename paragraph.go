@@ -0,0 +1,75 @@
+package canvas
+
+import (
+	"math"
+)
+
+// Paragraph is a block of rich text that combines measuring, laying out, drawing, hit testing, and selecting text, as is commonly needed by user interfaces. The rich text is itemized and shaped once, so that laying it out again for another width, such as when resizing a window, is fast. Positions are relative to the top-left of the paragraph, which is drawn at the position passed to Draw, and y points upwards so that the lines have negative y-coordinates.
+type Paragraph struct {
+	HAlign      TextAlign // horizontal alignment, defaults to Left
+	Indent      float64   // first-line indentation in millimeters
+	LineStretch float64   // percentage to stretch the line height
+
+	prepared *PreparedText
+	text     *Text
+
+	// settings of the cached layout
+	width       float64
+	halign      TextAlign
+	indent      float64
+	lineStretch float64
+}
+
+// NewParagraph returns a paragraph for the rich text. Later changes to the rich text do not affect the paragraph.
+func NewParagraph(rt *RichText) *Paragraph {
+	return &Paragraph{
+		HAlign:   Left,
+		prepared: rt.Prepare(),
+	}
+}
+
+// Layout lays out the paragraph for the given width in millimeters, where zero width puts each paragraph on a single line, and returns the laid out text. The layout is cached so that laying out for the same width again is free, unless HAlign, Indent, or LineStretch have changed.
+func (p *Paragraph) Layout(width float64) *Text {
+	if p.text == nil || p.width != width || p.halign != p.HAlign || p.indent != p.Indent || p.lineStretch != p.LineStretch {
+		p.text = p.prepared.Layout(width, 0.0, p.HAlign, Top, p.Indent, p.LineStretch)
+		p.width = width
+		p.halign = p.HAlign
+		p.indent = p.Indent
+		p.lineStretch = p.LineStretch
+	}
+	return p.text
+}
+
+// Text returns the laid out text for the width of the last call to Layout, or without a width if Layout was not called.
+func (p *Paragraph) Text() *Text {
+	return p.Layout(p.width)
+}
+
+// Size returns the width and height of the laid out text in millimeters.
+func (p *Paragraph) Size() (float64, float64) {
+	text := p.Text()
+	top, bottom := text.Heights()
+	width := 0.0
+	for _, line := range text.lines {
+		for _, span := range line.spans {
+			width = math.Max(width, span.X+span.Width)
+		}
+	}
+	return width, top + bottom
+}
+
+// Draw draws the laid out text on the canvas with its top-left at (x,y).
+func (p *Paragraph) Draw(c *Canvas, x, y float64) {
+	c.RenderText(p.Text(), Identity.Translate(x, y))
+}
+
+// HitTest returns the byte offset into the text of the caret position closest to the point, such as for placing the caret at a click, see Text.IndexAt.
+func (p *Paragraph) HitTest(pos Point) int {
+	offset, _ := p.Text().IndexAt(pos.X, pos.Y)
+	return offset
+}
+
+// Selection returns the rectangles that cover the text between the byte offsets a and b, see Text.SelectionRects.
+func (p *Paragraph) Selection(a, b int) []Rect {
+	return p.Text().SelectionRects(a, b)
+}
@@ -0,0 +1,79 @@
+package canvas
+
+import (
+	"testing"
+
+	"github.com/tdewolff/test"
+)
+
+func TestParagraph(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	rt := NewRichText(face)
+	rt.Add(face, "The quick brown fox jumps over the lazy dog.")
+	p := NewParagraph(rt)
+
+	// layout is cached per width
+	text := p.Layout(40.0)
+	test.That(t, text == p.Layout(40.0), "layout must be cached")
+	test.That(t, text != p.Layout(60.0), "layout must be redone for another width")
+	text = p.Layout(40.0)
+	p.Indent = 5.0
+	test.That(t, text != p.Layout(40.0), "layout must be redone for another indentation")
+	test.That(t, p.Text() == p.Layout(40.0), "text must use the width of the last layout")
+	p.Indent = 0.0
+	text = p.Layout(40.0)
+	test.That(t, 1 < len(text.lines))
+	width, height := p.Size()
+	test.That(t, width <= 40.0)
+	_, bottom := text.Heights()
+	test.Float(t, height, bottom)
+
+	c := New(40.0, height)
+	p.Draw(c, 0.0, height)
+	test.T(t, len(c.Commands()), 1)
+
+	// click on the left half of the second glyph of the first line
+	x := face.TextWidth("T") + 0.25*face.TextWidth("h")
+	y := -text.lines[0].y
+	test.T(t, p.HitTest(Point{x, y}), 1)
+	test.T(t, p.HitTest(Point{x + 0.5*face.TextWidth("h"), y}), 2)
+	test.T(t, p.HitTest(Point{-10.0, 100.0}), 0)                                                 // above the first line
+	test.T(t, p.HitTest(Point{0.0, -height - 10.0}), len("The quick brown fox jumps over the ")) // below the last line
+
+	// selection of "quick" on the first line
+	rects := p.Selection(len("The "), len("The quick"))
+	test.T(t, len(rects), 1)
+	test.Float(t, rects[0].X, face.TextWidth("The "))
+	test.Float(t, rects[0].W, face.TextWidth("quick"))
+	test.That(t, rects[0].Y < y && y < rects[0].Y+rects[0].H, "selection must cover the baseline")
+
+	// selection over a line break results in a rectangle per line
+	rects = p.Selection(len("The qu"), len(rt.String()))
+	test.T(t, len(rects), len(text.lines))
+	test.That(t, rects[1].Y < rects[0].Y, "second line must be below the first")
+}
+
+func TestParagraphRTL(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	rt := NewRichText(face)
+	rt.Add(face, "ab אבג")
+	p := NewParagraph(rt)
+	text := p.Layout(0.0)
+	y := -text.lines[0].y
+
+	// the right-to-left word starts at its right edge
+	rtlStart := len("ab ")
+	width := face.TextWidth("ab אבג")
+	test.T(t, p.HitTest(Point{width, y}), rtlStart)
+	test.T(t, p.HitTest(Point{width - face.TextWidth("א"), y}), rtlStart+len("א"))
+
+	rects := p.Selection(0, rtlStart+len("א"))
+	test.T(t, len(rects), 2)
+	test.Float(t, rects[1].X+rects[1].W, width)
+}
@@ -166,7 +166,7 @@ func (p *Path) Len() int {
 	return n
 }
 
-// Append appends path q to p and returns a new path if successful (otherwise either p or q are returned).
+// Append appends path q to p and returns a new path if successful (otherwise either p or q are returned). Since every path starts with a MoveTo, the subpaths of q remain separate from those of p, even if q starts where p ends, and are thus stroked separately. Use Join to continue the last subpath of p if q starts where p ends, or AppendConnected to always connect them.
 func (p *Path) Append(q *Path) *Path {
 	if q == nil || q.Empty() {
 		return p
@@ -176,6 +176,21 @@ func (p *Path) Append(q *Path) *Path {
 	return &Path{append(p.d, q.d...)}
 }
 
+// AppendConnected appends path q to p and connects the end of p to the start of q with a straight line, so that the last subpath of p and the first subpath of q form one continuous subpath. No line is added if q starts where p ends. If p ends in a Close command, q is appended as a separate subpath as for Append.
+func (p *Path) AppendConnected(q *Path) *Path {
+	if q == nil || q.Empty() {
+		return p
+	} else if p == nil || p.Empty() {
+		return q
+	} else if p.d[len(p.d)-1] == CloseCmd {
+		return p.Append(q)
+	}
+
+	p = p.Copy()
+	p.LineTo(q.d[1], q.d[2])
+	return p.Join(q)
+}
+
 // Join joins path q to p and returns a new path if successful (otherwise either p or q are returned). It's like executing the commands in q to p in sequence, where if the first MoveTo of q doesn't coincide with p, or if p ends in Close, it will fallback to appending the paths.
 func (p *Path) Join(q *Path) *Path {
 	if q == nil || q.Empty() {
@@ -1903,6 +1918,15 @@ func (p *Path) String() string {
 
 // ToSVG returns a string that represents the path in the SVG path data format with minification.
 func (p *Path) ToSVG() string {
+	return p.toSVG(func(f float64) fmt.Stringer { return num(f) })
+}
+
+// ToSVGDecimals returns a string like ToSVG but with all numbers rounded to the given number of decimal places. Since coordinates are absolute, rounding errors do not accumulate along the path.
+func (p *Path) ToSVGDecimals(decimals int) string {
+	return p.toSVG(func(f float64) fmt.Stringer { return decimal{f, decimals} })
+}
+
+func (p *Path) toSVG(num func(float64) fmt.Stringer) string {
 	if p.Empty() {
 		return ""
 	}
@@ -2015,6 +2039,15 @@ func (p *Path) ToPS() string {
 
 // ToPDF returns a string that represents the path in the PDF data format.
 func (p *Path) ToPDF() string {
+	return p.toPDF(func(f float64) fmt.Stringer { return dec(f) })
+}
+
+// ToPDFDecimals returns a string like ToPDF but with all numbers rounded to the given number of decimal places.
+func (p *Path) ToPDFDecimals(decimals int) string {
+	return p.toPDF(func(f float64) fmt.Stringer { return decimal{f, decimals} })
+}
+
+func (p *Path) toPDF(dec func(float64) fmt.Stringer) string {
 	if p.Empty() {
 		return ""
 	}
@@ -2,6 +2,7 @@ package canvas
 
 import (
 	"math"
+	"sort"
 )
 
 // NOTE: implementation inspired from github.com/golang/freetype/raster/stroke.go
@@ -565,9 +566,198 @@ func (p *Path) Offset(w float64, fillRule FillRule, tolerance float64) *Path {
 	return q
 }
 
-// Stroke converts a path into a stroke of width w and returns a new path. It uses cr to cap the start and end of the path, and jr to join all path elements. If the path closes itself, it will use a join between the start and end instead of capping them. The tolerance is the maximum deviation from the original path when flattening Béziers and optimizing the stroke.
+// Stroke converts a path into a stroke of width w and returns a new path. It uses cr to cap the start and end of the path, and jr to join all path elements. If the path closes itself, it will use a join between the start and end instead of capping them. The tolerance is the maximum deviation from the original path when flattening Béziers and optimizing the stroke. The stroke may overlap itself and must be filled using the NonZero fill rule, use StrokeOutline to get the stroke's boundary instead.
 func (p *Path) Stroke(w float64, cr Capper, jr Joiner, tolerance float64) *Path {
+	return p.StrokeSubpaths(w, func(int) (Capper, Joiner) {
+		return cr, jr
+	}, tolerance)
+}
+
+// StrokeOutline converts a path into a stroke of width w like Stroke, but returns the boundary of the stroke as a path without (self-)intersections or overlapping parts. The filled area is on the left of each contour, such that filling contours are counter clockwise and holes are clockwise and the outline fills the same area for either fill rule. This holds also for self-intersecting paths of which the stroke overlaps itself, and allows using the outline for boolean operations or exporting it as a filled shape. The outline is flattened with the given tolerance.
+func (p *Path) StrokeOutline(w float64, cr Capper, jr Joiner, tolerance float64) *Path {
+	q := p.Stroke(w, cr, jr, tolerance).Flatten(tolerance)
+
+	// collect the edges of the stroke, which intersect where the stroke overlaps itself
+	type edge struct {
+		a, b Point
+		ts   []float64
+		ps   []Point
+	}
+	edges := []*edge{}
+	for _, qi := range q.Split() {
+		coords := qi.Coords()
+		if coords[0].Equals(coords[len(coords)-1]) {
+			coords[len(coords)-1] = coords[0] // make sure the contour closes exactly
+		} else {
+			coords = append(coords, coords[0])
+		}
+		for k := 1; k < len(coords); k++ {
+			if !coords[k-1].Equals(coords[k]) {
+				edges = append(edges, &edge{a: coords[k-1], b: coords[k]})
+			}
+		}
+	}
+
+	// split the edges at their intersections, using the same point for both edges
+	for i, ei := range edges {
+		for _, ej := range edges[i+1:] {
+			for _, z := range intersectEdges(ei.a, ei.b, ej.a, ej.b) {
+				ei.ts, ei.ps = append(ei.ts, z.TA), append(ei.ps, z.Point)
+				ej.ts, ej.ps = append(ej.ts, z.TB), append(ej.ps, z.Point)
+			}
+		}
+	}
+
+	// keep the pieces of edges that separate a filled and an unfilled area, with the filled area on their left
+	type piece struct{ a, b Point }
+	pieces := map[Point][]piece{}
+	seen := map[piece]bool{}
+	for _, e := range edges {
+		points := []Point{e.a}
+		order := make([]int, len(e.ts))
+		for k := range order {
+			order[k] = k
+		}
+		sort.Slice(order, func(k, l int) bool { return e.ts[order[k]] < e.ts[order[l]] })
+		for _, k := range order {
+			points = append(points, e.ps[k])
+		}
+		points = append(points, e.b)
+
+		for k := 1; k < len(points); k++ {
+			a, b := points[k-1], points[k]
+			if a.Equals(b) {
+				continue
+			}
+			d := b.Sub(a)
+			normal := d.Rot90CCW().Norm(math.Min(w, d.Length()) * 1e-3)
+			mid := a.Interpolate(b, 0.5)
+			left, right := mid.Add(normal), mid.Sub(normal)
+			leftFills, rightFills := q.Fills(left.X, left.Y, NonZero), q.Fills(right.X, right.Y, NonZero)
+			if leftFills == rightFills {
+				continue
+			} else if rightFills {
+				a, b = b, a
+			}
+			if !seen[piece{a, b}] {
+				seen[piece{a, b}] = true
+				pieces[a] = append(pieces[a], piece{a, b})
+			}
+		}
+	}
+
+	// chain the pieces into closed contours
+	outline := &Path{}
+	for len(pieces) != 0 {
+		var start Point
+		for start = range pieces {
+			break
+		}
+		outline.MoveTo(start.X, start.Y)
+		pos := start
+		for {
+			next, ok := pieces[pos]
+			if !ok {
+				break // cannot happen for closed contours
+			}
+			pc := next[len(next)-1]
+			if len(next) == 1 {
+				delete(pieces, pos)
+			} else {
+				pieces[pos] = next[:len(next)-1]
+			}
+			pos = pc.b
+			if pos.Equals(start) {
+				break
+			}
+			outline.LineTo(pos.X, pos.Y)
+		}
+		outline.Close()
+	}
+	return outline
+}
+
+// intersectEdges returns the intersections of the line segments a0-a1 and b0-b1 that split either segment, excluding the shared endpoints of consecutive segments. Collinear overlapping segments intersect at the endpoints lying on the other segment.
+func intersectEdges(a0, a1, b0, b1 Point) Intersections {
+	da, db := a1.Sub(a0), b1.Sub(b0)
+	denom := da.PerpDot(db)
+	zs := Intersections{}
+	if Equal(denom, 0.0) {
+		if !Equal(da.PerpDot(b0.Sub(a0)), 0.0) {
+			return zs // parallel
+		}
+		// collinear, add endpoints that lie strictly inside the other segment
+		project := func(p, o, d Point) float64 {
+			return p.Sub(o).Dot(d) / d.Dot(d)
+		}
+		for _, p := range []Point{b0, b1} {
+			if t := project(p, a0, da); Epsilon < t && t < 1.0-Epsilon {
+				zs = append(zs, Intersection{Point: p, TA: t, TB: project(p, b0, db)})
+			}
+		}
+		for _, p := range []Point{a0, a1} {
+			if t := project(p, b0, db); Epsilon < t && t < 1.0-Epsilon {
+				zs = append(zs, Intersection{Point: p, TA: project(p, a0, da), TB: t})
+			}
+		}
+		return zs
+	}
+
+	ta := b0.Sub(a0).PerpDot(db) / denom
+	tb := b0.Sub(a0).PerpDot(da) / denom
+	if ta < -Epsilon || 1.0+Epsilon < ta || tb < -Epsilon || 1.0+Epsilon < tb {
+		return zs
+	}
+	ta = math.Max(0.0, math.Min(1.0, ta))
+	tb = math.Max(0.0, math.Min(1.0, tb))
+	if (ta == 0.0 || ta == 1.0) && (tb == 0.0 || tb == 1.0) {
+		return zs // shared endpoints
+	}
+	z := a0.Interpolate(a1, ta)
+	if ta == 0.0 {
+		z = a0
+	} else if ta == 1.0 {
+		z = a1
+	} else if tb == 0.0 {
+		z = b0
+	} else if tb == 1.0 {
+		z = b1
+	}
+	return Intersections{{Point: z, TA: ta, TB: tb}}
+}
+
+// StrokeSubpaths converts a path into a stroke of width w like Stroke, but uses a different capper and joiner for each subpath. The style function is called with the index of each subpath in the order returned by Split and returns its capper and joiner, where nil defaults to ButtCap and MiterJoin respectively. This allows stroking the parts of a composite shape, such as an icon, with distinct caps in one path.
+func (p *Path) StrokeSubpaths(w float64, style func(i int) (Capper, Joiner), tolerance float64) *Path {
 	// TODO: start first point at intersection between last and first segment. This allows a rectangle to have a stroke with twice 1xM, 3xL and one z command, just like a rectangle itself.
+	q := &Path{}
+	halfWidth := w / 2.0
+	for i, ps := range p.Split() {
+		cr, jr := style(i)
+		if cr == nil {
+			cr = ButtCap
+		}
+		if jr == nil {
+			jr = MiterJoin
+		}
+		rhs, lhs := offsetSegment(ps, halfWidth, cr, jr, tolerance)
+		if lhs != nil { // closed path
+			// inner path should go opposite direction to cancel the outer path
+			if ps.CCW() {
+				q = q.Append(rhs)
+				q = q.Append(lhs.Reverse())
+			} else {
+				q = q.Append(lhs.Reverse())
+				q = q.Append(rhs)
+			}
+		} else {
+			q = q.Append(rhs)
+		}
+	}
+	return q
+}
+
+// StrokeVariable converts a path into a stroke with a width that varies along the path and returns a new path. The width function is evaluated at t, the fraction of the arc length along each subpath between 0 and 1. It uses cr to cap the start and end of the path, and jr to join all path elements. If the path closes itself, it will use a join between the start and end instead of capping them. The tolerance is the maximum deviation from the original path when flattening Béziers and from the width profile between evaluated points.
+func (p *Path) StrokeVariable(width func(t float64) float64, cr Capper, jr Joiner, tolerance float64) *Path {
 	if cr == nil {
 		cr = ButtCap
 	}
@@ -575,10 +765,11 @@ func (p *Path) Stroke(w float64, cr Capper, jr Joiner, tolerance float64) *Path
 		jr = MiterJoin
 	}
 	q := &Path{}
-	halfWidth := w / 2.0
-	for _, ps := range p.Split() {
-		rhs, lhs := offsetSegment(ps, halfWidth, cr, jr, tolerance)
-		if lhs != nil { // closed path
+	for _, ps := range p.Flatten(tolerance).Split() {
+		rhs, lhs := offsetVariableSegment(ps, width, cr, jr, tolerance)
+		if rhs == nil {
+			continue
+		} else if lhs != nil { // closed path
 			// inner path should go opposite direction to cancel the outer path
 			if ps.CCW() {
 				q = q.Append(rhs)
@@ -593,3 +784,96 @@ func (p *Path) Stroke(w float64, cr Capper, jr Joiner, tolerance float64) *Path
 	}
 	return q
 }
+
+// offsetVariableSegment returns the rhs and lhs paths of a flattened subpath offset by a varying half width. It returns nil for the lhs if the subpath is open, in which case the rhs is the capped outline.
+func offsetVariableSegment(p *Path, width func(float64) float64, cr Capper, jr Joiner, tolerance float64) (*Path, *Path) {
+	closed := p.Closed()
+	coords := p.Coords()
+	if closed && 1 < len(coords) && coords[0].Equals(coords[len(coords)-1]) {
+		coords = coords[:len(coords)-1]
+	}
+	if len(coords) < 2 {
+		return nil, nil
+	}
+	if closed {
+		coords = append(coords, coords[0])
+	}
+
+	// arc length at each point
+	ds := make([]float64, len(coords))
+	for i := 1; i < len(coords); i++ {
+		ds[i] = ds[i-1] + coords[i].Sub(coords[i-1]).Length()
+	}
+	length := ds[len(ds)-1]
+	if Equal(length, 0.0) {
+		return nil, nil
+	}
+
+	// subdivide segments where the width deviates from a linear interpolation
+	pts := []Point{coords[0]}
+	ts := []float64{0.0}
+	ws := []float64{width(0.0) / 2.0}
+	var subdivide func(Point, Point, float64, float64, float64, float64, int)
+	subdivide = func(p0, p1 Point, t0, t1, w0, w1 float64, depth int) {
+		tm := (t0 + t1) / 2.0
+		wm := width(tm) / 2.0
+		if depth < 16 && tolerance < math.Abs(wm-(w0+w1)/2.0) {
+			pm := p0.Interpolate(p1, 0.5)
+			subdivide(p0, pm, t0, tm, w0, wm, depth+1)
+			subdivide(pm, p1, tm, t1, wm, w1, depth+1)
+			return
+		}
+		pts = append(pts, p1)
+		ts = append(ts, t1)
+		ws = append(ws, w1)
+	}
+	for i := 1; i < len(coords); i++ {
+		t := ds[i] / length
+		subdivide(coords[i-1], coords[i], ts[len(ts)-1], t, ws[len(ws)-1], width(t)/2.0, 0)
+	}
+
+	// unit normals of each segment
+	ns := make([]Point, len(pts)-1)
+	for i := range ns {
+		ns[i] = pts[i+1].Sub(pts[i]).Rot90CW().Norm(1.0)
+	}
+
+	rhs, lhs := &Path{}, &Path{}
+	rStart := pts[0].Add(ns[0].Mul(ws[0]))
+	lStart := pts[0].Sub(ns[0].Mul(ws[0]))
+	rhs.MoveTo(rStart.X, rStart.Y)
+	lhs.MoveTo(lStart.X, lStart.Y)
+	for i, n := range ns {
+		w := ws[i+1]
+		rEnd := pts[i+1].Add(n.Mul(w))
+		lEnd := pts[i+1].Sub(n.Mul(w))
+		rhs.LineTo(rEnd.X, rEnd.Y)
+		lhs.LineTo(lEnd.X, lEnd.Y)
+
+		// join the cur and next path segments
+		if i+1 < len(ns) || closed {
+			next := ns[0]
+			if i+1 < len(ns) {
+				next = ns[i+1]
+			}
+			if !n.Equals(next) {
+				jr.Join(rhs, lhs, w, pts[i+1], n.Mul(w), next.Mul(w), math.NaN(), math.NaN())
+			}
+		}
+	}
+
+	if closed {
+		rhs.Close()
+		lhs.Close()
+		return rhs, lhs
+	}
+
+	// default to CCW direction
+	lhs = lhs.Reverse()
+	last := len(ns) - 1
+	cr.Cap(rhs, ws[last+1], pts[last+1], ns[last].Mul(ws[last+1]))
+	rhs = rhs.Join(lhs)
+	cr.Cap(rhs, ws[0], pts[0], ns[0].Mul(-ws[0]))
+	rhs.Close()
+	return rhs, nil
+}
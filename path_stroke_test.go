@@ -92,6 +92,71 @@ func TestPathStrokeEllipse(t *testing.T) {
 	}
 }
 
+func TestPathStrokeSubpaths(t *testing.T) {
+	p := MustParseSVGPath("M0 0L10 0M0 10L10 10")
+	q := p.StrokeSubpaths(2.0, func(i int) (Capper, Joiner) {
+		if i == 0 {
+			return RoundCap, nil
+		}
+		return ButtCap, nil
+	}, Tolerance)
+
+	ps := q.Split()
+	test.T(t, len(ps), 2)
+	test.T(t, ps[0].Bounds(), Rect{-1.0, -1.0, 12.0, 2.0}) // round caps
+	test.T(t, ps[1].Bounds(), Rect{0.0, 9.0, 10.0, 2.0})   // butt caps
+}
+
+func TestPathStrokeOutline(t *testing.T) {
+	// a line
+	q := MustParseSVGPath("M0 0L10 0").StrokeOutline(2.0, ButtCap, MiterJoin, Tolerance)
+	test.T(t, len(q.Split()), 1)
+	test.That(t, q.Closed())
+	test.Float(t, PolylineFromPath(q).Area(), 20.0)
+
+	// two crossing lines overlap at a square
+	q = MustParseSVGPath("M0 0L10 0M5 -5L5 5").StrokeOutline(2.0, ButtCap, MiterJoin, Tolerance)
+	test.T(t, len(q.Split()), 1)
+	test.Float(t, PolylineFromPath(q).Area(), 36.0)
+
+	// a self-intersecting bowtie keeps its holes for either fill rule
+	q = MustParseSVGPath("M0 0L10 10L10 0L0 10z").StrokeOutline(1.0, ButtCap, MiterJoin, Tolerance)
+	for _, fillRule := range []FillRule{NonZero, EvenOdd} {
+		test.That(t, q.Fills(5.0, 5.0, fillRule), "crossing must be filled")
+		test.That(t, q.Fills(10.0, 5.0, fillRule), "stroke must be filled")
+		test.That(t, !q.Fills(2.0, 5.0, fillRule), "hole must not be filled")
+		test.That(t, !q.Fills(8.0, 5.0, fillRule), "hole must not be filled")
+	}
+
+	// a ring has a counter clockwise outer and a clockwise inner contour
+	q = MustParseSVGPath("M0 0L10 0L10 10L0 10z").StrokeOutline(2.0, ButtCap, MiterJoin, Tolerance)
+	ps := q.Split()
+	test.T(t, len(ps), 2)
+	test.That(t, ps[0].CCW() != ps[1].CCW())
+	test.Float(t, PolylineFromPath(q).Area(), 80.0)
+}
+
+func TestPathStrokeVariable(t *testing.T) {
+	width := func(t float64) float64 { return 1.0 + 4.0*t }
+	p := MustParseSVGPath("M0 0L10 0").StrokeVariable(width, ButtCap, RoundJoin, 0.01)
+	test.T(t, p, MustParseSVGPath("M0 -0.5L10 -2.5L10 2.5L0 0.5z"))
+	test.T(t, p.Bounds(), Rect{0.0, -2.5, 10.0, 5.0})
+
+	// widens along the path
+	p = MustParseSVGPath("M0 0L10 0L10 10").StrokeVariable(width, ButtCap, MiterJoin, 0.01)
+	test.Float(t, p.Bounds().Y, -1.5)
+	test.Float(t, p.Bounds().X+p.Bounds().W, 12.5)
+
+	// non-linear width is subdivided
+	p = MustParseSVGPath("M0 0L10 0").StrokeVariable(func(t float64) float64 { return 1.0 + 4.0*math.Sin(math.Pi*t) }, ButtCap, RoundJoin, 0.01)
+	test.Float(t, p.Bounds().H, 5.0)
+	test.That(t, 10 < len(p.Coords()))
+
+	// closed paths
+	p = MustParseSVGPath("M0 0L10 0L10 10L0 10z").StrokeVariable(func(float64) float64 { return 2.0 }, ButtCap, MiterJoin, 0.01)
+	test.T(t, p.Bounds(), Rect{-1.0, -1.0, 12.0, 12.0})
+}
+
 func TestPathOffset(t *testing.T) {
 	tolerance := 0.01
 	var tts = []struct {
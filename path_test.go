@@ -54,6 +54,24 @@ func TestPathAppend(t *testing.T) {
 	test.T(t, p, MustParseSVGPath("M5 0L5 10M0 0L10 15M20 15L25 15"))
 }
 
+func TestPathAppendConnected(t *testing.T) {
+	test.T(t, MustParseSVGPath("M5 0L5 10").AppendConnected(nil), MustParseSVGPath("M5 0L5 10"))
+	test.T(t, (&Path{}).AppendConnected(MustParseSVGPath("M5 0L5 10")), MustParseSVGPath("M5 0L5 10"))
+
+	p := MustParseSVGPath("M0 0L5 0")
+	q := MustParseSVGPath("M10 0L10 5")
+	test.T(t, len(p.Append(q).Split()), 2)
+	test.T(t, len(p.AppendConnected(q).Split()), 1)
+	test.T(t, p.AppendConnected(q), MustParseSVGPath("M0 0L10 0L10 5"))
+	test.T(t, p, MustParseSVGPath("M0 0L5 0"))
+
+	p = MustParseSVGPath("M0 0L5 0").AppendConnected(MustParseSVGPath("M5 0L5 5M10 10L15 10"))
+	test.T(t, p, MustParseSVGPath("M0 0L5 0L5 5M10 10L15 10"))
+
+	p = MustParseSVGPath("M0 0L5 0L5 5z").AppendConnected(MustParseSVGPath("M10 0L10 5"))
+	test.T(t, p, MustParseSVGPath("M0 0L5 0L5 5zM10 0L10 5"))
+}
+
 func TestPathJoin(t *testing.T) {
 	test.T(t, MustParseSVGPath("M5 0L5 10").Join(nil), MustParseSVGPath("M5 0L5 10"))
 	test.T(t, (&Path{}).Join(MustParseSVGPath("M5 0L5 10")), MustParseSVGPath("M5 0L5 10"))
@@ -812,6 +830,24 @@ func TestPathToSVG(t *testing.T) {
 	}
 }
 
+func TestPathToSVGDecimals(t *testing.T) {
+	var tts = []struct {
+		p   string
+		svg string
+	}{
+		{"L10.004 0Q15.126 10 20 0", "M0 0H10Q15.13 10 20 0"},
+		{"M0.333 0.333L0.667 0.5L1.001 1.001", "M.33 .33L.67 .5L1 1"},
+		{"A5.556 5.556 30 0 1 10 0", "M0 0A5.56 5.56 30 0110 0"},
+	}
+	for _, tt := range tts {
+		t.Run(tt.p, func(t *testing.T) {
+			p := MustParseSVGPath(tt.p)
+			test.T(t, p.ToSVGDecimals(2), tt.svg)
+		})
+	}
+	test.T(t, MustParseSVGPath("M0.333 0.333L1.001 1.001").ToPDFDecimals(1), ".3 .3 m 1 1 l")
+}
+
 func TestPathToPS(t *testing.T) {
 	var tts = []struct {
 		p  string
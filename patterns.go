@@ -1,6 +1,7 @@
 package canvas
 
 import (
+	"image"
 	"image/color"
 	"math"
 )
@@ -31,17 +32,119 @@ type Pattern interface {
 //	p.c.RenderViewTo(r, p.cell)
 //}
 
-//type ImagePattern struct {
-//	img  *image.RGBA
-//	cell Matrix
-//}
-//
-//func NewImagePattern() *ImagePattern {
-//	return &ImagePattern{}
-//}
-//
-//func (p *ImagePattern) ClipTo(r Renderer, clip *Path) {
-//}
+// ImageWrap is the method of extending an image paint beyond the bounds of its image. ImageClamp extends the pixels at the image's edges and ImageRepeat tiles the image.
+type ImageWrap int
+
+// See ImageWrap.
+const (
+	ImageClamp ImageWrap = iota
+	ImageRepeat
+)
+
+// ImagePaint is a filling pattern that maps an image onto a path by an affine transformation. Matrix transforms the image coordinates, that is in pixels with the origin in the bottom-left corner of the image as for RenderImage, to the coordinates of the path, so that the image follows the path's transformation.
+type ImagePaint struct {
+	Image  image.Image
+	Matrix Matrix
+	Wrap   ImageWrap
+}
+
+// NewImagePaint returns a new image paint that maps the image by the given matrix and extends it using the wrap method.
+func NewImagePaint(img image.Image, m Matrix, wrap ImageWrap) *ImagePaint {
+	return &ImagePaint{
+		Image:  img,
+		Matrix: m,
+		Wrap:   wrap,
+	}
+}
+
+// SetView sets the view. Automatically called by Canvas for coordinate system transformations, which are already part of the path's transformation.
+func (p *ImagePaint) SetView(view Matrix) Pattern {
+	return p
+}
+
+// SetColorSpace sets the color space. Automatically called by the rasterizer.
+func (p *ImagePaint) SetColorSpace(colorSpace ColorSpace) Pattern {
+	if _, ok := colorSpace.(LinearColorSpace); ok {
+		return p
+	}
+
+	bounds := p.Image.Bounds()
+	img := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.SetRGBA(x, y, colorSpace.ToLinear(p.Image.At(x, y)))
+		}
+	}
+	paint := *p
+	paint.Image = img
+	return &paint
+}
+
+// At returns the color at position (x,y) in image coordinates, interpolated bilinearly between the centers of the surrounding pixels.
+func (p *ImagePaint) At(x, y float64) color.RGBA {
+	bounds := p.Image.Bounds()
+	size := bounds.Size()
+	if size.X == 0 || size.Y == 0 {
+		return Transparent
+	}
+
+	// position relative to the center of the top-left pixel
+	u := x - 0.5
+	v := float64(size.Y) - y - 0.5
+	i, j := int(math.Floor(u)), int(math.Floor(v))
+	tx, ty := u-float64(i), v-float64(j)
+
+	var c [4]float64
+	for k, w := range [4]float64{(1.0 - tx) * (1.0 - ty), tx * (1.0 - ty), (1.0 - tx) * ty, tx * ty} {
+		if w == 0.0 {
+			continue
+		}
+		R, G, B, A := p.Image.At(bounds.Min.X+p.wrap(i+k%2, size.X), bounds.Min.Y+p.wrap(j+k/2, size.Y)).RGBA()
+		c[0] += w * float64(R)
+		c[1] += w * float64(G)
+		c[2] += w * float64(B)
+		c[3] += w * float64(A)
+	}
+	return color.RGBA{
+		uint8(c[0]/257.0 + 0.5),
+		uint8(c[1]/257.0 + 0.5),
+		uint8(c[2]/257.0 + 0.5),
+		uint8(c[3]/257.0 + 0.5),
+	}
+}
+
+// wrap maps the pixel index i into [0,n).
+func (p *ImagePaint) wrap(i, n int) int {
+	if p.Wrap == ImageRepeat {
+		if i %= n; i < 0 {
+			i += n
+		}
+		return i
+	} else if i < 0 {
+		return 0
+	} else if n <= i {
+		return n - 1
+	}
+	return i
+}
+
+// ClipTo fills the clipping path with the mean color of the image. Renderers that support image paints, such as the rasterizer and PDF, sample the image instead.
+func (p *ImagePaint) ClipTo(r Renderer, clip *Path) {
+	var c [4]float64
+	bounds := p.Image.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			R, G, B, A := p.Image.At(x, y).RGBA()
+			c[0] += float64(R)
+			c[1] += float64(G)
+			c[2] += float64(B)
+			c[3] += float64(A)
+		}
+	}
+	n := 257.0 * math.Max(1.0, float64(bounds.Dx()*bounds.Dy()))
+	mean := color.RGBA{uint8(c[0]/n + 0.5), uint8(c[1]/n + 0.5), uint8(c[2]/n + 0.5), uint8(c[3]/n + 0.5)}
+	r.RenderPath(clip, Style{Fill: Paint{Color: mean}}, Identity)
+}
 
 // Hatch pattern is a filling hatch pattern.
 type HatchPattern struct {
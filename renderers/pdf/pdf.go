@@ -5,13 +5,18 @@ import (
 	"image"
 	"io"
 	"math"
+	"sort"
 
 	"github.com/tdewolff/canvas"
+	canvasText "github.com/tdewolff/canvas/text"
 )
 
 type Options struct {
 	Compress    bool
 	SubsetFonts bool
+	Type3Fonts  bool // embed horizontal fonts as Type3 fonts with a content stream per glyph, which draws color and bitmap glyphs
+	Tagged      bool // write a structure tree of paragraphs and spans of text for accessibility (tagged PDF), except for text in isolated groups, alpha groups, and masks, which are drawn in form XObjects and are left untagged
+	Decimals    int  // number of decimal places of path coordinates, zero uses canvas.Precision
 	canvas.ImageEncoding
 }
 
@@ -26,6 +31,9 @@ type PDF struct {
 	w             *pdfPageWriter
 	width, height float64
 	opts          *Options
+
+	groups []*pdfPageWriter // writers of the backdrops of the open groups, nil for non-isolated groups
+	alphas []float64        // opacities of the open groups
 }
 
 // New returns a portable document format (PDF) renderer.
@@ -38,6 +46,8 @@ func New(w io.Writer, width, height float64, opts *Options) *PDF {
 	page := newPDFWriter(w).NewPage(width, height)
 	page.pdf.SetCompression(opts.Compress)
 	page.pdf.SetFontSubsetting(opts.SubsetFonts)
+	page.pdf.SetType3Fonts(opts.Type3Fonts)
+	page.pdf.SetTagged(opts.Tagged)
 	return &PDF{
 		w:      page,
 		width:  width,
@@ -67,6 +77,9 @@ func (r *PDF) NewPage(width, height float64) {
 
 // Close finished and closes the PDF.
 func (r *PDF) Close() error {
+	for 0 < len(r.groups) {
+		r.EndGroup()
+	}
 	return r.w.pdf.Close()
 }
 
@@ -75,8 +88,63 @@ func (r *PDF) Size() (float64, float64) {
 	return r.width, r.height
 }
 
+func (r *PDF) pathData(path *canvas.Path) string {
+	if 0 < r.opts.Decimals {
+		return path.ToPDFDecimals(r.opts.Decimals)
+	}
+	return path.ToPDF()
+}
+
+// RenderMasked renders a canvas masked by another canvas, both are transformed by the matrix. The mask's luminosity is used as the soft mask when luminosity is true, otherwise its alpha channel is used.
+func (r *PDF) RenderMasked(c, mask *canvas.Canvas, luminosity bool, m canvas.Matrix) {
+	w := r.w
+	content := w.NewForm()
+	r.w = content
+	c.RenderViewTo(r, m)
+
+	maskContent := w.NewForm()
+	r.w = maskContent
+	mask.RenderViewTo(r, m)
+
+	r.w = w
+	w.DrawMasked(content, maskContent, luminosity)
+}
+
+// BeginGroup starts a group of drawing operations. An isolated group is drawn in a transparency group form XObject, so that blend modes within the group do not mix with the backdrop.
+func (r *PDF) BeginGroup(isolate bool) {
+	if !isolate {
+		r.groups = append(r.groups, nil)
+		r.alphas = append(r.alphas, 1.0)
+		return
+	}
+	r.BeginAlphaGroup(1.0)
+}
+
+// BeginAlphaGroup starts an isolated group of drawing operations that is drawn in a transparency group form XObject, which is composited at the given opacity using the /ca and /CA entries of the graphics state.
+func (r *PDF) BeginAlphaGroup(alpha float64) {
+	r.groups = append(r.groups, r.w)
+	r.alphas = append(r.alphas, alpha)
+	r.w = r.w.NewForm()
+}
+
+// EndGroup ends the last group of drawing operations and composites it onto the backdrop.
+func (r *PDF) EndGroup() {
+	if len(r.groups) == 0 {
+		return
+	}
+	w, alpha := r.groups[len(r.groups)-1], r.alphas[len(r.alphas)-1]
+	r.groups = r.groups[:len(r.groups)-1]
+	r.alphas = r.alphas[:len(r.alphas)-1]
+	if w != nil {
+		w.DrawForm(r.w, alpha)
+		r.w = w
+	}
+}
+
 // RenderPath renders a path to the canvas using a style and a transformation matrix.
 func (r *PDF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	r.w.SetBlendMode(style.BlendMode)
+
 	// PDFs don't support the arcs joiner, miter joiner (not clipped), or miter joiner (clipped) with non-bevel fallback
 	strokeUnsupported := false
 	if _, ok := style.StrokeJoiner.(canvas.ArcsJoiner); ok {
@@ -110,12 +178,18 @@ func (r *PDF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 	//}
 
 	closed := false
-	data := path.Transform(m).ToPDF()
+	data := r.pathData(path.Transform(m))
 	if 1 < len(data) && data[len(data)-1] == 'h' {
 		data = data[:len(data)-2]
 		closed = true
 	}
 
+	if paint, ok := style.Fill.Pattern.(*canvas.ImagePaint); ok && style.HasFill() {
+		bounds := path.Transform(paint.Matrix.Inv()).FastBounds()
+		r.w.DrawImagePaint(paint, data, style.FillRule, bounds, r.opts.ImageEncoding, m)
+		style.Fill = canvas.Paint{}
+	}
+
 	if !style.HasStroke() || !strokeUnsupported {
 		if style.HasFill() && !style.HasStroke() {
 			r.w.SetFill(style.Fill)
@@ -206,47 +280,104 @@ func (r *PDF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 
 		r.w.SetFill(style.Stroke)
 		r.w.Write([]byte(" "))
-		r.w.Write([]byte(path.Transform(m).ToPDF()))
+		r.w.Write([]byte(r.pathData(path.Transform(m))))
 		r.w.Write([]byte(" f"))
 	}
 }
 
 // RenderText renders a text object to the canvas using a transformation matrix.
 func (r *PDF) RenderText(text *canvas.Text, m canvas.Matrix) {
+	r.w.SetBlendMode(canvas.BlendNormal)
 	text.WalkDecorations(func(fill canvas.Paint, p *canvas.Path) {
 		style := canvas.DefaultStyle
 		style.Fill = fill
 		r.RenderPath(p, style, m)
 	})
 
+	// tag the paragraphs of text drawn directly on the page, with their spans in logical order
+	var paragraphs []canvasText.Paragraph
+	var structure []*pdfStructElem
+	var clusters [][]int // logical position of the spans per paragraph
+	if r.w.pdf.tagged && r.w == r.w.pdf.page {
+		paragraphs = canvasText.Paragraphs(text.String(), canvasText.DirectionInvalid, canvasText.LeftToRight)
+		structure = make([]*pdfStructElem, len(paragraphs))
+		clusters = make([][]int, len(paragraphs))
+		for i := range paragraphs {
+			structure[i] = &pdfStructElem{tag: "P", page: len(r.w.pdf.pages), kids: []*pdfStructElem{}}
+		}
+	}
+
 	text.WalkSpans(func(x, y float64, span canvas.TextSpan) {
 		if span.IsText() {
 			style := canvas.DefaultStyle
 			style.Fill = span.Face.Fill
 
+			marked := structure != nil && 0 < len(span.Glyphs)
+			if marked {
+				cluster := int(span.Glyphs[0].Cluster)
+				for _, glyph := range span.Glyphs[1:] {
+					if int(glyph.Cluster) < cluster {
+						cluster = int(glyph.Cluster)
+					}
+				}
+				i := 0
+				for i+1 < len(paragraphs) && paragraphs[i].End <= cluster {
+					i++
+				}
+				k := sort.SearchInts(clusters[i], cluster+1) // after spans of the same cluster
+				mcid := r.w.BeginMarkedContent("Span")
+				elem := &pdfStructElem{tag: "Span", page: len(r.w.pdf.pages), mcid: mcid}
+				structure[i].kids = append(structure[i].kids[:k], append([]*pdfStructElem{elem}, structure[i].kids[k:]...)...)
+				clusters[i] = append(clusters[i][:k], append([]int{cluster}, clusters[i][k:]...)...)
+			}
+
 			r.w.StartTextObject()
 			r.w.SetFill(span.Face.Fill)
 			r.w.SetFont(span.Face.Font, span.Face.Size, span.Direction)
-			r.w.SetTextPosition(m.Translate(x, y).Shear(span.Face.FauxItalic, 0.0))
+			position := m.Translate(x, y)
+			if text.WritingMode == canvas.HorizontalTB && span.Rotation != canvasText.NoRotation {
+				// vertical text is rotated per glyph by WriteText
+				position = position.Rotate(float64(span.Rotation))
+			}
+			r.w.SetTextPosition(position.Shear(span.Face.FauxItalic, 0.0))
 
-			if 0.0 < span.Face.FauxBold {
+			if span.Face.HasStroke() {
+				if span.Face.Fill.Has() {
+					r.w.SetTextRenderMode(2)
+				} else {
+					r.w.SetTextRenderMode(1)
+				}
+				r.w.SetStroke(span.Face.Stroke)
+				r.w.SetLineWidth(span.Face.StrokeWidth)
+				r.w.SetLineJoin(canvas.RoundJoin)
+			} else if bold := span.Face.FauxBold + span.Face.Embolden; 0.0 < bold {
 				r.w.SetTextRenderMode(2)
 				r.w.SetStroke(span.Face.Fill)
-				fmt.Fprintf(r.w, " %v w", dec(span.Face.FauxBold*2.0))
+				fmt.Fprintf(r.w, " %v w", dec(bold*2.0))
 			} else {
 				r.w.SetTextRenderMode(0)
 			}
 			r.w.WriteText(text.WritingMode, span.Glyphs)
 			r.w.EndTextObject()
+			if marked {
+				r.w.EndMarkedContent()
+			}
 		} else {
 			for _, obj := range span.Objects {
 				obj.Canvas.RenderViewTo(r, m.Mul(obj.View(x, y, span.Face)))
 			}
 		}
 	})
+
+	for _, paragraph := range structure {
+		if 0 < len(paragraph.kids) {
+			r.w.pdf.structure = append(r.w.pdf.structure, paragraph)
+		}
+	}
 }
 
 // RenderImage renders an image to the canvas using a transformation matrix.
 func (r *PDF) RenderImage(img image.Image, m canvas.Matrix) {
+	r.w.SetBlendMode(canvas.BlendNormal)
 	r.w.DrawImage(img, r.opts.ImageEncoding, m)
 }
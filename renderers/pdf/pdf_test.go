@@ -3,12 +3,15 @@ package pdf
 import (
 	"bytes"
 	"image"
+	"image/color"
 	"io"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/tdewolff/canvas"
+	canvasFont "github.com/tdewolff/canvas/font"
 	"github.com/tdewolff/test"
 )
 
@@ -107,6 +110,99 @@ func doTestPDFText(t *testing.T, subsetFonts bool, expectedSize int, filename st
 	test.That(t, expectedSize-1000 < written && written < expectedSize+1000, "Unexpected rendering result length")
 }
 
+func TestPDFType3Font(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile(fontDir+"DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+
+	face := dejaVuSerif.Face(12, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	text := canvas.NewTextLine(face, "Type3", canvas.Left)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210, 297, &Options{Compress: false, SubsetFonts: true, Type3Fonts: true})
+	pdf.RenderText(text, canvas.Identity.Translate(15, 250))
+	test.Error(t, pdf.Close())
+
+	out := buf.String()
+	test.That(t, strings.Contains(out, "/Subtype /Type3"), "missing Type3 font dictionary")
+	test.That(t, strings.Contains(out, "/CharProcs"), "missing CharProcs")
+	test.That(t, strings.Contains(out, "/FontMatrix [.001 0 0 .001 0 0]"), "missing FontMatrix")
+	test.That(t, !strings.Contains(out, "/FontFile3"), "unexpected embedded font program")
+	test.That(t, strings.Contains(out, "[(\x01\x02\x03\x04\x05)]TJ"), "unexpected single-byte character codes")
+	test.That(t, strings.Contains(out, " d1 "), "missing glyph content stream")
+}
+
+func TestPDFType3FontBlocks(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile(fontDir+"DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+
+	// more than 256 glyphs are split over two Type3 fonts
+	var sb strings.Builder
+	for r := rune(0x21); r < 0x180; r++ {
+		if r < 0x7F || 0xA1 <= r {
+			sb.WriteRune(r)
+		}
+	}
+	face := dejaVuSerif.Face(12, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	text := canvas.NewTextLine(face, sb.String(), canvas.Left)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210, 297, &Options{Compress: false, SubsetFonts: true, Type3Fonts: true})
+	pdf.RenderText(text, canvas.Identity.Translate(15, 250))
+	test.Error(t, pdf.Close())
+
+	out := buf.String()
+	test.T(t, strings.Count(out, "/Subtype /Type3"), 2)
+	test.That(t, regexp.MustCompile(`\)\]TJ /F1 [0-9.]+ Tf \[\(`).MatchString(out), "missing switch to the second Type3 font")
+	test.That(t, !strings.Contains(out, "/LastChar 256"), "more than 256 glyphs in a Type3 font")
+}
+
+func TestPDFType3ColorGlyph(t *testing.T) {
+	b, err := os.ReadFile(fontDir + "DejaVuSerif.ttf")
+	test.Error(t, err)
+	sfnt, err := canvasFont.ParseSFNT(b, 0)
+	test.Error(t, err)
+
+	// the glyph of A has a layer of B in red and a layer of C in the text color
+	colr := canvasFont.NewBinaryWriter([]byte{})
+	colr.WriteUint16(0)  // version
+	colr.WriteUint16(1)  // numBaseGlyphRecords
+	colr.WriteUint32(14) // baseGlyphRecordsOffset
+	colr.WriteUint32(20) // layerRecordsOffset
+	colr.WriteUint16(2)  // numLayerRecords
+	colr.WriteUint16(sfnt.GlyphIndex('A'))
+	colr.WriteUint16(0) // firstLayerIndex
+	colr.WriteUint16(2) // numLayers
+	colr.WriteUint16(sfnt.GlyphIndex('B'))
+	colr.WriteUint16(0) // paletteIndex
+	colr.WriteUint16(sfnt.GlyphIndex('C'))
+	colr.WriteUint16(canvasFont.ForegroundPaletteIndex)
+	cpal := canvasFont.NewBinaryWriter([]byte{})
+	cpal.WriteUint16(0)  // version
+	cpal.WriteUint16(1)  // numPaletteEntries
+	cpal.WriteUint16(1)  // numPalettes
+	cpal.WriteUint16(1)  // numColorRecords
+	cpal.WriteUint32(14) // colorRecordsArrayOffset
+	cpal.WriteUint16(0)  // colorRecordIndices
+	cpal.WriteBytes([]byte{0, 0, 255, 255})
+	sfnt.Tables["COLR"] = colr.Bytes()
+	sfnt.Tables["CPAL"] = cpal.Bytes()
+
+	font, err := canvas.LoadFont(sfnt.Write(), 0, canvas.FontRegular)
+	test.Error(t, err)
+	text := canvas.NewTextLine(font.Face(12, canvas.Black), "AB", canvas.Left)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210, 297, &Options{Compress: false, SubsetFonts: true, Type3Fonts: true})
+	pdf.RenderText(text, canvas.Identity.Translate(15, 250))
+	test.Error(t, pdf.Close())
+
+	out := buf.String()
+	test.That(t, regexp.MustCompile(`stream\n\d+ 0 d0 q 1 0 0 rg [^Q]+ f Q [^Q]+ f\nendstream`).MatchString(out), "missing color glyph content stream")
+	test.That(t, regexp.MustCompile(`stream\n\d+ 0 -?\d+ -?\d+ \d+ \d+ d1 [^Q]+ f\nendstream`).MatchString(out), "missing outline glyph content stream")
+}
+
 func TestPDFImage(t *testing.T) {
 	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
 
@@ -145,3 +241,201 @@ func TestPDFMetadata(t *testing.T) {
 	test.That(t, strings.Contains(out, "/Author (d4)"), `could not find "/Author (d4)" in output`)
 	test.That(t, strings.Contains(out, "/Creator (e5)"), `could not find "/Creator (e5)" in output`)
 }
+
+func TestPDFSoftMask(t *testing.T) {
+	content := canvas.New(10.0, 10.0)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Color: canvas.Red}
+	content.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+
+	gradient := canvas.NewLinearGradient(canvas.Point{0.0, 0.0}, canvas.Point{10.0, 0.0})
+	gradient.Add(0.0, canvas.Black)
+	gradient.Add(1.0, canvas.White)
+	mask := canvas.New(10.0, 10.0)
+	style.Fill = canvas.Paint{Gradient: gradient}
+	mask.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 10.0, 10.0, &Options{Compress: false})
+	pdf.RenderMasked(content, mask, true, canvas.Identity)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm q /SM0 gs /Fm0 Do Q")
+	err := pdf.Close()
+	test.Error(t, err)
+	out := buf.String()
+
+	// find the soft mask and its transparency group
+	smask := regexp.MustCompile(`/SM0 << /SMask << /Type /Mask /G (\d+) 0 R /S /Luminosity >> >>`).FindStringSubmatch(out)
+	test.T(t, len(smask), 2)
+	test.That(t, strings.Contains(out, smask[1]+" 0 obj\n<< /Type /XObject /Subtype /Form "), "soft mask must be a form XObject")
+	test.That(t, strings.Contains(out, "/Pattern cs /P0 scn"), "soft mask must contain the gradient")
+	test.That(t, regexp.MustCompile(`/XObject << /Fm0 \d+ 0 R >>`).MatchString(out), "content must be a form XObject")
+}
+
+func TestPDFGlobalAlpha(t *testing.T) {
+	c := canvas.New(10.0, 10.0)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Color: canvas.Red}
+	c.RenderPath(canvas.Rectangle(6.0, 10.0), style, canvas.Identity)
+	c.RenderPath(canvas.Rectangle(6.0, 10.0).Translate(4.0, 0.0), style, canvas.Identity)
+	c.SetGlobalAlpha(0.5)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 10.0, 10.0, &Options{Compress: false})
+	c.RenderTo(pdf)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm q /A0 gs /Fm0 Do Q")
+	err := pdf.Close()
+	test.Error(t, err)
+	out := buf.String()
+
+	// the shapes are drawn opaque within a transparency group that is composited at half opacity
+	test.That(t, strings.Contains(out, "/A0 << /CA .5 /ca .5 >>"), "group must be composited with /ca")
+	form := regexp.MustCompile(`/XObject << /Fm0 (\d+) 0 R >>`).FindStringSubmatch(out)
+	test.T(t, len(form), 2)
+	test.That(t, strings.Contains(out, form[1]+" 0 obj\n<< /Type /XObject /Subtype /Form "), "group must be a form XObject")
+	test.That(t, strings.Contains(out, "/Group << /Type /Group /CS /DeviceRGB /S /Transparency >>"), "form must be a transparency group")
+	test.That(t, !strings.Contains(out, "/ca 1"), "shapes must be opaque")
+}
+
+func TestPDFBlendMode(t *testing.T) {
+	c := canvas.New(10.0, 10.0)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Color: canvas.Red}
+	c.BeginGroup(true)
+	c.RenderPath(canvas.Rectangle(6.0, 10.0), style, canvas.Identity)
+	style.BlendMode = canvas.BlendMultiply
+	c.RenderPath(canvas.Rectangle(6.0, 10.0).Translate(4.0, 0.0), style, canvas.Identity)
+	c.EndGroup()
+	style.BlendMode = canvas.BlendNormal
+	c.RenderPath(canvas.Rectangle(2.0, 2.0), style, canvas.Identity)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 10.0, 10.0, &Options{Compress: false})
+	c.RenderTo(pdf)
+	err := pdf.Close()
+	test.Error(t, err)
+	out := buf.String()
+
+	// the second rectangle is multiplied within the isolated group, the blend mode is reset after the group
+	test.That(t, strings.Contains(out, "/BMMultiply << /BM /Multiply >>"), "graphics state must set the blend mode")
+	test.That(t, strings.Contains(out, " /BMMultiply gs 4 0 m"), "path must be drawn with the blend mode")
+	test.That(t, !strings.Contains(out, "/BMNormal"), "blend mode of the page must not change")
+}
+
+func TestPDFMeshGradient(t *testing.T) {
+	gradient := canvas.NewMeshGradient()
+	gradient.AddRect(0.0, 0.0, 10.0, 10.0, [4]color.RGBA{canvas.Red, canvas.Lime, canvas.Blue, canvas.White})
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 10.0, 10.0, &Options{Compress: false})
+	pdf.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+	err := pdf.Close()
+	test.Error(t, err)
+	out := buf.String()
+
+	test.That(t, strings.Contains(out, "/Pattern cs /P0 scn"), "path must be filled with the pattern")
+	shading := regexp.MustCompile(`/Shading (\d+) 0 R`).FindStringSubmatch(out)
+	test.T(t, len(shading), 2)
+	test.That(t, strings.Contains(out, shading[1]+" 0 obj\n<< /BitsPerComponent 16 /BitsPerCoordinate 32 /BitsPerFlag 8 /ColorSpace /DeviceRGB /Decode [0 28.346457 0 28.346457 0 1 0 1 0 1] /Length 121 /ShadingType 6 >>"), "mesh shading must be a type 6 stream")
+}
+
+func TestPDFGradientSpread(t *testing.T) {
+	gradient := canvas.NewLinearGradient(canvas.Point{0.0, 0.0}, canvas.Point{4.0, 0.0})
+	gradient.Add(0.0, canvas.Black)
+	gradient.Add(1.0, canvas.White)
+	gradient.Spread = canvas.SpreadReflect
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 10.0, 10.0, &Options{Compress: false})
+	pdf.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+	err := pdf.Close()
+	test.Error(t, err)
+	out := buf.String()
+
+	// the page is covered by three repetitions of the gradient, where the middle one is reversed
+	test.That(t, strings.Contains(out, "/Coords [0 0 34.015748 0] /Domain [0 3]"), "shading must span the page")
+	test.That(t, strings.Contains(out, "/Bounds [1 2] /Domain [0 3] /Encode [0 1 1 0 0 1]"), "function must reflect every other repetition")
+}
+
+func TestPDFImagePaint(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Pix = []byte{255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 255}
+	style := canvas.DefaultStyle
+
+	render := func(wrap canvas.ImageWrap) string {
+		style.Fill = canvas.Paint{Pattern: canvas.NewImagePaint(img, canvas.Identity.Scale(5.0, 5.0), wrap)}
+		buf := &bytes.Buffer{}
+		pdf := New(buf, 20.0, 10.0, &Options{Compress: false})
+		pdf.RenderPath(canvas.Rectangle(20.0, 10.0), style, canvas.Identity)
+		err := pdf.Close()
+		test.Error(t, err)
+		return buf.String()
+	}
+
+	// the rectangle clips the image and its right edge pixels stretched over the remaining 10 mm
+	out := render(canvas.ImageClamp)
+	test.That(t, strings.Contains(out, "q 0 0 m 20 0 l 20 10 l 0 10 l W n q 10 0 0 10 0 0 cm /Im0 Do Q q 10 0 0 10 10 0 cm /Im1 Do Q Q"), "image must be clipped and clamped")
+	test.That(t, strings.Contains(out, "/Width 1 >>"), "edge must be embedded as a column")
+
+	// the image is drawn twice side by side
+	out = render(canvas.ImageRepeat)
+	test.That(t, strings.Contains(out, "W n q 10 0 0 10 0 0 cm /Im0 Do Q q 10 0 0 10 10 0 cm /Im0 Do Q Q"), "image must be tiled")
+}
+
+func TestPDFTagged(t *testing.T) {
+	dejaVuSerif, err := canvas.LoadFontFile(fontDir+"DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black)
+	red := dejaVuSerif.Face(12.0, canvas.Red)
+
+	rt := canvas.NewRichText(face)
+	rt.Add(face, "first ")
+	rt.Add(red, "paragraph")
+	rt.Add(face, "\nsecond")
+	text := rt.ToText(0.0, 0.0, canvas.Left, canvas.Top, 0.0, 0.0)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 100.0, 100.0, &Options{Compress: false, SubsetFonts: true, Tagged: true})
+	pdf.RenderText(text, canvas.Identity.Translate(10.0, 90.0))
+	err = pdf.Close()
+	test.Error(t, err)
+	out := buf.String()
+
+	// text spans are marked content referred to by the structure tree
+	test.That(t, strings.Contains(out, "/Span << /MCID 0 >> BDC BT"), "span must be marked content")
+	test.That(t, strings.Contains(out, "ET EMC /Span << /MCID 1 >> BDC"), "marked content must end after the span")
+	test.That(t, strings.Contains(out, "/MarkInfo << /Marked true >>"), "catalog must be marked")
+	test.That(t, strings.Contains(out, "/StructParents 0"), "page must refer to the parent tree")
+
+	root := regexp.MustCompile(`/StructTreeRoot (\d+) 0 R`).FindStringSubmatch(out)
+	test.T(t, len(root), 2)
+	test.That(t, strings.Contains(out, root[1]+" 0 obj\n<< /Type /StructTreeRoot "), "structure tree root must exist")
+	test.T(t, len(regexp.MustCompile(`<< /Type /StructElem [^>]*/S /P >>`).FindAllString(out, -1)), 2)
+	test.T(t, len(regexp.MustCompile(`<< /Type /StructElem [^>]*/S /Span >>`).FindAllString(out, -1)), 3)
+	test.That(t, regexp.MustCompile(`/ParentTree << /Nums \[0 \[\d+ 0 R \d+ 0 R \d+ 0 R\]\] >>`).MatchString(out), "parent tree must map the marked content")
+
+	// text in groups is drawn in a form XObject and is not tagged
+	buf.Reset()
+	pdf = New(buf, 100.0, 100.0, &Options{Compress: false, SubsetFonts: true, Tagged: true})
+	pdf.RenderText(text, canvas.Identity.Translate(10.0, 90.0))
+	pdf.BeginAlphaGroup(0.5)
+	pdf.RenderText(text, canvas.Identity.Translate(10.0, 50.0))
+	pdf.EndGroup()
+	err = pdf.Close()
+	test.Error(t, err)
+	out = buf.String()
+	test.T(t, strings.Count(out, " BDC"), 3)
+	test.T(t, len(regexp.MustCompile(`<< /Type /StructElem [^>]*/S /Span >>`).FindAllString(out, -1)), 3)
+	test.That(t, strings.Contains(out, "/Fm0 Do"), "group must be drawn")
+
+	// untagged documents have no structure
+	buf.Reset()
+	pdf = New(buf, 100.0, 100.0, &Options{Compress: false, SubsetFonts: true})
+	pdf.RenderText(text, canvas.Identity.Translate(10.0, 90.0))
+	err = pdf.Close()
+	test.Error(t, err)
+	test.That(t, !strings.Contains(buf.String(), "StructTreeRoot") && !strings.Contains(buf.String(), "BDC"), "document must not be tagged")
+}
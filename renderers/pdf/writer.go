@@ -7,6 +7,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"math"
 	"reflect"
@@ -34,8 +36,12 @@ type pdfWriter struct {
 	fontSubset map[*canvas.Font]*canvas.FontSubsetter
 	fontsH     map[*canvas.Font]pdfRef
 	fontsV     map[*canvas.Font]pdfRef
+	fontsType3 map[*canvas.Font][]pdfRef // Type3 fonts per block of 256 glyphs, see getType3Font
 	compress   bool
 	subset     bool
+	type3      bool
+	tagged     bool
+	structure  []*pdfStructElem // paragraphs in reading order
 	title      string
 	subject    string
 	keywords   string
@@ -50,6 +56,7 @@ func newPDFWriter(writer io.Writer) *pdfWriter {
 		fontSubset: map[*canvas.Font]*canvas.FontSubsetter{},
 		fontsH:     map[*canvas.Font]pdfRef{},
 		fontsV:     map[*canvas.Font]pdfRef{},
+		fontsType3: map[*canvas.Font][]pdfRef{},
 		compress:   true,
 		subset:     true,
 	}
@@ -68,6 +75,16 @@ func (w *pdfWriter) SetFontSubsetting(subset bool) {
 	w.subset = subset
 }
 
+// SetType3Fonts enables embedding horizontal fonts as Type3 fonts, where each glyph is drawn by its own content stream.
+func (w *pdfWriter) SetType3Fonts(type3 bool) {
+	w.type3 = type3
+}
+
+// SetTagged enables the structure tree of a tagged PDF, where text is marked as paragraphs and spans for accessibility.
+func (w *pdfWriter) SetTagged(tagged bool) {
+	w.tagged = tagged
+}
+
 // SetTitle sets the document's title.
 func (w *pdfWriter) SetTitle(title string) {
 	w.title = title
@@ -234,6 +251,9 @@ func (w *pdfWriter) writeObject(val interface{}) pdfRef {
 }
 
 func (w *pdfWriter) getFont(font *canvas.Font, vertical bool) pdfRef {
+	if !font.HasOutlines() {
+		panic("PDF: font has no glyph outlines")
+	}
 	fonts := w.fontsH
 	if vertical {
 		fonts = w.fontsV
@@ -251,6 +271,11 @@ func (w *pdfWriter) getFont(font *canvas.Font, vertical bool) pdfRef {
 }
 
 func (w *pdfWriter) writeFont(ref pdfRef, font *canvas.Font, vertical bool) {
+	if w.type3 && !vertical {
+		w.writeType3Font(font)
+		return
+	}
+
 	// subset the font
 	fontProgram := font.SFNT.Data
 	glyphIDs := w.fontSubset[font].List()
@@ -451,6 +476,197 @@ end`, bfRangeCount, bfRange.String(), bfCharCount, bfChar.String())
 	w.write("\nendobj\n")
 }
 
+// getType3Font returns the reference to the Type3 font that holds the glyphs of the font subset with indices from 256*block up to 256*(block+1). The first block is the font returned by getFont.
+func (w *pdfWriter) getType3Font(font *canvas.Font, block int) pdfRef {
+	refs := w.fontsType3[font]
+	if len(refs) == 0 {
+		refs = []pdfRef{w.getFont(font, false)}
+	}
+	for len(refs) <= block {
+		w.objOffsets = append(w.objOffsets, 0)
+		refs = append(refs, pdfRef(len(w.objOffsets)))
+	}
+	w.fontsType3[font] = refs
+	return refs[block]
+}
+
+// writeType3Font writes the font as Type3 fonts where each glyph is a content stream. Type3 fonts use single-byte character codes, so that every 256 glyphs of the font subset are written to another font, see getType3Font.
+func (w *pdfWriter) writeType3Font(font *canvas.Font) {
+	glyphIDs := w.fontSubset[font].List()
+	for block := 0; block*256 < len(glyphIDs); block++ {
+		end := len(glyphIDs)
+		if (block+1)*256 < end {
+			end = (block + 1) * 256
+		}
+		w.writeType3FontBlock(w.getType3Font(font, block), font, block, glyphIDs[block*256:end])
+	}
+}
+
+// writeType3FontBlock writes a Type3 font for up to 256 glyphs. Glyph space has 1000 units per em so that widths and TJ adjustments are the same as for other fonts. Color glyphs from the COLR table fill the outlines of their layers with the colors of the first palette and bitmap glyphs from the sbix or CBDT tables draw their image, both set their own colors (d0). Other glyphs fill their outline with the text color (d1).
+func (w *pdfWriter) writeType3FontBlock(ref pdfRef, font *canvas.Font, block int, glyphIDs []uint16) {
+	// the glyph procedures share the resources of the font, such as the graphics states for colors with transparency and the images of bitmap glyphs
+	proc := &pdfPageWriter{
+		Buffer:         &bytes.Buffer{},
+		pdf:            w,
+		resources:      pdfDict{},
+		graphicsStates: map[float64]pdfName{},
+		alpha:          1.0,
+	}
+
+	f := 1000.0 / float64(font.SFNT.Head.UnitsPerEm)
+	charProcs := pdfDict{}
+	differences := pdfArray{0}
+	widths := pdfArray{}
+	var bfChar strings.Builder
+	bfCharCount := 0
+	for code, glyphID := range glyphIDs {
+		width := int(f*float64(font.SFNT.GlyphAdvance(glyphID)) + 0.5)
+
+		proc.Reset()
+		if layers := font.SFNT.GlyphLayers(glyphID); layers != nil {
+			fmt.Fprintf(proc, "%d 0 d0", width)
+			for _, layer := range layers {
+				glyph := w.type3GlyphPath(font, layer.GlyphID, f)
+				if glyph.Empty() {
+					continue
+				}
+				if layer.PaletteIndex == canvasFont.ForegroundPaletteIndex {
+					fmt.Fprintf(proc, " %v f", glyph.ToPDFDecimals(2))
+				} else if c, ok := font.SFNT.PaletteColor(0, layer.PaletteIndex); ok && c.A != 0 {
+					a := float64(c.A) / 255.0
+					fmt.Fprintf(proc, " q %v %v %v rg", dec(float64(c.R)/255.0/a), dec(float64(c.G)/255.0/a), dec(float64(c.B)/255.0/a))
+					if c.A != 255 {
+						fmt.Fprintf(proc, " /%v gs", proc.getOpacityGS(a))
+					}
+					fmt.Fprintf(proc, " %v f Q", glyph.ToPDFDecimals(2))
+				}
+			}
+		} else if img, bitmap, ok := type3GlyphImage(font, glyphID); ok {
+			size := img.Bounds().Size()
+			s := 1000.0 / float64(bitmap.PPEM)
+			name := proc.embedImage(img, canvas.Lossless)
+			fmt.Fprintf(proc, "%d 0 d0 q %v 0 0 %v %v %v cm /%v Do Q", width, dec(s*float64(size.X)), dec(s*float64(size.Y)), dec(s*float64(bitmap.X)), dec(s*float64(bitmap.Y)), name)
+		} else {
+			xMin, yMin, xMax, yMax, _ := font.SFNT.GlyphBounds(glyphID)
+			fmt.Fprintf(proc, "%d 0 %d %d %d %d d1", width, int(math.Floor(f*float64(xMin))), int(math.Floor(f*float64(yMin))), int(math.Ceil(f*float64(xMax))), int(math.Ceil(f*float64(yMax))))
+			if glyph := w.type3GlyphPath(font, glyphID, f); !glyph.Empty() {
+				fmt.Fprintf(proc, " %v f", glyph.ToPDFDecimals(2))
+			}
+		}
+		procStream := pdfStream{
+			dict:   pdfDict{},
+			stream: append([]byte{}, proc.Bytes()...),
+		}
+		if w.compress {
+			procStream.dict["Filter"] = pdfFilterFlate
+		}
+
+		name := pdfName(fmt.Sprintf("g%d", code))
+		charProcs[name] = w.writeObject(procStream)
+		differences = append(differences, name)
+		widths = append(widths, width)
+
+		if 0 < block || 0 < code {
+			unicode := uint32(font.SFNT.Cmap.ToUnicode(glyphID))
+			if unicode != 0 {
+				if 0x010000 <= unicode && unicode <= 0x10FFFF {
+					// UTF-16 surrogates
+					unicode -= 0x10000
+					unicode = (0xD800+(unicode>>10)&0x3FF)<<16 + 0xDC00 + unicode&0x3FF
+					fmt.Fprintf(&bfChar, "<%02X> <%08X>\n", code, unicode)
+				} else {
+					fmt.Fprintf(&bfChar, "<%02X> <%04X>\n", code, unicode)
+				}
+				bfCharCount++
+			}
+		}
+	}
+
+	toUnicode := fmt.Sprintf(`/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CIDSystemInfo
+<< /Registry (Adobe)
+   /Ordering (UCS)
+   /Supplement 0
+>> def
+/CMapName /Adobe-Identity-UCS def
+/CMapType 2 def
+1 begincodespacerange
+<00> <FF>
+endcodespacerange
+%d beginbfchar
+%sendbfchar
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`, bfCharCount, bfChar.String())
+	toUnicodeStream := pdfStream{
+		dict:   pdfDict{},
+		stream: []byte(toUnicode),
+	}
+	if w.compress {
+		toUnicodeStream.dict["Filter"] = pdfFilterFlate
+	}
+	toUnicodeRef := w.writeObject(toUnicodeStream)
+
+	dict := pdfDict{
+		"Type":    pdfName("Font"),
+		"Subtype": pdfName("Type3"),
+		"FontBBox": pdfArray{
+			int(math.Floor(f * float64(font.SFNT.Head.XMin))),
+			int(math.Floor(f * float64(font.SFNT.Head.YMin))),
+			int(math.Ceil(f * float64(font.SFNT.Head.XMax))),
+			int(math.Ceil(f * float64(font.SFNT.Head.YMax))),
+		},
+		"FontMatrix": pdfArray{0.001, 0, 0, 0.001, 0, 0},
+		"CharProcs":  charProcs,
+		"Encoding": pdfDict{
+			"Type":        pdfName("Encoding"),
+			"Differences": differences,
+		},
+		"FirstChar": 0,
+		"LastChar":  len(glyphIDs) - 1,
+		"Widths":    widths,
+		"Resources": proc.resources,
+		"ToUnicode": toUnicodeRef,
+	}
+
+	w.objOffsets[ref-1] = w.pos
+	w.write("%v 0 obj\n", ref)
+	w.writeVal(dict)
+	w.write("\nendobj\n")
+}
+
+// type3GlyphPath returns the outline of a glyph in glyph space.
+func (w *pdfWriter) type3GlyphPath(font *canvas.Font, glyphID uint16, f float64) *canvas.Path {
+	glyph := &canvas.Path{}
+	if err := font.SFNT.GlyphPath(glyph, glyphID, 0, 0.0, 0.0, f, canvasFont.NoHinting); err != nil && w.err == nil {
+		w.err = err
+	}
+	return glyph
+}
+
+// type3GlyphImage returns the decoded image of a bitmap glyph. It returns false if the glyph has no bitmap or if its format is not supported.
+func type3GlyphImage(font *canvas.Font, glyphID uint16) (image.Image, canvasFont.GlyphBitmap, bool) {
+	bitmap, ok := font.SFNT.GlyphBitmap(glyphID)
+	if !ok || bitmap.PPEM == 0 {
+		return nil, bitmap, false
+	}
+
+	var img image.Image
+	var err error
+	switch bitmap.Format {
+	case "png ":
+		img, err = png.Decode(bytes.NewReader(bitmap.Data))
+	case "jpg ":
+		img, err = jpeg.Decode(bytes.NewReader(bitmap.Data))
+	default:
+		return nil, bitmap, false
+	}
+	return img, bitmap, err == nil
+}
+
 // Close finished the document.
 func (w *pdfWriter) Close() error {
 	// TODO: support cross reference table streams and compressed objects for all dicts
@@ -471,13 +687,18 @@ func (w *pdfWriter) Close() error {
 	}
 
 	// document catalog
-	w.objOffsets[0] = w.pos
-	w.write("%v 0 obj\n", 1)
-	w.writeVal(pdfDict{
+	catalog := pdfDict{
 		"Type":  pdfName("Catalog"),
 		"Pages": pdfRef(3),
 		// TODO: add metadata?
-	})
+	}
+	if w.tagged && 0 < len(w.structure) {
+		catalog["StructTreeRoot"] = w.writeStructTree()
+		catalog["MarkInfo"] = pdfDict{"Marked": true}
+	}
+	w.objOffsets[0] = w.pos
+	w.write("%v 0 obj\n", 1)
+	w.writeVal(catalog)
 	w.write("\nendobj\n")
 
 	// metadata
@@ -532,14 +753,99 @@ func (w *pdfWriter) Close() error {
 	return w.err
 }
 
+// pdfStructElem is an element of the structure tree of a tagged PDF. Elements without kids refer to a marked-content sequence on their page by its identifier.
+type pdfStructElem struct {
+	tag  pdfName
+	page int // index of the page
+	mcid int
+	kids []*pdfStructElem
+	ref  pdfRef
+}
+
+// writeStructTree writes the structure tree with a document element that contains the paragraphs, and the parent tree that maps the marked-content sequences of each page to their structure elements.
+func (w *pdfWriter) writeStructTree() pdfRef {
+	reserve := func() pdfRef {
+		w.objOffsets = append(w.objOffsets, 0)
+		return pdfRef(len(w.objOffsets))
+	}
+	root, document := reserve(), reserve()
+	var assign func([]*pdfStructElem)
+	assign = func(elems []*pdfStructElem) {
+		for _, elem := range elems {
+			elem.ref = reserve()
+			assign(elem.kids)
+		}
+	}
+	assign(w.structure)
+
+	parents := map[int]pdfArray{} // structure elements by page and MCID
+	var write func([]*pdfStructElem, pdfRef) pdfArray
+	write = func(elems []*pdfStructElem, parent pdfRef) pdfArray {
+		refs := pdfArray{}
+		for _, elem := range elems {
+			dict := pdfDict{
+				"Type": pdfName("StructElem"),
+				"S":    elem.tag,
+				"P":    parent,
+				"Pg":   w.pages[elem.page],
+			}
+			if elem.kids == nil {
+				dict["K"] = elem.mcid
+				for len(parents[elem.page]) <= elem.mcid {
+					parents[elem.page] = append(parents[elem.page], nil)
+				}
+				parents[elem.page][elem.mcid] = elem.ref
+			} else {
+				dict["K"] = write(elem.kids, elem.ref)
+			}
+			w.objOffsets[elem.ref-1] = w.pos
+			w.write("%v 0 obj\n", elem.ref)
+			w.writeVal(dict)
+			w.write("\nendobj\n")
+			refs = append(refs, elem.ref)
+		}
+		return refs
+	}
+	kids := write(w.structure, document)
+
+	w.objOffsets[document-1] = w.pos
+	w.write("%v 0 obj\n", document)
+	w.writeVal(pdfDict{
+		"Type": pdfName("StructElem"),
+		"S":    pdfName("Document"),
+		"P":    root,
+		"K":    kids,
+	})
+	w.write("\nendobj\n")
+
+	nums := pdfArray{}
+	for page := range w.pages {
+		if refs, ok := parents[page]; ok {
+			nums = append(nums, page, refs)
+		}
+	}
+	w.objOffsets[root-1] = w.pos
+	w.write("%v 0 obj\n", root)
+	w.writeVal(pdfDict{
+		"Type":              pdfName("StructTreeRoot"),
+		"K":                 document,
+		"ParentTree":        pdfDict{"Nums": nums},
+		"ParentTreeNextKey": len(w.pages),
+	})
+	w.write("\nendobj\n")
+	return root
+}
+
 type pdfPageWriter struct {
 	*bytes.Buffer
 	pdf           *pdfWriter
 	width, height float64
 	resources     pdfDict
+	mcid          int // next marked-content identifier
 
 	graphicsStates map[float64]pdfName
 	alpha          float64
+	blendMode      canvas.BlendMode
 	fill           canvas.Paint
 	stroke         canvas.Paint
 	lineWidth      float64
@@ -550,6 +856,7 @@ type pdfPageWriter struct {
 	font           *canvas.Font
 	fontSize       float64
 	fontDirection  canvasText.Direction
+	fontBlock      int // block of 256 glyphs of the current Type3 font
 	inTextObject   bool
 	textPosition   canvas.Matrix
 	textCharSpace  float64
@@ -605,7 +912,7 @@ func (w *pdfPageWriter) writePage(parent pdfRef) pdfRef {
 		stream.dict["Filter"] = pdfFilterFlate
 	}
 	contents := w.pdf.writeObject(stream)
-	return w.pdf.writeObject(pdfDict{
+	page := pdfDict{
 		"Type":      pdfName("Page"),
 		"Parent":    parent,
 		"MediaBox":  pdfArray{0.0, 0.0, w.width * ptPerMm, w.height * ptPerMm},
@@ -617,7 +924,24 @@ func (w *pdfPageWriter) writePage(parent pdfRef) pdfRef {
 			"CS":   pdfName("DeviceRGB"),
 		},
 		"Contents": contents,
-	})
+	}
+	if 0 < w.mcid {
+		page["StructParents"] = len(w.pdf.pages) // key into the parent tree
+	}
+	return w.pdf.writeObject(page)
+}
+
+// BeginMarkedContent starts a marked-content sequence with the given tag, and returns its marked-content identifier that is unique on the page.
+func (w *pdfPageWriter) BeginMarkedContent(tag pdfName) int {
+	mcid := w.mcid
+	w.mcid++
+	fmt.Fprintf(w, " /%v << /MCID %d >> BDC", tag, mcid)
+	return mcid
+}
+
+// EndMarkedContent ends a marked-content sequence.
+func (w *pdfPageWriter) EndMarkedContent() {
+	fmt.Fprintf(w, " EMC")
 }
 
 // SetAlpha sets the transparency value.
@@ -629,6 +953,35 @@ func (w *pdfPageWriter) SetAlpha(alpha float64) {
 	}
 }
 
+// blendModeNames are the PDF names of the blend modes.
+var blendModeNames = map[canvas.BlendMode]pdfName{
+	canvas.BlendNormal:   "Normal",
+	canvas.BlendMultiply: "Multiply",
+	canvas.BlendScreen:   "Screen",
+	canvas.BlendDarken:   "Darken",
+	canvas.BlendLighten:  "Lighten",
+}
+
+// SetBlendMode sets the blend mode using the /BM entry of the graphics state.
+func (w *pdfPageWriter) SetBlendMode(mode canvas.BlendMode) {
+	if mode == w.blendMode {
+		return
+	}
+	name, ok := blendModeNames[mode]
+	if !ok {
+		panic("PDF: blend mode not supported")
+	}
+	if _, ok := w.resources["ExtGState"]; !ok {
+		w.resources["ExtGState"] = pdfDict{}
+	}
+	gs := pdfName("BM" + name)
+	w.resources["ExtGState"].(pdfDict)[gs] = pdfDict{
+		"BM": name,
+	}
+	fmt.Fprintf(w, " /%v gs", gs)
+	w.blendMode = mode
+}
+
 // SetFill sets the filling paint.
 func (w *pdfPageWriter) SetFill(fill canvas.Paint) {
 	if fill.Equal(w.fill) {
@@ -771,22 +1124,27 @@ func (w *pdfPageWriter) SetFont(font *canvas.Font, size float64, direction canva
 		w.fontDirection = direction
 
 		vertical := direction == canvasText.TopToBottom || direction == canvasText.BottomToTop
-		ref := w.pdf.getFont(font, vertical)
-		if _, ok := w.resources["Font"]; !ok {
-			w.resources["Font"] = pdfDict{}
-		} else {
-			for name, fontRef := range w.resources["Font"].(pdfDict) {
-				if ref == fontRef {
-					fmt.Fprintf(w, " /%v %v Tf", name, dec(size))
-					return
-				}
+		w.fontBlock = 0
+		w.selectFont(w.pdf.getFont(font, vertical), size)
+	}
+}
+
+// selectFont adds the font to the resources if needed and sets it as the current font.
+func (w *pdfPageWriter) selectFont(ref pdfRef, size float64) {
+	if _, ok := w.resources["Font"]; !ok {
+		w.resources["Font"] = pdfDict{}
+	} else {
+		for name, fontRef := range w.resources["Font"].(pdfDict) {
+			if ref == fontRef {
+				fmt.Fprintf(w, " /%v %v Tf", name, dec(size))
+				return
 			}
 		}
-
-		name := pdfName(fmt.Sprintf("F%d", len(w.resources["Font"].(pdfDict))))
-		w.resources["Font"].(pdfDict)[name] = ref
-		fmt.Fprintf(w, " /%v %v Tf", name, dec(size))
 	}
+
+	name := pdfName(fmt.Sprintf("F%d", len(w.resources["Font"].(pdfDict))))
+	w.resources["Font"].(pdfDict)[name] = ref
+	fmt.Fprintf(w, " /%v %v Tf", name, dec(size))
 }
 
 // SetTextPosition sets the text position.
@@ -857,6 +1215,9 @@ func (w *pdfPageWriter) WriteText(mode canvas.WritingMode, TJ ...interface{}) {
 		return
 	}
 
+	vertical := w.fontDirection == canvasText.TopToBottom || w.fontDirection == canvasText.BottomToTop
+	type3 := w.pdf.type3 && !vertical
+
 	first := true
 	write := func(glyphs []canvasText.Glyph) {
 		if first {
@@ -868,7 +1229,18 @@ func (w *pdfPageWriter) WriteText(mode canvas.WritingMode, TJ ...interface{}) {
 		subset := w.pdf.fontSubset[w.font]
 		for _, glyph := range glyphs {
 			glyphID := subset.Get(glyph.ID)
-			for _, c := range []uint8{uint8((glyphID & 0xff00) >> 8), uint8(glyphID & 0x00ff)} {
+			code := []uint8{uint8((glyphID & 0xff00) >> 8), uint8(glyphID & 0x00ff)}
+			if type3 {
+				if block := int(glyphID >> 8); block != w.fontBlock {
+					// switch to the Type3 font that holds the glyph
+					fmt.Fprintf(w, ")]TJ")
+					w.fontBlock = block
+					w.selectFont(w.pdf.getType3Font(w.font, block), w.fontSize)
+					fmt.Fprintf(w, " [(")
+				}
+				code = code[1:]
+			}
+			for _, c := range code {
 				if c == '\n' {
 					binary.Write(w, binary.BigEndian, uint8('\\'))
 					binary.Write(w, binary.BigEndian, uint8('n'))
@@ -907,6 +1279,15 @@ func (w *pdfPageWriter) WriteText(mode canvas.WritingMode, TJ ...interface{}) {
 	for _, tj := range TJ {
 		switch val := tj.(type) {
 		case []canvasText.Glyph:
+			// empty glyphs have no advance and are not written
+			glyphs := make([]canvasText.Glyph, 0, len(val))
+			for _, glyph := range val {
+				if !glyph.Empty {
+					glyphs = append(glyphs, glyph)
+				}
+			}
+			val = glyphs
+
 			i := 0
 			for j, glyph := range val {
 				if mode == canvas.HorizontalTB || !glyph.Vertical {
@@ -971,6 +1352,70 @@ func (w *pdfPageWriter) DrawImage(img image.Image, enc canvas.ImageEncoding, m c
 	fmt.Fprintf(w, " %v %v %v %v %v %v cm /%v Do Q", dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]), name)
 }
 
+// DrawImagePaint fills the path data, transformed by m, with an image paint. The path is used as a clipping path for the image XObject, which is drawn for each tile within the bounds in image coordinates for repeating images, or once with its edge pixels stretched up to the bounds for clamped images.
+func (w *pdfPageWriter) DrawImagePaint(paint *canvas.ImagePaint, data string, fillRule canvas.FillRule, bounds canvas.Rect, enc canvas.ImageEncoding, m canvas.Matrix) {
+	rect := paint.Image.Bounds()
+	size := rect.Size()
+	if size.X == 0 || size.Y == 0 {
+		return
+	}
+
+	w.SetAlpha(1.0)
+	fmt.Fprintf(w, " q %v W", data)
+	if fillRule == canvas.EvenOdd {
+		fmt.Fprintf(w, "*")
+	}
+	fmt.Fprintf(w, " n")
+
+	name := w.embedImage(paint.Image, enc)
+	m = m.Mul(paint.Matrix)
+	width, height := float64(size.X), float64(size.Y)
+	draw := func(name pdfName, x0, y0, x1, y1 float64) {
+		tile := m.Translate(x0, y0).Scale(x1-x0, y1-y0)
+		fmt.Fprintf(w, " q %v %v %v %v %v %v cm /%v Do Q", dec(tile[0][0]), dec(tile[1][0]), dec(tile[0][1]), dec(tile[1][1]), dec(tile[0][2]), dec(tile[1][2]), name)
+	}
+	if paint.Wrap == canvas.ImageRepeat {
+		for j := math.Floor(bounds.Y / height); j*height < bounds.Y+bounds.H; j++ {
+			for i := math.Floor(bounds.X / width); i*width < bounds.X+bounds.W; i++ {
+				draw(name, i*width, j*height, (i+1.0)*width, (j+1.0)*height)
+			}
+		}
+	} else {
+		// columns and rows of the edges and the image itself, with rows from bottom to top
+		xs := []float64{math.Min(bounds.X, 0.0), 0.0, width, math.Max(bounds.X+bounds.W, width)}
+		ys := []float64{math.Min(bounds.Y, 0.0), 0.0, height, math.Max(bounds.Y+bounds.H, height)}
+		cols := []image.Rectangle{
+			image.Rect(rect.Min.X, 0, rect.Min.X+1, 0),
+			image.Rect(rect.Min.X, 0, rect.Max.X, 0),
+			image.Rect(rect.Max.X-1, 0, rect.Max.X, 0),
+		}
+		rows := []image.Rectangle{
+			image.Rect(0, rect.Max.Y-1, 0, rect.Max.Y),
+			image.Rect(0, rect.Min.Y, 0, rect.Max.Y),
+			image.Rect(0, rect.Min.Y, 0, rect.Min.Y+1),
+		}
+		for j := 0; j < 3; j++ {
+			for i := 0; i < 3; i++ {
+				if xs[i+1] <= xs[i] || ys[j+1] <= ys[j] {
+					continue
+				} else if i == 1 && j == 1 {
+					draw(name, xs[i], ys[j], xs[i+1], ys[j+1])
+					continue
+				}
+				sub := image.Rect(cols[i].Min.X, rows[j].Min.Y, cols[i].Max.X, rows[j].Max.Y)
+				edge := image.NewRGBA(image.Rect(0, 0, sub.Dx(), sub.Dy()))
+				for y := 0; y < sub.Dy(); y++ {
+					for x := 0; x < sub.Dx(); x++ {
+						edge.Set(x, y, paint.Image.At(sub.Min.X+x, sub.Min.Y+y))
+					}
+				}
+				draw(w.embedImage(edge, enc), xs[i], ys[j], xs[i+1], ys[j+1])
+			}
+		}
+	}
+	fmt.Fprintf(w, " Q")
+}
+
 func (w *pdfPageWriter) embedImage(img image.Image, enc canvas.ImageEncoding) pdfName {
 	size := img.Bounds().Size()
 	sp := img.Bounds().Min // starting point
@@ -1034,6 +1479,83 @@ func (w *pdfPageWriter) embedImage(img image.Image, enc canvas.ImageEncoding) pd
 	return name
 }
 
+// NewForm returns a writer for a form XObject that is drawn in the current user space and inherits the current graphics state.
+func (w *pdfPageWriter) NewForm() *pdfPageWriter {
+	form := *w
+	form.Buffer = &bytes.Buffer{}
+	form.resources = pdfDict{}
+	form.graphicsStates = map[float64]pdfName{}
+	form.alpha = 1.0 // reset at the start of a transparency group
+	form.inTextObject = false
+	return &form
+}
+
+func (w *pdfPageWriter) writeForm(form *pdfPageWriter) pdfRef {
+	b := form.Bytes()
+	if 0 < len(b) && b[0] == ' ' {
+		b = b[1:]
+	}
+	stream := pdfStream{
+		dict: pdfDict{
+			"Type":      pdfName("XObject"),
+			"Subtype":   pdfName("Form"),
+			"BBox":      pdfArray{0.0, 0.0, w.width, w.height},
+			"Resources": form.resources,
+			"Group": pdfDict{
+				"Type": pdfName("Group"),
+				"S":    pdfName("Transparency"),
+				"CS":   pdfName("DeviceRGB"),
+			},
+		},
+		stream: b,
+	}
+	if w.pdf.compress {
+		stream.dict["Filter"] = pdfFilterFlate
+	}
+	return w.pdf.writeObject(stream)
+}
+
+// DrawMasked draws the content form masked by the mask form, using the mask's luminosity or its alpha channel as a soft mask.
+func (w *pdfPageWriter) DrawMasked(content, mask *pdfPageWriter, luminosity bool) {
+	subtype := pdfName("Alpha")
+	if luminosity {
+		subtype = pdfName("Luminosity")
+	}
+
+	if _, ok := w.resources["ExtGState"]; !ok {
+		w.resources["ExtGState"] = pdfDict{}
+	}
+	gs := pdfName(fmt.Sprintf("SM%d", len(w.resources["ExtGState"].(pdfDict))))
+	w.resources["ExtGState"].(pdfDict)[gs] = pdfDict{
+		"SMask": pdfDict{
+			"Type": pdfName("Mask"),
+			"S":    subtype,
+			"G":    w.writeForm(mask),
+		},
+	}
+
+	if _, ok := w.resources["XObject"]; !ok {
+		w.resources["XObject"] = pdfDict{}
+	}
+	name := pdfName(fmt.Sprintf("Fm%d", len(w.resources["XObject"].(pdfDict))))
+	w.resources["XObject"].(pdfDict)[name] = w.writeForm(content)
+	fmt.Fprintf(w, " q /%v gs /%v Do Q", gs, name)
+}
+
+// DrawForm draws the form as a transparency group that is composited at the given opacity.
+func (w *pdfPageWriter) DrawForm(form *pdfPageWriter, alpha float64) {
+	if _, ok := w.resources["XObject"]; !ok {
+		w.resources["XObject"] = pdfDict{}
+	}
+	name := pdfName(fmt.Sprintf("Fm%d", len(w.resources["XObject"].(pdfDict))))
+	w.resources["XObject"].(pdfDict)[name] = w.writeForm(form)
+	if alpha != 1.0 {
+		fmt.Fprintf(w, " q /%v gs /%v Do Q", w.getOpacityGS(alpha), name)
+	} else {
+		fmt.Fprintf(w, " q /%v Do Q", name)
+	}
+}
+
 func (w *pdfPageWriter) getOpacityGS(a float64) pdfName {
 	if name, ok := w.graphicsStates[a]; ok {
 		return name
@@ -1056,21 +1578,51 @@ func (w *pdfPageWriter) getPattern(gradient canvas.Gradient) pdfName {
 	shading := pdfDict{
 		"ColorSpace": pdfName("DeviceRGB"),
 	}
+	pattern := pdfDict{
+		"Type":        pdfName("Pattern"),
+		"PatternType": 2,
+		"Shading":     shading,
+	}
 	if g, ok := gradient.(*canvas.LinearGradient); ok {
+		start, end := g.Start, g.End
 		shading["ShadingType"] = 2
-		shading["Coords"] = pdfArray{g.Start.X * ptPerMm, g.Start.Y * ptPerMm, g.End.X * ptPerMm, g.End.Y * ptPerMm}
 		shading["Function"] = patternStopsFunction(g.Stops)
+		if g.Spread != canvas.SpreadPad {
+			pad := *g
+			pad.Spread = canvas.SpreadPad
+			t0, t1 := w.spreadDomain(pad.Offset, math.Inf(-1.0), math.Inf(1.0))
+			d := g.End.Sub(g.Start)
+			start, end = g.Start.Add(d.Mul(t0)), g.Start.Add(d.Mul(t1))
+			shading["Domain"] = pdfArray{t0, t1}
+			shading["Function"] = spreadFunction(g.Stops, g.Spread, t0, t1)
+		}
+		shading["Coords"] = pdfArray{start.X * ptPerMm, start.Y * ptPerMm, end.X * ptPerMm, end.Y * ptPerMm}
 		shading["Extend"] = pdfArray{true, true}
 	} else if g, ok := gradient.(*canvas.RadialGradient); ok {
+		c0, c1, r0, r1 := g.C0, g.C1, g.R0, g.R1
 		shading["ShadingType"] = 3
-		shading["Coords"] = pdfArray{g.C0.X * ptPerMm, g.C0.Y * ptPerMm, g.R0 * ptPerMm, g.C1.X * ptPerMm, g.C1.Y * ptPerMm, g.R1 * ptPerMm}
 		shading["Function"] = patternStopsFunction(g.Stops)
+		if g.Spread != canvas.SpreadPad {
+			// the radius may not become negative
+			tMin, tMax := math.Inf(-1.0), math.Inf(1.0)
+			if dr := g.R1 - g.R0; 0.0 < dr {
+				tMin = -g.R0 / dr
+			} else if dr < 0.0 {
+				tMax = -g.R0 / dr
+			}
+			pad := *g
+			pad.Spread = canvas.SpreadPad
+			t0, t1 := w.spreadDomain(pad.Offset, tMin, tMax)
+			cd, dr := g.C1.Sub(g.C0), g.R1-g.R0
+			c0, c1 = g.C0.Add(cd.Mul(t0)), g.C0.Add(cd.Mul(t1))
+			r0, r1 = math.Max(0.0, g.R0+t0*dr), math.Max(0.0, g.R0+t1*dr)
+			shading["Domain"] = pdfArray{t0, t1}
+			shading["Function"] = spreadFunction(g.Stops, g.Spread, t0, t1)
+		}
+		shading["Coords"] = pdfArray{c0.X * ptPerMm, c0.Y * ptPerMm, r0 * ptPerMm, c1.X * ptPerMm, c1.Y * ptPerMm, r1 * ptPerMm}
 		shading["Extend"] = pdfArray{true, true}
-	}
-	pattern := pdfDict{
-		"Type":        pdfName("Pattern"),
-		"PatternType": 2,
-		"Shading":     shading,
+	} else if g, ok := gradient.(*canvas.MeshGradient); ok {
+		pattern["Shading"] = w.meshShading(g)
 	}
 
 	if _, ok := w.resources["Pattern"]; !ok {
@@ -1086,6 +1638,116 @@ func (w *pdfPageWriter) getPattern(gradient canvas.Gradient) pdfName {
 	return name
 }
 
+// meshShading returns a reference to a Coons patch mesh shading stream (type 6) of the mesh gradient. Coordinates are encoded as 32-bit integers within the bounding box of the patches and color components as 16-bit integers.
+func (w *pdfPageWriter) meshShading(g *canvas.MeshGradient) pdfRef {
+	bounds := canvas.Rect{}
+	for i, patch := range g.Patches {
+		for j, p := range patch.Points {
+			if i == 0 && j == 0 {
+				bounds = canvas.Rect{p.X, p.Y, 0.0, 0.0}
+			} else {
+				bounds = bounds.AddPoint(p)
+			}
+		}
+	}
+	if canvas.Equal(bounds.W, 0.0) {
+		bounds.W = 1.0
+	}
+	if canvas.Equal(bounds.H, 0.0) {
+		bounds.H = 1.0
+	}
+
+	b := make([]byte, len(g.Patches)*(1+12*8+4*6))
+	i := 0
+	for _, patch := range g.Patches {
+		b[i] = 0 // edge flag: new patch
+		i++
+		for _, p := range patch.Points {
+			binary.BigEndian.PutUint32(b[i:], uint32((p.X-bounds.X)/bounds.W*math.MaxUint32+0.5))
+			binary.BigEndian.PutUint32(b[i+4:], uint32((p.Y-bounds.Y)/bounds.H*math.MaxUint32+0.5))
+			i += 8
+		}
+		for _, col := range patch.Colors {
+			a := float64(col.A) / 255.0
+			for _, c := range []uint8{col.R, col.G, col.B} {
+				v := 0.0
+				if a != 0.0 {
+					v = math.Min(float64(c)/255.0/a, 1.0)
+				}
+				binary.BigEndian.PutUint16(b[i:], uint16(v*math.MaxUint16+0.5))
+				i += 2
+			}
+		}
+	}
+
+	dict := pdfDict{
+		"ShadingType":       6,
+		"ColorSpace":        pdfName("DeviceRGB"),
+		"BitsPerCoordinate": 32,
+		"BitsPerComponent":  16,
+		"BitsPerFlag":       8,
+		"Decode":            pdfArray{bounds.X * ptPerMm, (bounds.X + bounds.W) * ptPerMm, bounds.Y * ptPerMm, (bounds.Y + bounds.H) * ptPerMm, 0, 1, 0, 1, 0, 1},
+	}
+	if w.pdf.compress {
+		dict["Filter"] = pdfFilterFlate
+	}
+	return w.pdf.writeObject(pdfStream{
+		dict:   dict,
+		stream: b,
+	})
+}
+
+// maxSpreadRepetitions limits the number of repetitions of repeating and reflecting gradients on either side of the gradient.
+const maxSpreadRepetitions = 128
+
+// spreadDomain returns the range of offsets of the padded gradient at the corners of the page, including [0,1] and limited to [tMin,tMax] and to maxSpreadRepetitions repetitions on either side. Since PDF shadings only support padding, repeating and reflecting gradients are emulated over this range.
+func (w *pdfPageWriter) spreadDomain(offset func(float64, float64) (float64, bool), tMin, tMax float64) (float64, float64) {
+	t0, t1 := 0.0, 1.0
+	for _, corner := range []canvas.Point{{0.0, 0.0}, {w.width, 0.0}, {0.0, w.height}, {w.width, w.height}} {
+		if t, ok := offset(corner.X, corner.Y); ok {
+			t0, t1 = math.Min(t0, t), math.Max(t1, t)
+		}
+	}
+	if math.IsInf(tMin, -1.0) {
+		t0 = math.Floor(t0) // whole repetitions
+	}
+	if math.IsInf(tMax, 1.0) {
+		t1 = math.Ceil(t1)
+	}
+	t0 = math.Max(math.Max(t0, tMin), -maxSpreadRepetitions)
+	t1 = math.Min(math.Min(t1, tMax), 1.0+maxSpreadRepetitions)
+	return t0, t1
+}
+
+// spreadFunction returns a stitching function over the domain [t0,t1] that repeats the stops function every unit offset, which is reversed for every other repetition when reflecting.
+func spreadFunction(stops canvas.Stops, spread canvas.Spread, t0, t1 float64) pdfDict {
+	f := patternStopsFunction(stops)
+	fs := pdfArray{}
+	encode := pdfArray{}
+	bounds := pdfArray{}
+	for k := math.Floor(t0); k < t1; k++ {
+		a, b := math.Max(t0, k)-k, math.Min(t1, k+1.0)-k
+		if spread == canvas.SpreadReflect && math.Mod(k, 2.0) != 0.0 {
+			a, b = 1.0-a, 1.0-b
+		}
+		if 0 < len(fs) {
+			bounds = append(bounds, k)
+		}
+		fs = append(fs, f)
+		encode = append(encode, a, b)
+	}
+	if len(fs) == 1 && encode[0] == 0.0 && encode[1] == 1.0 {
+		return f
+	}
+	return pdfDict{
+		"FunctionType": 3,
+		"Domain":       pdfArray{t0, t1},
+		"Encode":       encode,
+		"Bounds":       bounds,
+		"Functions":    fs,
+	}
+}
+
 func patternStopsFunction(stops canvas.Stops) pdfDict {
 	if len(stops) < 2 {
 		return pdfDict{}
@@ -0,0 +1,91 @@
+package rasterizer
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/tdewolff/canvas"
+)
+
+// Dither is the dithering method used to reduce banding when quantizing gradients to 8-bit colors.
+type Dither int
+
+// see Dither
+const (
+	NoDither      Dither = iota
+	OrderedDither        // 8x8 Bayer matrix
+	NoiseDither          // interleaved gradient noise, which approximates blue noise
+)
+
+var bayer8x8 = [64]uint8{
+	0, 32, 8, 40, 2, 34, 10, 42,
+	48, 16, 56, 24, 50, 18, 58, 26,
+	12, 44, 4, 36, 14, 46, 6, 38,
+	60, 28, 52, 20, 62, 30, 54, 22,
+	3, 35, 11, 43, 1, 33, 9, 41,
+	51, 19, 59, 27, 49, 17, 57, 25,
+	15, 47, 7, 39, 13, 45, 5, 37,
+	63, 31, 55, 23, 61, 29, 53, 21,
+}
+
+// threshold returns the dithering threshold ∈ [0,1) for the pixel at (x,y).
+func (dither Dither) threshold(x, y int) float64 {
+	switch dither {
+	case OrderedDither:
+		return (float64(bayer8x8[(y&7)*8+(x&7)]) + 0.5) / 64.0
+	case NoiseDither:
+		// see Jorge Jimenez, "Next Generation Post Processing in Call of Duty: Advanced Warfare", 2014
+		_, f := math.Modf(0.06711056*float64(x) + 0.00583715*float64(y))
+		_, f = math.Modf(52.9829189 * f)
+		return f
+	}
+	return 0.5
+}
+
+// quantize returns the 8-bit color of a 16-bit color for the pixel at (x,y).
+func (dither Dither) quantize(c color.RGBA64, x, y int) color.RGBA {
+	t := dither.threshold(x, y)
+	q := func(v uint16) uint8 {
+		return uint8(math.Min(255.0, math.Floor(float64(v)/257.0+t)))
+	}
+	a := q(c.A)
+	min := func(v, a uint8) uint8 {
+		if a < v {
+			return a // keep alpha-premultiplied colors valid
+		}
+		return v
+	}
+	return color.RGBA{min(q(c.R), a), min(q(c.G), a), min(q(c.B), a), a}
+}
+
+// transferFunc returns the function that encodes linear color components ∈ [0,1] for the output of the color space, or nil if the output is linear or the color space is unknown. It is used to dither at 16-bit precision in the output encoding, since dithering before the conversion is undone by the conversion.
+func transferFunc(colorSpace canvas.ColorSpace) func(float64) float64 {
+	switch cs := colorSpace.(type) {
+	case canvas.GammaColorSpace:
+		return func(c float64) float64 {
+			return math.Pow(c, 1.0/cs.Gamma)
+		}
+	case canvas.SRGBColorSpace:
+		return func(c float64) float64 {
+			// Formula from EXT_sRGB.
+			if c < 0.0031308 {
+				return 12.92 * c
+			}
+			return 1.055*math.Pow(c, 1.0/2.4) - 0.055
+		}
+	}
+	return nil
+}
+
+// encode returns the alpha-premultiplied 16-bit color encoded by the transfer function from a linear color.
+func encode(c color.RGBA64, f func(float64) float64) color.RGBA64 {
+	if c.A == 0 {
+		return color.RGBA64{}
+	}
+	a := float64(c.A)
+	e := func(v uint16) uint16 {
+		x := math.Max(0.0, math.Min(1.0, f(math.Min(1.0, float64(v)/a))))
+		return uint16(x*a + 0.5)
+	}
+	return color.RGBA64{e(c.R), e(c.G), e(c.B), c.A}
+}
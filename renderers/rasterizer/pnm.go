@@ -0,0 +1,57 @@
+package rasterizer
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// EncodePPM writes the image as a binary PPM (P6) with 8-bit RGB samples. Since PPM has no alpha channel, transparent pixels are composited over black.
+func EncodePPM(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "P6\n%d %d\n255\n", bounds.Dx(), bounds.Dy()); err != nil {
+		return err
+	}
+	row := make([]byte, 3*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// premultiplied colors are equal to compositing over black
+			r, g, b, _ := img.At(x, y).RGBA()
+			i := 3 * (x - bounds.Min.X)
+			row[i+0] = uint8(r >> 8)
+			row[i+1] = uint8(g >> 8)
+			row[i+2] = uint8(b >> 8)
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// EncodePAM writes the image as a PAM (P7) with 8-bit non-premultiplied RGB_ALPHA samples.
+func EncodePAM(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n", bounds.Dx(), bounds.Dy()); err != nil {
+		return err
+	}
+	row := make([]byte, 4*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			i := 4 * (x - bounds.Min.X)
+			row[i+0] = c.R
+			row[i+1] = c.G
+			row[i+2] = c.B
+			row[i+3] = c.A
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
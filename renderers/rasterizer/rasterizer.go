@@ -2,6 +2,7 @@ package rasterizer
 
 import (
 	"image"
+	"image/color"
 	"math"
 
 	"github.com/tdewolff/canvas"
@@ -10,6 +11,10 @@ import (
 	"golang.org/x/image/vector"
 )
 
+func init() {
+	canvas.RegisterRasterizer(Draw)
+}
+
 // Draw draws the canvas on a new image with given resolution (in dots-per-millimeter). Higher resolution will result in larger images.
 func Draw(c *canvas.Canvas, resolution canvas.Resolution, colorSpace canvas.ColorSpace) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, int(c.W*resolution.DPMM()+0.5), int(c.H*resolution.DPMM()+0.5)))
@@ -24,6 +29,12 @@ type Rasterizer struct {
 	draw.Image
 	resolution canvas.Resolution
 	colorSpace canvas.ColorSpace
+	dither     Dither
+	lutSize    int
+	dst        draw.Image // output image when dithering for a non-linear color space, the Image is then a 16-bit linear buffer
+
+	groups []draw.Image // backdrops of the open groups, nil for non-isolated groups
+	alphas []float64    // opacities of the open groups
 }
 
 // New returns a renderer that draws to a rasterized image. By default the linear color space is used, which assumes input and output colors are in linearRGB. If the sRGB color space is used for drawing with an average of gamma=2.2, the input and output colors are assumed to be in sRGB (a common assumption) and blending happens in linearRGB. Be aware that for text this results in thin stems for black-on-white (but wide stems for white-on-black).
@@ -52,12 +63,51 @@ func FromImage(img draw.Image, resolution canvas.Resolution, colorSpace canvas.C
 }
 
 func (r *Rasterizer) Close() {
-	if _, ok := r.colorSpace.(canvas.LinearColorSpace); !ok {
+	for 0 < len(r.groups) {
+		r.EndGroup()
+	}
+	if r.dst != nil {
+		// gamma compress at 16-bit precision and dither in the output encoding
+		f := transferFunc(r.colorSpace)
+		src := r.Image.(*image.RGBA64)
+		bounds := src.Bounds()
+		for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+			for i := bounds.Min.X; i < bounds.Max.X; i++ {
+				r.dst.Set(i, j, r.dither.quantize(encode(src.RGBA64At(i, j), f), i, j))
+			}
+		}
+		r.Image, r.dst = r.dst, nil
+	} else if _, ok := r.colorSpace.(canvas.LinearColorSpace); !ok {
 		// gamma compress
 		changeColorSpace(r.Image, r.Image, r.colorSpace.FromLinear)
 	}
 }
 
+// SetDither sets the dithering method for gradients, which reduces visible banding of subtle gradients. By default no dithering is used. For the gamma and sRGB color spaces, drawing happens at 16-bit precision and the whole image is dithered when it is converted to the output color space on Close.
+func (r *Rasterizer) SetDither(dither Dither) {
+	r.dither = dither
+	if dither != NoDither && r.dst == nil && len(r.groups) == 0 && transferFunc(r.colorSpace) != nil {
+		// dithering before gamma compression would be undone by it, so keep drawing in 16-bit linear space until Close
+		bounds := r.Image.Bounds()
+		buf := image.NewRGBA64(bounds)
+		draw.Draw(buf, bounds, r.Image, bounds.Min, draw.Src)
+		r.Image, r.dst = buf, r.Image
+	}
+}
+
+// newLayer returns a transparent image for a group with the same bounds and precision as the image.
+func (r *Rasterizer) newLayer() draw.Image {
+	if r.dst != nil {
+		return image.NewRGBA64(r.Image.Bounds())
+	}
+	return image.NewRGBA(r.Image.Bounds())
+}
+
+// SetGradientLUT sets the size of the lookup table of the color ramp of linear and radial gradients, which speeds up filling large areas with gradients at a small loss of accuracy. Larger tables are more accurate, where a size of 1024 is hardly distinguishable from evaluating the color stops per pixel. By default no lookup table is used, and it is not used when dithering.
+func (r *Rasterizer) SetGradientLUT(size int) {
+	r.lutSize = size
+}
+
 // Size returns the size of the canvas in millimeters.
 func (r *Rasterizer) Size() (float64, float64) {
 	size := r.Bounds().Size()
@@ -133,13 +183,23 @@ func (r *Rasterizer) RenderPath(path *canvas.Path, style canvas.Style, m canvas.
 			src = image.NewUniform(r.colorSpace.ToLinear(style.Fill.Color))
 		} else if style.Fill.IsGradient() {
 			gradient := style.Fill.Gradient.SetColorSpace(r.colorSpace)
-			src = NewGradientImage(gradient, zp, size, r.resolution)
+			gradientImage := NewGradientImage(gradient, zp, size, r.resolution)
+			if r.dst != nil {
+				gradientImage.precise = true
+			} else {
+				gradientImage.Dither = r.dither
+				gradientImage.SetLUT(r.lutSize)
+			}
+			src = gradientImage
+		} else if paint, ok := style.Fill.Pattern.(*canvas.ImagePaint); ok {
+			paint = paint.SetColorSpace(r.colorSpace).(*canvas.ImagePaint)
+			src = NewImagePaintImage(paint, m, zp, size, r.resolution)
 		} else if style.Fill.IsPattern() {
 			pattern := style.Fill.Pattern.SetColorSpace(r.colorSpace)
 			pattern.ClipTo(r, fill)
 		}
 		if src != nil {
-			ras.Draw(r.Image, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy})
+			r.draw(ras, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy}, style.BlendMode)
 		}
 	}
 	if style.HasStroke() {
@@ -158,14 +218,149 @@ func (r *Rasterizer) RenderPath(path *canvas.Path, style canvas.Style, m canvas.
 			src = image.NewUniform(r.colorSpace.ToLinear(style.Stroke.Color))
 		} else if style.Stroke.IsGradient() {
 			gradient := style.Stroke.Gradient.SetColorSpace(r.colorSpace)
-			src = NewGradientImage(gradient, zp, size, r.resolution)
+			gradientImage := NewGradientImage(gradient, zp, size, r.resolution)
+			if r.dst != nil {
+				gradientImage.precise = true
+			} else {
+				gradientImage.Dither = r.dither
+				gradientImage.SetLUT(r.lutSize)
+			}
+			src = gradientImage
+		} else if paint, ok := style.Stroke.Pattern.(*canvas.ImagePaint); ok {
+			paint = paint.SetColorSpace(r.colorSpace).(*canvas.ImagePaint)
+			src = NewImagePaintImage(paint, m, zp, size, r.resolution)
 		} else if style.Fill.IsPattern() {
 			pattern := style.Stroke.Pattern.SetColorSpace(r.colorSpace)
 			pattern.ClipTo(r, fill)
 		}
 		if src != nil {
-			ras.Draw(r.Image, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy})
+			r.draw(ras, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy}, style.BlendMode)
+		}
+	}
+}
+
+// draw draws the rasterized path with the source image, using a blend mode to mix it with the backdrop.
+func (r *Rasterizer) draw(ras *vector.Rasterizer, rect image.Rectangle, src image.Image, sp image.Point, mode canvas.BlendMode) {
+	if mode == canvas.BlendNormal {
+		ras.Draw(r.Image, rect, src, sp)
+		return
+	}
+
+	layer := image.NewRGBA(rect)
+	ras.Draw(layer, rect, src, sp)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := layer.PixOffset(x, y)
+			as := float64(layer.Pix[i+3]) / 255.0
+			if as == 0.0 {
+				continue
+			}
+			Rb, Gb, Bb, Ab := r.Image.At(x, y).RGBA()
+			ab := float64(Ab) / 65535.0
+			cb := [3]float64{float64(Rb) / 65535.0, float64(Gb) / 65535.0, float64(Bb) / 65535.0}
+
+			// premultiplied compositing of the blended source over the backdrop
+			c := [3]float64{}
+			for k := range c {
+				cs := float64(layer.Pix[i+k]) / 255.0
+				c[k] = cs*(1.0-ab) + cb[k]*(1.0-as)
+				if ab != 0.0 {
+					c[k] += as * ab * mode.Blend(cb[k]/ab, cs/as)
+				}
+			}
+			a := as + ab - as*ab
+			r.Image.Set(x, y, color.RGBA64{
+				uint16(math.Min(c[0], a)*65535.0 + 0.5),
+				uint16(math.Min(c[1], a)*65535.0 + 0.5),
+				uint16(math.Min(c[2], a)*65535.0 + 0.5),
+				uint16(a*65535.0 + 0.5),
+			})
+		}
+	}
+}
+
+// Coverage rasterizes the path transformed by the matrix without painting it, and calls the callback for each pixel row that the path covers with the row y, the column x of the first covered pixel, and the coverage of consecutive pixels from x, where 0 is uncovered and 255 is fully covered. Rows are visited from top to bottom in image coordinates, and are clipped to the image. This decouples coverage from color, so that the path can be composited with an arbitrary paint or blend function.
+func (r *Rasterizer) Coverage(path *canvas.Path, m canvas.Matrix, callback func(y, x int, coverage []uint8)) {
+	path = path.Transform(m)
+	bounds := path.Bounds()
+
+	padding := 2
+	size := r.Bounds().Size()
+	dpmm := r.resolution.DPMM()
+	x0 := int(bounds.X*dpmm) - padding
+	y0 := size.Y - int((bounds.Y+bounds.H)*dpmm) - padding
+	x1 := x0 + int(bounds.W*dpmm) + 2*padding
+	y1 := y0 + int(bounds.H*dpmm) + 2*padding
+	if x0 < 0 {
+		x0 = 0
+	}
+	if y0 < 0 {
+		y0 = 0
+	}
+	if size.X < x1 {
+		x1 = size.X
+	}
+	if size.Y < y1 {
+		y1 = size.Y
+	}
+	if x1 <= x0 || y1 <= y0 {
+		return // outside canvas or has no size
+	}
+
+	w, h := x1-x0, y1-y0
+	ras := vector.NewRasterizer(w, h)
+	path = path.Translate(-float64(x0)/dpmm, -float64(size.Y-y1)/dpmm)
+	path.ToRasterizer(ras, r.resolution)
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	ras.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	for y := 0; y < h; y++ {
+		row := mask.Pix[y*mask.Stride : y*mask.Stride+w]
+		start, end := 0, w
+		for start < end && row[start] == 0 {
+			start++
+		}
+		for start < end && row[end-1] == 0 {
+			end--
+		}
+		if start < end {
+			callback(y0+y, x0+start, row[start:end])
+		}
+	}
+}
+
+// BeginGroup starts a group of drawing operations. An isolated group is drawn on a transparent layer that is composited onto the backdrop when the group ends, so that blend modes within the group do not mix with the backdrop.
+func (r *Rasterizer) BeginGroup(isolate bool) {
+	if !isolate {
+		r.groups = append(r.groups, nil)
+		r.alphas = append(r.alphas, 1.0)
+		return
+	}
+	r.BeginAlphaGroup(1.0)
+}
+
+// BeginAlphaGroup starts an isolated group of drawing operations that is composited onto the backdrop at the given opacity when the group ends.
+func (r *Rasterizer) BeginAlphaGroup(alpha float64) {
+	r.groups = append(r.groups, r.Image)
+	r.alphas = append(r.alphas, alpha)
+	r.Image = r.newLayer()
+}
+
+// EndGroup ends the last group of drawing operations and composites it onto the backdrop.
+func (r *Rasterizer) EndGroup() {
+	if len(r.groups) == 0 {
+		return
+	}
+	backdrop, alpha := r.groups[len(r.groups)-1], r.alphas[len(r.alphas)-1]
+	r.groups = r.groups[:len(r.groups)-1]
+	r.alphas = r.alphas[:len(r.alphas)-1]
+	if backdrop != nil {
+		if alpha < 1.0 {
+			mask := image.NewUniform(color.Alpha16{uint16(alpha*0xFFFF + 0.5)})
+			draw.DrawMask(backdrop, backdrop.Bounds(), r.Image, r.Image.Bounds().Min, mask, image.Point{}, draw.Over)
+		} else {
+			draw.Draw(backdrop, backdrop.Bounds(), r.Image, r.Image.Bounds().Min, draw.Over)
 		}
+		r.Image = backdrop
 	}
 }
 
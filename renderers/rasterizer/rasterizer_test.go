@@ -0,0 +1,560 @@
+package rasterizer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+func TestRasterizerBlendGroup(t *testing.T) {
+	yellow := color.RGBA{255, 255, 0, 255}
+	gray := color.RGBA{128, 128, 128, 255}
+
+	drawCanvas := func(group, isolate bool) *canvas.Canvas {
+		c := canvas.New(10.0, 10.0)
+		style := canvas.DefaultStyle
+		style.Fill = canvas.Paint{Color: yellow}
+		c.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+		if group {
+			c.BeginGroup(isolate)
+		}
+		style.Fill = canvas.Paint{Color: gray}
+		style.BlendMode = canvas.BlendMultiply
+		c.RenderPath(canvas.Rectangle(5.0, 10.0), style, canvas.Identity)
+		if group {
+			c.EndGroup()
+		}
+		return c
+	}
+
+	// multiply with the yellow backdrop
+	img := Draw(drawCanvas(false, false), canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(2, 5), color.RGBA{128, 128, 0, 255})
+	test.T(t, img.RGBAAt(7, 5), yellow)
+
+	// multiply within the isolated group only, which is then composited normally
+	img = Draw(drawCanvas(true, true), canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(2, 5), gray)
+	test.T(t, img.RGBAAt(7, 5), yellow)
+
+	// non-isolated groups blend with the backdrop
+	img = Draw(drawCanvas(true, false), canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(2, 5), color.RGBA{128, 128, 0, 255})
+
+	cmds := drawCanvas(true, true).Commands()
+	test.T(t, len(cmds), 4)
+	test.T(t, cmds[1], canvas.DrawCommand(canvas.GroupCmd{Begin: true, Isolate: true}))
+	test.T(t, cmds[3], canvas.DrawCommand(canvas.GroupCmd{}))
+}
+
+func TestRasterizerGlobalAlpha(t *testing.T) {
+	drawCanvas := func(fill color.RGBA) *canvas.Canvas {
+		c := canvas.New(10.0, 10.0)
+		style := canvas.DefaultStyle
+		style.Fill = canvas.Paint{Color: fill}
+		c.RenderPath(canvas.Rectangle(6.0, 10.0), style, canvas.Identity)
+		c.RenderPath(canvas.Rectangle(6.0, 10.0).Translate(4.0, 0.0), style, canvas.Identity)
+		return c
+	}
+
+	// overlapping shapes with a reduced opacity each are darkened twice
+	img := Draw(drawCanvas(color.RGBA{0, 0, 0, 128}), canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(2, 5).A, uint8(128))
+	test.T(t, img.RGBAAt(5, 5).A, uint8(192))
+
+	// global alpha composites the canvas as a whole
+	c := drawCanvas(canvas.Black)
+	c.SetGlobalAlpha(0.5)
+	img = Draw(c, canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(2, 5).A, uint8(128))
+	test.T(t, img.RGBAAt(5, 5).A, uint8(128))
+
+	c.SetGlobalAlpha(0.0)
+	img = Draw(c, canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(5, 5).A, uint8(0))
+
+	// a canvas rendered onto another canvas records an alpha group
+	c.SetGlobalAlpha(0.5)
+	dst := canvas.New(10.0, 10.0)
+	c.RenderTo(dst)
+	cmds := dst.Commands()
+	test.T(t, len(cmds), 4)
+	test.T(t, cmds[0], canvas.DrawCommand(canvas.GroupCmd{Begin: true, Isolate: true, Alpha: 0.5}))
+	img = Draw(dst, canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(5, 5).A, uint8(128))
+
+	// Reset restores the opacity
+	c.SetGlobalAlpha(0.0)
+	c.Reset()
+	c.RenderPath(canvas.Rectangle(10.0, 10.0), canvas.DefaultStyle, canvas.Identity)
+	img = Draw(c, canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(5, 5).A, uint8(255))
+
+	// the zero value of a canvas is opaque
+	c = &canvas.Canvas{W: 10.0, H: 10.0}
+	c.SetBackground(canvas.Black)
+	img = Draw(c, canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(5, 5).A, uint8(255))
+}
+
+func TestRasterizerGradientLUT(t *testing.T) {
+	gradient := canvas.NewRadialGradient(canvas.Point{50.0, 50.0}, 0.0, canvas.Point{50.0, 50.0}, 50.0)
+	gradient.Add(0.0, canvas.Red)
+	gradient.Add(0.3, canvas.Yellow)
+	gradient.Add(0.7, color.RGBA{0, 0, 255, 128})
+	gradient.Add(1.0, canvas.Black)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+
+	render := func(size int) *image.RGBA {
+		ras := New(100.0, 100.0, canvas.DPMM(1.0), canvas.LinearColorSpace{})
+		ras.SetGradientLUT(size)
+		ras.RenderPath(canvas.Rectangle(100.0, 100.0), style, canvas.Identity)
+		ras.Close()
+		return ras.Image.(*image.RGBA)
+	}
+
+	exact, lut := render(0), render(1024)
+	maxDiff := 0
+	for i := range exact.Pix {
+		diff := int(exact.Pix[i]) - int(lut.Pix[i])
+		if diff < 0 {
+			diff = -diff
+		}
+		if maxDiff < diff {
+			maxDiff = diff
+		}
+	}
+	test.That(t, maxDiff <= 1, "lookup table must be accurate to one color level")
+	test.T(t, lut.RGBAAt(0, 0), canvas.Black) // outside the outer circle
+	test.T(t, lut.RGBAAt(50, 50), exact.RGBAAt(50, 50))
+}
+
+func TestRasterizerGradientSpread(t *testing.T) {
+	gradient := canvas.NewLinearGradient(canvas.Point{0.0, 0.0}, canvas.Point{10.0, 0.0})
+	gradient.Add(0.0, canvas.Black)
+	gradient.Add(1.0, canvas.White)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+
+	render := func(spread canvas.Spread) *image.RGBA {
+		gradient.Spread = spread
+		ras := New(40.0, 1.0, canvas.DPMM(1.0), canvas.LinearColorSpace{})
+		ras.RenderPath(canvas.Rectangle(40.0, 1.0), style, canvas.Identity)
+		ras.Close()
+		return ras.Image.(*image.RGBA)
+	}
+
+	img := render(canvas.SpreadPad)
+	test.T(t, img.RGBAAt(25, 0), canvas.White)
+
+	// the pattern repeats every 10 pixels
+	img = render(canvas.SpreadRepeat)
+	for x := 0; x < 10; x++ {
+		test.T(t, img.RGBAAt(x+10, 0), img.RGBAAt(x, 0))
+		test.T(t, img.RGBAAt(x+30, 0), img.RGBAAt(x, 0))
+	}
+	test.That(t, img.RGBAAt(9, 0).R > 200 && img.RGBAAt(10, 0).R < 50, "gradient must restart")
+
+	// every other repetition is mirrored around the end of the gradient
+	img = render(canvas.SpreadReflect)
+	for x := 0; x < 10; x++ {
+		test.T(t, img.RGBAAt(20-x, 0), img.RGBAAt(x, 0))
+		test.T(t, img.RGBAAt(x+20, 0), img.RGBAAt(x, 0))
+	}
+}
+
+func TestRasterizerImagePaint(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(img, image.Rect(0, 0, 2, 2), image.NewUniform(red), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(2, 0, 4, 2), image.NewUniform(green), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 2, 2, 4), image.NewUniform(blue), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(2, 2, 4, 4), image.NewUniform(canvas.White), image.Point{}, draw.Src)
+
+	// the image of 10x10 mm follows the rotation of the rectangle
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Pattern: canvas.NewImagePaint(img, canvas.Identity.Scale(2.5, 2.5), canvas.ImageClamp)}
+	ras := New(40.0, 30.0, canvas.DPMM(1.0), canvas.LinearColorSpace{})
+	ras.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity.Translate(20.0, 5.0).Rotate(45.0))
+	ras.Close()
+	test.T(t, ras.Image.(*image.RGBA).RGBAAt(16, 17), red)
+	test.T(t, ras.Image.(*image.RGBA).RGBAAt(23, 17), canvas.White)
+	test.T(t, ras.Image.(*image.RGBA).RGBAAt(2, 2), canvas.Transparent)
+
+	render := func(wrap canvas.ImageWrap) *image.RGBA {
+		style.Fill = canvas.Paint{Pattern: canvas.NewImagePaint(img, canvas.Identity.Scale(2.5, 2.5), wrap)}
+		ras := New(20.0, 10.0, canvas.DPMM(1.0), canvas.LinearColorSpace{})
+		ras.RenderPath(canvas.Rectangle(20.0, 10.0), style, canvas.Identity)
+		ras.Close()
+		return ras.Image.(*image.RGBA)
+	}
+
+	// the edge pixels extend to the right of the image
+	rgba := render(canvas.ImageClamp)
+	test.T(t, rgba.RGBAAt(15, 2), green)
+	test.T(t, rgba.RGBAAt(15, 7), canvas.White)
+
+	// the image repeats every 10 pixels
+	rgba = render(canvas.ImageRepeat)
+	test.T(t, rgba.RGBAAt(12, 2), red)
+	test.T(t, rgba.RGBAAt(17, 2), green)
+	test.T(t, rgba.RGBAAt(12, 7), blue)
+}
+
+func BenchmarkRasterizerRadialGradient(b *testing.B) {
+	gradient := canvas.NewRadialGradient(canvas.Point{250.0, 250.0}, 0.0, canvas.Point{250.0, 250.0}, 250.0)
+	for i := 0; i <= 10; i++ {
+		gradient.Add(float64(i)/10.0, color.RGBA{uint8(25 * i), 0, uint8(255 - 25*i), 255})
+	}
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+
+	for _, size := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("lut=%d", size), func(b *testing.B) {
+			ras := New(500.0, 500.0, canvas.DPMM(1.0), canvas.LinearColorSpace{})
+			ras.SetGradientLUT(size)
+			for i := 0; i < b.N; i++ {
+				ras.RenderPath(canvas.Rectangle(500.0, 500.0), style, canvas.Identity)
+			}
+		})
+	}
+}
+
+func TestRasterizerCoverage(t *testing.T) {
+	r := New(20.0, 20.0, canvas.DPMM(2.0), nil)
+	triangle := canvas.MustParseSVGPath("M1 1L9 1L1 9z") // area of 32mm² or 128px²
+
+	area := 0.0
+	rows := 0
+	r.Coverage(triangle, canvas.Identity.Translate(5.0, 5.0), func(y, x int, coverage []uint8) {
+		test.That(t, 0 <= x && x+len(coverage) <= 40 && 0 <= y && y < 40, "span must be inside the image")
+		test.That(t, 0 < coverage[0] && 0 < coverage[len(coverage)-1], "span must be trimmed")
+		for _, c := range coverage {
+			area += float64(c) / 255.0
+		}
+		rows++
+	})
+	test.Float(t, math.Round(area), 128.0)
+	test.T(t, rows, 16)
+
+	// coverage is clipped to the image and does not paint
+	rows = 0
+	r.Coverage(triangle, canvas.Identity.Translate(15.0, 15.0), func(y, x int, coverage []uint8) {
+		test.That(t, 0 <= y && x+len(coverage) <= 40, "span must be clipped")
+		rows++
+	})
+	test.T(t, rows, 8) // top 4mm of the triangle
+	test.T(t, r.Image.(*image.RGBA).RGBAAt(20, 20).A, uint8(0))
+}
+
+func TestRasterizerDither(t *testing.T) {
+	// shallow gradient of 10 gray levels over 200 pixels
+	gradient := canvas.NewLinearGradient(canvas.Point{0.0, 0.0}, canvas.Point{200.0, 0.0})
+	gradient.Add(0.0, color.RGBA{100, 100, 100, 255})
+	gradient.Add(1.0, color.RGBA{110, 110, 110, 255})
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+
+	// banding is measured as the mean deviation from the exact gradient of the pixel values averaged per column
+	banding := func(dither Dither, colorSpace canvas.ColorSpace) float64 {
+		// the gradient is interpolated between the stops in linear space and encoded for the output
+		encode := func(v float64) float64 { return v }
+		if f := transferFunc(colorSpace); f != nil {
+			encode = func(v float64) float64 { return 255.0 * f(v/255.0) }
+		}
+		c0, c1 := float64(colorSpace.ToLinear(gradient.Stops[0].Color).R), float64(colorSpace.ToLinear(gradient.Stops[1].Color).R)
+
+		ras := New(200.0, 16.0, canvas.DPMM(1.0), colorSpace)
+		ras.SetDither(dither)
+		ras.RenderPath(canvas.Rectangle(200.0, 16.0), style, canvas.Identity)
+		ras.Close()
+
+		deviation := 0.0
+		for x := 0; x < 200; x++ {
+			mean := 0.0
+			for y := 0; y < 16; y++ {
+				mean += float64(ras.At(x, y).(color.RGBA).R) / 16.0
+			}
+			exact := encode(c0 + (c1-c0)*(float64(x)+0.5)/200.0)
+			deviation += math.Abs(mean-exact) / 200.0
+		}
+		return deviation
+	}
+
+	for _, colorSpace := range []canvas.ColorSpace{canvas.LinearColorSpace{}, canvas.SRGBColorSpace{}} {
+		deviation := banding(NoDither, colorSpace)
+		test.That(t, 0.2 < deviation, "deviation", deviation, "for color space", colorSpace)
+		for _, dither := range []Dither{OrderedDither, NoiseDither} {
+			ditherDeviation := banding(dither, colorSpace)
+			test.That(t, ditherDeviation < deviation/2.0, "deviation", ditherDeviation, "for dither", dither, "and color space", colorSpace)
+		}
+	}
+}
+
+func TestRasterizerMeshGradient(t *testing.T) {
+	// Coons patch with a curved top side, corners are bottom-left, top-left, top-right, and bottom-right
+	colors := [4]color.RGBA{canvas.Red, canvas.Lime, canvas.Blue, canvas.White}
+	gradient := canvas.NewMeshGradient()
+	gradient.Add([12]canvas.Point{
+		{0.0, 0.0}, {0.0, 3.0}, {0.0, 7.0},
+		{0.0, 10.0}, {3.0, 12.0}, {7.0, 12.0},
+		{10.0, 10.0}, {10.0, 7.0}, {10.0, 3.0},
+		{10.0, 0.0}, {7.0, 0.0}, {3.0, 0.0},
+	}, colors)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+
+	ras := New(10.0, 10.0, canvas.DPMM(10.0), canvas.LinearColorSpace{})
+	ras.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+	ras.Close()
+
+	near := func(a, b color.RGBA) bool {
+		d := func(x, y uint8) bool { return math.Abs(float64(x)-float64(y)) <= 8.0 }
+		return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+	}
+	for i, pos := range [][2]int{{0, 99}, {0, 0}, {99, 0}, {99, 99}} {
+		c := ras.At(pos[0], pos[1]).(color.RGBA)
+		test.That(t, near(c, colors[i]), "corner", i, c, "must be close to", colors[i])
+	}
+
+	// the color at the patch's center is the average of the corners
+	c := ras.At(50, 42).(color.RGBA)
+	test.That(t, near(c, color.RGBA{128, 128, 128, 255}), "center", c)
+}
+
+func TestCanvasRasterize(t *testing.T) {
+	src := canvas.New(10.0, 10.0)
+	ctx := canvas.NewContext(src)
+	ctx.SetFillColor(canvas.Red)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(5.0, 10.0))
+	img, err := src.Rasterize(canvas.DPMM(2.0))
+	test.Error(t, err)
+	test.T(t, img.Bounds(), image.Rect(0, 0, 20, 20))
+
+	// embed the snapshot into another canvas
+	dst := canvas.New(10.0, 10.0)
+	ctx = canvas.NewContext(dst)
+	ctx.DrawImage(0.0, 0.0, img, canvas.DPMM(2.0))
+	out, err := dst.Rasterize(canvas.DPMM(2.0))
+	test.Error(t, err)
+	test.T(t, out.Bounds(), img.Bounds())
+	for _, pos := range []image.Point{{2, 10}, {9, 0}, {10, 19}, {17, 5}} {
+		test.T(t, out.At(pos.X, pos.Y), img.At(pos.X, pos.Y), pos)
+	}
+	test.T(t, out.At(2, 10), canvas.Red)
+	test.T(t, out.At(17, 5), canvas.Transparent)
+}
+
+func TestCanvasImage(t *testing.T) {
+	c := canvas.New(10.0, 10.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFillColor(canvas.Red)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(5.0, 10.0))
+
+	// pass the canvas to a standard image function
+	img := c.Image(canvas.DPMM(2.0))
+	dst := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(dst, dst.Bounds(), img, image.Point{}, draw.Src)
+	test.T(t, img.Bounds(), image.Rect(0, 0, 20, 20))
+	test.T(t, dst.At(2, 10), canvas.Red)
+	test.T(t, dst.At(17, 5), canvas.Transparent)
+}
+
+func TestRasterizerGammaCorrectBlending(t *testing.T) {
+	c := canvas.New(1.0, 1.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFillColor(canvas.Black)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(1.0, 1.0))
+	ctx.SetFillColor(canvas.RGBA(255, 255, 255, 0.5))
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(1.0, 1.0))
+
+	// blending in sRGB space gives half the sRGB value, while blending in linear space gives half the light intensity
+	img := Draw(c, canvas.DPMM(1.0), canvas.LinearColorSpace{})
+	test.T(t, img.At(0, 0), color.RGBA{127, 127, 127, 255})
+	img = Draw(c, canvas.DPMM(1.0), canvas.SRGBColorSpace{})
+	test.T(t, img.At(0, 0), color.RGBA{187, 187, 187, 255})
+}
+
+func TestRasterizerHollowText(t *testing.T) {
+	family := canvas.NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(283.46, canvas.Transparent) // 100mm
+	face.Stroke = canvas.Paint{Color: canvas.Black}
+	face.StrokeWidth = 1.0
+	txt := canvas.NewTextLine(face, "I", canvas.Left)
+
+	// the outline bounds include the stroke
+	bounds := txt.OutlineBounds()
+	filled := family.Face(283.46, canvas.Black)
+	test.Float(t, bounds.W, canvas.NewTextLine(filled, "I", canvas.Left).OutlineBounds().W+1.0)
+
+	c := canvas.New(bounds.W, bounds.H)
+	ctx := canvas.NewContext(c)
+	ctx.DrawText(-bounds.X, -bounds.Y, txt)
+	img := Draw(c, canvas.DPMM(4.0), canvas.DefaultColorSpace)
+
+	// the center of the thick stem is not filled, while its contour is stroked
+	h := img.Bounds().Dy() / 2
+	test.T(t, img.At(img.Bounds().Dx()/2, h), canvas.Transparent)
+	edges, inside := 0, false
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		if opaque := img.At(x, h).(color.RGBA).A == 255; opaque && !inside {
+			edges++
+			inside = true
+		} else if !opaque {
+			inside = false
+		}
+	}
+	test.T(t, edges, 2)
+}
+
+func TestRasterizerTextClip(t *testing.T) {
+	family := canvas.NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(28.346, canvas.Black) // 10mm
+
+	// an unbreakable word that overflows the box to the right
+	txt := canvas.NewTextBox(face, "overflowing", 20.0, 0.0, canvas.Left, canvas.Top, 0.0, 0.0)
+	test.That(t, txt.Overflows || 20.0 < txt.OutlineBounds().W, "text must overflow")
+
+	draw := func(clip bool) *image.RGBA {
+		txt.Clip = clip
+		c := canvas.New(60.0, 20.0)
+		ctx := canvas.NewContext(c)
+		ctx.DrawText(0.0, 20.0, txt)
+		return Draw(c, canvas.DPMM(2.0), canvas.DefaultColorSpace)
+	}
+	inkRight := func(img *image.RGBA) bool {
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			for x := 42; x < img.Bounds().Dx(); x++ { // right of 21mm
+				if img.At(x, y).(color.RGBA).A != 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	test.That(t, inkRight(draw(false)), "unclipped text must spill out of the box")
+	test.That(t, !inkRight(draw(true)), "clipped text must not spill out of the box")
+}
+
+func TestRasterizerStemDarkening(t *testing.T) {
+	family := canvas.NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(6.0, canvas.Black) // 6px at 72 DPI
+
+	coverage := func(darkening bool) int {
+		face.StemDarkening = darkening
+		txt := canvas.NewTextLine(face, "illi", canvas.Left)
+		c := canvas.New(10.0, 5.0)
+		ctx := canvas.NewContext(c)
+		ctx.DrawText(0.5, 1.0, txt)
+		img := Draw(c, canvas.DPI(72.0), canvas.DefaultColorSpace)
+
+		sum := 0
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				sum += int(img.At(x, y).(color.RGBA).A)
+			}
+		}
+		return sum
+	}
+	regular, darkened := coverage(false), coverage(true)
+	test.That(t, 0 < regular, "text must be rendered")
+	test.That(t, float64(regular)*1.1 < float64(darkened), "stem darkening must increase coverage", regular, darkened)
+}
+
+func TestRasterizerMirror(t *testing.T) {
+	family := canvas.NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, canvas.Black)
+	face.SubpixelGrid = 1.0 // keep glyphs on whole pixels so that both renderings are pixel aligned
+
+	draw := func(mirror bool) *image.RGBA {
+		c := canvas.New(30.0, 10.0)
+		ctx := canvas.NewContext(c)
+		ctx.DrawText(2.3, 3.1, canvas.NewTextLine(face, "Transfer", canvas.Left))
+		if mirror {
+			c.Mirror(canvas.MirrorHorizontal)
+		}
+		return Draw(c, canvas.DPMM(4.0), canvas.DefaultColorSpace)
+	}
+	img, mirrored := draw(false), draw(true)
+	test.T(t, mirrored.Bounds(), img.Bounds())
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	sum, diff := 0, 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := int(img.RGBAAt(x, y).A)
+			b := int(mirrored.RGBAAt(w-1-x, y).A)
+			sum += a
+			if diff < a-b {
+				diff = a - b
+			} else if diff < b-a {
+				diff = b - a
+			}
+		}
+	}
+	test.That(t, 0 < sum, "text must be rendered")
+	test.That(t, diff <= 1, "mirrored text must be the horizontal flip of the text", diff)
+}
+
+func TestRasterizerPAM(t *testing.T) {
+	c := canvas.New(4.0, 3.0)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Color: color.RGBA{128, 0, 0, 128}}
+	c.RenderPath(canvas.Rectangle(2.0, 3.0), style, canvas.Identity)
+	img := Draw(c, canvas.DPMM(1.0), nil)
+
+	var b bytes.Buffer
+	test.Error(t, EncodePAM(&b, img))
+	header := "P7\nWIDTH 4\nHEIGHT 3\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n"
+	test.String(t, b.String()[:len(header)], header)
+	data := b.Bytes()[len(header):]
+	test.T(t, len(data), 4*3*4)
+	test.T(t, data[:4], []byte{255, 0, 0, 128}) // non-premultiplied
+	test.T(t, data[12:16], []byte{0, 0, 0, 0})
+
+	b.Reset()
+	test.Error(t, EncodePPM(&b, img))
+	header = "P6\n4 3\n255\n"
+	test.String(t, b.String()[:len(header)], header)
+	data = b.Bytes()[len(header):]
+	test.T(t, len(data), 4*3*3)
+	test.T(t, data[:3], []byte{128, 0, 0})
+}
+
+func TestRasterizerBackground(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	c := canvas.New(10.0, 10.0)
+	c.SetBackground(red)
+	c.RenderPath(canvas.Rectangle(5.0, 5.0), canvas.DefaultStyle, canvas.Identity)
+
+	img := Draw(c, canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(2, 7), color.RGBA{0, 0, 0, 255})
+	test.T(t, img.RGBAAt(7, 2), red)
+	test.T(t, img.RGBAAt(7, 7), red)
+
+	c.SetBackground(canvas.Transparent)
+	img = Draw(c, canvas.DPMM(1.0), nil)
+	test.T(t, img.RGBAAt(7, 2), color.RGBA{})
+}
@@ -3,6 +3,7 @@ package rasterizer
 import (
 	"image"
 	"image/color"
+	"math"
 
 	"github.com/tdewolff/canvas"
 	"golang.org/x/image/draw"
@@ -28,10 +29,25 @@ func changeColorSpace(dst draw.Image, src image.Image, f colorFunc) {
 	}
 }
 
+// gradient64 is implemented by gradients that return colors at 16-bit precision, which is required for dithering.
+type gradient64 interface {
+	At64(float64, float64) color.RGBA64
+}
+
+// gradientRamp is implemented by gradients whose colors depend only on the position along the gradient, so that the colors can be looked up in a color ramp.
+type gradientRamp interface {
+	Offset(float64, float64) (float64, bool)
+	Ramp(int) []color.RGBA
+}
+
 type GradientImage struct {
 	g        canvas.Gradient
 	zp, size image.Point
 	dpmm     float64
+	lut      []color.Color // boxed colors to avoid an allocation per pixel
+	precise  bool          // return undithered colors at 16-bit precision, which are dithered after drawing
+
+	Dither Dither
 }
 
 func NewGradientImage(g canvas.Gradient, zp, size image.Point, res canvas.Resolution) *GradientImage {
@@ -43,7 +59,22 @@ func NewGradientImage(g canvas.Gradient, zp, size image.Point, res canvas.Resolu
 	}
 }
 
+// SetLUT sets the size of the lookup table of the color ramp that is used instead of evaluating the color stops per pixel, which speeds up filling large areas with gradients that have many stops. Each pixel's position along the gradient is still evaluated exactly. It has no effect for gradients other than linear and radial gradients or when dithering, and sizes smaller than two disable the lookup table.
+func (img *GradientImage) SetLUT(size int) {
+	img.lut = nil
+	if g, ok := img.g.(gradientRamp); ok && 2 <= size {
+		ramp := g.Ramp(size)
+		img.lut = make([]color.Color, len(ramp))
+		for i, c := range ramp {
+			img.lut[i] = c
+		}
+	}
+}
+
 func (img *GradientImage) ColorModel() color.Model {
+	if img.precise {
+		return color.RGBA64Model
+	}
 	return color.RGBAModel
 }
 
@@ -52,7 +83,57 @@ func (img *GradientImage) Bounds() image.Rectangle {
 }
 
 func (img *GradientImage) At(x, y int) color.Color {
-	return img.g.At(float64(img.zp.X+x)/img.dpmm, float64(img.size.Y-img.zp.Y-y)/img.dpmm)
+	gx, gy := float64(img.zp.X+x)/img.dpmm, float64(img.size.Y-img.zp.Y-y)/img.dpmm
+	if img.precise {
+		if g, ok := img.g.(gradient64); ok {
+			return g.At64(gx, gy)
+		}
+	} else if img.Dither != NoDither {
+		if g, ok := img.g.(gradient64); ok {
+			return img.Dither.quantize(g.At64(gx, gy), img.zp.X+x, img.zp.Y+y)
+		}
+	} else if img.lut != nil {
+		t, ok := img.g.(gradientRamp).Offset(gx, gy)
+		if !ok {
+			return canvas.Transparent
+		}
+		t = math.Max(0.0, math.Min(1.0, t))
+		return img.lut[int(t*float64(len(img.lut)-1)+0.5)]
+	}
+	return img.g.At(gx, gy)
+}
+
+// ImagePaintImage is an image that samples an image paint at the center of each pixel of the destination.
+type ImagePaintImage struct {
+	p        *canvas.ImagePaint
+	inv      canvas.Matrix // from destination millimeters to image coordinates
+	zp, size image.Point
+	dpmm     float64
+}
+
+// NewImagePaintImage returns an image that samples the image paint as used for a path transformed by m.
+func NewImagePaintImage(p *canvas.ImagePaint, m canvas.Matrix, zp, size image.Point, res canvas.Resolution) *ImagePaintImage {
+	return &ImagePaintImage{
+		p:    p,
+		inv:  m.Mul(p.Matrix).Inv(),
+		zp:   zp,   // zero-point in dst
+		size: size, // dst size
+		dpmm: res.DPMM(),
+	}
+}
+
+func (img *ImagePaintImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (img *ImagePaintImage) Bounds() image.Rectangle {
+	return image.Rectangle{image.Point{-1e9, -1e9}, image.Point{1e9, 1e9}}
+}
+
+func (img *ImagePaintImage) At(x, y int) color.Color {
+	px, py := (float64(img.zp.X+x)+0.5)/img.dpmm, (float64(img.size.Y-img.zp.Y-y)-0.5)/img.dpmm
+	pos := img.inv.Dot(canvas.Point{px, py})
+	return img.p.At(pos.X, pos.Y)
 }
 
 //func NewPatternImage(p canvas.Pattern, zp, size image.Point, res canvas.Resolution, colorSpace canvas.ColorSpace) *image.RGBA {
@@ -36,6 +36,10 @@ func Write(filename string, c *canvas.Canvas, opts ...interface{}) error {
 		return c.WriteFile(filename, TIFF(opts...))
 	case ".bmp":
 		return c.WriteFile(filename, BMP(opts...))
+	case ".ppm":
+		return c.WriteFile(filename, PPM(opts...))
+	case ".pam":
+		return c.WriteFile(filename, PAM(opts...))
 	//case ".webp":
 	//	return c.WriteFile(filename, WEBP(opts...))
 	case ".svgz":
@@ -166,6 +170,44 @@ func BMP(opts ...interface{}) canvas.Writer {
 	}
 }
 
+func PPM(opts ...interface{}) canvas.Writer {
+	resolution := canvas.DPMM(1.0)
+	colorSpace := canvas.DefaultColorSpace
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case canvas.Resolution:
+			resolution = o
+		case canvas.ColorSpace:
+			colorSpace = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		img := rasterizer.Draw(c, resolution, colorSpace)
+		return rasterizer.EncodePPM(w, img)
+	}
+}
+
+func PAM(opts ...interface{}) canvas.Writer {
+	resolution := canvas.DPMM(1.0)
+	colorSpace := canvas.DefaultColorSpace
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case canvas.Resolution:
+			resolution = o
+		case canvas.ColorSpace:
+			colorSpace = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		img := rasterizer.Draw(c, resolution, colorSpace)
+		return rasterizer.EncodePAM(w, img)
+	}
+}
+
 //func WEBP(opts ...interface{}) canvas.Writer {
 //	options := &webp.Options{}
 //	resolution := canvas.DPMM(1.0)
@@ -23,6 +23,7 @@ type Options struct {
 	Compression int
 	EmbedFonts  bool
 	SubsetFonts bool
+	Decimals    int // number of decimal places of path coordinates, zero uses canvas.Precision significant digits
 	canvas.ImageEncoding
 }
 
@@ -41,6 +42,7 @@ type SVG struct {
 	maskID        int
 	patterns      map[canvas.Gradient]string
 	classes       []string
+	groups        int // number of open groups
 	opts          *Options
 }
 
@@ -72,6 +74,9 @@ func New(w io.Writer, width, height float64, opts *Options) *SVG {
 
 // Close finished and closes the SVG.
 func (r *SVG) Close() error {
+	for 0 < r.groups {
+		r.EndGroup()
+	}
 	if r.opts.EmbedFonts {
 		r.writeFonts()
 	}
@@ -86,6 +91,10 @@ func (r *SVG) writeFonts() {
 	if 0 < len(r.fonts) {
 		fmt.Fprintf(r.w, "<style>")
 		for font := range r.fonts {
+			if !font.HasOutlines() {
+				// fonts from metrics are resolved by the viewer using the font family name
+				continue
+			}
 			b := font.SFNT.Data
 			if r.opts.SubsetFonts {
 				glyphIDs := r.fontSubset[font].List()
@@ -152,6 +161,59 @@ func (r *SVG) Size() (float64, float64) {
 	return r.width, r.height
 }
 
+// BeginGroup starts a group of drawing operations. An isolated group creates a new stacking context using the isolation property, so that blend modes within the group do not mix with the backdrop.
+func (r *SVG) BeginGroup(isolate bool) {
+	if isolate {
+		fmt.Fprintf(r.w, `<g style="isolation:isolate">`)
+	} else {
+		fmt.Fprintf(r.w, `<g>`)
+	}
+	r.groups++
+}
+
+// BeginAlphaGroup starts an isolated group of drawing operations that is composited at the given opacity, see canvas.AlphaGroupRenderer. The opacity property creates a new stacking context like the isolation property.
+func (r *SVG) BeginAlphaGroup(alpha float64) {
+	fmt.Fprintf(r.w, `<g opacity="%v">`, dec(alpha))
+	r.groups++
+}
+
+// EndGroup ends the last group of drawing operations.
+func (r *SVG) EndGroup() {
+	if r.groups == 0 {
+		return
+	}
+	fmt.Fprintf(r.w, `</g>`)
+	r.groups--
+}
+
+// blendModes are the CSS names of the blend modes used by the mix-blend-mode property.
+var blendModes = map[canvas.BlendMode]string{
+	canvas.BlendNormal:   "normal",
+	canvas.BlendMultiply: "multiply",
+	canvas.BlendScreen:   "screen",
+	canvas.BlendDarken:   "darken",
+	canvas.BlendLighten:  "lighten",
+}
+
+// blendModeStyle returns the style declaration of the blend mode, or an empty string for the normal blend mode.
+func blendModeStyle(mode canvas.BlendMode) string {
+	if mode == canvas.BlendNormal {
+		return ""
+	}
+	name, ok := blendModes[mode]
+	if !ok {
+		panic("SVG: blend mode not supported")
+	}
+	return "mix-blend-mode:" + name
+}
+
+func (r *SVG) pathData(path *canvas.Path) string {
+	if 0 < r.opts.Decimals {
+		return path.ToSVGDecimals(r.opts.Decimals)
+	}
+	return path.ToSVG()
+}
+
 // RenderPath renders a path to the canvas using a style and a transformation matrix.
 func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
 	if style.HasFill() && style.Fill.IsGradient() {
@@ -163,7 +225,7 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 
 	stroke := path
 	path = path.Transform(canvas.Identity.ReflectYAbout(r.height / 2.0).Mul(m))
-	fmt.Fprintf(r.w, `<path d="%s`, path.ToSVG())
+	fmt.Fprintf(r.w, `<path d="%s`, r.pathData(path))
 
 	strokeUnsupported := false
 	if arcs, ok := style.StrokeJoiner.(canvas.ArcsJoiner); ok && math.IsNaN(arcs.Limit) {
@@ -202,6 +264,9 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 		} else {
 			fmt.Fprintf(r.w, `" fill="none`)
 		}
+		if blend := blendModeStyle(style.BlendMode); blend != "" {
+			fmt.Fprintf(r.w, `" style="%s`, blend)
+		}
 	} else {
 		b := &strings.Builder{}
 		if style.HasFill() {
@@ -256,6 +321,9 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 				}
 			}
 		}
+		if blend := blendModeStyle(style.BlendMode); blend != "" {
+			fmt.Fprintf(b, ";%s", blend)
+		}
 		if 0 < b.Len() {
 			fmt.Fprintf(r.w, `" style="%s`, b.String()[1:])
 		}
@@ -270,7 +338,7 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 		}
 		stroke = stroke.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, canvas.Tolerance)
 		stroke = stroke.Transform(canvas.Identity.ReflectYAbout(r.height / 2.0).Mul(m))
-		fmt.Fprintf(r.w, `<path d="%s`, stroke.ToSVG())
+		fmt.Fprintf(r.w, `<path d="%s`, r.pathData(stroke))
 		if !style.Stroke.IsColor() || style.Stroke.Color != canvas.Black {
 			fmt.Fprintf(r.w, `" fill="`)
 			r.writePaint(r.w, style.Stroke)
@@ -278,6 +346,9 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 		if style.FillRule == canvas.EvenOdd {
 			fmt.Fprintf(r.w, `" fill-rule="evenodd`)
 		}
+		if blend := blendModeStyle(style.BlendMode); blend != "" {
+			fmt.Fprintf(r.w, `" style="%s`, blend)
+		}
 		r.writeClasses(r.w)
 		fmt.Fprintf(r.w, `"/>`)
 	}
@@ -359,6 +430,11 @@ func (r *SVG) writeFontStyle(face, faceMain *canvas.FontFace, rtl bool) {
 	}
 }
 
+func (r *SVG) writeLanguage(lang string) {
+	fmt.Fprintf(r.w, `" xml:lang="`)
+	xml.EscapeText(r.w, []byte(lang))
+}
+
 // RenderText renders a text object to the canvas using a transformation matrix.
 func (r *SVG) RenderText(text *canvas.Text, m canvas.Matrix) {
 	if text.Empty() {
@@ -391,6 +467,10 @@ func (r *SVG) RenderText(text *canvas.Text, m canvas.Matrix) {
 	} else {
 		fmt.Fprintf(r.w, `<text transform="%s`, m.ToSVG(r.height))
 	}
+	if faceMain.Language != "" {
+		// the language selects localized glyph forms in the viewer
+		r.writeLanguage(faceMain.Language)
+	}
 	fmt.Fprintf(r.w, `" style="font:`)
 	if faceMain.Style&canvas.FontItalic != 0 {
 		fmt.Fprintf(r.w, ` italic`)
@@ -441,7 +521,18 @@ func (r *SVG) RenderText(text *canvas.Text, m canvas.Matrix) {
 				x += span.Width
 			}
 			fmt.Fprintf(r.w, `<tspan x="%v" y="%v`, num(x), num(y))
+			if text.WritingMode == canvas.HorizontalTB && span.Rotation != canvasText.NoRotation {
+				fmt.Fprintf(r.w, `" rotate="%v`, num(-float64(span.Rotation)))
+			}
 			r.writeFontStyle(span.Face, faceMain, span.Direction == canvasText.RightToLeft && rtls*2 <= n)
+			if span.Face.Language != faceMain.Language {
+				r.writeLanguage(span.Face.Language)
+			}
+			if span.Face.HasStroke() {
+				fmt.Fprintf(r.w, `" stroke="`)
+				r.writePaint(r.w, span.Face.Stroke)
+				fmt.Fprintf(r.w, `" stroke-width="%v" stroke-linejoin="round`, num(span.Face.StrokeWidth))
+			}
 			r.writeClasses(r.w)
 			fmt.Fprintf(r.w, `">`)
 			xml.EscapeText(r.w, []byte(span.Text))
@@ -564,22 +655,72 @@ func (r *SVG) getPattern(gradient canvas.Gradient) string {
 
 	fmt.Fprintf(r.w, `<defs>`)
 	if linearGradient, ok := gradient.(*canvas.LinearGradient); ok {
-		fmt.Fprintf(r.w, `<linearGradient id="%v" gradientUnits="userSpaceOnUse" x1="%v" y1="%v" x2="%v" y2="%v">`, ref, dec(linearGradient.Start.X), dec(r.height-linearGradient.Start.Y), dec(linearGradient.End.X), dec(r.height-linearGradient.End.Y))
+		fmt.Fprintf(r.w, `<linearGradient id="%v" gradientUnits="userSpaceOnUse" x1="%v" y1="%v" x2="%v" y2="%v"%v>`, ref, dec(linearGradient.Start.X), dec(r.height-linearGradient.Start.Y), dec(linearGradient.End.X), dec(r.height-linearGradient.End.Y), spreadMethod(linearGradient.Spread))
 		for _, stop := range linearGradient.Stops {
 			fmt.Fprintf(r.w, `<stop offset="%v" stop-color="%v"/>`, dec(stop.Offset), canvas.CSSColor(stop.Color))
 		}
 		fmt.Fprintf(r.w, `</linearGradient>`)
 	} else if radialGradient, ok := gradient.(*canvas.RadialGradient); ok {
-		fmt.Fprintf(r.w, `<radialGradient id="%v" gradientUnits="userSpaceOnUse" fx="%v" fy="%v" fr="%v" cx="%v" cy="%v" r="%v">`, ref, dec(radialGradient.C0.X), dec(r.height-radialGradient.C0.Y), dec(radialGradient.R0), dec(radialGradient.C1.X), dec(r.height-radialGradient.C1.Y), dec(radialGradient.R1))
+		fmt.Fprintf(r.w, `<radialGradient id="%v" gradientUnits="userSpaceOnUse" fx="%v" fy="%v" fr="%v" cx="%v" cy="%v" r="%v"%v>`, ref, dec(radialGradient.C0.X), dec(r.height-radialGradient.C0.Y), dec(radialGradient.R0), dec(radialGradient.C1.X), dec(r.height-radialGradient.C1.Y), dec(radialGradient.R1), spreadMethod(radialGradient.Spread))
 		for _, stop := range radialGradient.Stops {
 			fmt.Fprintf(r.w, `<stop offset="%v" stop-color="%v"/>`, dec(stop.Offset), canvas.CSSColor(stop.Color))
 		}
 		fmt.Fprintf(r.w, `</radialGradient>`)
+	} else if meshGradient, ok := gradient.(*canvas.MeshGradient); ok {
+		// SVG has no mesh gradients, use a pattern with the rasterized mesh instead
+		r.writeMeshPattern(ref, meshGradient)
 	}
 	fmt.Fprintf(r.w, `</defs>`)
 	return ref
 }
 
+// meshGradientResolution is the resolution at which mesh gradients are rasterized.
+var meshGradientResolution = canvas.DPMM(8.0)
+
+func (r *SVG) writeMeshPattern(ref string, g *canvas.MeshGradient) {
+	xmin, ymin, xmax, ymax := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, patch := range g.Patches {
+		for _, p := range patch.Points {
+			xmin, ymin = math.Min(xmin, p.X), math.Min(ymin, p.Y)
+			xmax, ymax = math.Max(xmax, p.X), math.Max(ymax, p.Y)
+		}
+	}
+	if xmax <= xmin || ymax <= ymin {
+		fmt.Fprintf(r.w, `<pattern id="%v" patternUnits="userSpaceOnUse" width="0" height="0"/>`, ref)
+		return
+	}
+
+	dpmm := meshGradientResolution.DPMM()
+	img := image.NewRGBA(image.Rect(0, 0, int(math.Ceil((xmax-xmin)*dpmm)), int(math.Ceil((ymax-ymin)*dpmm))))
+	size := img.Bounds().Size()
+	for j := 0; j < size.Y; j++ {
+		for i := 0; i < size.X; i++ {
+			img.SetRGBA(i, j, g.At(xmin+(float64(i)+0.5)/dpmm, ymax-(float64(j)+0.5)/dpmm))
+		}
+	}
+	w, h := float64(size.X)/dpmm, float64(size.Y)/dpmm
+
+	fmt.Fprintf(r.w, `<pattern id="%v" patternUnits="userSpaceOnUse" x="%v" y="%v" width="%v" height="%v"><image width="%v" height="%v" preserveAspectRatio="none" xlink:href="data:image/png;base64,`, ref, dec(xmin), dec(r.height-ymax), dec(w), dec(h), dec(w), dec(h))
+	encoder := base64.NewEncoder(base64.StdEncoding, r.w)
+	if err := png.Encode(encoder, img); err != nil {
+		panic(err)
+	}
+	if err := encoder.Close(); err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(r.w, `"/></pattern>`)
+}
+
+// spreadMethod returns the spreadMethod attribute of a gradient, which is omitted for the default pad.
+func spreadMethod(spread canvas.Spread) string {
+	if spread == canvas.SpreadRepeat {
+		return ` spreadMethod="repeat"`
+	} else if spread == canvas.SpreadReflect {
+		return ` spreadMethod="reflect"`
+	}
+	return ""
+}
+
 func (r *SVG) writePaint(w io.Writer, paint canvas.Paint) {
 	if paint.IsPattern() {
 		// TODO
@@ -1,7 +1,15 @@
 package svg
 
 import (
+	"bytes"
+	"image/color"
+	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/tdewolff/canvas"
+	canvasText "github.com/tdewolff/canvas/text"
+	"github.com/tdewolff/test"
 )
 
 func TestSVGText(t *testing.T) {
@@ -30,3 +38,106 @@ func TestSVGText(t *testing.T) {
 	//s := regexp.MustCompile(`base64,.+'`).ReplaceAllString(buf.String(), "base64,'") // remove embedded font
 	//test.String(t, s, `<style>`+"\n"+`@font-face{font-family:'dejavu-serif';src:url('data:font/truetype;base64,');}`+"\n"+`@font-face{font-family:'eb-garamond';src:url('data:font/opentype;base64,');}`+"\n"+`</style><text x="0" y="0" style="font: 12px dejavu-serif"><tspan x="0" y="7.421875" style="font:8px dejavu-serif">dejaVu8</tspan><tspan x="0" y="20.453125" letter-spacing="1" style="font-style:italic;fill:#f00">glyphspacing</tspan><tspan x="0" y="33.725625" style="font:700 6.996px dejavu-serif">dejaVu12sub</tspan><tspan x="0" y="38.5" style="font:700 10px eb-garamond">garamond10</tspan></text><path d="M0 22.703125H91.71875V21.803125H0z" fill="#f00"/>`)
 }
+
+func TestSVGDecimals(t *testing.T) {
+	buf := &bytes.Buffer{}
+	opts := DefaultOptions
+	opts.Decimals = 2
+	svg := New(buf, 100.0, 100.0, &opts)
+	p := canvas.MustParseSVGPath("M0.123456 1.98765L10.00001 20.3333333C30.1111111 40.2222222 50.4444444 60.5555555 70.6666666 80.7777777z")
+	svg.RenderPath(p, canvas.DefaultStyle, canvas.Identity.Translate(0.333333, 0.0))
+	svg.Close()
+
+	path := regexp.MustCompile(`<path d="([^"]*)"`).FindStringSubmatch(buf.String())
+	test.T(t, len(path), 2)
+	test.String(t, path[1], "M.46 98.01L10.33 79.67C30.44 59.78 50.78 39.44 71 19.22z")
+	for _, num := range regexp.MustCompile(`[0-9.]+`).FindAllString(path[1], -1) {
+		if i := strings.IndexByte(num, '.'); i != -1 {
+			test.That(t, len(num)-i-1 <= 2, num)
+		}
+	}
+}
+
+func TestSVGTextLanguage(t *testing.T) {
+	font, err := canvas.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, canvas.Black)
+	face.Language = "ru"
+
+	rt := canvas.NewRichText(face)
+	rt.Add(face, "обед ")
+	rt.AddWithLang(face, "обед", "sr", canvasText.ScriptInvalid)
+	rt.Add(face, " обед")
+	text := rt.ToText(0.0, 0.0, canvas.Left, canvas.Top, 0.0, 0.0)
+
+	buf := &bytes.Buffer{}
+	svg := New(buf, 100.0, 100.0, nil)
+	svg.RenderText(text, canvas.Identity)
+	s := buf.String()
+	test.That(t, strings.Contains(s, `<text x="0" y="100" xml:lang="ru"`), s)
+	test.That(t, strings.Contains(s, `xml:lang="sr">обед</tspan>`), s)
+	test.T(t, strings.Count(s, "xml:lang"), 2)
+}
+
+func TestSVGGradientSpread(t *testing.T) {
+	gradient := canvas.NewRadialGradient(canvas.Point{5.0, 5.0}, 0.0, canvas.Point{5.0, 5.0}, 2.0)
+	gradient.Add(0.0, canvas.Black)
+	gradient.Add(1.0, canvas.White)
+	gradient.Spread = canvas.SpreadRepeat
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+
+	buf := &bytes.Buffer{}
+	svg := New(buf, 10.0, 10.0, nil)
+	svg.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+	svg.Close()
+	test.That(t, strings.Contains(buf.String(), `r="2" spreadMethod="repeat">`), "gradient must repeat")
+}
+
+func TestSVGMeshGradient(t *testing.T) {
+	gradient := canvas.NewMeshGradient()
+	gradient.AddRect(2.0, 2.0, 6.0, 4.0, [4]color.RGBA{canvas.Red, canvas.Lime, canvas.Blue, canvas.White})
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+
+	buf := &bytes.Buffer{}
+	svg := New(buf, 10.0, 10.0, nil)
+	svg.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+	svg.Close()
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, `<defs><pattern id="p1" patternUnits="userSpaceOnUse" x="2" y="4" width="6" height="4"><image width="6" height="4" preserveAspectRatio="none" xlink:href="data:image/png;base64,`), s)
+	test.That(t, strings.Contains(s, `fill="url(#p1)"`), s)
+}
+
+func TestSVGBlendMode(t *testing.T) {
+	style := canvas.DefaultStyle
+	style.BlendMode = canvas.BlendScreen
+
+	buf := &bytes.Buffer{}
+	svg := New(buf, 10.0, 10.0, nil)
+	svg.BeginGroup(true)
+	svg.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+	style.Stroke = canvas.Paint{Color: canvas.Red}
+	svg.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+	svg.Close()
+
+	s := buf.String()
+	test.That(t, regexp.MustCompile(`^<svg [^>]*><g style="isolation:isolate"><path d="[^"]*" style="mix-blend-mode:screen"/>`).MatchString(s), s)
+	test.That(t, strings.Contains(s, `;mix-blend-mode:screen"/></g></svg>`), s)
+}
+
+func TestSVGGlobalAlpha(t *testing.T) {
+	c := canvas.New(10.0, 10.0)
+	c.RenderPath(canvas.Rectangle(10.0, 10.0), canvas.DefaultStyle, canvas.Identity)
+	c.RenderPath(canvas.Rectangle(10.0, 10.0), canvas.DefaultStyle, canvas.Identity)
+	c.SetGlobalAlpha(0.5)
+
+	buf := &bytes.Buffer{}
+	svg := New(buf, 10.0, 10.0, nil)
+	c.RenderTo(svg)
+	svg.Close()
+
+	s := buf.String()
+	test.That(t, regexp.MustCompile(`^<svg [^>]*><g opacity=".5"><path [^>]*/><path [^>]*/></g></svg>$`).MatchString(s), s)
+}
@@ -1,6 +1,8 @@
 package canvas
 
 import (
+	"bytes"
+	"fmt"
 	"image"
 	"image/color"
 	"math"
@@ -8,6 +10,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/tdewolff/canvas/font"
@@ -49,6 +52,46 @@ func (ta TextAlign) String() string {
 	return "Invalid(" + strconv.Itoa(int(ta)) + ")"
 }
 
+const alignAuto TextAlign = -1 // alignment is inherited
+
+// TabAlign specifies how the text following a tab aligns to its tab stop.
+type TabAlign int
+
+// see TabAlign
+const (
+	LeftTab    TabAlign = iota // the text starts at the tab stop
+	RightTab                   // the text ends at the tab stop
+	CenterTab                  // the text is centered on the tab stop
+	DecimalTab                 // the decimal separator of the text is at the tab stop
+)
+
+func (ta TabAlign) String() string {
+	switch ta {
+	case LeftTab:
+		return "LeftTab"
+	case RightTab:
+		return "RightTab"
+	case CenterTab:
+		return "CenterTab"
+	case DecimalTab:
+		return "DecimalTab"
+	}
+	return "Invalid(" + strconv.Itoa(int(ta)) + ")"
+}
+
+// TabStop is a tab stop at a position in millimeters from the start of the line, which is the left of the line for left-to-right paragraphs and the right for right-to-left paragraphs. The text following a tab character, up to the next tab or the end of the paragraph, aligns to the first tab stop after the tab's position. For DecimalTab, the text aligns on the first occurrence of the decimal separator, which defaults to '.', or aligns to the right if there is none.
+type TabStop struct {
+	Pos     float64
+	Align   TabAlign
+	Decimal rune
+}
+
+// ParagraphStyle is the horizontal alignment and first-line indentation in millimeters of a paragraph, see RichText.SetParagraphStyle. The alignment is one of Left, Right, Center, or Justify, or Top, Bottom, Center, or Justify in vertical writing modes. An indentation of NaN keeps the default indentation, which is the indentation passed to ToText for the first paragraph and zero for the others.
+type ParagraphStyle struct {
+	Align  TextAlign
+	Indent float64
+}
+
 // VerticalAlign specifies how the object should align vertically when embedded in text.
 type VerticalAlign int
 
@@ -119,29 +162,43 @@ func (orient TextOrientation) String() string {
 type Text struct {
 	lines []line
 	fonts map[*Font]bool
+	faces []faceStart // faces with which the text was added, see StyledRuns
 	WritingMode
 	TextOrientation
 	width, height float64
 	text          string
 	Overflows     bool // true if lines stick out of the box
+	Clip          bool // clip the glyphs and decorations to the box when rendered as paths, like CSS's overflow:hidden
+
+	boundaries []int // sorted cluster boundaries, computed lazily by clusterBoundaries
 }
 
 type line struct {
 	y     float64
 	spans []TextSpan
+	face  *FontFace // determines the heights of an empty line
 }
 
 // Heights returns the maximum top, ascent, descent, and bottom heights of the line, where top and bottom are equal to ascent and descent respectively with added line spacing.
 func (l line) Heights(mode WritingMode) (float64, float64, float64, float64) {
+	if len(l.spans) == 0 && l.face != nil {
+		return l.face.heights(mode)
+	}
+
 	top, ascent, descent, bottom := 0.0, 0.0, 0.0, 0.0
 	if mode == HorizontalTB {
 		for _, span := range l.spans {
 			if span.IsText() {
 				spanTop, spanAscent, spanDescent, spanBottom := span.Face.heights(mode)
-				top = math.Max(top, spanTop)
-				ascent = math.Max(ascent, spanAscent)
-				descent = math.Max(descent, spanDescent)
-				bottom = math.Max(bottom, spanBottom)
+				if span.Face.TightLineHeight && span.Rotation == canvasText.NoRotation {
+					if inkAscent, inkDescent, ok := span.inkHeights(); ok {
+						spanTop, spanAscent, spanDescent, spanBottom = inkAscent, inkAscent, inkDescent, inkDescent
+					}
+				}
+				top = math.Max(top, spanTop+span.Y)
+				ascent = math.Max(ascent, spanAscent+span.Y)
+				descent = math.Max(descent, spanDescent-span.Y)
+				bottom = math.Max(bottom, spanBottom-span.Y)
 			} else {
 				for _, obj := range span.Objects {
 					spanAscent, spanDescent := obj.Heights(span.Face)
@@ -158,7 +215,9 @@ func (l line) Heights(mode WritingMode) (float64, float64, float64, float64) {
 		for _, span := range l.spans {
 			if span.IsText() {
 				for _, glyph := range span.Glyphs {
-					if glyph.Vertical {
+					if glyph.Empty {
+						continue
+					} else if glyph.Vertical {
 						width = math.Max(width, 1.2*span.Face.mmPerEm*float64(glyph.SFNT.GlyphAdvance(glyph.ID))) // TODO: what left/right padding should upright characters in a vertical layout have?
 					} else {
 						spanTop, spanAscent, spanDescent, spanBottom := span.Face.heights(mode)
@@ -182,9 +241,177 @@ func (l line) Heights(mode WritingMode) (float64, float64, float64, float64) {
 	return top, ascent, descent, bottom
 }
 
+// alignBaselines shifts the text spans vertically so that they align on the dominant baseline, which is the default baseline of the reference span's script as given by the font's BASE table. The reference span is the first text span with a script other than Common or Inherited, or otherwise the first text span. The dominant baseline of each span, as given by the BASE table of its own font and script, is aligned with that of the reference span. Fonts without a BASE table are not shifted. The shift is added to the baseline shift of the font face.
+func (l *line) alignBaselines(mode WritingMode) {
+	if mode != HorizontalTB {
+		return // TODO: vertical baselines
+	}
+
+	ref := -1
+	for i, span := range l.spans {
+		if !span.IsText() || len(span.Glyphs) == 0 {
+			continue
+		} else if ref == -1 {
+			ref = i
+		}
+		if script := span.script(); script != canvasText.ScriptCommon && script != canvasText.ScriptInherited {
+			ref = i
+			break
+		}
+	}
+	if ref == -1 {
+		return
+	}
+	refBase, ok := l.spans[ref].Face.baseScript(l.spans[ref].script())
+	if !ok {
+		return
+	}
+	tag := refBase.DefaultBaseline
+	refY := l.spans[ref].Face.mmPerEm * float64(refBase.Coords[tag])
+	for i, span := range l.spans {
+		if i == ref || !span.IsText() || len(span.Glyphs) == 0 {
+			continue
+		}
+		if baseScript, ok := span.Face.baseScript(span.script()); ok {
+			if coord, ok := baseScript.Coords[tag]; ok {
+				l.spans[i].Y += refY - span.Face.mmPerEm*float64(coord)
+			}
+		}
+	}
+}
+
+// align moves the spans horizontally so that the line is aligned within the given width.
+func (l *line) align(halign TextAlign, width float64) {
+	if len(l.spans) == 0 {
+		return
+	}
+	left, right := math.Inf(1), math.Inf(-1)
+	for _, span := range l.spans {
+		left = math.Min(left, span.X)
+		right = math.Max(right, span.X+span.Width)
+	}
+
+	dx := -left
+	if halign == Right {
+		dx = width - right
+	} else if halign == Center || halign == Middle {
+		dx = (width - right - left) / 2.0
+	}
+	for i := range l.spans {
+		l.spans[i].X += dx
+	}
+}
+
+// mirror reorders the spans of a line in a right-to-left paragraph from right to left. The spans are positioned for a left-to-right paragraph where only runs of right-to-left spans are reversed, and are reordered by their embedding levels following rule L2 of UAX#9.
+func (l *line) mirror() {
+	// reverse positions of spans within their extent
+	reverse := func(spans []TextSpan) {
+		left, right := math.Inf(1), math.Inf(-1)
+		for _, span := range spans {
+			left = math.Min(left, span.X)
+			right = math.Max(right, span.X+span.Width)
+		}
+		for i := range spans {
+			spans[i].X = left + right - spans[i].X - spans[i].Width
+		}
+	}
+	// reverse all runs of spans for which in returns true
+	reverseRuns := func(in func(TextSpan) bool) {
+		for a := 0; a < len(l.spans); a++ {
+			if in(l.spans[a]) {
+				b := a + 1
+				for b < len(l.spans) && in(l.spans[b]) {
+					b++
+				}
+				reverse(l.spans[a:b])
+				a = b
+			}
+		}
+	}
+
+	// undo the reversal of right-to-left runs while reversing the line
+	reverse(l.spans)
+	reverseRuns(func(span TextSpan) bool {
+		return span.Direction == canvasText.RightToLeft
+	})
+
+	maxLevel := 0
+	for _, span := range l.spans {
+		if maxLevel < span.level {
+			maxLevel = span.level
+		}
+	}
+	for level := 2; level <= maxLevel; level++ {
+		reverseRuns(func(span TextSpan) bool {
+			return level <= span.level
+		})
+	}
+}
+
+// trimSpaces removes the whitespace glyphs at the visual start and end of the line and realigns the spans. The text of the spans is kept.
+func (l *line) trimSpaces(halign TextAlign) {
+	order := make([]int, len(l.spans)) // spans in visual order
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return l.spans[order[i]].X < l.spans[order[j]].X
+	})
+
+	left := 0.0
+	for _, i := range order {
+		span := &l.spans[i]
+		if !span.IsText() {
+			break
+		}
+		n := 0
+		for n < len(span.Glyphs) && canvasText.IsSpace(span.Glyphs[n].Text) {
+			n++
+		}
+		w := span.Face.textWidth(span.Glyphs[:n])
+		span.Glyphs = span.Glyphs[n:]
+		span.X += w
+		span.Width -= w
+		left += w
+		if 0 < len(span.Glyphs) {
+			break
+		}
+	}
+
+	right := 0.0
+	for k := len(order) - 1; 0 <= k; k-- {
+		span := &l.spans[order[k]]
+		if !span.IsText() {
+			break
+		}
+		n := len(span.Glyphs)
+		for 0 < n && canvasText.IsSpace(span.Glyphs[n-1].Text) {
+			n--
+		}
+		w := span.Face.textWidth(span.Glyphs[n:])
+		span.Glyphs = span.Glyphs[:n]
+		span.Width -= w
+		right += w
+		if 0 < len(span.Glyphs) {
+			break
+		}
+	}
+
+	dx := -left
+	if halign == Right {
+		dx = right
+	} else if halign == Center || halign == Middle {
+		dx = (right - left) / 2.0
+	}
+	for i := range l.spans {
+		l.spans[i].X += dx
+	}
+}
+
 // TextSpan is a span of text.
 type TextSpan struct {
 	X         float64
+	Y         float64 // baseline shift with respect to the line's baseline, positive is upwards
 	Width     float64
 	Face      *FontFace
 	Text      string
@@ -193,6 +420,8 @@ type TextSpan struct {
 	Rotation  canvasText.Rotation
 
 	Objects []TextSpanObject
+
+	level int // embedding level
 }
 
 // IsText returns true if the text span is text and not objects (such as images or paths).
@@ -200,11 +429,75 @@ func (span *TextSpan) IsText() bool {
 	return len(span.Objects) == 0
 }
 
+// GlyphPositions returns the offsets of the glyph boundaries with respect to the span's X position in the logical order of the glyphs. The first and last position are the leading and trailing edge of the span respectively. For right-to-left text the positions are thus decreasing from the span's width to zero. This allows placing a caret between any two glyphs.
+func (span *TextSpan) GlyphPositions() []float64 {
+	if !span.IsText() {
+		positions := make([]float64, 0, len(span.Objects)+1)
+		for _, obj := range span.Objects {
+			positions = append(positions, obj.X)
+		}
+		return append(positions, span.Width)
+	}
+
+	n := len(span.Glyphs)
+	positions := make([]float64, n+1)
+	rtl := span.Direction == canvasText.RightToLeft || span.Direction == canvasText.BottomToTop
+	x := 0.0
+	for i, glyph := range span.Glyphs {
+		// glyphs are in visual order
+		if glyph.Vertical {
+			x -= span.Face.mmPerEm * float64(glyph.YAdvance)
+		} else {
+			x += span.Face.mmPerEm * float64(glyph.XAdvance)
+		}
+		if rtl {
+			positions[n-1-i] = x
+		} else {
+			positions[i+1] = x
+		}
+	}
+	return positions
+}
+
+// script returns the script of the span, which is the first script of its glyphs other than Common or Inherited, or otherwise the script of the first glyph.
+func (span *TextSpan) script() canvasText.Script {
+	for _, glyph := range span.Glyphs {
+		if glyph.Script != canvasText.ScriptCommon && glyph.Script != canvasText.ScriptInherited && glyph.Script != canvasText.ScriptInvalid {
+			return glyph.Script
+		}
+	}
+	if len(span.Glyphs) == 0 {
+		return canvasText.ScriptInvalid
+	}
+	return span.Glyphs[0].Script
+}
+
+// inkHeights returns the ascent and descent of the glyph outlines of the span. It returns false if the span has no visible glyphs.
+func (span *TextSpan) inkHeights() (float64, float64, bool) {
+	ascent, descent := math.Inf(-1), math.Inf(-1)
+	for _, glyph := range span.Glyphs {
+		if glyph.Empty {
+			continue
+		}
+		xMin, yMin, xMax, yMax, err := span.Face.Font.GlyphBounds(glyph.ID)
+		if err != nil || xMin == xMax && yMin == yMax {
+			continue
+		}
+		ascent = math.Max(ascent, span.Face.mmPerEm*float64(int32(yMax)+span.Face.YOffset+glyph.YOffset))
+		descent = math.Max(descent, -span.Face.mmPerEm*float64(int32(yMin)+span.Face.YOffset+glyph.YOffset))
+	}
+	if math.IsInf(ascent, -1) {
+		return 0.0, 0.0, false
+	}
+	return ascent, descent, true
+}
+
 // TextSpanObject is an object that can be used within a text span. It is a wrapper around Canvas and can thus draw anything to be mixed with text, such as images (emoticons) or paths (symbols).
 type TextSpanObject struct {
 	*Canvas
 	X, Y          float64
 	Width, Height float64
+	Depth         float64 // height of the object below the baseline for Baseline alignment
 	VAlign        VerticalAlign
 }
 
@@ -221,7 +514,7 @@ func (obj TextSpanObject) Heights(face *FontFace) (float64, float64) {
 		descent := face.Metrics().Descent
 		return -descent + obj.Height, descent
 	}
-	return obj.Height, 0.0 // Baseline
+	return obj.Height - obj.Depth, obj.Depth // Baseline
 }
 
 // View returns the object's view to be placed within the text line.:
@@ -261,11 +554,17 @@ func NewTextLine(face *FontFace, s string, halign TextAlign) *Text {
 				ppem := face.PPEM(DefaultResolution)
 				lineWidth := 0.0
 				line := line{y: y, spans: []TextSpan{}}
+				clusterOffset := uint32(i)
 				for _, item := range itemizeString(s[i:j]) {
-					glyphs, direction := face.Font.shaper.Shape(item.Text, ppem, face.Direction, face.Script, face.Language, face.Font.features, face.Font.variations)
+					glyphs, direction := face.shape(item.Text, ppem, face.Direction, face.Script)
+					for k := range glyphs {
+						glyphs[k].Cluster += clusterOffset // clusters index into the whole text
+					}
+					clusterOffset += uint32(len(item.Text))
 					width := face.textWidth(glyphs)
 					line.spans = append(line.spans, TextSpan{
 						X:         lineWidth,
+						Y:         face.BaselineShift,
 						Width:     width,
 						Face:      face,
 						Text:      item.Text,
@@ -284,6 +583,9 @@ func NewTextLine(face *FontFace, s string, halign TextAlign) *Text {
 					}
 				}
 				t.lines = append(t.lines, line)
+			} else if 0 < j {
+				// empty line, including the one after a trailing newline as for NewTextBox
+				t.lines = append(t.lines, line{y: y, face: face})
 			}
 			y += ascent + descent + spacing
 			i = j + utf8.RuneLen(r)
@@ -300,6 +602,122 @@ func NewTextBox(face *FontFace, s string, width, height float64, halign, valign
 	return rt.ToText(width, height, halign, valign, indent, lineStretch)
 }
 
+// FitTextSize returns the largest font size in points at which the string fits in the box, and the text laid out at that size. If the height is zero, the text is laid out as by NewTextLine and its widest line must fit the width. Otherwise the text is wrapped as by NewTextBox and all of it must fit the width and height, where a zero width puts each paragraph on a single line. The size is found by a binary search over the font size of a copy of the face, which thus keeps its other properties. If the text does not fit at any size it returns zero and nil, and if the box has no size or the string is empty the face's size is used.
+func FitTextSize(face *FontFace, s string, width, height float64) (float64, *Text) {
+	layout := func(size float64) (*Text, bool) {
+		sized := *face
+		sized.Size = size
+		sized.mmPerEm = size / float64(face.Font.Head.UnitsPerEm)
+		if height == 0.0 {
+			text := NewTextLine(&sized, s, Left)
+			for _, line := range text.lines {
+				lineWidth := 0.0
+				for _, span := range line.spans {
+					lineWidth += span.Width
+				}
+				if width < lineWidth {
+					return text, false
+				}
+			}
+			return text, true
+		}
+		text := NewTextBox(&sized, s, width, height, Left, Top, 0.0, 0.0)
+		return text, !text.Overflows && text.String() == s
+	}
+	if width == 0.0 && height == 0.0 || s == "" {
+		text, _ := layout(face.Size)
+		return face.Size / mmPerPt, text
+	}
+
+	// find an upper bound that does not fit, then bisect
+	lo, hi := 0.0, face.Size
+	for i := 0; i < 16; i++ {
+		if _, ok := layout(hi); !ok {
+			break
+		}
+		lo, hi = hi, 2.0*hi
+	}
+	if lo == 0.0 {
+		lo = hi / 1024.0
+		if _, ok := layout(lo); !ok {
+			return 0.0, nil
+		}
+	}
+	for 1e-3*lo < hi-lo {
+		mid := (lo + hi) / 2.0
+		if _, ok := layout(mid); ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	text, _ := layout(lo)
+	return lo / mmPerPt, text
+}
+
+// NewTextOnCircle lays out a single line of text along a circle centered at the drawn coordinate, such as for badges and stamps. The text starts at startAngle in degrees, counter clockwise from the positive x-axis, and runs clockwise or counter clockwise along the circle with the glyph advances measured along the arc. Each glyph is rotated to be tangent to the circle with its baseline on the circle, for clockwise text the glyphs stand on the outside of the circle and for counter clockwise text on the inside. When upright is set the glyphs are not rotated and their centers are placed on the circle instead. Each grapheme cluster is a separate text span, which renderers place and rotate individually.
+func NewTextOnCircle(face *FontFace, s string, radius, startAngle float64, clockwise, upright bool) *Text {
+	t := &Text{
+		fonts: map[*Font]bool{face.Font: true},
+		text:  s,
+	}
+
+	glyphs, direction := face.shape(s, face.PPEM(DefaultResolution), face.Direction, face.Script)
+	clusters := make([]int, 0, len(glyphs))
+	for _, glyph := range glyphs {
+		clusters = append(clusters, int(glyph.Cluster))
+	}
+	sort.Ints(clusters)
+
+	sign := 1.0
+	if clockwise {
+		sign = -1.0
+	}
+	xHeight := face.Metrics().XHeight
+
+	line := line{spans: []TextSpan{}}
+	x := 0.0
+	for i := 0; i < len(glyphs); {
+		// group glyphs of the same cluster
+		j := i + 1
+		for j < len(glyphs) && glyphs[j].Cluster == glyphs[i].Cluster {
+			j++
+		}
+		start, end := int(glyphs[i].Cluster), len(s)
+		if k := sort.SearchInts(clusters, start+1); k < len(clusters) {
+			end = clusters[k]
+		}
+
+		width := face.textWidth(glyphs[i:j])
+		theta := startAngle*math.Pi/180.0 + sign*(x+width/2.0)/radius
+		center := Point{radius * math.Cos(theta), radius * math.Sin(theta)}
+
+		rotation := 0.0
+		origin := center.Sub(Point{width / 2.0, xHeight / 2.0})
+		if !upright {
+			rotation = theta*180.0/math.Pi + sign*90.0
+			origin = center.Sub(Identity.Rotate(rotation).Dot(Point{width / 2.0, 0.0}))
+		}
+
+		line.spans = append(line.spans, TextSpan{
+			X:         origin.X,
+			Y:         origin.Y,
+			Width:     width,
+			Face:      face,
+			Text:      s[start:end],
+			Glyphs:    glyphs[i:j],
+			Direction: direction,
+			Rotation:  canvasText.Rotation(rotation),
+		})
+		x += width
+		i = j
+	}
+	if 0 < len(line.spans) {
+		t.lines = append(t.lines, line)
+	}
+	return t
+}
+
 type indexer []int
 
 func (indexer indexer) index(loc int) int {
@@ -318,6 +736,17 @@ type RichText struct {
 	faces  []*FontFace
 	mode   WritingMode
 	orient TextOrientation
+	trim   bool
+	smart  bool
+
+	alignLast           TextAlign
+	direction, fallback canvasText.Direction
+	leading             func(int) float64
+	tabStops            []TabStop
+	tabSize             float64
+	tolerance           float64
+	looseness           int
+	paragraphStyles     map[int]ParagraphStyle // by paragraph index
 
 	defaultFace *FontFace
 	objects     []TextSpanObject
@@ -334,6 +763,10 @@ func NewRichText(face *FontFace) *RichText {
 		faces:       []*FontFace{face},
 		mode:        HorizontalTB,
 		orient:      Natural,
+		alignLast:   alignAuto,
+		fallback:    canvasText.LeftToRight,
+		tabSize:     8.0,
+		tolerance:   canvasText.Tolerance,
 		defaultFace: face,
 	}
 }
@@ -343,6 +776,7 @@ func (rt *RichText) Reset() {
 	rt.Builder.Reset()
 	rt.locs = rt.locs[:1]
 	rt.faces = rt.faces[:1]
+	rt.paragraphStyles = nil
 }
 
 // SetWritingMode sets the writing mode.
@@ -355,6 +789,83 @@ func (rt *RichText) SetTextOrientation(orient TextOrientation) {
 	rt.orient = orient
 }
 
+// SetTrimSpaces sets whether leading and trailing whitespace is trimmed for each line, so that centered text is truly centered and right-aligned text is flush. The logical text of the spans is not altered.
+func (rt *RichText) SetTrimSpaces(trim bool) {
+	rt.trim = trim
+}
+
+// SetSmartTypography sets whether text added by Add and AddWithLang has its straight quotation marks replaced by curly quotation marks, double and triple hyphens by dashes, and three periods by an ellipsis, see text.SmartTypography. The quotation marks follow the language of the font face. By default it is disabled.
+func (rt *RichText) SetSmartTypography(smart bool) {
+	rt.smart = smart
+}
+
+// SetTextAlignLast sets the horizontal alignment of the last line of each paragraph, similar to CSS's text-align-last, such as centering the last line of a justified paragraph. Setting it stops justifying the last lines of paragraphs. By default the last line is aligned as the other lines, except for the last line of justified text which is left-aligned. Justify is not supported and aligns to the left.
+func (rt *RichText) SetTextAlignLast(halign TextAlign) {
+	rt.alignLast = halign
+}
+
+// SetDirection sets the base direction of the paragraphs to LeftToRight or RightToLeft. If it is DirectionInvalid, which is the default, the direction of each paragraph is detected from its first strong directional character and the fallback direction is used for paragraphs without any. The spans of lines in right-to-left paragraphs are ordered from right to left, and the last line of justified right-to-left paragraphs is aligned to the right.
+func (rt *RichText) SetDirection(direction, fallback canvasText.Direction) {
+	rt.direction = direction
+	rt.fallback = fallback
+}
+
+// SetExtraLeading sets a function that returns the extra space in millimeters to add before the line with the given index, such as to separate stanzas of a poem. The extra space is taken into account when fitting the lines within the height of the text box and for vertical justification.
+func (rt *RichText) SetExtraLeading(leading func(line int) float64) {
+	rt.leading = leading
+}
+
+// SetLineBreakOptions sets the tolerance and looseness of the line breaking algorithm. The tolerance is the maximum adjustment ratio of the spaces of a line, which is canvasText.Tolerance (2.0) by default. Values between 1.0 and 10.0 are sensible: a smaller tolerance gives tighter spacing but more overfull lines, while a larger tolerance allows looser lines. A negative tolerance is taken as zero. The looseness is the desired number of lines more (positive) or fewer (negative) than optimal for each paragraph, usually -1, 0, or 1, and is zero by default.
+func (rt *RichText) SetLineBreakOptions(tolerance float64, looseness int) {
+	if !(0.0 <= tolerance) {
+		tolerance = 0.0
+	}
+	rt.tolerance = tolerance
+	rt.looseness = looseness
+}
+
+// SetTabStops replaces the tab stops, so that the text following a tab character aligns to the first tab stop after the tab, see TabStop. Tabs after the last tab stop advance to the default tab stops, see SetTabSize. Tab stops are only applied in horizontal writing mode. Positions are measured from the start of the line in logical order, which includes the indentation of the first line of a paragraph. Tabs have the advance up to their tab stop during line breaking, so that they are never stretched or shrunk and lines do not overflow, and the lines are broken again when their tabs advance to other tab stops after wrapping.
+func (rt *RichText) SetTabStops(stops ...TabStop) {
+	rt.tabStops = append(rt.tabStops[:0], stops...)
+	sort.SliceStable(rt.tabStops, func(i, j int) bool { return rt.tabStops[i].Pos < rt.tabStops[j].Pos })
+}
+
+// SetTabSize sets the distance between the default tab stops in multiples of the width of a space of the tab's font face. The default tab stops are left-aligned and used for tabs after the last tab stop, see SetTabStops. By default it is 8, and zero disables the default tab stops so that those tabs have the advance of a space.
+func (rt *RichText) SetTabSize(size float64) {
+	rt.tabSize = size
+}
+
+// SetParagraphStyle sets the horizontal alignment and first-line indentation of the paragraph at the current position, that is the paragraph that the text written next is part of. Paragraphs are separated by newlines and it overrides the halign and indent arguments of ToText for that paragraph only, such as to center a heading above a justified body.
+func (rt *RichText) SetParagraphStyle(style ParagraphStyle) {
+	if rt.paragraphStyles == nil {
+		rt.paragraphStyles = map[int]ParagraphStyle{}
+	}
+	rt.paragraphStyles[paragraphIndex(rt.String())] = style
+}
+
+// SetParagraphAlign sets the horizontal alignment of the paragraph at the current position, see SetParagraphStyle, and keeps its first-line indentation. Paragraphs without an alignment use the halign argument of ToText.
+func (rt *RichText) SetParagraphAlign(halign TextAlign) {
+	style, ok := rt.paragraphStyles[paragraphIndex(rt.String())]
+	if !ok {
+		style.Indent = math.NaN()
+	}
+	style.Align = halign
+	rt.SetParagraphStyle(style)
+}
+
+// paragraphIndex returns the number of paragraph separators in s, counting \r\n as one, which is the index of the paragraph at the end of s.
+func paragraphIndex(s string) int {
+	n := 0
+	prev := rune(0)
+	for _, r := range s {
+		if canvasText.IsNewline(r) && (r != '\n' || prev != '\r') {
+			n++
+		}
+		prev = r
+	}
+	return n
+}
+
 // SetFace sets the font face.
 func (rt *RichText) SetFace(face *FontFace) {
 	if face == nil {
@@ -405,10 +916,62 @@ func (rt *RichText) SetFaceSpan(face *FontFace, start, end int) {
 // Add adds a string with a given font face.
 func (rt *RichText) Add(face *FontFace, text string) *RichText {
 	rt.SetFace(face)
+	if rt.smart {
+		prev, _ := utf8.DecodeLastRuneInString(rt.String())
+		if prev == utf8.RuneError {
+			prev = 0
+		}
+		text = canvasText.SmartTypography(text, prev, face.language())
+	}
 	rt.WriteString(text)
 	return rt
 }
 
+// Hyphenate inserts soft hyphens (U+00AD) at the hyphenation opportunities of the text added so far, using Liang's algorithm with the hyphenation patterns of the given language, see canvasText.LoadHyphenator. The line breaker may break words at the soft hyphens, where a hyphen is shown. Words shorter than canvasText.HyphenationMinWord are skipped, the parts of words joined by an explicit hyphen are hyphenated separately, and words that already contain a soft hyphen, word joiner (U+2060), or zero width no-break space (U+FEFF) are left as is. It returns an error if the language is not supported.
+func (rt *RichText) Hyphenate(lang string) error {
+	h, ok := canvasText.LoadHyphenator(lang)
+	if !ok {
+		return fmt.Errorf("unsupported hyphenation language: %s", lang)
+	}
+
+	s := rt.String()
+	offsets := h.HyphenateText(s)
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	// insert soft hyphens and move the face locations accordingly
+	locs := append(indexer{}, rt.locs...)
+	rt.Builder.Reset()
+	prev, runes := 0, 0
+	for _, offset := range offsets {
+		rt.WriteString(s[prev:offset])
+		runes += utf8.RuneCountInString(s[prev:offset])
+		rt.WriteRune('\u00AD')
+		for i, loc := range rt.locs {
+			if runes <= loc {
+				locs[i]++
+			}
+		}
+		prev = offset
+	}
+	rt.WriteString(s[prev:])
+	rt.locs = locs
+	return nil
+}
+
+// AddWithLang adds a string with a font face and overrides its language and script for shaping, this affects language-specific features such as locl. The language is a BCP 47 tag and the script may be ScriptInvalid to detect the script from the text.
+func (rt *RichText) AddWithLang(face *FontFace, text, lang string, script canvasText.Script) *RichText {
+	if face == nil {
+		panic("FontFace cannot be nil")
+	}
+	langFace := *face
+	langFace.Language = lang
+	langFace.Script = script
+	langFace.overrideScript = true
+	return rt.Add(&langFace, text)
+}
+
 // AddCanvas adds a canvas object that can have paths/images/texts.
 func (rt *RichText) AddCanvas(c *Canvas, valign VerticalAlign) *RichText {
 
@@ -446,13 +1009,40 @@ func (rt *RichText) AddImage(img image.Image, res Resolution, valign VerticalAli
 	return rt
 }
 
+// AddSVG adds an SVG fragment, such as an inline icon, that is parsed into a canvas. The resolution is used to convert SVG user units (pixels) to millimeters. Unsupported SVG elements are ignored.
+func (rt *RichText) AddSVG(svg []byte, res Resolution, valign VerticalAlign) error {
+	c, err := ParseSVG(bytes.NewReader(svg))
+	if err != nil {
+		return err
+	}
+
+	// ParseSVG returns a canvas in pixel units
+	f := 1.0 / res.DPMM()
+	if f != 1.0 {
+		scaled := New(f*c.W, f*c.H)
+		c.RenderViewTo(scaled, Identity.Scale(f, f))
+		c = scaled
+	}
+	rt.AddCanvas(c, valign)
+	return nil
+}
+
 // AddLaTeX adds a LaTeX formula.
 func (rt *RichText) AddLaTeX(s string) error {
-	p, err := ParseLaTeX(s)
+	return rt.AddLaTeXWithOptions(s, DefaultLaTeXOptions)
+}
+
+// AddLaTeXWithOptions adds a LaTeX formula with the given fill color and font size. Use the size and fill color of the current font face to match the surrounding text. The formula's baseline is aligned with the text's baseline.
+func (rt *RichText) AddLaTeXWithOptions(s string, opts LaTeXOptions) error {
+	f, err := ParseLaTeXFormula(s, opts)
 	if err != nil {
 		return err
 	}
-	rt.AddPath(p, Black, Baseline)
+	bounds := f.Bounds()
+	c := New(bounds.W, bounds.H)
+	f.RenderTo(c, Identity.Translate(-bounds.X, -bounds.Y))
+	rt.AddCanvas(c, Baseline)
+	rt.objects[len(rt.objects)-1].Depth = math.Max(0.0, -bounds.Y)
 	return nil
 }
 
@@ -481,14 +1071,85 @@ func scriptDirection(mode WritingMode, orient TextOrientation, script canvasText
 
 // ToText takes the added text spans and fits them within a given box of certain width and height using Donald Knuth's line breaking algorithm.
 func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, indent, lineStretch float64) *Text {
+	return rt.Prepare().Layout(width, height, halign, valign, indent, lineStretch)
+}
+
+// PreparedText is rich text that has been itemized and shaped into glyphs, but has not yet been broken into lines. It can be laid out repeatedly, for example at different widths when interactively resizing a text box, without shaping the text again.
+type PreparedText struct {
+	mode        WritingMode
+	orient      TextOrientation
+	trim        bool
+	alignLast   TextAlign
+	leading     func(int) float64
+	tabStops    []TabStop
+	tabSize     float64
+	tolerance   float64
+	looseness   int
+	defaultFace *FontFace
+	objects     []TextSpanObject
+	paragraphs  []canvasText.Paragraph
+	styles      map[int]ParagraphStyle
+	addedFaces  []faceStart // faces with which the text was added
+
+	log          string
+	glyphs       []canvasText.Glyph
+	glyphIndices indexer // indexes glyphs into faces
+	faces        []*FontFace
+	levels       []int
+	directions   []canvasText.Direction
+	rotations    []canvasText.Rotation
+}
+
+// Prepare itemizes and shapes the added text spans, which can then be laid out by PreparedText.Layout. Later changes to the rich text do not affect the prepared text.
+func (rt *RichText) Prepare() *PreparedText {
 	log := rt.String()
 	logRunes := []rune(log)
-	embeddingLevels := canvasText.EmbeddingLevels(logRunes)
+	paragraphs := canvasText.Paragraphs(log, rt.direction, rt.fallback)
+	embeddingLevels := make([]int, 0, len(logRunes))
+	for _, paragraph := range paragraphs {
+		paragraphRunes := []rune(log[paragraph.Start:paragraph.End])
+		embeddingLevels = append(embeddingLevels, canvasText.ParagraphEmbeddingLevels(paragraphRunes, paragraph.Direction)...)
+	}
 
 	// itemize string by font face and script
 	texts := []string{}
 	scripts := []canvasText.Script{}
 	faces := []*FontFace{}
+	levels := []int{}
+	itemizeScripts := func(face *FontFace, i, j int) {
+		items := canvasText.ScriptItemizer(logRunes[i:j], embeddingLevels[i:j])
+		for _, item := range items {
+			texts = append(texts, item.Text)
+			scripts = append(scripts, face.itemScript(item.Script))
+			faces = append(faces, face)
+			levels = append(levels, item.Level)
+		}
+	}
+	itemizeText := func(face *FontFace, i, j int) {
+		if face.EmojiFace == nil {
+			itemizeScripts(face, i, j)
+			return
+		}
+
+		// split off emoji sequences with emoji presentation
+		a := i
+		for k := i; k < j; {
+			if n := canvasText.EmojiSequence(logRunes[k:j]); 0 < n {
+				if a < k {
+					itemizeScripts(face, a, k)
+				}
+				itemizeScripts(face.EmojiFace, k, k+n)
+				k += n
+				a = k
+			} else {
+				k++
+			}
+		}
+		if a < j {
+			itemizeScripts(face, a, j)
+		}
+	}
+
 	i := 0       // index into logRunes
 	curFace := 0 // index into rt.faces
 	for j := range logRunes {
@@ -499,14 +1160,10 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 				texts = append(texts, string(logRunes[i:j]))
 				scripts = append(scripts, canvasText.ScriptInvalid)
 				faces = append(faces, nil)
+				levels = append(levels, embeddingLevels[i])
 			} else {
 				// text
-				items := canvasText.ScriptItemizer(logRunes[i:j], embeddingLevels[i:j])
-				for _, item := range items {
-					texts = append(texts, item.Text)
-					scripts = append(scripts, item.Script)
-					faces = append(faces, rt.faces[curFace])
-				}
+				itemizeText(rt.faces[curFace], i, j)
 			}
 			curFace = nextFace
 			i = j
@@ -518,14 +1175,10 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 			texts = append(texts, string(logRunes[i:]))
 			scripts = append(scripts, canvasText.ScriptInvalid)
 			faces = append(faces, nil)
+			levels = append(levels, embeddingLevels[i])
 		} else {
 			// text
-			items := canvasText.ScriptItemizer(logRunes[i:], embeddingLevels[i:])
-			for _, item := range items {
-				texts = append(texts, item.Text)
-				scripts = append(scripts, item.Script)
-				faces = append(faces, rt.faces[curFace])
-			}
+			itemizeText(rt.faces[curFace], i, len(logRunes))
 		}
 	}
 
@@ -565,7 +1218,7 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 			// text
 			ppem := face.PPEM(DefaultResolution)
 			direction, rotation = scriptDirection(rt.mode, rt.orient, script, face.Direction)
-			glyphsString, direction = face.Font.shaper.Shape(text, ppem, direction, script, face.Language, face.Font.features, face.Font.variations)
+			glyphsString, direction = face.shapeRun(text, ppem, direction, script)
 			for i := range glyphsString {
 				glyphsString[i].SFNT = face.Font.SFNT
 				glyphsString[i].Size = face.Size
@@ -602,7 +1255,59 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 		rotations[k] = rotation
 	}
 
-	if rt.mode != HorizontalTB {
+	styles := make(map[int]ParagraphStyle, len(rt.paragraphStyles))
+	for k, style := range rt.paragraphStyles {
+		styles[k] = style
+	}
+
+	// convert the rune locations of the added faces to byte offsets
+	byteOffsets := make([]int, 0, len(logRunes)+1)
+	for i := range log {
+		byteOffsets = append(byteOffsets, i)
+	}
+	byteOffsets = append(byteOffsets, len(log))
+	addedFaces := make([]faceStart, 0, len(rt.locs))
+	for k, loc := range rt.locs {
+		if k+1 == len(rt.locs) && loc < len(logRunes) || k+1 < len(rt.locs) && loc < rt.locs[k+1] {
+			addedFaces = append(addedFaces, faceStart{byteOffsets[loc], rt.faces[k]})
+		}
+	}
+	return &PreparedText{
+		mode:         rt.mode,
+		orient:       rt.orient,
+		trim:         rt.trim,
+		alignLast:    rt.alignLast,
+		leading:      rt.leading,
+		tabStops:     append([]TabStop{}, rt.tabStops...),
+		tabSize:      rt.tabSize,
+		tolerance:    rt.tolerance,
+		looseness:    rt.looseness,
+		defaultFace:  rt.defaultFace,
+		objects:      append([]TextSpanObject{}, rt.objects...),
+		paragraphs:   paragraphs,
+		styles:       styles,
+		addedFaces:   addedFaces,
+		log:          log,
+		glyphs:       glyphs,
+		glyphIndices: glyphIndices,
+		faces:        faces,
+		levels:       levels,
+		directions:   directions,
+		rotations:    rotations,
+	}
+}
+
+// Layout fits the prepared text within a given box of certain width and height using Donald Knuth's line breaking algorithm, see RichText.ToText.
+func (pt *PreparedText) Layout(width, height float64, halign, valign TextAlign, indent, lineStretch float64) *Text {
+	log := pt.log
+	glyphs := make([]canvasText.Glyph, len(pt.glyphs), len(pt.glyphs)+1)
+	copy(glyphs, pt.glyphs) // glyphs are reordered and referenced by the spans
+	glyphIndices := pt.glyphIndices
+	faces := pt.faces
+	directions := pt.directions
+	rotations := pt.rotations
+
+	if pt.mode != HorizontalTB {
 		width, height = height, width
 		halign, valign = valign, halign
 		if halign == Top {
@@ -617,39 +1322,61 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 		}
 	}
 
-	align := canvasText.Left
-	if halign == Justify {
-		align = canvasText.Justified
+	if len(log) == 0 {
+		// empty text has no lines
+		return &Text{
+			fonts:           map[*Font]bool{},
+			WritingMode:     pt.mode,
+			TextOrientation: pt.orient,
+			width:           width,
+			height:          height,
+		}
 	}
 
 	// break glyphs into lines following Donald Knuth's line breaking algorithm
-	looseness := 0
-	items := canvasText.GlyphsToItems(glyphs, indent, align)
-
+	var items []canvasText.Item
 	var breaks []*canvasText.Breakpoint
 	var overflows bool
-	if width != 0.0 {
-		var ok bool
-		breaks, ok = canvasText.Linebreak(items, width, looseness)
-		overflows = !ok
-	} else if len(items) == 0 {
-		breaks = append(breaks, &canvasText.Breakpoint{Position: 0, Width: 0.0})
-	} else {
-		lineWidth := 0.0
-		for i, item := range items {
-			if item.Type != canvasText.PenaltyType {
-				lineWidth += item.Width
-			} else if item.Penalty <= -canvasText.Infinity {
-				breaks = append(breaks, &canvasText.Breakpoint{Position: i, Width: lineWidth})
-				lineWidth = 0.0
+	breakLines := func() {
+		items = pt.glyphsToItems(glyphs, halign, indent)
+		breaks, overflows = nil, false
+		if 0.0 < width && width < narrowestGlyph(glyphs) {
+			// no glyph fits the width, put one glyph on each line
+			items, breaks = breakEveryGlyph(items, glyphs)
+			overflows = true
+		} else if width != 0.0 {
+			var ok bool
+			breaks, ok = canvasText.LinebreakWithTolerance(items, width, pt.tolerance, pt.looseness)
+			overflows = !ok
+		} else if len(items) == 0 {
+			breaks = append(breaks, &canvasText.Breakpoint{Position: 0, Width: 0.0})
+		} else {
+			lineWidth := 0.0
+			for i, item := range items {
+				if item.Type != canvasText.PenaltyType {
+					lineWidth += item.Width
+				} else if item.Penalty <= -canvasText.Infinity {
+					breaks = append(breaks, &canvasText.Breakpoint{Position: i, Width: lineWidth})
+					lineWidth = 0.0
+				}
 			}
 		}
 	}
+	if pt.mode == HorizontalTB {
+		pt.advanceTabs(glyphs, indent, nil)
+	}
+	breakLines()
+	if pt.mode == HorizontalTB && width != 0.0 {
+		// tabs advance to the tab stops from the start of their line, which is only known after line breaking, so break again until the tabs on wrapped lines keep their advances
+		for n := 0; n < 4 && pt.advanceTabs(glyphs, indent, lineStarts(items, breaks)); n++ {
+			breakLines()
+		}
+	}
+	pt.trimLetterSpacing(glyphs, items, breaks)
 
 	// clean up items, remove penalties/glues that were not chosen as breaks, this concatenates adjacent boxes and thus spans
-	var j int
-	i, j = 0, 0 // index into: glyphs, breaks/lines
-	shift := 0  // break index shift
+	i, j := 0, 0 // index into: glyphs, breaks/lines
+	shift := 0   // break index shift
 	if 0 < len(items) && items[0].Width == 0.0 {
 		// remove empty indent box
 		items = items[1:]
@@ -715,21 +1442,26 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 	t := &Text{
 		lines:           []line{{}},
 		fonts:           map[*Font]bool{},
-		WritingMode:     rt.mode,
-		TextOrientation: rt.orient,
+		WritingMode:     pt.mode,
+		TextOrientation: pt.orient,
 		width:           width,
 		height:          height,
 		text:            log,
+		faces:           pt.addedFaces,
 		Overflows:       overflows,
 	}
 	glyphs = append(glyphs, canvasText.Glyph{Cluster: uint32(len(log))}) // makes indexing easier
 
-	i, j = 0, 0      // index into: glyphs, breaks/lines
-	x, y := 0.0, 0.0 // both positive toward the bottom right
+	i, j = 0, 0                                         // index into: glyphs, breaks/lines
+	x, y := 0.0, 0.0                                    // both positive toward the bottom right
+	paragraphEnds := []int{}                            // lines that end with a forced line break
+	paragraph := 0                                      // index of the paragraph of the current line
+	aligns := []TextAlign{pt.paragraphAlign(0, halign)} // horizontal alignment per line
+	prevFace := pt.defaultFace
 	lineSpacing := 1.0 + lineStretch
-	if halign == Right {
+	if aligns[0] == Right {
 		x += width - breaks[j].Width
-	} else if halign == Center || halign == Middle {
+	} else if aligns[0] == Center || aligns[0] == Middle {
 		x += (width - breaks[j].Width) / 2.0
 	}
 	for position, item := range items {
@@ -748,6 +1480,7 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 						SFNT:     span.Face.Font.SFNT,
 						Size:     span.Face.Size,
 						ID:       id,
+						Cluster:  glyphs[i].Cluster,
 						XAdvance: int32(span.Face.Font.GlyphAdvance(id)),
 						Text:     '-',
 					}
@@ -757,19 +1490,23 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 				}
 			}
 
-			var ascent, descent, bottom float64
+			t.lines[j].alignBaselines(pt.mode)
+
 			if len(t.lines[j].spans) == 0 {
-				_, ascent, descent, bottom = faces[glyphIndices.index(i)].heights(rt.mode)
-			} else {
-				_, ascent, descent, bottom = t.lines[j].Heights(rt.mode)
+				t.lines[j].face = faces[glyphIndices.index(i)]
 			}
+			_, ascent, descent, bottom := t.lines[j].Heights(pt.mode)
 			if 0 < j {
 				ascent *= lineSpacing
 				// don't stretch descent for possible last line
 			}
 			bottom *= lineSpacing
 
-			if height != 0.0 && height < y+ascent+descent {
+			extra := 0.0
+			if pt.leading != nil {
+				extra = pt.leading(j)
+			}
+			if height != 0.0 && height < y+extra+ascent+descent {
 				// doesn't fit or at the end of items
 				t.lines = t.lines[:len(t.lines)-1]
 				if 0 < j {
@@ -780,20 +1517,25 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 				}
 				break
 			}
+			y += extra
 			t.lines[j].y = y + ascent
 			y += ascent + bottom
 			if position == len(items)-1 {
 				break
+			} else if item.Type == canvasText.PenaltyType && item.Penalty <= -canvasText.Infinity {
+				paragraphEnds = append(paragraphEnds, j)
+				paragraph++
 			}
 
 			t.lines = append(t.lines, line{})
+			aligns = append(aligns, pt.paragraphAlign(paragraph, halign))
 			if j+1 < len(breaks) {
 				j++
 			}
 			x = 0.0
-			if halign == Right {
+			if lineAlign := aligns[len(aligns)-1]; lineAlign == Right {
 				x += width - breaks[j].Width
-			} else if halign == Center || halign == Middle {
+			} else if lineAlign == Center || lineAlign == Middle {
 				x += (width - breaks[j].Width) / 2.0
 			}
 		} else if item.Type == canvasText.BoxType {
@@ -804,26 +1546,28 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 			k := glyphIndices.index(i)
 			for b := i + 1; b <= i+item.Size; b++ {
 				nextK := glyphIndices.index(b)
-				if nextK != k || b == i+item.Size {
+				if nextK != k || b == i+item.Size || glyphs[b-1].Text == '\t' && pt.mode == HorizontalTB {
+					// spans also end at tabs so that the text following a tab is a separate span
 					face := faces[k]
 					ac, bc := glyphs[a].Cluster, glyphs[b].Cluster
 
-					var w float64
+					var w, shift float64
 					var objects []TextSpanObject
 					if face != nil {
 						// text
 						w = face.textWidth(glyphs[a:b])
+						if pt.mode == HorizontalTB {
+							shift = face.BaselineShift
+						}
 						t.fonts[face.Font] = true
+						prevFace = face
 					} else {
 						// path/image object, only one glyph is ever selected; b-a == 1
-						if 0 < len(t.lines[j].spans) {
-							face = t.lines[j].spans[len(t.lines[j].spans)-1].Face
-						} else {
-							face = rt.defaultFace
-						}
+						// inherit the face of the preceding text, also across lines
+						face = prevFace
 						for _, glyph := range glyphs[a:b] {
-							obj := rt.objects[glyph.ID]
-							if rt.mode == HorizontalTB {
+							obj := pt.objects[glyph.ID]
+							if pt.mode == HorizontalTB {
 								obj.X = w
 								w += obj.Width
 							} else {
@@ -846,6 +1590,7 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 					s := log[ac:bc]
 					t.lines[j].spans = append(t.lines[j].spans, TextSpan{
 						X:         x + dx,
+						Y:         shift,
 						Width:     w,
 						Face:      face,
 						Text:      s,
@@ -853,6 +1598,7 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 						Glyphs:    glyphs[a:b],
 						Direction: directions[k],
 						Rotation:  rotations[k],
+						level:     pt.levels[k],
 					})
 
 					if directions[k] == canvasText.RightToLeft || directions[k] == canvasText.BottomToTop {
@@ -903,20 +1649,57 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 
 	if 0 < j {
 		// remove line gap of last line
-		_, _, descent, bottom := t.lines[j-1].Heights(rt.mode)
+		_, _, descent, bottom := t.lines[j-1].Heights(pt.mode)
 		y += -bottom*lineSpacing + descent
 	}
 
-	// vertical align
-	if rt.mode == VerticalRL {
-		if valign == Top {
-			valign = Bottom
-		} else if valign == Bottom {
-			valign = Top
+	rtl := make([]bool, len(t.lines)) // lines in right-to-left paragraphs
+	if pt.mode == HorizontalTB {
+		for j := range t.lines {
+			if pt.lineDirection(t.lines[j]) == canvasText.RightToLeft {
+				t.lines[j].mirror()
+				rtl[j] = true
+			}
 		}
 	}
-	if valign == Center || valign == Middle || valign == Bottom {
-		dy := height - y
+
+	if pt.trim {
+		for j := range t.lines {
+			t.lines[j].trimSpaces(aligns[j])
+		}
+	}
+
+	if pt.alignLast != alignAuto && width != 0.0 {
+		alignLast := pt.alignLast
+		if alignLast == Top {
+			alignLast = Left
+		} else if alignLast == Bottom {
+			alignLast = Right
+		}
+		for _, j := range append(paragraphEnds, len(t.lines)-1) {
+			if j < len(t.lines) {
+				t.lines[j].align(alignLast, width)
+			}
+		}
+	} else if width != 0.0 {
+		// the last line of justified right-to-left paragraphs starts at the right
+		for _, j := range append(paragraphEnds, len(t.lines)-1) {
+			if 0 <= j && j < len(t.lines) && rtl[j] && aligns[j] == Justify {
+				t.lines[j].align(Right, width)
+			}
+		}
+	}
+
+	// vertical align
+	if pt.mode == VerticalRL {
+		if valign == Top {
+			valign = Bottom
+		} else if valign == Bottom {
+			valign = Top
+		}
+	}
+	if valign == Center || valign == Middle || valign == Bottom {
+		dy := height - y
 		if valign == Center || valign == Middle {
 			dy /= 2.0
 		}
@@ -931,7 +1714,7 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 			dy += ddy
 		}
 	}
-	if rt.mode == VerticalRL {
+	if pt.mode == VerticalRL {
 		for j := range t.lines {
 			t.lines[j].y = height - t.lines[j].y
 		}
@@ -939,6 +1722,353 @@ func (rt *RichText) ToText(width, height float64, halign, valign TextAlign, inde
 	return t
 }
 
+// paragraphAlign returns the horizontal alignment of the paragraph with the given index, which defaults to halign.
+func (pt *PreparedText) paragraphAlign(paragraph int, halign TextAlign) TextAlign {
+	style, ok := pt.styles[paragraph]
+	if !ok {
+		return halign
+	} else if style.Align == Top {
+		return Left
+	} else if style.Align == Bottom {
+		return Right
+	}
+	return style.Align
+}
+
+// paragraphIndent returns the first-line indentation of the paragraph with the given index, which defaults to indent for the first paragraph and to zero for the others.
+func (pt *PreparedText) paragraphIndent(paragraph int, indent float64) float64 {
+	if style, ok := pt.styles[paragraph]; ok && !math.IsNaN(style.Indent) {
+		return style.Indent
+	} else if paragraph == 0 {
+		return indent
+	}
+	return 0.0
+}
+
+// advanceTabs sets the advances of the tab glyphs so that the text following each tab aligns to its tab stop, see RichText.SetTabStops. Positions are measured in logical order from the start of the line, which is the right of the line for right-to-left paragraphs, so that the line breaker accounts for the advances of the tabs. The line starts are the indices of the first glyphs of the wrapped lines, or nil if the lines are not yet broken so that only paragraphs start new lines. It returns true if the advance of any tab changed.
+func (pt *PreparedText) advanceTabs(glyphs []canvasText.Glyph, indent float64, lineStarts []int) bool {
+	changed := false
+	paragraph := 0
+	x := pt.paragraphIndent(0, indent)
+	l := 0 // index into lineStarts
+	for i, glyph := range glyphs {
+		end := len(glyphs) // end of the line
+		for l < len(lineStarts) && lineStarts[l] <= i {
+			if lineStarts[l] == i && 0 < i && !canvasText.IsNewline(glyphs[i-1].Text) {
+				x = 0.0 // wrapped line
+			}
+			l++
+		}
+		if l < len(lineStarts) {
+			end = lineStarts[l]
+		}
+
+		if canvasText.IsNewline(glyph.Text) {
+			if glyph.Text != '\n' || i == 0 || glyphs[i-1].Text != '\r' {
+				paragraph++
+			}
+			x = pt.paragraphIndent(paragraph, indent)
+			continue
+		} else if glyph.Text != '\t' {
+			x += glyph.Advance()
+			continue
+		}
+
+		var stop TabStop
+		if k := sort.Search(len(pt.tabStops), func(k int) bool { return x < pt.tabStops[k].Pos }); k < len(pt.tabStops) {
+			stop = pt.tabStops[k]
+		} else if size := pt.tabSize * glyph.Size / float64(glyph.SFNT.Head.UnitsPerEm) * float64(glyph.SFNT.GlyphAdvance(glyph.SFNT.GlyphIndex(' '))); 0.0 < size {
+			stop.Pos = (math.Floor(x/size) + 1.0) * size
+		} else {
+			// advance of a space
+			changed = changed || glyphs[i].XAdvance != pt.glyphs[i].XAdvance
+			glyphs[i].XAdvance = pt.glyphs[i].XAdvance
+			x += glyphs[i].Advance()
+			continue
+		}
+
+		pos := stop.Pos
+		if stop.Align != LeftTab {
+			decimal := stop.Decimal
+			if decimal == 0 {
+				decimal = '.'
+			}
+			// the text following the tab spans up to the next tab or the end of the line or paragraph
+			width, offset := 0.0, math.NaN()
+			for _, next := range glyphs[i+1 : end] {
+				if next.Text == '\t' || canvasText.IsNewline(next.Text) {
+					break
+				} else if next.Text == decimal && math.IsNaN(offset) {
+					offset = width
+				}
+				width += next.Advance()
+			}
+			if stop.Align == RightTab || stop.Align == DecimalTab && math.IsNaN(offset) {
+				pos -= width
+			} else if stop.Align == CenterTab {
+				pos -= width / 2.0
+			} else if stop.Align == DecimalTab {
+				pos -= offset
+			}
+		}
+		advance := math.Max(pos, x) - x
+		xAdvance := int32(advance*float64(glyph.SFNT.Head.UnitsPerEm)/glyph.Size + 0.5)
+		changed = changed || glyphs[i].XAdvance != xAdvance
+		glyphs[i].XAdvance = xAdvance
+		x += glyphs[i].Advance()
+	}
+	return changed
+}
+
+// lineStarts returns the indices into glyphs of the first glyphs of the lines after the first, where the spaces at the start of a line are part of the line break.
+func lineStarts(items []canvasText.Item, breaks []*canvasText.Breakpoint) []int {
+	starts := []int{}
+	i, j := 0, 0 // index into: glyphs, breaks
+	for k := 0; k < len(items) && j < len(breaks); k++ {
+		i += items[k].Size
+		if k == breaks[j].Position {
+			for k+1 < len(items) && (items[k+1].Type == canvasText.GlueType || items[k+1].Type == canvasText.PenaltyType && -canvasText.Infinity < items[k+1].Penalty) {
+				k++
+				i += items[k].Size
+			}
+			starts = append(starts, i)
+			j++
+		}
+	}
+	return starts
+}
+
+// trimLetterSpacing removes the letter spacing after the glyph at the visual end of each line, since FontFace.shapeRun adds it after every glyph, and updates the widths of its box and line and the adjustment ratio of the line accordingly. The line is not trimmed when it ends in a hyphen.
+func (pt *PreparedText) trimLetterSpacing(glyphs []canvasText.Glyph, items []canvasText.Item, breaks []*canvasText.Breakpoint) {
+	if len(items) == 0 {
+		return
+	}
+	starts := make([]int, len(items)+1) // indices into glyphs of the items
+	for k, item := range items {
+		starts[k+1] = starts[k] + item.Size
+	}
+
+	k := 0 // index into items
+	for _, b := range breaks {
+		first, last := -1, -1 // first and last box with glyphs
+		boxed := false        // glues count from the first box of the line, as for the line breaker
+		stretch, shrink := 0.0, 0.0
+		for ; k < b.Position; k++ {
+			if items[k].Type == canvasText.BoxType {
+				if 0 < items[k].Size {
+					if first == -1 {
+						first = k
+					}
+					last = k
+				}
+				boxed = true
+			} else if items[k].Type == canvasText.GlueType && boxed {
+				stretch += items[k].Stretch
+				shrink += items[k].Shrink
+			}
+		}
+		k = b.Position + 1
+		if last == -1 || items[b.Position].Type == canvasText.PenaltyType && items[b.Position].Size == 1 && glyphs[starts[b.Position]].Text == '\u00AD' {
+			continue
+		}
+
+		i := pt.lineEndGlyph(glyphs, starts[first], starts[last+1])
+		if i == -1 {
+			continue
+		}
+		d := pt.faces[pt.glyphIndices.index(i)].trimLetterSpacing(&glyphs[i])
+		if d == 0.0 {
+			continue
+		}
+		for box := first; box <= last; box++ {
+			if starts[box] <= i && i < starts[box+1] {
+				items[box].Width -= d
+				break
+			}
+		}
+		b.Width -= d
+		if 0.0 < b.Ratio && 0.0 < stretch && !math.IsInf(stretch, 0.0) {
+			b.Ratio += d / stretch
+		} else if b.Ratio < 0.0 && 0.0 < shrink && !math.IsInf(shrink, 0.0) {
+			b.Ratio += d / shrink
+		}
+	}
+}
+
+// lineEndGlyph returns the index of the glyph with an advance at the visual end of the line, which spans the glyphs in the range [a,b) in logical order, or -1 if there is none or if it is an object. This is the logically last glyph, unless the line ends in a block of right-to-left runs whose logically first glyph is at the visual end. For right-to-left paragraphs, whose lines are mirrored, it is the reverse.
+func (pt *PreparedText) lineEndGlyph(glyphs []canvasText.Glyph, a, b int) int {
+	rtlParagraph := false
+	if pt.mode == HorizontalTB {
+		for _, paragraph := range pt.paragraphs {
+			if int(glyphs[a].Cluster) < paragraph.End {
+				rtlParagraph = paragraph.Direction == canvasText.RightToLeft
+				break
+			}
+		}
+	}
+	opposite := func(i int) bool {
+		direction := pt.directions[pt.glyphIndices.index(i)]
+		return (direction == canvasText.RightToLeft || direction == canvasText.BottomToTop) != rtlParagraph
+	}
+
+	i, di := b-1, -1
+	if rtlParagraph {
+		i, di = a, 1
+	}
+	if opposite(i) {
+		// the visual end is at the other end of the block of runs in the opposite direction
+		for a <= i+di && i+di < b && (opposite(i+di) || canvasText.IsSpace(glyphs[i+di].Text)) {
+			i += di
+		}
+		di = -di
+	}
+	for ; a <= i && i < b; i += di {
+		if pt.faces[pt.glyphIndices.index(i)] == nil {
+			return -1
+		} else if !canvasText.IsSpace(glyphs[i].Text) && (glyphs[i].XAdvance != 0 || glyphs[i].YAdvance != 0) {
+			return i
+		}
+	}
+	return -1
+}
+
+// glyphsToItems converts the glyphs to line breaking items, where each paragraph has its own alignment and first-line indentation if a paragraph style was set. The last lines of justified paragraphs are justified as well, except for the last line of the text or when the alignment of the last lines is set by SetTextAlignLast.
+func (pt *PreparedText) glyphsToItems(glyphs []canvasText.Glyph, halign TextAlign, indent float64) []canvasText.Item {
+	lineBreakAlign := func(halign TextAlign) canvasText.Align {
+		if halign == Justify {
+			return canvasText.Justified
+		}
+		return canvasText.Left
+	}
+	if len(glyphs) == 0 || len(pt.styles) == 0 && (halign != Justify || pt.alignLast == alignAuto) {
+		return canvasText.GlyphsToItemsWithText(glyphs, pt.log, indent, lineBreakAlign(halign))
+	}
+
+	items := []canvasText.Item{}
+	paragraph, start := 0, 0
+	for i := 0; i <= len(glyphs); i++ {
+		if i < len(glyphs) && !canvasText.IsNewline(glyphs[i].Text) {
+			continue
+		} else if i == len(glyphs) && start == len(glyphs) && 0 < start {
+			// empty last line after a trailing newline
+			items = append(items, canvasText.Glue(0.0, math.Inf(1.0), 0.0))
+			items = append(items, canvasText.Penalty(0.0, -canvasText.Infinity, true))
+			break
+		}
+
+		end := len(pt.log)
+		if i < len(glyphs) {
+			end = int(glyphs[i].Cluster)
+		}
+		paragraphAlign := pt.paragraphAlign(paragraph, halign)
+		paragraphItems := canvasText.GlyphsToItemsWithText(glyphs[start:i], pt.log[:end], pt.paragraphIndent(paragraph, indent), lineBreakAlign(paragraphAlign))
+		if len(paragraphItems) == 0 {
+			paragraphItems = append(paragraphItems, canvasText.Penalty(0.0, -canvasText.Infinity, false))
+		} else if i < len(glyphs) && paragraphAlign == Justify && pt.alignLast == alignAuto {
+			// justify the last line of the paragraph by removing its infinitely stretchable glue
+			paragraphItems = append(paragraphItems[:len(paragraphItems)-2], canvasText.Penalty(0.0, -canvasText.Infinity, false))
+		}
+		if i < len(glyphs) {
+			// the forced line break includes the newline, and \r\n counts as one
+			n := 1
+			if glyphs[i].Text == '\r' && i+1 < len(glyphs) && glyphs[i+1].Text == '\n' {
+				n++
+			}
+			paragraphItems[len(paragraphItems)-1].Size += n
+			i += n - 1
+		}
+		items = append(items, paragraphItems...)
+		paragraph++
+		start = i + 1
+	}
+	return items
+}
+
+// narrowestGlyph returns the smallest advance of the glyphs that are not spaces or zero-width, or zero if there are none.
+func narrowestGlyph(glyphs []canvasText.Glyph) float64 {
+	narrowest := 0.0
+	for _, glyph := range glyphs {
+		if advance := glyph.Advance(); 0.0 < advance && !canvasText.IsSpace(glyph.Text) && !canvasText.IsNewline(glyph.Text) {
+			if narrowest == 0.0 || advance < narrowest {
+				narrowest = advance
+			}
+		}
+	}
+	return narrowest
+}
+
+// breakEveryGlyph splits the boxes of words into a box per glyph and breaks the items after every glyph, for widths too small to fit any glyph. Zero-width glyphs such as combining marks stay with the preceding glyph, boxes that include spaces such as the indentation are not split, and forced line breaks are kept.
+func breakEveryGlyph(items []canvasText.Item, glyphs []canvasText.Glyph) ([]canvasText.Item, []*canvasText.Breakpoint) {
+	split := make([]canvasText.Item, 0, len(items))
+	isGlyph := make([]bool, 0, len(items)) // box has a glyph that is not a space
+	i := 0                                 // index into glyphs
+	for _, item := range items {
+		n := item.Size
+		hasSpace := false
+		for k := i; k < i+n && k < len(glyphs); k++ {
+			hasSpace = hasSpace || canvasText.IsSpace(glyphs[k].Text)
+		}
+		if item.Type != canvasText.BoxType || n < 2 || hasSpace || len(glyphs) < i+n {
+			split = append(split, item)
+			isGlyph = append(isGlyph, item.Type == canvasText.BoxType && 0.0 < item.Width && !hasSpace)
+			i += n
+			continue
+		}
+		for k, glyph := range glyphs[i : i+n] {
+			advance := glyph.Advance()
+			if k == 0 || advance == 0.0 {
+				if k == 0 {
+					split = append(split, canvasText.Box(0.0))
+					isGlyph = append(isGlyph, false)
+				}
+				split[len(split)-1].Width += advance
+			} else {
+				split = append(split, canvasText.Penalty(0.0, 0.0, false))
+				split = append(split, canvasText.Box(advance))
+				isGlyph = append(isGlyph, false, false)
+			}
+			split[len(split)-1].Size++
+			isGlyph[len(isGlyph)-1] = 0.0 < split[len(split)-1].Width
+		}
+		i += n
+	}
+
+	// break at every legal breakpoint once the line has a glyph, skipping glues and penalties at the start of a line
+	breaks := []*canvasText.Breakpoint{}
+	lineWidth, hasGlyph := 0.0, false
+	for b, item := range split {
+		legal := item.Type == canvasText.PenaltyType && item.Penalty < canvasText.Infinity || item.Type == canvasText.GlueType && 0 < b && split[b-1].Type == canvasText.BoxType && b+1 < len(split) && split[b+1].Type != canvasText.PenaltyType
+		if item.Type == canvasText.PenaltyType && item.Penalty <= -canvasText.Infinity || legal && hasGlyph {
+			breaks = append(breaks, &canvasText.Breakpoint{Position: b, Width: lineWidth})
+			lineWidth, hasGlyph = 0.0, false
+		} else if item.Type == canvasText.BoxType {
+			lineWidth += item.Width
+			hasGlyph = hasGlyph || isGlyph[b]
+		} else if item.Type == canvasText.GlueType && hasGlyph {
+			lineWidth += item.Width
+		}
+	}
+	return split, breaks
+}
+
+// lineDirection returns the base direction of the paragraph that contains the line.
+func (pt *PreparedText) lineDirection(l line) canvasText.Direction {
+	cluster := uint32(len(pt.log))
+	for _, span := range l.spans {
+		for _, glyph := range span.Glyphs {
+			if glyph.Cluster < cluster {
+				cluster = glyph.Cluster
+			}
+		}
+	}
+	for _, paragraph := range pt.paragraphs {
+		if int(cluster) < paragraph.End {
+			return paragraph.Direction
+		}
+	}
+	return canvasText.LeftToRight
+}
+
 // Empty returns true if there are no text lines or text spans.
 func (t *Text) Empty() bool {
 	for _, line := range t.lines {
@@ -968,14 +2098,14 @@ func (t *Text) Heights() (float64, float64) {
 
 // Bounds returns the bounding rectangle that defines the text box.
 func (t *Text) Bounds() Rect {
-	if len(t.lines) == 0 || len(t.lines[0].spans) == 0 {
+	if t.Empty() {
 		return Rect{}
 	}
 	rect := Rect{}
 	for _, line := range t.lines {
 		for _, span := range line.spans {
 			// TODO: vertical text
-			rect = rect.Add(Rect{span.X, -line.y - span.Face.Metrics().Descent, span.Width, span.Face.Metrics().Ascent + span.Face.Metrics().Descent})
+			rect = rect.Add(Rect{span.X, -line.y + span.Y - span.Face.Metrics().Descent, span.Width, span.Face.Metrics().Ascent + span.Face.Metrics().Descent})
 		}
 	}
 	return rect
@@ -983,19 +2113,27 @@ func (t *Text) Bounds() Rect {
 
 // OutlineBounds returns the rectangle that contains the entire text box, i.e. the glyph outlines (slow).
 func (t *Text) OutlineBounds() Rect {
-	if len(t.lines) == 0 || len(t.lines[0].spans) == 0 {
+	if t.Empty() {
 		return Rect{}
 	}
 	r := Rect{}
 	for _, line := range t.lines {
 		for _, span := range line.spans {
 			// TODO: vertical text
-			p, _, err := span.Face.toPath(span.Glyphs, span.Face.PPEM(DefaultResolution))
+			p, _, err := span.Face.toPath(span.Glyphs, span.Face.PPEM(DefaultResolution), font.NoHinting)
 			if err != nil {
 				panic(err)
 			}
+			if span.Rotation != canvasText.NoRotation {
+				p = p.Transform(Identity.Rotate(float64(span.Rotation)))
+			}
 			spanBounds := p.Bounds()
-			spanBounds = spanBounds.Move(Point{span.X, -line.y})
+			if span.Face.HasStroke() {
+				// round joins extend the outline by half the stroke width
+				d := span.Face.StrokeWidth / 2.0
+				spanBounds = Rect{spanBounds.X - d, spanBounds.Y - d, spanBounds.W + 2.0*d, spanBounds.H + 2.0*d}
+			}
+			spanBounds = spanBounds.Move(Point{span.X, -line.y + span.Y})
 			r = r.Add(spanBounds)
 		}
 	}
@@ -1022,6 +2160,36 @@ func (t *Text) Fonts() []*Font {
 	return fonts
 }
 
+// UsedGlyphs returns the glyph IDs used per font in increasing order and without duplicates, including inserted hyphens. This can be used as input for font subsetting. Composite glyph dependencies are not included.
+func (t *Text) UsedGlyphs() map[*Font][]uint16 {
+	used := map[*Font]map[uint16]bool{}
+	for _, line := range t.lines {
+		for _, span := range line.spans {
+			if span.IsText() {
+				if used[span.Face.Font] == nil {
+					used[span.Face.Font] = map[uint16]bool{}
+				}
+				for _, glyph := range span.Glyphs {
+					if !glyph.Empty {
+						used[span.Face.Font][glyph.ID] = true
+					}
+				}
+			}
+		}
+	}
+
+	glyphs := map[*Font][]uint16{}
+	for font, ids := range used {
+		list := make([]uint16, 0, len(ids))
+		for id := range ids {
+			list = append(list, id)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		glyphs[font] = list
+	}
+	return glyphs
+}
+
 // MostCommonFontFace returns the most common FontFace of the text.
 func (t *Text) MostCommonFontFace() *FontFace {
 	fonts := map[*Font]int{}
@@ -1029,9 +2197,11 @@ func (t *Text) MostCommonFontFace() *FontFace {
 	styles := map[FontStyle]int{}
 	variants := map[FontVariant]int{}
 	colors := map[color.RGBA]int{}
+	languages := map[string]int{}
 	for _, line := range t.lines {
 		for _, span := range line.spans {
 			fonts[span.Face.Font]++
+			languages[span.Face.Language]++
 			sizes[span.Face.Size]++
 			styles[span.Face.Style]++
 			variants[span.Face.Variant]++
@@ -1044,7 +2214,7 @@ func (t *Text) MostCommonFontFace() *FontFace {
 		return nil
 	}
 
-	font, size, style, variant, col := (*Font)(nil), 0.0, FontRegular, FontNormal, Black
+	font, size, style, variant, col, lang := (*Font)(nil), 0.0, FontRegular, FontNormal, Black, ""
 	for key, val := range fonts {
 		if fonts[font] < val {
 			font = key
@@ -1070,10 +2240,16 @@ func (t *Text) MostCommonFontFace() *FontFace {
 			col = key
 		}
 	}
+	for key, val := range languages {
+		if languages[lang] < val {
+			lang = key
+		}
+	}
 
 	face := font.Face(size*ptPerMm, col)
 	face.Style = style
 	face.Variant = variant
+	face.Language = lang
 	return face
 }
 
@@ -1096,6 +2272,13 @@ func (t *Text) WalkDecorations(callback func(fill Paint, deco *Path)) {
 		active := []decorationSpan{}
 		for k, span := range line.spans {
 			foundActive := make([]bool, len(active))
+			if 0 < len(span.Objects) {
+				// continue active decorations beneath path/image objects
+				for i := range active {
+					active[i].width = span.X + span.Width - active[i].x
+					foundActive[i] = true
+				}
+			}
 			for _, spanDeco := range span.Face.Deco {
 				found := false
 				for i, deco := range active {
@@ -1160,6 +2343,39 @@ func (t *Text) WalkDecorations(callback func(fill Paint, deco *Path)) {
 	}
 }
 
+// MergeSpans coalesces adjacent text spans on each line that share the same font face, direction, rotation, and baseline shift into a single span with concatenated glyphs. This reduces the overhead for renderers that emit state per span. Spans are only merged when they abut, as space stretched by justification cannot be expressed in the glyph advances, and right-to-left or bottom-to-top spans are never merged.
+func (t *Text) MergeSpans() {
+	for j := range t.lines {
+		spans := t.lines[j].spans
+		if len(spans) < 2 {
+			continue
+		}
+		merged := spans[:1]
+		for _, span := range spans[1:] {
+			prev := &merged[len(merged)-1]
+			if !prev.canMerge(span) {
+				merged = append(merged, span)
+				continue
+			}
+			prev.Glyphs = append(prev.Glyphs[:len(prev.Glyphs):len(prev.Glyphs)], span.Glyphs...) // glyphs may share their backing array
+			prev.Text += span.Text
+			prev.Width = span.X + span.Width - prev.X
+		}
+		t.lines[j].spans = merged
+	}
+}
+
+func (span *TextSpan) canMerge(next TextSpan) bool {
+	if !span.IsText() || !next.IsText() || span.Direction != next.Direction || span.Rotation != next.Rotation || span.level != next.level {
+		return false
+	} else if span.Direction == canvasText.RightToLeft || span.Direction == canvasText.BottomToTop {
+		return false
+	} else if !Equal(span.Y, next.Y) || !Equal(span.X+span.Width, next.X) {
+		return false
+	}
+	return span.Face == next.Face || span.Face.Equals(next.Face)
+}
+
 // WalkLines calls the callback for each text line.
 func (t *Text) WalkLines(callback func(float64, []TextSpan)) {
 	for _, line := range t.lines {
@@ -1174,7 +2390,7 @@ func (t *Text) WalkSpans(callback func(float64, float64, TextSpan)) {
 			xOffset := span.Face.mmPerEm * float64(span.Face.XOffset)
 			yOffset := span.Face.mmPerEm * float64(span.Face.YOffset)
 			if t.WritingMode == HorizontalTB {
-				callback(span.X+xOffset, -line.y+yOffset, span)
+				callback(span.X+xOffset, -line.y+span.Y+yOffset, span)
 			} else {
 				callback(line.y+xOffset, -span.X+yOffset, span)
 			}
@@ -1182,17 +2398,113 @@ func (t *Text) WalkSpans(callback func(float64, float64, TextSpan)) {
 	}
 }
 
-// RenderAsPath renders the text and its decorations converted to paths, calling r.RenderPath.
+// VisualSpans returns a copy of the text spans of the line with the given index in visual order, that is sorted by increasing X position. Lines are indexed in the order of WalkLines and nil is returned if the index is out of range. This is useful for backends or formats that need the spans from left to right, regardless of the bidirectional reordering of the line.
+func (t *Text) VisualSpans(lineIndex int) []TextSpan {
+	if lineIndex < 0 || len(t.lines) <= lineIndex {
+		return nil
+	}
+	spans := make([]TextSpan, len(t.lines[lineIndex].spans))
+	copy(spans, t.lines[lineIndex].spans)
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].X < spans[j].X
+	})
+	return spans
+}
+
+// StyledRun is a run of text in a single font face, see Text.StyledRuns.
+type StyledRun struct {
+	Text string
+	Face *FontFace // nil for path and image objects
+}
+
+// faceStart is the byte offset from which the text has the font face, nil for path and image objects.
+type faceStart struct {
+	start int
+	face  *FontFace
+}
+
+// StyledRuns returns the text split into runs of the font faces with which the text was added in logical order, merging the spans of a face across line boundaries. The runs cover the entire text, including whitespace and newlines at line breaks. This reconstructs the structure of the rich text, such as for exporting to editable formats. Path and image objects are separate runs with a nil face. For text that was not laid out from rich text, the faces of the spans are used and whitespace at line breaks is added to the preceding run.
+func (t *Text) StyledRuns() []StyledRun {
+	starts := t.faces
+	if starts == nil {
+		for _, line := range t.lines {
+			for _, span := range line.spans {
+				if len(span.Glyphs) == 0 {
+					continue
+				}
+				start := int(span.Glyphs[0].Cluster)
+				for _, glyph := range span.Glyphs[1:] {
+					if int(glyph.Cluster) < start {
+						start = int(glyph.Cluster)
+					}
+				}
+				face := span.Face
+				if !span.IsText() {
+					face = nil
+				}
+				starts = append(starts, faceStart{start, face})
+			}
+		}
+		sort.SliceStable(starts, func(i, j int) bool { return starts[i].start < starts[j].start })
+		if 0 < len(starts) {
+			starts[0].start = 0
+		}
+	}
+
+	runs := []StyledRun{}
+	for i, run := range starts {
+		start, end := run.start, len(t.text) // the text is cut off when it overflows the height
+		if i+1 < len(starts) && starts[i+1].start < end {
+			end = starts[i+1].start
+		}
+		if end <= start {
+			continue
+		} else if run.face == nil {
+			// each object is a separate run
+			for start < end {
+				_, size := utf8.DecodeRuneInString(t.text[start:end])
+				runs = append(runs, StyledRun{Text: t.text[start : start+size]})
+				start += size
+			}
+		} else if 0 < len(runs) && runs[len(runs)-1].Face == run.face {
+			runs[len(runs)-1].Text += t.text[start:end]
+		} else {
+			runs = append(runs, StyledRun{Text: t.text[start:end], Face: run.face})
+		}
+	}
+	return runs
+}
+
+// RenderAsPath renders the text and its decorations converted to paths, calling r.RenderPath. If Clip is set, the glyphs and decorations are clipped to the text box, but path and image objects are not.
 func (t *Text) RenderAsPath(r Renderer, m Matrix, resolution Resolution) {
+	renderPath := func(p *Path, style Style) {
+		if t.Clip {
+			clip := t.clipRect(p, style)
+			if style.HasStroke() {
+				// clip the stroke outline instead of stroking the clipped path
+				stroke := p.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, Tolerance).And(clip)
+				p = p.And(clip)
+				strokeStyle := DefaultStyle
+				strokeStyle.Fill = style.Stroke
+				style.Stroke = Paint{}
+				r.RenderPath(p, style, m)
+				r.RenderPath(stroke, strokeStyle, m)
+				return
+			}
+			p = p.And(clip)
+		}
+		r.RenderPath(p, style, m)
+	}
+
 	t.WalkDecorations(func(paint Paint, p *Path) {
 		style := DefaultStyle
 		style.Fill = paint
-		r.RenderPath(p, style, m)
+		renderPath(p, style)
 	})
 
 	for _, line := range t.lines {
 		for _, span := range line.spans {
-			x, y := span.X, -line.y
+			x, y := span.X, -line.y+span.Y
 			if t.WritingMode != HorizontalTB {
 				x, y = line.y, -span.X
 			}
@@ -1200,19 +2512,43 @@ func (t *Text) RenderAsPath(r Renderer, m Matrix, resolution Resolution) {
 			if span.IsText() {
 				style := DefaultStyle
 				style.Fill = span.Face.Fill
-				p, _, err := span.Face.toPath(span.Glyphs, span.Face.PPEM(resolution))
+				if span.Face.HasStroke() {
+					style.Stroke = span.Face.Stroke
+					style.StrokeWidth = span.Face.StrokeWidth
+					style.StrokeJoiner = RoundJoin
+				}
+				hinting := font.NoHinting
+				if resolution != 0.0 && span.Face.Hinting == font.BytecodeHinting && span.Rotation == text.NoRotation && m.IsTranslation() {
+					// grid-fitted outlines are only sharp when they are not scaled or skewed afterwards
+					hinting = font.BytecodeHinting
+				}
+				grid, x0 := 0.0, 0.0
+				if resolution != 0.0 && span.Face.SubpixelGrid != 0.0 && span.Rotation == text.NoRotation && t.WritingMode == HorizontalTB && m[0][1] == 0.0 && m[1][0] == 0.0 && m[0][0] != 0.0 {
+					// snap glyphs horizontally to the subpixel grid of the raster, also when mirrored or scaled
+					grid = span.Face.SubpixelGrid / resolution.DPMM() / math.Abs(m[0][0])
+					x0, _ = m.Pos()
+					x0 = x0/m[0][0] + x
+				}
+				p, _, err := span.Face.toSnappedPath(span.Glyphs, span.Face.PPEM(resolution), hinting, x0, grid)
 				if err != nil {
 					panic(err)
 				}
+				if d := span.Face.stemDarkening(resolution); d != 0.0 {
+					p = p.Offset(d, NonZero, Tolerance)
+				}
 				p = p.Transform(Identity.Rotate(float64(span.Rotation)))
 				if resolution != 0.0 && span.Face.Hinting != font.NoHinting && span.Rotation == text.NoRotation {
 					// grid-align vertically on pixel raster, this improves font sharpness
+					sy := 1.0
+					if m[0][1] == 0.0 && m[1][0] == 0.0 && m[1][1] != 0.0 {
+						sy = m[1][1] // mirrored or scaled
+					}
 					_, dy := m.Pos()
-					dy += y
-					y += float64(int(dy*resolution.DPMM()+0.5))/resolution.DPMM() - dy
+					dy += sy * y
+					y += (math.Floor(dy*resolution.DPMM()+0.5)/resolution.DPMM() - dy) / sy
 				}
 				p = p.Translate(x, y)
-				r.RenderPath(p, style, m)
+				renderPath(p, style)
 			} else {
 				for _, obj := range span.Objects {
 					obj.RenderViewTo(r, m.Mul(obj.View(x, y, span.Face)))
@@ -1222,7 +2558,271 @@ func (t *Text) RenderAsPath(r Renderer, m Matrix, resolution Resolution) {
 	}
 }
 
+// clipRect returns the rectangle of the text box in the coordinates of the rendered paths, where a zero width or height of the box is unbounded and covers the path.
+func (t *Text) clipRect(p *Path, style Style) *Path {
+	bounds := p.Bounds()
+	if style.HasStroke() {
+		d := style.StrokeWidth
+		bounds = Rect{bounds.X - d, bounds.Y - d, bounds.W + 2.0*d, bounds.H + 2.0*d}
+	}
+	width, height := t.width, t.height
+	if t.WritingMode != HorizontalTB {
+		width, height = height, width
+	}
+
+	x0, x1 := bounds.X, bounds.X+bounds.W
+	y0, y1 := bounds.Y, bounds.Y+bounds.H
+	if width != 0.0 {
+		x0, x1 = 0.0, width
+	}
+	if height != 0.0 {
+		y0, y1 = -height, 0.0
+	}
+	return Rectangle(x1-x0, y1-y0).Translate(x0, y0)
+}
+
+// RenderRange renders only the lines that are at least partially within the vertical range between yMin and yMax, see RenderAsPath. The range is in the coordinates of the text, where the top of the text box is at zero and y points upwards so that lines have negative y-coordinates. For vertical writing modes, the range applies to the horizontal position of the lines instead. This allows rendering only the visible part of long texts, such as in a scrolled view.
+func (t *Text) RenderRange(r Renderer, m Matrix, resolution Resolution, yMin, yMax float64) {
+	visible := *t
+	visible.lines = nil
+	for _, line := range t.lines {
+		_, ascent, descent, _ := line.Heights(t.WritingMode)
+		lo, hi := -line.y-descent, -line.y+ascent
+		if t.WritingMode != HorizontalTB {
+			lo, hi = line.y-descent, line.y+ascent
+		}
+		if lo <= yMax && yMin <= hi {
+			visible.lines = append(visible.lines, line)
+		}
+	}
+	visible.RenderAsPath(r, m, resolution)
+}
+
 // String returns the content of the text box.
 func (t *Text) String() string {
 	return t.text
 }
+
+// ClusterToByteRange returns the start and end byte offsets into the logical text of the glyph cluster that contains the given cluster, where Glyph.Cluster holds the start of a cluster. A ligature such as "fi" maps to all the characters it represents, and a character that is decomposed into multiple glyphs is a single cluster. This can be used to highlight text that was found by searching.
+func (t *Text) ClusterToByteRange(cluster uint32) (int, int) {
+	if len(t.text) <= int(cluster) {
+		return len(t.text), len(t.text)
+	}
+
+	boundaries := t.clusterBoundaries()
+	i := sort.SearchInts(boundaries, int(cluster)+1) // first boundary after the cluster
+	start, end := 0, len(t.text)
+	if 0 < i {
+		start = boundaries[i-1]
+	}
+	if i < len(boundaries) {
+		end = boundaries[i]
+	}
+	return start, end
+}
+
+// clusterBoundaries returns the sorted byte offsets into the text at which glyph clusters start, which are the clusters of the glyphs and the whitespace at line breaks that has no glyphs. They are computed once so that looking up a cluster is a binary search.
+func (t *Text) clusterBoundaries() []int {
+	if t.boundaries != nil {
+		return t.boundaries
+	}
+
+	boundaries := []int{}
+	for _, line := range t.lines {
+		for _, span := range line.spans {
+			for _, glyph := range span.Glyphs {
+				boundaries = append(boundaries, int(glyph.Cluster))
+			}
+		}
+	}
+
+	// whitespace at line breaks has no glyphs
+	for i, r := range t.text {
+		if unicode.IsSpace(r) {
+			boundaries = append(boundaries, i, i+utf8.RuneLen(r))
+		}
+	}
+	sort.Ints(boundaries)
+
+	n := 0
+	for i, boundary := range boundaries {
+		if i == 0 || boundaries[n-1] != boundary {
+			boundaries[n] = boundary
+			n++
+		}
+	}
+	t.boundaries = boundaries[:n]
+	return t.boundaries
+}
+
+// lineAt returns the index of the line whose vertical extent contains y, or the closest line. It returns -1 if there are no lines.
+func (t *Text) lineAt(y float64) int {
+	closest, dist := -1, math.Inf(1)
+	for j, line := range t.lines {
+		_, ascent, descent, _ := line.Heights(t.WritingMode)
+		top, bottom := -line.y+ascent, -line.y-descent
+		if bottom <= y && y <= top {
+			return j
+		} else if d := math.Min(math.Abs(y-top), math.Abs(y-bottom)); d < dist {
+			closest, dist = j, d
+		}
+	}
+	return closest
+}
+
+// spanCarets returns the x-coordinates of the caret positions of the span in logical order and their byte offsets into the text, that is before each glyph cluster and after the last. The end of the last cluster is found in the cluster boundaries that are shared by all spans, so that hit testing takes time proportional to the glyphs of a line rather than to the whole text.
+func (t *Text) spanCarets(span TextSpan) ([]float64, []int) {
+	positions := span.GlyphPositions()
+	n := len(span.Glyphs)
+	if len(positions) != n+1 {
+		return nil, nil
+	}
+
+	xs := make([]float64, 0, n+1)
+	offsets := make([]int, 0, n+1)
+	rtl := span.Direction == canvasText.RightToLeft || span.Direction == canvasText.BottomToTop
+	for k := 0; k < n; k++ {
+		glyph := span.Glyphs[k]
+		if rtl {
+			glyph = span.Glyphs[n-1-k]
+		}
+		if 0 < k && int(glyph.Cluster) == offsets[len(offsets)-1] {
+			continue // multiple glyphs of the same cluster
+		}
+		xs = append(xs, span.X+positions[k])
+		offsets = append(offsets, int(glyph.Cluster))
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	_, end := t.ClusterToByteRange(uint32(offsets[len(offsets)-1]))
+	xs = append(xs, span.X+positions[n])
+	offsets = append(offsets, end)
+	return xs, offsets
+}
+
+// spanRange returns the start and end byte offsets into the text of the glyph clusters of the span.
+func (t *Text) spanRange(span TextSpan) (int, int) {
+	if len(span.Glyphs) == 0 {
+		return 0, 0
+	}
+	first, last := span.Glyphs[0].Cluster, span.Glyphs[0].Cluster
+	for _, glyph := range span.Glyphs[1:] {
+		if glyph.Cluster < first {
+			first = glyph.Cluster
+		} else if last < glyph.Cluster {
+			last = glyph.Cluster
+		}
+	}
+	_, end := t.ClusterToByteRange(last)
+	return int(first), end
+}
+
+// SelectionRects returns the rectangles that cover the text between the byte offsets start and end, with one rectangle per contiguous range of selected glyphs on each line spanning the line's ascent and descent. Bidirectional text may thus result in multiple rectangles per line. Filling the rectangles before drawing the text highlights it like a marker, such as for selections or search results. Only horizontal writing modes are supported.
+func (t *Text) SelectionRects(start, end int) []Rect {
+	if end < start {
+		start, end = end, start
+	}
+
+	rects := []Rect{}
+	for _, line := range t.lines {
+		var ranges [][2]float64
+		for _, span := range line.spans {
+			if a, b := t.spanRange(span); b <= start || end <= a {
+				continue // only compute the carets of selected spans
+			}
+			xs, offsets := t.spanCarets(span)
+			for i := 0; i+1 < len(xs); i++ {
+				if start <= offsets[i] && offsets[i] < end {
+					ranges = append(ranges, [2]float64{math.Min(xs[i], xs[i+1]), math.Max(xs[i], xs[i+1])})
+				}
+			}
+		}
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+		_, ascent, descent, _ := line.Heights(t.WritingMode)
+		for i := 0; i < len(ranges); i++ {
+			x0, x1 := ranges[i][0], ranges[i][1]
+			for i+1 < len(ranges) && ranges[i+1][0] <= x1+Epsilon {
+				x1 = math.Max(x1, ranges[i+1][1])
+				i++
+			}
+			rects = append(rects, Rect{x0, -line.y - descent, x1 - x0, ascent + descent})
+		}
+	}
+	return rects
+}
+
+// CursorAt returns the index of the line and the position on its baseline of the caret at the given byte offset into the text, such as for drawing a caret. Offsets inside a glyph cluster snap to the start of the cluster, which is at its right edge for right-to-left spans. It returns false if the offset is past the end of the text. Only horizontal writing modes are supported.
+func (t *Text) CursorAt(offset int) (int, float64, float64, bool) {
+	if offset < 0 || len(t.text) < offset {
+		return 0, 0.0, 0.0, false
+	}
+
+	// lines are in logical order, so the caret is on the last line that starts at or before the offset
+	index := -1
+	for j, line := range t.lines {
+		start := -1
+		for _, span := range line.spans {
+			if a, b := t.spanRange(span); a < b && (start == -1 || a < start) {
+				start = a
+			}
+		}
+		if offset < start {
+			break
+		} else if start != -1 {
+			index = j
+		}
+	}
+	if index == -1 {
+		return 0, 0.0, 0.0, false
+	}
+
+	// find the caret of the cluster that contains the offset, preferring the start of a cluster over the end of a span
+	x, y := 0.0, -t.lines[index].y
+	found, foundOffset, foundEnd := false, 0, false
+	for _, span := range t.lines[index].spans {
+		xs, offsets := t.spanCarets(span)
+		for i, caret := range offsets {
+			end := i+1 == len(offsets)
+			if offset < caret || found && (caret < foundOffset || caret == foundOffset && (end || !foundEnd)) {
+				continue
+			}
+			x = xs[i]
+			found, foundOffset, foundEnd = true, caret, end
+		}
+	}
+	if !found {
+		return 0, 0.0, 0.0, false
+	}
+	return index, x, y, true
+}
+
+// IndexAt returns the byte offset into the text of the caret position closest to the point, such as for placing the caret at a click. The line is the one whose ascent and descent contain y, and points above the first line or below the last line select the closest line. The caret positions of right-to-left spans are mirrored, so that clicking on the right half of a glyph places the caret before it. It returns false if the text has no lines. Only horizontal writing modes are supported.
+func (t *Text) IndexAt(x, y float64) (int, bool) {
+	j := t.lineAt(y)
+	if j < 0 {
+		return 0, false
+	}
+
+	offset, dist := 0, math.Inf(1)
+	for _, span := range t.lines[j].spans {
+		xs, offsets := t.spanCarets(span)
+		for i, caret := range xs {
+			if d := math.Abs(x - caret); d < dist {
+				offset, dist = offsets[i], d
+			}
+		}
+	}
+	return offset, true
+}
+
+// WordBounds returns the start and end byte offsets into the logical text of the word that contains the given cluster, following the word boundaries of UAX#29. If the cluster is at whitespace or punctuation, the bounds of that segment are returned instead. This can be used to select a word on double-click.
+func (t *Text) WordBounds(cluster int) (int, int) {
+	return canvasText.WordBounds(t.text, cluster)
+}
+
+// GraphemeBounds returns the start and end byte offsets into the logical text of the grapheme cluster (user-perceived character) that contains the given cluster. This can be used to move a caret by one character.
+func (t *Text) GraphemeBounds(cluster int) (int, int) {
+	return canvasText.GraphemeBounds(t.text, cluster)
+}
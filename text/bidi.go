@@ -0,0 +1,113 @@
+package text
+
+import (
+	"math"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// Paragraph is a paragraph of text with its base direction. Start and end are byte offsets, where the end includes the paragraph separator.
+type Paragraph struct {
+	Start, End int
+	Direction  Direction
+}
+
+// Paragraphs splits a string into paragraphs at paragraph separators such as newlines (rule P1 of UAX#9). The base direction of each paragraph is the given direction if it is LeftToRight or RightToLeft, otherwise it is detected by ParagraphDirection using the fallback direction.
+func Paragraphs(s string, direction, fallback Direction) []Paragraph {
+	paragraphs := []Paragraph{}
+	start := 0
+	for i := 0; i < len(s); {
+		props, n := bidi.LookupString(s[i:])
+		if n == 0 {
+			n = 1
+		}
+		i += n
+		if props.Class() == bidi.B && !(s[i-n] == '\r' && i < len(s) && s[i] == '\n') {
+			paragraphs = append(paragraphs, Paragraph{start, i, DirectionInvalid})
+			start = i
+		}
+	}
+	if start < len(s) {
+		paragraphs = append(paragraphs, Paragraph{start, len(s), DirectionInvalid})
+	}
+
+	for i, paragraph := range paragraphs {
+		if direction == LeftToRight || direction == RightToLeft {
+			paragraphs[i].Direction = direction
+		} else {
+			paragraphs[i].Direction = ParagraphDirection(s[paragraph.Start:paragraph.End], fallback)
+		}
+	}
+	return paragraphs
+}
+
+// ParagraphDirection returns the direction of the first strong directional character of a paragraph while skipping characters inside isolates, or the fallback direction if there is none (rules P2 and P3 of UAX#9).
+func ParagraphDirection(s string, fallback Direction) Direction {
+	isolates := 0
+	for i := 0; i < len(s); {
+		props, n := bidi.LookupString(s[i:])
+		if n == 0 {
+			n = 1
+		}
+		i += n
+
+		switch props.Class() {
+		case bidi.LRI, bidi.RLI, bidi.FSI:
+			isolates++
+		case bidi.PDI:
+			if 0 < isolates {
+				isolates--
+			}
+		case bidi.L:
+			if isolates == 0 {
+				return LeftToRight
+			}
+		case bidi.R, bidi.AL:
+			if isolates == 0 {
+				return RightToLeft
+			}
+		case bidi.B:
+			return fallback
+		}
+	}
+	return fallback
+}
+
+// BidiLevels returns the resolved embedding levels for each rune of a paragraph with the given base direction, which is detected from the text if it is not LeftToRight or RightToLeft, and the visual-to-logical index map of the runes as returned by VisualOrder. This allows callers to reorder their own runs consistently with the text layout. The paragraph is reordered as a single line.
+func BidiLevels(str []rune, direction Direction) ([]int, []int) {
+	if len(str) == 0 {
+		return []int{}, []int{}
+	}
+	levels := ParagraphEmbeddingLevels(str, direction)
+	return levels, VisualOrder(levels)
+}
+
+// VisualOrder returns the visual-to-logical index map for the embedding levels of a line, so that the i-th character from the left has index order[i] in logical order. From the highest level down to the lowest odd level, every run of characters at that level or higher is reversed (rule L2 of UAX#9).
+func VisualOrder(levels []int) []int {
+	order := make([]int, len(levels))
+	maxLevel, minOddLevel := 0, math.MaxInt32
+	for i, level := range levels {
+		order[i] = i
+		if maxLevel < level {
+			maxLevel = level
+		}
+		if level%2 == 1 && level < minOddLevel {
+			minOddLevel = level
+		}
+	}
+	for level := maxLevel; minOddLevel <= level; level-- {
+		for a := 0; a < len(order); a++ {
+			if level <= levels[order[a]] {
+				b := a + 1
+				for b < len(order) && level <= levels[order[b]] {
+					b++
+				}
+				for i, j := a, b-1; i < j; i, j = i+1, j-1 {
+					order[i], order[j] = order[j], order[i]
+				}
+				a = b
+			}
+		}
+	}
+	return order
+}
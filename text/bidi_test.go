@@ -0,0 +1,66 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/tdewolff/test"
+)
+
+func TestParagraphDirection(t *testing.T) {
+	var tts = []struct {
+		s         string
+		direction Direction
+	}{
+		{"", RightToLeft},                               // fallback
+		{"123 ...", RightToLeft},                        // neutrals only
+		{"abc", LeftToRight},                            // Latin letter
+		{"مرحبا hello", RightToLeft},                    // Arabic letter
+		{"(1) שלום", RightToLeft},                       // Hebrew after neutrals
+		{"\u2067abc\u2069 שלום", RightToLeft},           // skip isolate
+		{"\u2067abc", RightToLeft},                      // unterminated isolate
+		{"123\nabc", RightToLeft},                       // paragraph separator
+		{"\u202Babc", LeftToRight},                      // embeddings are not skipped
+		{"\u2066\u2067abc\u2069def\u2069", RightToLeft}, // nested isolates
+	}
+	for _, tt := range tts {
+		t.Run(tt.s, func(t *testing.T) {
+			test.T(t, ParagraphDirection(tt.s, RightToLeft), tt.direction)
+		})
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	test.T(t, Paragraphs("", DirectionInvalid, LeftToRight), []Paragraph{})
+	test.T(t, Paragraphs("abc\nשלום\r\n123", DirectionInvalid, RightToLeft), []Paragraph{
+		{0, 4, LeftToRight},
+		{4, 14, RightToLeft},
+		{14, 17, RightToLeft},
+	})
+	test.T(t, Paragraphs("abc\u2029שלום", LeftToRight, RightToLeft), []Paragraph{ // paragraph separator
+		{0, 6, LeftToRight},
+		{6, 14, LeftToRight},
+	})
+}
+
+func TestBidiLevels(t *testing.T) {
+	var tts = []struct {
+		s         string
+		direction Direction
+		levels    []int
+		order     []int
+	}{
+		{"", LeftToRight, []int{}, []int{}},
+		{"abc", DirectionInvalid, []int{0, 0, 0}, []int{0, 1, 2}},
+		{"אבג", DirectionInvalid, []int{1, 1, 1}, []int{2, 1, 0}},
+		{"ab אב 12", LeftToRight, []int{0, 0, 0, 1, 1, 1, 2, 2}, []int{0, 1, 2, 6, 7, 5, 4, 3}},
+		{"ab אב 12", RightToLeft, []int{2, 2, 1, 1, 1, 1, 2, 2}, []int{6, 7, 5, 4, 3, 2, 0, 1}},
+		{"אב ab.", RightToLeft, []int{1, 1, 1, 2, 2, 1}, []int{5, 3, 4, 2, 1, 0}},
+	}
+	for _, tt := range tts {
+		t.Run(tt.s, func(t *testing.T) {
+			levels, order := BidiLevels([]rune(tt.s), tt.direction)
+			test.T(t, levels, tt.levels)
+			test.T(t, order, tt.order)
+		})
+	}
+}
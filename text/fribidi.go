@@ -8,7 +8,17 @@ import (
 
 // EmbeddingLevels returns the embedding levels for each rune of a mixed LTR/RTL string. A change in level means a change in direction.
 func EmbeddingLevels(str []rune) []int {
+	return ParagraphEmbeddingLevels(str, DirectionInvalid)
+}
+
+// ParagraphEmbeddingLevels returns the embedding levels for each rune of a paragraph with the given base direction, which is detected from the text if it is not LeftToRight or RightToLeft.
+func ParagraphEmbeddingLevels(str []rune, direction Direction) []int {
 	pbase := fribidi.CharType(fribidi.ON)
+	if direction == LeftToRight {
+		pbase = fribidi.LTR
+	} else if direction == RightToLeft {
+		pbase = fribidi.RTL
+	}
 	vis, _ := fribidi.LogicalToVisual(fribidi.DefaultFlags, str, &pbase)
 
 	levels := make([]int, len(str))
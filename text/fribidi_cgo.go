@@ -14,7 +14,17 @@ import (
 
 // EmbeddingLevels returns the embedding levels for each rune of a mixed LTR/RTL string. A change in level means a change in direction.
 func EmbeddingLevels(str []rune) []int {
+	return ParagraphEmbeddingLevels(str, DirectionInvalid)
+}
+
+// ParagraphEmbeddingLevels returns the embedding levels for each rune of a paragraph with the given base direction, which is detected from the text if it is not LeftToRight or RightToLeft.
+func ParagraphEmbeddingLevels(str []rune, direction Direction) []int {
 	pbaseDir := C.FriBidiParType(C.FRIBIDI_PAR_ON) // neutral direction
+	if direction == LeftToRight {
+		pbaseDir = C.FRIBIDI_PAR_LTR
+	} else if direction == RightToLeft {
+		pbaseDir = C.FRIBIDI_PAR_RTL
+	}
 	bidiTypes := make([]C.FriBidiCharType, len(str))
 	bracketTypes := make([]C.FriBidiBracketType, len(str))
 	embeddingLevels := make([]C.FriBidiLevel, len(str))
@@ -4,6 +4,7 @@ package text
 
 import (
 	"bytes"
+	"strings"
 
 	"github.com/go-text/typesetting/harfbuzz"
 	"github.com/go-text/typesetting/language"
@@ -77,7 +78,14 @@ func (s Shaper) Shape(text string, ppem uint16, direction Direction, script Scri
 	buf.Props.Script = language.Script(script)
 	buf.Props.Direction = harfbuzz.Direction(direction)
 	buf.GuessSegmentProperties() // only sets direction, script, and language if unset
-	buf.Shape(s.font, nil)
+
+	var hbFeatures []harfbuzz.Feature
+	for _, feature := range strings.Split(features, ",") {
+		if hbFeature, err := harfbuzz.ParseFeature(strings.TrimSpace(feature)); err == nil {
+			hbFeatures = append(hbFeatures, hbFeature)
+		}
+	}
+	buf.Shape(s.font, hbFeatures)
 
 	runeMap := make([]int, len(rtext)+1)
 	j := 0
@@ -0,0 +1,176 @@
+package text
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// HyphenationMinWord is the minimum number of letters of a word to be hyphenated.
+var HyphenationMinWord = 5
+
+// HyphenationMinLeft is the minimum number of letters before a hyphen.
+var HyphenationMinLeft = 2
+
+// HyphenationMinRight is the minimum number of letters after a hyphen.
+var HyphenationMinRight = 3
+
+// Hyphenator finds the hyphenation opportunities of words using Frank M. Liang's algorithm with TeX hyphenation patterns. See Frank M. Liang, "Word Hy-phen-a-tion by Com-put-er", 1983.
+type Hyphenator struct {
+	patterns   map[string][]uint8 // values between the letters of each pattern
+	maxLen     int                // maximum number of letters of a pattern
+	exceptions map[string][]int   // hyphen positions by word
+}
+
+// NewHyphenator returns a hyphenator for the given patterns and exceptions in TeX format, separated by whitespace. Patterns contain digits between their letters where odd digits allow and even digits disallow hyphenation, and a period marks the start or end of a word, such as ".ach4" and "a1b". Exceptions are hyphenated words that take precedence over the patterns, such as "ta-ble".
+func NewHyphenator(patterns, exceptions string) *Hyphenator {
+	h := &Hyphenator{
+		patterns:   map[string][]uint8{},
+		exceptions: map[string][]int{},
+	}
+	for _, pattern := range strings.Fields(patterns) {
+		letters := []rune{}
+		values := []uint8{0}
+		for _, r := range pattern {
+			if '0' <= r && r <= '9' {
+				values[len(values)-1] = uint8(r - '0')
+			} else {
+				letters = append(letters, r)
+				values = append(values, 0)
+			}
+		}
+		h.patterns[string(letters)] = values
+		if h.maxLen < len(letters) {
+			h.maxLen = len(letters)
+		}
+	}
+	for _, exception := range strings.Fields(exceptions) {
+		positions := []int{}
+		n := 0
+		for _, r := range exception {
+			if r == '-' {
+				positions = append(positions, n)
+			} else {
+				n++
+			}
+		}
+		h.exceptions[strings.ReplaceAll(exception, "-", "")] = positions
+	}
+	return h
+}
+
+var hyphenators = struct {
+	sync.Mutex
+	m map[string]*Hyphenator
+}{m: map[string]*Hyphenator{}}
+
+// LoadHyphenator returns the hyphenator for the given language as a BCP 47 tag, such as "en-US" or "de". It supports English and German, where English uses the American English patterns and German the patterns for the reformed orthography. It returns false if the language is not supported.
+func LoadHyphenator(lang string) (*Hyphenator, bool) {
+	lang = strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+	if i := strings.IndexByte(lang, '-'); i != -1 {
+		lang = lang[:i]
+	}
+
+	hyphenators.Lock()
+	defer hyphenators.Unlock()
+	if h, ok := hyphenators.m[lang]; ok {
+		return h, true
+	}
+	var h *Hyphenator
+	switch lang {
+	case "en":
+		h = NewHyphenator(hyphenationPatternsEnUS, hyphenationExceptionsEnUS)
+	case "de":
+		h = NewHyphenator(hyphenationPatternsDE, "")
+	default:
+		return nil, false
+	}
+	hyphenators.m[lang] = h
+	return h, true
+}
+
+// Hyphenate returns the rune indices of the word before which it may be hyphenated. Words shorter than HyphenationMinWord are not hyphenated, and hyphens are at least HyphenationMinLeft and HyphenationMinRight letters from the start and end of the word respectively.
+func (h *Hyphenator) Hyphenate(word string) []int {
+	n := utf8.RuneCountInString(word)
+	if n < HyphenationMinWord {
+		return nil
+	}
+	letters := make([]rune, 0, n+2)
+	letters = append(letters, '.')
+	for _, r := range word {
+		letters = append(letters, unicode.ToLower(r))
+	}
+	letters = append(letters, '.')
+	if positions, ok := h.exceptions[string(letters[1:n+1])]; ok {
+		return hyphenationRange(positions, n)
+	}
+
+	// find the maximum values between the letters of all matching patterns
+	values := make([]uint8, len(letters)+1)
+	for i := range letters {
+		for j := i + 1; j <= len(letters) && j-i <= h.maxLen; j++ {
+			if pattern, ok := h.patterns[string(letters[i:j])]; ok {
+				for k, value := range pattern {
+					if values[i+k] < value {
+						values[i+k] = value
+					}
+				}
+			}
+		}
+	}
+
+	positions := []int{}
+	for i := 1; i < n; i++ {
+		if values[i+1]%2 == 1 {
+			positions = append(positions, i)
+		}
+	}
+	return hyphenationRange(positions, n)
+}
+
+// hyphenationRange removes the hyphen positions that are too close to the start or end of a word with n letters.
+func hyphenationRange(positions []int, n int) []int {
+	kept := []int{}
+	for _, i := range positions {
+		if HyphenationMinLeft <= i && i <= n-HyphenationMinRight {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// HyphenateText returns the byte offsets into the text where a soft hyphen (U+00AD) may be inserted. Words are sequences of letters and are hyphenated separately at explicit hyphens and other punctuation. Words that contain a soft hyphen, word joiner (U+2060), or zero width no-break space (U+FEFF) are not hyphenated, as they are already hyphenated or must not be broken.
+func (h *Hyphenator) HyphenateText(s string) []int {
+	offsets := []int{}
+	start := -1
+	for i := 0; i <= len(s); {
+		r, size := rune(0), 0
+		if i < len(s) {
+			r, size = utf8.DecodeRuneInString(s[i:])
+		}
+		inWord := unicode.IsLetter(r) || unicode.Is(unicode.Mn, r) || r == '\u00AD' || r == '\u2060' || r == '\uFEFF'
+		if inWord && start == -1 {
+			start = i
+		} else if !inWord && start != -1 {
+			word := s[start:i]
+			if !strings.ContainsAny(word, "\u00AD\u2060\uFEFF") {
+				positions := h.Hyphenate(word)
+				n, k := 0, 0
+				for j := range word {
+					if k < len(positions) && positions[k] == n {
+						offsets = append(offsets, start+j)
+						k++
+					}
+					n++
+				}
+			}
+			start = -1
+		}
+		if i == len(s) {
+			break
+		}
+		i += size
+	}
+	return offsets
+}
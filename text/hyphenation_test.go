@@ -0,0 +1,76 @@
+package text
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tdewolff/test"
+)
+
+func hyphenate(h *Hyphenator, word string) string {
+	sb := strings.Builder{}
+	positions := h.Hyphenate(word)
+	for i, r := range []rune(word) {
+		if 0 < len(positions) && positions[0] == i {
+			sb.WriteByte('-')
+			positions = positions[1:]
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func TestHyphenate(t *testing.T) {
+	en, ok := LoadHyphenator("en-US")
+	test.That(t, ok)
+	de, ok := LoadHyphenator("de_DE")
+	test.That(t, ok)
+	_, ok = LoadHyphenator("xx")
+	test.That(t, !ok)
+
+	var tests = []struct {
+		h        *Hyphenator
+		word     string
+		expected string
+	}{
+		{en, "hyphenation", "hy-phen-ation"},
+		{en, "Programming", "Pro-gram-ming"},
+		{en, "typesetting", "type-set-ting"},
+		{en, "table", "ta-ble"},          // exception
+		{en, "associate", "as-so-ciate"}, // exception
+		{en, "and", "and"},               // too short
+		{de, "Silbentrennung", "Sil-ben-tren-nung"},
+		{de, "Donaudampfschifffahrt", "Do-nau-dampf-schiff-fahrt"},
+		{de, "Übergrößen", "Über-grö-ßen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			test.T(t, hyphenate(tt.h, tt.word), tt.expected)
+		})
+	}
+}
+
+func TestHyphenateText(t *testing.T) {
+	en, _ := LoadHyphenator("en")
+
+	var tests = []struct {
+		text     string
+		expected string
+	}{
+		{"hyphenation", "hy|phen|ation"},
+		{"the typesetting of text", "the type|set|ting of text"},
+		{"computer-typesetting", "com|puter-type|set|ting"}, // explicit hyphen
+		{"hyphen\u2060ation", "hyphen\u2060ation"},          // word joiner
+		{"hy\u00ADphenation", "hy\u00ADphenation"},          // already hyphenated
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			s := tt.text
+			offsets := en.HyphenateText(s)
+			for i := len(offsets) - 1; 0 <= i; i-- {
+				s = s[:offsets[i]] + "|" + s[offsets[i]:]
+			}
+			test.T(t, s, tt.expected)
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"math"
 	"unicode"
 
+	"github.com/go-text/typesetting/segmenter"
+	"github.com/go-text/typesetting/unicodedata"
 	"github.com/tdewolff/canvas/font"
 )
 
@@ -44,6 +46,9 @@ import (
 //   \u3000 IDEOGRAPHIC SPACE - breakpoint space
 //   \uFEFF ZERO WIDTH NO-BREAK SPACE - no breakpoint
 //
+// Other break opportunities follow the line breaking classes of Unicode Standard Annex #14, "Unicode Line Breaking Algorithm", https://www.unicode.org/reports/tr14/
+// such as between CJK characters, after em dashes and slashes, and not before closing brackets or after opening brackets, even when separated by spaces.
+//
 // When to use what?
 //   Start a new line: \n
 //   Space that doesn't break: \u00A0
@@ -71,6 +76,12 @@ var (
 	CommaFactor     = 1.25
 )
 
+// Kinsoku enables strict kinsoku shori (line breaking rules) for Japanese, which additionally disallows lines to start with small kana or the prolonged sound mark. Closing brackets and punctuation such as 、 and 。 never start a line, and opening brackets never end a line, regardless.
+var Kinsoku = true
+
+// PunctuationShrink is the shrinkability of full-width CJK brackets and punctuation as a fraction of their advance for justified text. Their glyphs are mostly blank on one side, which may be compressed to fit a line, such as for paired brackets. Glyphs whose advance was already narrowed, such as by the palt or vpal features, are not compressed.
+var PunctuationShrink = 0.5
+
 // Tolerance is the maximum stretchability of the spaces of a line.
 var Tolerance = 2.0
 
@@ -182,6 +193,8 @@ type Breakpoint struct {
 	W, Y, Z  float64
 	Ratio    float64
 	Demerits float64
+
+	fills int // number of glues with infinite stretch
 }
 
 func (br *Breakpoint) String() string {
@@ -269,6 +282,7 @@ type linebreaker struct {
 	activeNodes   *Breakpoints
 	inactiveNodes *Breakpoints
 	W, Y, Z       float64
+	fills         int // number of glues with infinite stretch, which are not added to Y
 	width         float64
 	nextTolerance float64
 }
@@ -293,7 +307,9 @@ func (lb *linebreaker) computeAdjustmentRatio(b int, active *Breakpoint) float64
 	}
 	ratio := 0.0
 	if L < lb.width {
-		if lb.Y-active.Y == 0.0 {
+		if active.fills < lb.fills {
+			return 0.0 // infinitely stretchable, such as the last line of a paragraph
+		} else if lb.Y-active.Y == 0.0 {
 			// no stretching allowed, add artificial space to distinguish unstretchable lines
 			// this helps with left/center/right aligned text
 			// this promotes putting as many glyphs (CJK) as possible on a line
@@ -309,21 +325,25 @@ func (lb *linebreaker) computeAdjustmentRatio(b int, active *Breakpoint) float64
 	return math.Min(ratio, Infinity) // range [-inf,1000]
 }
 
-func (lb *linebreaker) computeSum(b int) (float64, float64, float64) {
+func (lb *linebreaker) computeSum(b int) (float64, float64, float64, int) {
 	// compute tw=(sum w)after(b), ty=(sum y)after(b), and tz=(sum z)after(b)
 	// count all glues after the proposed break at b until a box, compulsory break, or explicit space
 	// these glues are eaten up by the proposed break and should be taken into account
-	W, Y, Z := lb.W, lb.Y, lb.Z
+	W, Y, Z, fills := lb.W, lb.Y, lb.Z, lb.fills
 	for i, item := range lb.items[b:] {
 		if item.Type == BoxType || (item.Type == PenaltyType && item.Penalty <= -Infinity && 0 < i) {
 			break
 		} else if item.Type == GlueType {
 			W += item.Width
-			Y += item.Stretch
+			if math.IsInf(item.Stretch, 1.0) {
+				fills++
+			} else {
+				Y += item.Stretch
+			}
 			Z += item.Shrink
 		}
 	}
-	return W, Y, Z
+	return W, Y, Z, fills
 }
 
 func (lb *linebreaker) mainLoop(b int, tolerance float64) {
@@ -400,7 +420,7 @@ func (lb *linebreaker) mainLoop(b int, tolerance float64) {
 
 		if Dmin < math.Inf(1.0) {
 			// insert new active node for break from A[c] to the current item
-			W, Y, Z := lb.computeSum(b)
+			W, Y, Z, fills := lb.computeSum(b)
 			width := lb.W
 			if lb.items[b].Type == PenaltyType {
 				width += lb.items[b].Width
@@ -418,6 +438,7 @@ func (lb *linebreaker) mainLoop(b int, tolerance float64) {
 						Z:        Z,
 						Ratio:    R[c],
 						Demerits: D[c],
+						fills:    fills,
 					}
 					if active == nil {
 						lb.activeNodes.Push(breakpoint)
@@ -432,8 +453,16 @@ func (lb *linebreaker) mainLoop(b int, tolerance float64) {
 
 // Linebreak breaks a list of items using Donald Knuth's line breaking algorithm. See Donald E. Knuth and Michael F. Plass, "Breaking Paragraphs into Lines", 1981
 func Linebreak(items []Item, width float64, looseness int) ([]*Breakpoint, bool) {
+	return LinebreakWithTolerance(items, width, Tolerance, looseness)
+}
+
+// LinebreakWithTolerance is like Linebreak but with the given tolerance instead of Tolerance, which is the maximum adjustment ratio of the spaces of a line. A larger tolerance allows looser lines and thus fewer overfull lines, a negative tolerance is taken as zero.
+func LinebreakWithTolerance(items []Item, width, maxRatio float64, looseness int) ([]*Breakpoint, bool) {
+	if !(0.0 <= maxRatio) {
+		maxRatio = 0.0
+	}
 	overflows := false
-	tolerance := Tolerance
+	tolerance := maxRatio
 
 START:
 	// create an active node representing the beginning of the paragraph
@@ -448,7 +477,11 @@ START:
 				lb.mainLoop(b, tolerance)
 			}
 			lb.W += item.Width
-			lb.Y += item.Stretch
+			if math.IsInf(item.Stretch, 1.0) {
+				lb.fills++
+			} else {
+				lb.Y += item.Stretch
+			}
 			lb.Z += item.Shrink
 		} else if item.Type == PenaltyType && item.Penalty < Infinity {
 			lb.mainLoop(b, tolerance)
@@ -479,6 +512,7 @@ START:
 							Z:        lb.Z,
 							Ratio:    0.0,
 							Demerits: parent.Demerits + 1000.0,
+							fills:    lb.fills,
 						}
 						lb.activeNodes.Push(breakpoint)
 					}
@@ -523,7 +557,7 @@ START:
 		if b.Line+1 < len(breaks) {
 			breaks[b.Line+1].Width -= b.W
 		}
-		if b.Ratio < -1.0 || Tolerance < b.Ratio {
+		if b.Ratio < -1.0 || maxRatio < b.Ratio {
 			b.Ratio = 0.0
 		}
 		breaks[b.Line] = b
@@ -556,8 +590,84 @@ func IsNewline(r rune) bool {
 	return false
 }
 
-// GlyphsToItems converts a slice of glyphs into the box/glue/penalty items model as used by Knuth's line breaking algorithm. The SFNT and Size of each glyph must be set. Indent and align specify the indentation width of the first line and the alignment (left, right, centered, justified) of the lines respectively.
+// lineBreakOpportunities returns for each glyph whether a line may break before it, following the line breaking classes of UAX#14. The clusters of the glyphs are byte offsets into the source text, or if the text is empty the source is formed by the text of the glyphs instead. Lines only break between glyph clusters. All spaces are regarded as regular spaces and path/image objects as object replacement characters. UAX#14 requires a dictionary to break South East Asian scripts such as Thai, Lao, Khmer, Myanmar, and Tibetan, so instead a line may break between any of their clusters.
+func lineBreakOpportunities(glyphs []Glyph, text string) []bool {
+	// runes of the source and the index into runes for each glyph
+	var runes []rune
+	indices := make([]int, len(glyphs))
+	if text == "" || len(glyphs) == 0 {
+		runes = make([]rune, len(glyphs))
+		for i, glyph := range glyphs {
+			runes[i] = glyph.Text
+			indices[i] = i
+		}
+	} else {
+		lo, hi := len(text), len(text)
+		for _, glyph := range glyphs {
+			if int(glyph.Cluster) < lo {
+				lo = int(glyph.Cluster)
+			}
+		}
+		offsets := make([]int, hi-lo+1) // rune index for each byte offset
+		for k, r := range text[lo:hi] {
+			offsets[k] = len(runes)
+			runes = append(runes, r)
+		}
+		for i, glyph := range glyphs {
+			indices[i] = offsets[int(glyph.Cluster)-lo]
+		}
+	}
+	for i, glyph := range glyphs {
+		if IsSpace(glyph.Text) {
+			runes[indices[i]] = ' '
+		} else if glyph.Text == 0 {
+			runes[indices[i]] = '\uFFFC'
+		}
+	}
+
+	opportunities := make([]bool, len(runes)+1)
+	var seg segmenter.Segmenter
+	seg.Init(runes)
+	iter := seg.LineIterator()
+	for iter.Next() {
+		line := iter.Line()
+		opportunities[line.Offset+len(line.Text)] = true
+	}
+
+	breaks := make([]bool, len(glyphs)+1)
+	breaks[len(glyphs)] = true
+	for i := range glyphs {
+		if 0 < i && indices[i] == indices[i-1] {
+			continue // same cluster
+		}
+		r := runes[indices[i]]
+		breaks[i] = opportunities[indices[i]]
+		if !breaks[i] && 0 < i && unicode.Is(unicodedata.BreakSA, r) && !unicode.Is(unicode.Mn, r) && unicode.Is(unicodedata.BreakSA, runes[indices[i-1]]) {
+			breaks[i] = true
+		} else if Kinsoku && unicode.Is(unicodedata.BreakCJ, r) {
+			breaks[i] = false
+		}
+	}
+	return breaks
+}
+
+// isFullWidthOpening returns true for full-width opening brackets, which are blank on their leading side.
+func isFullWidthOpening(r rune) bool {
+	return unicode.Is(unicodedata.LargeEastAsian, r) && unicode.Is(unicodedata.BreakOP, r)
+}
+
+// isFullWidthClosing returns true for full-width closing brackets and punctuation such as \u3001 and \u3002, which are blank on their trailing side.
+func isFullWidthClosing(r rune) bool {
+	return unicode.Is(unicodedata.LargeEastAsian, r) && (unicode.Is(unicodedata.BreakCL, r) || unicode.Is(unicodedata.BreakCP, r))
+}
+
+// GlyphsToItems converts a slice of glyphs into the box/glue/penalty items model as used by Knuth's line breaking algorithm. The SFNT and Size of each glyph must be set. Indent and align specify the indentation width of the first line and the alignment (left, right, centered, justified) of the lines respectively. Line break opportunities are found in the text of the glyphs, see GlyphsToItemsWithText to use the source text instead.
 func GlyphsToItems(glyphs []Glyph, indent float64, align Align) []Item {
+	return GlyphsToItemsWithText(glyphs, "", indent, align)
+}
+
+// GlyphsToItemsWithText is like GlyphsToItems, but finds the line break opportunities of UAX#14 in the source text, where the clusters of the glyphs are byte offsets into text. This is more accurate when glyphs represent several characters, such as ligatures. The text may end after the last glyph cluster, but is then segmented as well.
+func GlyphsToItemsWithText(glyphs []Glyph, text string, indent float64, align Align) []Item {
 	if len(glyphs) == 0 {
 		return []Item{}
 	}
@@ -567,12 +677,14 @@ func GlyphsToItems(glyphs []Glyph, indent float64, align Align) []Item {
 	if align != Justified {
 		n := 0.0
 		for _, glyph := range glyphs {
-			if IsSpace(glyph.Text) {
+			if IsSpace(glyph.Text) && glyph.Text != '\t' {
 				stretchWidth += glyph.Advance()
 				n += 1.0
 			}
 		}
-		stretchWidth /= n
+		if n != 0.0 {
+			stretchWidth /= n
+		}
 	}
 
 	// trim spaces from start and end
@@ -607,9 +719,23 @@ func GlyphsToItems(glyphs []Glyph, indent float64, align Align) []Item {
 	if align == Centered {
 		items = append(items, Glue(0.0, stretchWidth, 0.0))
 	}
+	breaks := lineBreakOpportunities(glyphs, text)
 	for i := first; i < last; i++ {
 		glyph := glyphs[i]
 		if IsSpace(glyph.Text) {
+			// spaces are breakpoints unless UAX#14 disallows a break after them, such as before a closing bracket
+			j := i + 1
+			for j < len(glyphs) && IsSpace(glyphs[j].Text) {
+				j++
+			}
+			spacePenalty := 0.0
+			if !breaks[j] {
+				spacePenalty = Infinity
+				if items[len(items)-1].Type == BoxType {
+					items = append(items, Penalty(0.0, Infinity, false))
+				}
+			}
+
 			spaceWidth := glyph.Advance()
 			spaceFactor := 1.0
 			if !FrenchSpacing && align == Justified {
@@ -631,7 +757,10 @@ func GlyphsToItems(glyphs []Glyph, indent float64, align Align) []Item {
 				}
 			}
 			var w, y, z float64
-			if align == Justified {
+			if align == Justified && glyph.Text == '\t' {
+				// tabs have the advance up to their tab stop and are not stretched or shrunk
+				w = spaceWidth
+			} else if align == Justified {
 				w = spaceWidth
 				y = spaceWidth * SpaceStretch * spaceFactor
 				z = spaceWidth * SpaceShrink / spaceFactor
@@ -650,11 +779,11 @@ func GlyphsToItems(glyphs []Glyph, indent float64, align Align) []Item {
 			if align == Justified {
 				items[len(items)-1].Size++
 			} else if align == Left || align == Right {
-				items = append(items, Penalty(0.0, 0.0, false))
+				items = append(items, Penalty(0.0, spacePenalty, false))
 				items = append(items, Glue(spaceWidth, -stretchWidth, 0.0))
 				items[len(items)-1].Size++
 			} else if align == Centered {
-				items = append(items, Penalty(0.0, 0.0, false))
+				items = append(items, Penalty(0.0, spacePenalty, false))
 				items = append(items, Glue(spaceWidth, -stretchWidth, 0.0))
 				items[len(items)-1].Size++
 				items = append(items, Box(0.0))
@@ -693,9 +822,17 @@ func GlyphsToItems(glyphs []Glyph, indent float64, align Align) []Item {
 		} else {
 			// glyphs
 			width := glyph.Advance()
+			shrinkable := align == Justified && 0.0 < PunctuationShrink && 1 < len(items) && 0.75*glyph.Size < width
+			if shrinkable && isFullWidthOpening(glyph.Text) {
+				// compress the leading blank of opening brackets, break before only when allowed
+				if !breaks[i] && items[len(items)-1].Type == BoxType {
+					items = append(items, Penalty(0.0, Infinity, false))
+				}
+				items = append(items, Glue(0.0, 0.0, PunctuationShrink*width))
+			}
 			if 1 < len(items) && items[len(items)-1].Type == BoxType {
-				if IsSpacelessScript(glyph.Script) || IsSpacelessScript(glyphs[i-1].Script) {
-					// allow breaks around spaceless script glyphs, most commonly CJK
+				if breaks[i] && glyphs[i-1].Text != '-' {
+					// allow breaks following UAX#14, most commonly between CJK glyphs
 					items = append(items, Penalty(0.0, 0.0, false))
 					items = append(items, Box(width))
 				} else {
@@ -706,8 +843,15 @@ func GlyphsToItems(glyphs []Glyph, indent float64, align Align) []Item {
 				items = append(items, Box(width))
 			}
 			items[len(items)-1].Size++
+			if shrinkable && isFullWidthClosing(glyph.Text) && i+1 < last && !IsSpace(glyphs[i+1].Text) {
+				// compress the trailing blank of closing brackets and punctuation, break after only when allowed
+				if !breaks[i+1] {
+					items = append(items, Penalty(0.0, Infinity, false))
+				}
+				items = append(items, Glue(0.0, 0.0, PunctuationShrink*width))
+			}
 		}
-		if glyph.Text == '-' {
+		if glyph.Text == '-' && breaks[i+1] {
 			// optional break after hyphen
 			items = append(items, Penalty(0.0, HyphenPenalty, true))
 		}
@@ -3,8 +3,10 @@ package text
 import (
 	"fmt"
 	"math"
+	"os"
 	"testing"
 
+	"github.com/tdewolff/canvas/font"
 	"github.com/tdewolff/test"
 )
 
@@ -40,6 +42,9 @@ func TestLinebreak(t *testing.T) {
 
 		// line too long
 		{[]Item{Box(120.0), P, Box(100.0)}, "1>0", []float64{0.0, 0.0}},
+
+		// paragraph break with infinite stretch, following lines are still stretched
+		{[]Item{Box(50.0), Penalty(0.0, Infinity, false), Glue(0.0, math.Inf(1.0), 0.0), Penalty(0.0, -Infinity, false), Box(50.0), G, Box(30.0), P, Box(100.0)}, "7>3>0", []float64{0.0, 2.0, 0.0}},
 	}
 
 	for i, tt := range tests {
@@ -55,3 +60,80 @@ func TestLinebreak(t *testing.T) {
 		})
 	}
 }
+
+func TestLineBreakOpportunities(t *testing.T) {
+	var tests = []struct {
+		s      string
+		breaks string // | marks a break opportunity
+	}{
+		{"漢字（かな）。漢", "漢|字|（か|な）。|漢"},
+		{"a (b) c", "a |(b) |c"},
+		{"word )", "word )"},
+		{"and/or x", "and/|or |x"},
+		{"-5 a-b", "-5 |a-|b"},
+		{"ちょっとカード", "ちょっ|と|カー|ド"}, // kinsoku
+		{"สวัสดีครับ", "ส|วั|ส|ดี|ค|รั|บ"}, // spaceless script
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			runes := []rune(tt.s)
+			glyphs := make([]Glyph, len(runes))
+			for i, r := range runes {
+				glyphs[i].Text = r
+			}
+			breaks := lineBreakOpportunities(glyphs, "")
+
+			s := ""
+			for i, r := range runes {
+				if 0 < i && breaks[i] {
+					s += "|"
+				}
+				s += string(r)
+			}
+			test.String(t, s, tt.breaks)
+		})
+	}
+}
+
+func TestPunctuationShrink(t *testing.T) {
+	b, err := os.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+	sfnt, err := font.ParseSFNT(b, 0)
+	test.Error(t, err)
+
+	shrinkable := func(advance int32) bool {
+		em := int32(sfnt.Head.UnitsPerEm)
+		glyphs := []Glyph{}
+		for _, r := range "日（日）日" {
+			xadv := em
+			if r == '（' || r == '）' {
+				xadv = advance
+			}
+			glyphs = append(glyphs, Glyph{SFNT: sfnt, Size: 10.0, Text: r, XAdvance: xadv})
+		}
+		for _, item := range GlyphsToItems(glyphs, 0.0, Justified) {
+			if item.Type == GlueType && 0.0 < item.Shrink {
+				return true
+			}
+		}
+		return false
+	}
+	test.That(t, shrinkable(int32(sfnt.Head.UnitsPerEm)), "full-width brackets must be compressible")
+	test.That(t, !shrinkable(int32(sfnt.Head.UnitsPerEm)/2), "proportional brackets must not be compressed")
+}
+
+func TestLineBreakOpportunitiesText(t *testing.T) {
+	// the source text is segmented and the second glyph of a cluster never breaks
+	text := "x漢字 (y)"
+	glyphs := []Glyph{
+		{Text: '漢', Cluster: 1},
+		{Text: '字', Cluster: 4},
+		{Text: '字', Cluster: 4},
+		{Text: ' ', Cluster: 7},
+		{Text: '(', Cluster: 8},
+		{Text: 'y', Cluster: 9},
+		{Text: ')', Cluster: 10},
+	}
+	breaks := lineBreakOpportunities(glyphs, text)
+	test.T(t, breaks, []bool{false, true, false, false, true, false, false, true})
+}
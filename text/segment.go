@@ -0,0 +1,249 @@
+package text
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// See: Unicode Standard Annex #29, "Unicode Text Segmentation", https://www.unicode.org/reports/tr29/
+// The grapheme cluster and word boundary rules are implemented using the general category and script of characters, which approximates the character properties of UAX#29 without the need for large tables.
+
+type graphemeClass int
+
+const (
+	graphemeOther graphemeClass = iota
+	graphemeCR
+	graphemeLF
+	graphemeControl
+	graphemeExtend
+	graphemeZWJ
+	graphemeSpacingMark
+	graphemeRegionalIndicator
+	graphemeExtendedPictographic
+	graphemeL
+	graphemeV
+	graphemeT
+	graphemeLV
+	graphemeLVT
+)
+
+func graphemeClassOf(r rune) graphemeClass {
+	switch {
+	case r == '\r':
+		return graphemeCR
+	case r == '\n':
+		return graphemeLF
+	case r == '\u200D':
+		return graphemeZWJ
+	case r == '\u200C', 0x1F3FB <= r && r <= 0x1F3FF, 0xE0020 <= r && r <= 0xE007F:
+		return graphemeExtend // ZWNJ, emoji modifiers, and tags
+	case 0x1F1E6 <= r && r <= 0x1F1FF:
+		return graphemeRegionalIndicator
+	case 0x1100 <= r && r <= 0x115F, 0xA960 <= r && r <= 0xA97C:
+		return graphemeL
+	case 0x1160 <= r && r <= 0x11A7, 0xD7B0 <= r && r <= 0xD7C6:
+		return graphemeV
+	case 0x11A8 <= r && r <= 0x11FF, 0xD7CB <= r && r <= 0xD7FB:
+		return graphemeT
+	case 0xAC00 <= r && r <= 0xD7A3:
+		if (r-0xAC00)%28 == 0 {
+			return graphemeLV
+		}
+		return graphemeLVT
+	case unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r):
+		return graphemeExtend
+	case unicode.Is(unicode.Mc, r):
+		return graphemeSpacingMark
+	case unicode.IsControl(r), r == '\u2028', r == '\u2029':
+		return graphemeControl
+	case isExtendedPictographic(r):
+		return graphemeExtendedPictographic
+	}
+	return graphemeOther
+}
+
+func isExtendedPictographic(r rune) bool {
+	return r == 0x00A9 || r == 0x00AE || r == 0x203C || r == 0x2049 || r == 0x2122 || r == 0x2139 || 0x2194 <= r && r <= 0x21AA || 0x2300 <= r && r <= 0x23FF || 0x25A0 <= r && r <= 0x27BF || 0x2B00 <= r && r <= 0x2BFF || r == 0x3030 || r == 0x303D || r == 0x3297 || r == 0x3299 || 0x1F000 <= r && r <= 0x1FAFF
+}
+
+// isGraphemeBoundary returns true if there is a grapheme cluster boundary between two characters. The number of preceding regional indicators and whether the previous character is part of an emoji ZWJ sequence are needed for rules GB11 to GB13.
+func isGraphemeBoundary(prev, next graphemeClass, riCount int, emoji bool) bool {
+	switch {
+	case prev == graphemeCR && next == graphemeLF: // GB3
+		return false
+	case prev == graphemeCR || prev == graphemeLF || prev == graphemeControl: // GB4
+		return true
+	case next == graphemeCR || next == graphemeLF || next == graphemeControl: // GB5
+		return true
+	case prev == graphemeL && (next == graphemeL || next == graphemeV || next == graphemeLV || next == graphemeLVT): // GB6
+		return false
+	case (prev == graphemeLV || prev == graphemeV) && (next == graphemeV || next == graphemeT): // GB7
+		return false
+	case (prev == graphemeLVT || prev == graphemeT) && next == graphemeT: // GB8
+		return false
+	case next == graphemeExtend || next == graphemeZWJ || next == graphemeSpacingMark: // GB9 and GB9a
+		return false
+	case prev == graphemeZWJ && next == graphemeExtendedPictographic && emoji: // GB11
+		return false
+	case prev == graphemeRegionalIndicator && next == graphemeRegionalIndicator: // GB12 and GB13
+		return riCount%2 == 0
+	}
+	return true // GB999
+}
+
+// GraphemeBreaks returns the byte offsets of the extended grapheme cluster boundaries in s, including zero and the length of s for non-empty strings.
+func GraphemeBreaks(s string) []int {
+	if len(s) == 0 {
+		return []int{}
+	}
+
+	breaks := []int{0}
+	r, n := utf8.DecodeRuneInString(s)
+	prev := graphemeClassOf(r)
+	riCount := 0
+	if prev == graphemeRegionalIndicator {
+		riCount = 1
+	}
+	emoji := prev == graphemeExtendedPictographic
+	for i := n; i < len(s); i += n {
+		r, n = utf8.DecodeRuneInString(s[i:])
+		next := graphemeClassOf(r)
+		if isGraphemeBoundary(prev, next, riCount, emoji) {
+			breaks = append(breaks, i)
+		}
+
+		if next == graphemeRegionalIndicator {
+			riCount++
+		} else {
+			riCount = 0
+		}
+		if next == graphemeExtendedPictographic {
+			emoji = true
+		} else if next != graphemeExtend && next != graphemeZWJ {
+			emoji = false
+		}
+		prev = next
+	}
+	return append(breaks, len(s))
+}
+
+type wordClass int
+
+const (
+	wordOther wordClass = iota
+	wordNewline
+	wordSpace
+	wordALetter
+	wordNumeric
+	wordKatakana
+	wordExtendNumLet
+	wordMidLetter
+	wordMidNum
+	wordMidNumLet
+)
+
+func wordClassOf(r rune) wordClass {
+	switch r {
+	case '\r', '\n', '\v', '\f', '\u0085', '\u2028', '\u2029':
+		return wordNewline
+	case ':', '\u00B7', '\u0387', '\u05F4', '\u2027', '\uFE13', '\uFE55', '\uFF1A':
+		return wordMidLetter
+	case ',', ';', '\u037E', '\u0589', '\u060C', '\u060D', '\u066C', '\u07F8', '\u2044', '\uFE10', '\uFE14', '\uFE50', '\uFE54', '\uFF0C', '\uFF1B':
+		return wordMidNum
+	case '.', '\'', '\u2018', '\u2019', '\u2024', '\uFE52', '\uFF07', '\uFF0E':
+		return wordMidNumLet
+	}
+	switch {
+	case unicode.Is(unicode.Zs, r) && r != '\u00A0' && r != '\u2007' && r != '\u202F':
+		return wordSpace
+	case unicode.Is(unicode.Katakana, r):
+		return wordKatakana
+	case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r):
+		return wordOther // ideographs are words on their own
+	case unicode.IsLetter(r):
+		return wordALetter
+	case unicode.Is(unicode.Nd, r):
+		return wordNumeric
+	case unicode.Is(unicode.Pc, r):
+		return wordExtendNumLet
+	}
+	return wordOther
+}
+
+// WordBreaks returns the byte offsets of the word boundaries in s, including zero and the length of s for non-empty strings. Words are runs of letters and digits, including punctuation within words such as in "can't" or "3.14", while whitespace runs and other characters such as punctuation form their own segments.
+func WordBreaks(s string) []int {
+	graphemes := GraphemeBreaks(s)
+	if len(graphemes) == 0 {
+		return []int{}
+	}
+
+	// classify each grapheme cluster by its first character, which ignores extending characters (WB4)
+	classes := make([]wordClass, len(graphemes)-1)
+	for i := range classes {
+		r, _ := utf8.DecodeRuneInString(s[graphemes[i]:])
+		classes[i] = wordClassOf(r)
+	}
+	isLetter := func(i int) bool {
+		return 0 <= i && i < len(classes) && classes[i] == wordALetter
+	}
+	isNumeric := func(i int) bool {
+		return 0 <= i && i < len(classes) && classes[i] == wordNumeric
+	}
+
+	breaks := []int{0}
+	for i := 1; i < len(classes); i++ {
+		prev, next := classes[i-1], classes[i]
+		boundary := true
+		switch {
+		case prev == wordSpace && next == wordSpace: // WB3d
+			boundary = false
+		case prev == wordALetter && next == wordALetter: // WB5
+			boundary = false
+		case prev == wordALetter && (next == wordMidLetter || next == wordMidNumLet) && isLetter(i+1): // WB6
+			boundary = false
+		case (prev == wordMidLetter || prev == wordMidNumLet) && next == wordALetter && isLetter(i-2): // WB7
+			boundary = false
+		case (prev == wordALetter || prev == wordNumeric) && (next == wordALetter || next == wordNumeric): // WB8, WB9, and WB10
+			boundary = false
+		case prev == wordNumeric && (next == wordMidNum || next == wordMidNumLet) && isNumeric(i+1): // WB12
+			boundary = false
+		case (prev == wordMidNum || prev == wordMidNumLet) && next == wordNumeric && isNumeric(i-2): // WB11
+			boundary = false
+		case prev == wordKatakana && next == wordKatakana: // WB13
+			boundary = false
+		case (prev == wordALetter || prev == wordNumeric || prev == wordKatakana || prev == wordExtendNumLet) && next == wordExtendNumLet: // WB13a
+			boundary = false
+		case prev == wordExtendNumLet && (next == wordALetter || next == wordNumeric || next == wordKatakana): // WB13b
+			boundary = false
+		}
+		if boundary {
+			breaks = append(breaks, graphemes[i])
+		}
+	}
+	return append(breaks, len(s))
+}
+
+// boundsAt returns the segment of breaks that contains byte index i.
+func boundsAt(breaks []int, i int) (int, int) {
+	if len(breaks) == 0 {
+		return 0, 0
+	} else if i <= 0 {
+		return breaks[0], breaks[1]
+	}
+	for j := 1; j < len(breaks); j++ {
+		if i < breaks[j] {
+			return breaks[j-1], breaks[j]
+		}
+	}
+	return breaks[len(breaks)-2], breaks[len(breaks)-1]
+}
+
+// GraphemeBounds returns the start and end byte offsets of the extended grapheme cluster in s that contains the byte at index i.
+func GraphemeBounds(s string, i int) (int, int) {
+	return boundsAt(GraphemeBreaks(s), i)
+}
+
+// WordBounds returns the start and end byte offsets of the word in s that contains the byte at index i. If i is at whitespace or punctuation, the bounds of that segment are returned instead.
+func WordBounds(s string, i int) (int, int) {
+	return boundsAt(WordBreaks(s), i)
+}
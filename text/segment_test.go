@@ -0,0 +1,63 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/tdewolff/test"
+)
+
+func TestGraphemeBreaks(t *testing.T) {
+	var tts = []struct {
+		s      string
+		breaks []int
+	}{
+		{"", []int{}},
+		{"abc", []int{0, 1, 2, 3}},
+		{"e\u0301x", []int{0, 3, 4}},                                 // combining acute accent
+		{"\r\na", []int{0, 2, 3}},                                    // CR LF
+		{"\U0001F1F3\U0001F1F1\U0001F1E9", []int{0, 8, 12}},          // flags pair up
+		{"\U0001F468\u200D\U0001F469\u200D\U0001F467", []int{0, 18}}, // ZWJ sequence
+		{"\U0001F44D\U0001F3FD", []int{0, 8}},                        // emoji modifier
+		{"\u1100\u1161\u11A8", []int{0, 9}},                          // Hangul jamo
+		{"\u0915\u093F", []int{0, 6}},                                // Devanagari spacing mark
+	}
+	for _, tt := range tts {
+		t.Run(tt.s, func(t *testing.T) {
+			test.T(t, GraphemeBreaks(tt.s), tt.breaks)
+		})
+	}
+}
+
+func TestWordBreaks(t *testing.T) {
+	var tts = []struct {
+		s      string
+		breaks []int
+	}{
+		{"", []int{}},
+		{"hello world", []int{0, 5, 6, 11}},
+		{"can't stop", []int{0, 5, 6, 10}},
+		{"3.14, 2", []int{0, 4, 5, 6, 7}},
+		{"a  b", []int{0, 1, 3, 4}},
+		{"snake_case", []int{0, 10}},
+		{"end.", []int{0, 3, 4}},
+		{"日本語", []int{0, 3, 6, 9}},
+		{"カタカナ", []int{0, 12}},
+		{"caf\u00E9s", []int{0, 6}},
+		{"cafe\u0301s", []int{0, 7}},
+	}
+	for _, tt := range tts {
+		t.Run(tt.s, func(t *testing.T) {
+			test.T(t, WordBreaks(tt.s), tt.breaks)
+		})
+	}
+
+	start, end := WordBounds("hello world", 2)
+	test.T(t, start, 0)
+	test.T(t, end, 5)
+	start, end = WordBounds("hello world", 5)
+	test.T(t, start, 5)
+	test.T(t, end, 6)
+	start, end = GraphemeBounds("e\u0301x", 1)
+	test.T(t, start, 0)
+	test.T(t, end, 3)
+}
@@ -2,13 +2,16 @@ package text
 
 import (
 	"fmt"
+	"unicode"
 
+	"github.com/go-text/typesetting/unicodedata"
 	"github.com/tdewolff/canvas/font"
 )
 
 type ScriptItem struct {
 	Script
-	Text string
+	Level int // embedding level
+	Text  string
 }
 
 // ScriptItemizer divides the string in parts for each different script.
@@ -41,6 +44,7 @@ func ScriptItemizer(runes []rune, embeddingLevels []int) []ScriptItem {
 		if j != 0 && (curLevel != level || curScript != script && curScript != ScriptInherited && curScript != ScriptCommon && script != ScriptInherited && script != ScriptCommon) {
 			items = append(items, ScriptItem{
 				Script: curScript,
+				Level:  curLevel,
 				Text:   string(runes[i:j]),
 			})
 			i = j
@@ -48,6 +52,7 @@ func ScriptItemizer(runes []rune, embeddingLevels []int) []ScriptItem {
 	}
 	items = append(items, ScriptItem{
 		Script: scripts[len(scripts)-1],
+		Level:  len(scripts) - 1,
 		Text:   string(runes[i:]),
 	})
 	return items
@@ -67,6 +72,7 @@ type Glyph struct {
 	XOffset  int32
 	YOffset  int32
 	Text     rune
+	Empty    bool // has no outline and must not be rendered, such as the glyph of a zero-width character
 }
 
 func (g Glyph) Advance() float64 {
@@ -92,7 +98,13 @@ func (g Glyph) Rotation() Rotation {
 	return rot
 }
 
-// TODO: implement Liang's (soft) hyphenation algorithm? Add \u00AD at opportunities, unless \u2060 or \uFEFF is present
+// IsControl returns true for control and format characters that have no visual representation and are not handled by the layout, such as the bell character or bidirectional formatting characters. Tabs, paragraph separators, the soft hyphen, and the zero-width characters of IsZeroWidth are excluded.
+func IsControl(r rune) bool {
+	if r == '\t' || r == '\u00AD' || IsParagraphSeparator(r) || IsZeroWidth(r) {
+		return false
+	}
+	return unicode.Is(unicode.Cc, r) || unicode.Is(unicode.Cf, r)
+}
 
 // IsParagraphSeparator returns true for paragraph separator runes.
 func IsParagraphSeparator(r rune) bool {
@@ -100,6 +112,83 @@ func IsParagraphSeparator(r rune) bool {
 	return 0x0A <= r && r <= 0x0D || r == 0x85 || r == '\u2028' || r == '\u2029'
 }
 
+// IsZeroWidth returns true for invisible format characters that have no advance, such as the zero width space, non-joiner, joiner, word joiner, and the byte order mark (zero width no-break space).
+func IsZeroWidth(r rune) bool {
+	return 0x200B <= r && r <= 0x200D || r == 0x2060 || r == 0xFEFF
+}
+
+// IsDefaultIgnorable returns true for the Default_Ignorable_Code_Point characters of Unicode, which have no visible glyph and no advance unless explicitly supported by the font, such as variation selectors, the zero width joiner, the soft hyphen, and bidirectional formatting characters.
+func IsDefaultIgnorable(r rune) bool {
+	switch {
+	case r < 0x00AD:
+		return false
+	case r == 0x00AD || r == 0x034F || r == 0x061C || 0x115F <= r && r <= 0x1160 || 0x17B4 <= r && r <= 0x17B5 || 0x180B <= r && r <= 0x180F:
+		return true
+	case 0x200B <= r && r <= 0x200F || 0x202A <= r && r <= 0x202E || 0x2060 <= r && r <= 0x206F || r == 0x3164:
+		return true
+	case 0xFE00 <= r && r <= 0xFE0F || r == 0xFEFF || r == 0xFFA0 || 0xFFF0 <= r && r <= 0xFFF8:
+		return true
+	case 0x1BCA0 <= r && r <= 0x1BCA3 || 0x1D173 <= r && r <= 0x1D17A || 0xE0000 <= r && r <= 0xE0FFF:
+		return true
+	}
+	return false
+}
+
+// HasEmojiPresentation returns true for characters that are displayed as emoji rather than as text by default, see the Emoji_Presentation property of Unicode's emoji data. The presentation of an emoji character can be selected explicitly by a following U+FE0E (text) or U+FE0F (emoji) variation selector.
+func HasEmojiPresentation(r rune) bool {
+	return unicode.Is(unicodedata.Emoji_Presentation, r)
+}
+
+// EmojiSequence returns the number of characters of the emoji sequence at the start of runes when it is displayed with emoji presentation, or zero otherwise. The sequence includes the presentation selector, emoji modifiers such as skin tones, a combining keycap, tags, and further emoji joined by the zero width joiner. A pair of regional indicators forms a flag.
+func EmojiSequence(runes []rune) int {
+	if len(runes) == 0 || !unicode.Is(unicodedata.Emoji, runes[0]) {
+		return 0
+	}
+
+	n := 1
+	emoji := HasEmojiPresentation(runes[0])
+	if 0x1F1E6 <= runes[0] && runes[0] <= 0x1F1FF {
+		if 1 < len(runes) && 0x1F1E6 <= runes[1] && runes[1] <= 0x1F1FF {
+			n++ // flag
+		}
+		return n
+	}
+	for n < len(runes) {
+		r := runes[n]
+		if r == '\uFE0E' && n == 1 {
+			return 0 // text presentation
+		} else if r == '\uFE0F' || r == '\u20E3' || unicode.Is(unicodedata.Emoji_Modifier, r) {
+			emoji = true
+			n++
+		} else if 0xE0020 <= r && r <= 0xE007F {
+			n++ // tag
+		} else if r == '\u200D' && n+1 < len(runes) && unicode.Is(unicodedata.Emoji, runes[n+1]) {
+			emoji = true
+			n += 2
+		} else {
+			break
+		}
+	}
+	if !emoji {
+		return 0
+	}
+	return n
+}
+
+// RequiredFeatures returns the OpenType features that are required to render the script correctly and that should thus never be disabled, such as the joining forms and required ligatures of Arabic or the conjunct forms of Indic scripts. Glyph composition, localized forms, and mark positioning are only required for the joining and Indic scripts, for other scripts they may be disabled like any other feature.
+func RequiredFeatures(script Script) []string {
+	features := []string{"rvrn"}
+	switch script {
+	case Adlam, Arabic, HanifiRohingya, Mandaic, Manichaean, Mongolian, Nko, PhagsPa, PsalterPahlavi, Syriac:
+		features = append(features, "ccmp", "locl", "mark", "mkmk", "rlig", "init", "isol", "fina", "fin2", "fin3", "medi", "med2")
+	case Bengali, Devanagari, Gujarati, Gurmukhi, Kannada, Khmer, Malayalam, Myanmar, Oriya, Sinhala, Tamil, Telugu:
+		features = append(features, "ccmp", "locl", "mark", "mkmk", "rlig", "abvf", "abvs", "akhn", "blwf", "blws", "cjct", "half", "haln", "nukt", "pref", "pres", "pstf", "psts", "rkrf", "rphf", "vatu")
+	case Hangul:
+		features = append(features, "ljmo", "vjmo", "tjmo")
+	}
+	return features
+}
+
 func IsSpacelessScript(script Script) bool {
 	// missing: S'gaw Karen
 	return script == Han || script == Hangul || script == Katakana || script == Khmer || script == Lao || script == PhagsPa || script == Brahmi || script == TaiTham || script == NewTaiLue || script == TaiLe || script == TaiViet || script == Thai || script == Tibetan || script == Myanmar
@@ -0,0 +1,132 @@
+package text
+
+import (
+	"sort"
+
+	"github.com/tdewolff/canvas/font"
+)
+
+// TraceStep is a step in a shaping trace, which records an OpenType feature that substituted (GSUB) or positioned (GPOS) the glyphs of a range of clusters.
+type TraceStep struct {
+	Feature string   // feature tag, such as liga
+	Table   string   // GSUB or GPOS
+	Lookups []uint16 // lookup indices of the feature in the table
+	Cluster uint32   // first cluster of the affected range
+
+	Input  []Glyph // glyphs without the feature applied
+	Output []Glyph // glyphs with the feature applied
+}
+
+// ShapeTrace shapes the string like Shape and additionally returns a trace of the features of the GSUB and GPOS tables of the font that changed the glyphs of each range of clusters, which helps to debug surprising shaping results. The trace is obtained by shaping again with each feature disabled, so that it is slow and should only be used for debugging. Features that cannot be disabled, such as those required by complex scripts, are not recorded.
+func (s Shaper) ShapeTrace(sfnt *font.SFNT, text string, ppem uint16, direction Direction, script Script, lang string, features string, variations string) ([]Glyph, Direction, []TraceStep) {
+	glyphs, direction := s.Shape(text, ppem, direction, script, lang, features, variations)
+
+	tags := map[font.FeatureTag]bool{}
+	gsubLookups, gposLookups := map[font.FeatureTag][]uint16{}, map[font.FeatureTag][]uint16{}
+	if sfnt.Gsub != nil {
+		gsubLookups = sfnt.Gsub.Features()
+		for tag := range gsubLookups {
+			tags[tag] = true
+		}
+	}
+	if sfnt.Gpos != nil {
+		gposLookups = sfnt.Gpos.Features()
+		for tag := range gposLookups {
+			tags[tag] = true
+		}
+	}
+	sortedTags := make([]string, 0, len(tags))
+	for tag := range tags {
+		sortedTags = append(sortedTags, string(tag))
+	}
+	sort.Strings(sortedTags)
+
+	var trace []TraceStep
+	for _, tag := range sortedTags {
+		disabled := "-" + tag
+		if features != "" {
+			disabled = features + "," + disabled
+		}
+		input, _ := s.Shape(text, ppem, direction, script, lang, disabled, variations)
+		for _, cluster := range commonClusters(glyphs, input, uint32(len(text))) {
+			in, out := clusterGlyphs(input, cluster[0], cluster[1]), clusterGlyphs(glyphs, cluster[0], cluster[1])
+			step := TraceStep{
+				Feature: tag,
+				Cluster: cluster[0],
+				Input:   in,
+				Output:  out,
+			}
+			if !equalGlyphIDs(in, out) {
+				step.Table = "GSUB"
+				step.Lookups = gsubLookups[font.FeatureTag(tag)]
+			} else if !equalGlyphPositions(in, out) {
+				step.Table = "GPOS"
+				step.Lookups = gposLookups[font.FeatureTag(tag)]
+			} else {
+				continue
+			}
+			trace = append(trace, step)
+		}
+	}
+	sort.SliceStable(trace, func(i, j int) bool {
+		return trace[i].Cluster < trace[j].Cluster
+	})
+	return glyphs, direction, trace
+}
+
+// commonClusters returns the cluster ranges delimited by cluster boundaries that are shared by both glyph sequences, which are the smallest ranges that can be compared.
+func commonClusters(a, b []Glyph, n uint32) [][2]uint32 {
+	inA := map[uint32]bool{}
+	for _, glyph := range a {
+		inA[glyph.Cluster] = true
+	}
+	bounds := []uint32{}
+	for _, glyph := range b {
+		if inA[glyph.Cluster] {
+			bounds = append(bounds, glyph.Cluster)
+			delete(inA, glyph.Cluster)
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	ranges := make([][2]uint32, len(bounds))
+	for i := range bounds {
+		end := n
+		if i+1 < len(bounds) {
+			end = bounds[i+1]
+		}
+		ranges[i] = [2]uint32{bounds[i], end}
+	}
+	return ranges
+}
+
+func clusterGlyphs(glyphs []Glyph, start, end uint32) []Glyph {
+	var cluster []Glyph
+	for _, glyph := range glyphs {
+		if start <= glyph.Cluster && glyph.Cluster < end {
+			cluster = append(cluster, glyph)
+		}
+	}
+	return cluster
+}
+
+func equalGlyphIDs(a, b []Glyph) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			return false
+		}
+	}
+	return true
+}
+
+func equalGlyphPositions(a, b []Glyph) bool {
+	for i := range a {
+		if a[i].XAdvance != b[i].XAdvance || a[i].YAdvance != b[i].YAdvance || a[i].XOffset != b[i].XOffset || a[i].YOffset != b[i].YOffset {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package text
+
+import (
+	"os"
+	"testing"
+
+	"github.com/tdewolff/canvas/font"
+	"github.com/tdewolff/test"
+)
+
+func TestShapeTrace(t *testing.T) {
+	b, err := os.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+	sfnt, err := font.ParseSFNT(b, 0)
+	test.Error(t, err)
+	shaper, err := NewShaperSFNT(sfnt)
+	test.Error(t, err)
+	defer shaper.Destroy()
+
+	glyphs, _, trace := shaper.ShapeTrace(sfnt, "fi", 12, LeftToRight, Latin, "en", "", "")
+	test.T(t, len(glyphs), 1)
+
+	var liga *TraceStep
+	for i, step := range trace {
+		if step.Feature == "liga" {
+			liga = &trace[i]
+		}
+	}
+	test.That(t, liga != nil, "must have liga step")
+	test.String(t, liga.Table, "GSUB")
+	test.That(t, 0 < len(liga.Lookups))
+	test.T(t, liga.Cluster, uint32(0))
+	test.T(t, len(liga.Input), 2)
+	test.T(t, liga.Input[0].ID, sfnt.GlyphIndex('f'))
+	test.T(t, liga.Input[1].ID, sfnt.GlyphIndex('i'))
+	test.T(t, len(liga.Output), 1)
+	test.T(t, liga.Output[0].ID, glyphs[0].ID)
+
+	// kerning is a positioning feature
+	_, _, trace = shaper.ShapeTrace(sfnt, "AV", 12, LeftToRight, Latin, "en", "", "")
+	test.T(t, len(trace), 1)
+	test.String(t, trace[0].Feature, "kern")
+	test.String(t, trace[0].Table, "GPOS")
+}
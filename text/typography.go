@@ -0,0 +1,96 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+// quotes are the primary opening and closing, and secondary opening and closing quotation marks.
+type quotes [4]rune
+
+var defaultQuotes = quotes{'“', '”', '‘', '’'}
+
+// languageQuotes are the quotation marks per primary language subtag, see https://en.wikipedia.org/wiki/Quotation_mark#Summary_table
+var languageQuotes = map[string]quotes{
+	"cs": {'„', '“', '‚', '‘'},
+	"da": {'»', '«', '›', '‹'},
+	"de": {'„', '“', '‚', '‘'},
+	"es": {'«', '»', '“', '”'},
+	"fi": {'”', '”', '’', '’'},
+	"fr": {'«', '»', '‹', '›'},
+	"it": {'«', '»', '“', '”'},
+	"ja": {'「', '」', '『', '』'},
+	"nb": {'«', '»', '‘', '’'},
+	"pl": {'„', '”', '‚', '’'},
+	"ru": {'«', '»', '„', '“'},
+	"sk": {'„', '“', '‚', '‘'},
+	"sv": {'”', '”', '’', '’'},
+	"uk": {'«', '»', '„', '“'},
+}
+
+// isOpeningContext returns true if a quotation mark following r opens a quotation.
+func isOpeningContext(r rune) bool {
+	return r == 0 || unicode.IsSpace(r) || unicode.In(r, unicode.Ps, unicode.Pi, unicode.Pd) || r == '—' || r == '–'
+}
+
+// SmartTypography replaces straight quotation marks by curly quotation marks, double and triple hyphens by dashes, and three periods by an ellipsis. Apostrophes within words become right single quotation marks, and double hyphens between digits become en dashes such as for ranges. The previous character is used to determine whether a quotation mark at the start of s opens or closes a quotation and may be zero. The BCP 47 language tag selects the quotation marks, such as „…“ for German or «…» for French, and defaults to English.
+func SmartTypography(s string, prev rune, lang string) string {
+	q := defaultQuotes
+	if i := strings.IndexAny(lang, "-_"); i != -1 {
+		lang = lang[:i]
+	}
+	if langQuotes, ok := languageQuotes[strings.ToLower(lang)]; ok {
+		q = langQuotes
+	}
+
+	rs := []rune(s)
+	sb := strings.Builder{}
+	sb.Grow(len(s))
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		next := rune(0)
+		if i+1 < len(rs) {
+			next = rs[i+1]
+		}
+
+		switch r {
+		case '"':
+			if isOpeningContext(prev) {
+				r = q[0]
+			} else {
+				r = q[1]
+			}
+		case '\'':
+			if (unicode.IsLetter(prev) || unicode.IsDigit(prev)) && unicode.IsLetter(next) {
+				r = '’' // apostrophe
+			} else if isOpeningContext(prev) {
+				r = q[2]
+			} else {
+				r = q[3]
+			}
+		case '-', '.':
+			n := 1
+			for i+n < len(rs) && rs[i+n] == r {
+				n++
+			}
+			after := rune(0)
+			if i+n < len(rs) {
+				after = rs[i+n]
+			}
+			i += n - 1
+
+			if r == '-' && n == 2 && unicode.IsDigit(prev) && unicode.IsDigit(after) {
+				r = '–' // range
+			} else if r == '-' && (n == 2 || n == 3) {
+				r = '—'
+			} else if r == '.' && n == 3 {
+				r = '…'
+			} else {
+				sb.WriteString(strings.Repeat(string(r), n-1))
+			}
+		}
+		sb.WriteRune(r)
+		prev = r
+	}
+	return sb.String()
+}
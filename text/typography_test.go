@@ -0,0 +1,30 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/tdewolff/test"
+)
+
+func TestSmartTypography(t *testing.T) {
+	var tts = []struct {
+		s    string
+		prev rune
+		lang string
+		out  string
+	}{
+		{`He said "hi"--really...`, 0, "", "He said “hi”—really…"},
+		{`'quoted' and don't`, 0, "en", "‘quoted’ and don’t"},
+		{`pages 10--12 --- or ---- not`, 0, "", "pages 10–12 — or ---- not"},
+		{`a-b .. ....`, 0, "", "a-b .. ...."},
+		{`("nested")`, 0, "", "(“nested”)"},
+		{`"end`, 'x', "", "”end"},
+		{`er sagte "Hallo"`, 0, "de-DE", "er sagte „Hallo“"},
+		{`il dit "bonjour"`, 0, "fr", "il dit «bonjour»"},
+	}
+	for _, tt := range tts {
+		t.Run(tt.s, func(t *testing.T) {
+			test.String(t, SmartTypography(tt.s, tt.prev, tt.lang), tt.out)
+		})
+	}
+}
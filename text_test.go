@@ -1,8 +1,16 @@
 package canvas
 
 import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
+	"github.com/tdewolff/canvas/font"
+	canvasText "github.com/tdewolff/canvas/text"
 	"github.com/tdewolff/test"
 )
 
@@ -190,3 +198,1509 @@ func TestTextBox(t *testing.T) {
 	ctx.DrawText(0, 0, NewTextBox(face, "\ntext", 100, 100, Left, Top, 0, 0))
 	ctx.DrawText(0, 0, NewTextBox(face, "text\n\ntext2", 100, 100, Left, Top, 0, 0))
 }
+
+func TestTextEmpty(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	pt := ptPerMm * float64(family.fonts[FontRegular].Head.UnitsPerEm)
+	face := family.Face(pt, Black, FontRegular, FontNormal) // ascent is 1901, descent is 483
+
+	// NewTextLine and NewTextBox have the same lines and height, but the former has its first baseline at the origin and the latter its top
+	tests := []struct {
+		s      string
+		lines  int
+		height float64
+	}{
+		{"", 0, 0.0},
+		{" ", 1, 2384.0},
+		{"\n", 2, 4768.0},
+		{"\n\n", 3, 7152.0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.s), func(t *testing.T) {
+			text := NewTextLine(face, tt.s, Left)
+			test.T(t, len(text.lines), tt.lines)
+			top, bottom := text.Heights()
+			if tt.lines != 0 {
+				test.Float(t, top, 1901.0)
+			}
+			test.Float(t, top+bottom, tt.height)
+
+			text = NewTextBox(face, tt.s, 10000.0, 10000.0, Left, Top, 0.0, 0.0)
+			test.T(t, len(text.lines), tt.lines)
+			top, bottom = text.Heights()
+			test.Float(t, top, 0.0)
+			test.Float(t, top+bottom, tt.height)
+			if tt.s == "" {
+				test.That(t, text.Empty())
+				test.T(t, text.Bounds(), Rect{})
+			}
+		})
+	}
+}
+
+func TestTextBoxTinyWidth(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	// no glyph fits, so each glyph gets its own line
+	text := NewTextBox(face, "ab cd\ne", 0.1, 0.0, Left, Top, 0.0, 0.0)
+	test.That(t, text.Overflows, "text must overflow")
+	lines := []string{}
+	for _, line := range text.lines {
+		test.T(t, len(line.spans), 1)
+		test.T(t, len(line.spans[0].Glyphs), 1)
+		lines = append(lines, line.spans[0].Text)
+	}
+	test.T(t, lines, []string{"a", "b ", "c", "d\n", "e"})
+
+	text = NewTextBox(face, "", 0.1, 0.0, Left, Top, 0.0, 0.0)
+	test.That(t, !text.Overflows, "empty text must not overflow")
+}
+
+func TestFitTextSize(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+	label := "The quick brown fox jumps over the lazy dog"
+
+	// single line shrinks to fit the width
+	size, text := FitTextSize(face, label, 30.0, 0.0)
+	test.That(t, 0.0 < size && size < 12.0, "text must shrink")
+	test.T(t, len(text.lines), 1)
+	test.That(t, font.Face(size, Black).TextWidth(label) <= 30.0, "text must fit")
+	test.That(t, 30.0 < font.Face(size*1.01, Black).TextWidth(label), "size must be the largest that fits")
+
+	// wrapped text must fit the height as well
+	size, text = FitTextSize(face, label, 30.0, 15.0)
+	test.That(t, 1 < len(text.lines), "text must wrap")
+	test.That(t, !text.Overflows && text.String() == label, "text must fit")
+	test.Float(t, text.lines[0].spans[0].Face.Size, size*mmPerPt) // laid out at the size
+	larger := NewTextBox(font.Face(size*1.01, Black), label, 30.0, 15.0, Left, Top, 0.0, 0.0)
+	test.That(t, larger.Overflows || larger.String() != label, "size must be the largest that fits")
+
+	// short labels grow to fit
+	size, _ = FitTextSize(face, "a", 30.0, 0.0)
+	test.That(t, 12.0 < size, "text must grow")
+
+	size, _ = FitTextSize(face, label, 0.0, 0.0)
+	test.Float(t, size, 12.0)
+}
+
+func TestRichTextSVG(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.Add(face, "icon ")
+	err := rt.AddSVG([]byte(`<svg width="10" height="10"><circle cx="5" cy="5" r="5" fill="red"/></svg>`), DPMM(1.0), FontMiddle)
+	test.Error(t, err)
+	rt.Add(face, " text")
+
+	text := rt.ToText(100.0, 100.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 1)
+	objs := []TextSpanObject{}
+	for _, span := range text.lines[0].spans {
+		objs = append(objs, span.Objects...)
+	}
+	test.T(t, len(objs), 1)
+	test.T(t, objs[0].Canvas.Empty(), false)
+	test.Float(t, objs[0].Width, 10.0)
+	test.Float(t, objs[0].Height, 10.0)
+
+	err = rt.AddSVG([]byte(`<html></html>`), DPMM(1.0), FontMiddle)
+	test.That(t, err != nil)
+}
+
+func TestTextSpacing(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	spaced := *face
+	spaced.LetterSpacing = 1.0
+	letter := face.mmPerEm * math.Round(1.0/face.mmPerEm)
+
+	text := NewTextLine(&spaced, "HEADING", Left)
+	test.Float(t, text.Bounds().W, NewTextLine(face, "HEADING", Left).Bounds().W+6.0*letter)
+
+	// letter spacing is kept between spans of different scripts
+	lineWidth := func(text *Text) float64 {
+		span := text.lines[0].spans[len(text.lines[0].spans)-1]
+		return span.X + span.Width
+	}
+	text = NewTextLine(&spaced, "abcαβγ", Left)
+	test.T(t, len(text.lines[0].spans), 2)
+	test.Float(t, lineWidth(text), lineWidth(NewTextLine(face, "abcαβγ", Left))+5.0*letter)
+	text = NewTextBox(&spaced, "abcαβγ", 0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines[0].spans), 2)
+	test.Float(t, lineWidth(text), lineWidth(NewTextBox(face, "abcαβγ", 0.0, 0.0, Left, Top, 0.0, 0.0))+5.0*letter)
+
+	// but not at the end of wrapped lines, which align to the right
+	width := spaced.TextWidth("aaa bbb") + 2.0
+	text = NewTextBox(&spaced, "aaa bbb ccc", width, 0.0, Right, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 2)
+	for _, line := range text.lines {
+		span := line.spans[len(line.spans)-1]
+		test.Float(t, span.X+span.Width, width)
+	}
+
+	// word spacing widens the glue between words of justified text
+	s := "aaa bbb ccc ddd"
+	width = face.TextWidth(s) + 1.0
+	text = NewTextBox(face, s, width, 0.0, Justify, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 1)
+
+	spaced = *face
+	spaced.WordSpacing = 3.0
+	text = NewTextBox(&spaced, s, width, 0.0, Justify, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 2)
+	test.T(t, text.String(), s)
+}
+
+func TestTextTightLineHeight(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	face.TightLineHeight = true
+	metrics := face.Metrics()
+
+	heights := func(s string) (float64, float64) {
+		text := NewTextLine(face, s, Left)
+		_, ascent, descent, _ := text.lines[0].Heights(text.WritingMode)
+		return ascent, descent
+	}
+	ascent, descent := heights("aceo")
+	test.That(t, ascent < metrics.CapHeight, "lowercase line must be lower than the cap height", ascent)
+	test.That(t, 0.0 < descent && descent < 0.1*face.Size, "overshoot only", descent)
+
+	ascent2, descent2 := heights("Type")
+	test.That(t, ascent < ascent2 && ascent2 < metrics.Ascent, "ascenders must be higher", ascent, ascent2)
+	test.That(t, descent < descent2 && descent2 < metrics.Descent, "descenders must be lower", descent, descent2)
+
+	// lines without visible glyphs use the metrics
+	ascent, descent = heights(" ")
+	test.Float(t, ascent, metrics.Ascent)
+	test.Float(t, descent, metrics.Descent)
+
+	// lines are laid out closer together
+	text := NewTextBox(face, "aceo\naceo", 0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.That(t, text.lines[1].y-text.lines[0].y < metrics.LineHeight/2.0)
+}
+
+func TestTextBaselines(t *testing.T) {
+	b, err := ioutil.ReadFile("resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+	sfnt, err := font.ParseSFNT(b, 0)
+	test.Error(t, err)
+
+	// add BASE table where Latin has an alphabetic and Devanagari a hanging dominant baseline
+	sfnt.Tables["BASE"], err = ioutil.ReadFile("resources/BASE.bin")
+	test.Error(t, err)
+	fontBase, err := LoadFont(sfnt.Write(), 0, FontRegular)
+	test.Error(t, err)
+	unitsPerEm := float64(fontBase.Head.UnitsPerEm)
+
+	// spans of the same script align on their dominant baseline
+	face10 := fontBase.Face(10.0, Black)
+	face20 := fontBase.Face(20.0, Black)
+	rt := NewRichText(face10)
+	rt.Add(face10, "देव")
+	rt.Add(face20, "नागरी")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 1)
+	test.T(t, len(text.lines[0].spans), 2)
+	test.Float(t, text.lines[0].spans[0].Y, 0.0)
+	test.Float(t, text.lines[0].spans[1].Y, (1600.0*face10.Size-1600.0*face20.Size)/unitsPerEm) // hanging baselines align
+
+	// spans of other scripts align on the dominant baseline of the first span
+	rt = NewRichText(face10)
+	rt.Add(face10, "abc")
+	rt.Add(face20, "देव")
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines[0].spans), 2)
+	test.Float(t, text.lines[0].spans[0].Y, 0.0)
+	test.Float(t, text.lines[0].spans[1].Y, -100.0*face20.Size/unitsPerEm) // alphabetic baselines align
+
+	rt = NewRichText(face10)
+	rt.Add(face10, "देव")
+	rt.Add(face20, "abc")
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines[0].spans), 2)
+	test.Float(t, text.lines[0].spans[0].Y, 0.0)
+	test.Float(t, text.lines[0].spans[1].Y, (1600.0*face10.Size-1400.0*face20.Size)/unitsPerEm) // hanging baselines align
+
+	// spans starting with common characters take the script of the following characters
+	rt = NewRichText(face10)
+	rt.Add(face10, "1. देव")
+	rt.Add(face20, "abc")
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.Float(t, text.lines[0].spans[len(text.lines[0].spans)-1].Y, (1600.0*face10.Size-1400.0*face20.Size)/unitsPerEm)
+
+	// fonts without BASE table are not shifted
+	fontNoBase, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	rt = NewRichText(face10)
+	rt.Add(fontNoBase.Face(10.0, Black), "abc")
+	rt.Add(face20, "def")
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.Float(t, text.lines[0].spans[1].Y, 0.0)
+}
+
+func TestTextBaselineShift(t *testing.T) {
+	fontDejaVu, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := fontDejaVu.Face(12.0, Black)
+	faceSub := fontDejaVu.Face(12.0, Black)
+	faceSub.SetBaselineShiftEm(-0.2)
+	test.Float(t, faceSub.BaselineShift, -0.2*face.Size)
+
+	rt := NewRichText(face)
+	rt.Add(face, "H")
+	rt.Add(faceSub, "2")
+	rt.Add(face, "O")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 1)
+	test.T(t, len(text.lines[0].spans), 3)
+	test.Float(t, text.lines[0].spans[0].Y, 0.0)
+	test.Float(t, text.lines[0].spans[1].Y, -0.2*face.Size)
+	test.Float(t, text.lines[0].spans[2].Y, 0.0)
+
+	// glyphs are drawn with the shift and the line's descent includes it
+	ys := []float64{}
+	text.WalkSpans(func(x, y float64, span TextSpan) {
+		ys = append(ys, y)
+	})
+	test.Float(t, ys[1]-ys[0], -0.2*face.Size)
+	_, _, descent, _ := text.lines[0].Heights(HorizontalTB)
+	test.Float(t, descent, face.Metrics().Descent+0.2*face.Size)
+}
+
+func TestTextSpanGlyphPositions(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	for _, s := range []string{"text", "שלום"} {
+		text := NewTextLine(face, s, Left)
+		span := text.lines[0].spans[0]
+		positions := span.GlyphPositions()
+		test.T(t, len(positions), len(span.Glyphs)+1)
+
+		if span.Direction == canvasText.RightToLeft {
+			// reverse to visual order
+			for i := 0; i < len(positions)/2; i++ {
+				positions[i], positions[len(positions)-1-i] = positions[len(positions)-1-i], positions[i]
+			}
+		}
+		test.Float(t, positions[0], 0.0)
+		test.Float(t, positions[len(positions)-1], span.Width)
+		for i := 1; i < len(positions); i++ {
+			test.That(t, positions[i-1] <= positions[i], "positions must be monotonic in visual order")
+		}
+	}
+}
+
+func TestRichTextTrimSpaces(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.SetTrimSpaces(true)
+	rt.Add(face, "  text   ")
+
+	text := rt.ToText(100.0, 0.0, Center, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 1)
+	left, right := math.Inf(1), math.Inf(-1)
+	for _, span := range text.lines[0].spans {
+		if 0 < len(span.Glyphs) {
+			left = math.Min(left, span.X)
+			right = math.Max(right, span.X+span.Width)
+		}
+	}
+	test.Float(t, (left+right)/2.0, 50.0)
+	test.Float(t, right-left, face.TextWidth("text"))
+	test.T(t, text.String(), "  text   ")
+
+	text = rt.ToText(100.0, 0.0, Right, Top, 0.0, 0.0)
+	span := text.lines[0].spans[len(text.lines[0].spans)-1]
+	test.Float(t, span.X+span.Width, 100.0)
+}
+
+func TestRichTextAlignLast(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.SetTextAlignLast(Center)
+	rt.Add(face, "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.")
+
+	lineBounds := func(l line) (float64, float64) {
+		left, right := math.Inf(1), math.Inf(-1)
+		for _, span := range l.spans {
+			left = math.Min(left, span.X)
+			right = math.Max(right, span.X+span.Width)
+		}
+		return left, right
+	}
+
+	text := rt.ToText(100.0, 0.0, Justify, Top, 0.0, 0.0)
+	test.That(t, 4 <= len(text.lines), "must have at least two lines per paragraph")
+	lastLines := map[int]bool{len(text.lines) - 1: true}
+	for j, l := range text.lines {
+		if strings.HasSuffix(l.spans[len(l.spans)-1].Text, "\n") {
+			lastLines[j] = true
+		}
+	}
+	test.T(t, len(lastLines), 2)
+	for j, l := range text.lines {
+		left, right := lineBounds(l)
+		if lastLines[j] {
+			test.That(t, right-left < 99.0, "last line must not be justified")
+			test.Float(t, (left+right)/2.0, 50.0)
+		} else {
+			test.Float(t, left, 0.0)
+		}
+	}
+
+	// by default the last line of justified text is left-aligned, and the last lines of other paragraphs are justified
+	rt.SetTextAlignLast(alignAuto)
+	text = rt.ToText(100.0, 0.0, Justify, Top, 0.0, 0.0)
+	left, right := lineBounds(text.lines[len(text.lines)-1])
+	test.Float(t, left, 0.0)
+	test.That(t, right < 99.0, "last line must not be justified")
+	for _, l := range text.lines[:len(text.lines)-1] {
+		left, right = lineBounds(l)
+		test.Float(t, left, 0.0)
+		test.That(t, 99.0 < right, "line must be justified")
+	}
+}
+
+func TestRichTextParagraphStyle(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.SetParagraphStyle(ParagraphStyle{Align: Center})
+	rt.Add(face, "Heading\n")
+	rt.Add(face, "Lorem ipsum dolor sit amet, consectetur adipiscing elit.\r\n")
+	rt.SetParagraphStyle(ParagraphStyle{Align: Right, Indent: 10.0})
+	rt.Add(face, "Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris.")
+
+	lineBounds := func(l line) (float64, float64) {
+		left, right := math.Inf(1), math.Inf(-1)
+		for _, span := range l.spans {
+			left = math.Min(left, span.X)
+			right = math.Max(right, span.X+span.Width)
+		}
+		return left, right
+	}
+
+	text := rt.ToText(100.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 5)
+	test.String(t, text.lines[0].spans[0].Text, "Heading\n")
+	left, right := lineBounds(text.lines[0])
+	test.Float(t, (left+right)/2.0, 50.0)
+	for _, l := range text.lines[1:3] {
+		left, _ = lineBounds(l)
+		test.Float(t, left, 0.0)
+	}
+	_, right = lineBounds(text.lines[4])
+	test.Float(t, right, 100.0)
+
+	// without paragraph styles the global alignment is used
+	rt.Reset()
+	rt.Add(face, "Heading\nLorem ipsum")
+	text = rt.ToText(100.0, 0.0, Left, Top, 0.0, 0.0)
+	left, _ = lineBounds(text.lines[0])
+	test.Float(t, left, 0.0)
+}
+
+func TestRichTextSetParagraphAlign(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	lineBounds := func(l line) (float64, float64) {
+		left, right := math.Inf(1), math.Inf(-1)
+		for _, span := range l.spans {
+			left = math.Min(left, span.X)
+			right = math.Max(right, span.X+span.Width)
+		}
+		return left, right
+	}
+
+	// paragraphs without an alignment use the global alignment
+	rt := NewRichText(face)
+	rt.SetParagraphAlign(Center)
+	rt.Add(face, "Heading\n")
+	rt.Add(face, "Lorem ipsum\n")
+	rt.SetParagraphAlign(Left)
+	rt.Add(face, "dolor sit amet")
+	text := rt.ToText(100.0, 0.0, Right, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 3)
+	left, right := lineBounds(text.lines[0])
+	test.Float(t, (left+right)/2.0, 50.0)
+	_, right = lineBounds(text.lines[1])
+	test.Float(t, right, 100.0)
+	left, _ = lineBounds(text.lines[2])
+	test.Float(t, left, 0.0)
+
+	// the paragraph keeps the global indentation of the first line
+	rt = NewRichText(face)
+	rt.SetParagraphAlign(Left)
+	rt.Add(face, "dolor sit amet")
+	text = rt.ToText(100.0, 0.0, Right, Top, 80.0, 0.0)
+	test.String(t, text.lines[len(text.lines)-1].spans[0].Text, "amet")
+
+	// vertical writing modes align the paragraphs along the columns
+	rt = NewRichText(face)
+	rt.SetWritingMode(VerticalRL)
+	rt.Add(face, "\u65E5\u672C\n")
+	rt.SetParagraphAlign(Bottom)
+	rt.Add(face, "\u65E5\u672C\n")
+	rt.SetParagraphAlign(Center)
+	rt.Add(face, "\u65E5\u672C")
+	text = rt.ToText(50.0, 100.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 3)
+	left, _ = lineBounds(text.lines[0])
+	test.Float(t, left, 0.0)
+	_, right = lineBounds(text.lines[1])
+	test.Float(t, right, 100.0)
+	left, right = lineBounds(text.lines[2])
+	test.Float(t, (left+right)/2.0, 50.0)
+}
+
+func TestRichTextTabStops(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.SetTabStops(TabStop{Pos: 60.0, Align: RightTab}, TabStop{Pos: 30.0, Align: LeftTab})
+	rt.Add(face, "a\tbc\tdef")
+
+	text := rt.ToText(100.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 1)
+	spans := text.lines[0].spans
+	test.T(t, len(spans), 3)
+	test.T(t, spans[1].Text, "bc\t")
+	test.Float(t, spans[1].X, 30.0)
+	test.T(t, spans[2].Text, "def")
+	test.Float(t, spans[2].X+spans[2].Width, 60.0)
+
+	// decimal and center tabs
+	rt = NewRichText(face)
+	rt.SetTabStops(TabStop{Pos: 30.0, Align: DecimalTab, Decimal: ','}, TabStop{Pos: 60.0, Align: CenterTab})
+	rt.Add(face, "a\t12,5\tbc")
+
+	text = rt.ToText(100.0, 0.0, Left, Top, 0.0, 0.0)
+	spans = text.lines[0].spans
+	test.T(t, len(spans), 3)
+	test.Float(t, spans[1].X+face.TextWidth("12"), 30.0)
+	test.Float(t, spans[2].X+spans[2].Width/2.0, 60.0)
+
+	// tabs on wrapped lines align to the tab stops from the start of their line
+	rt = NewRichText(face)
+	rt.SetTabStops(TabStop{Pos: 20.0}, TabStop{Pos: 40.0})
+	rt.Add(face, "one two three four five six seven eight nine ten\t1")
+	text = rt.ToText(50.0, 0.0, Left, Top, 0.0, 0.0)
+	test.That(t, 1 < len(text.lines))
+	spans = text.lines[len(text.lines)-1].spans
+	test.T(t, spans[len(spans)-1].Text, "1")
+	prev := spans[len(spans)-2]
+	x := prev.X + face.TextWidth(strings.TrimSuffix(prev.Text, "\t"))
+	if x < 20.0 {
+		test.Float(t, spans[len(spans)-1].X, 20.0)
+	} else {
+		test.Float(t, spans[len(spans)-1].X, 40.0)
+	}
+}
+
+func TestRichTextSetTabStops(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	// columns of numbers align to the tab stops
+	rt := NewRichText(face)
+	rt.SetTabStops(TabStop{Pos: 40.0}, TabStop{Pos: 20.0})
+	rt.Add(face, "1\t22\t333\n4444\t5\t66\n7\t\t8")
+	text := rt.ToText(100.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 3)
+	for _, line := range text.lines[:2] {
+		test.T(t, len(line.spans), 3)
+		test.Float(t, line.spans[1].X, 20.0)
+		test.Float(t, line.spans[2].X, 40.0)
+	}
+	test.Float(t, text.lines[2].spans[len(text.lines[2].spans)-1].X, 40.0)
+
+	// tabs after the last tab stop advance to the default tab stops
+	tabWidth := 8.0 * face.TextWidth(" ")
+	rt = NewRichText(face)
+	rt.Add(face, "1\t22\t333")
+	text = rt.ToText(100.0, 0.0, Left, Top, 0.0, 0.0)
+	test.Float(t, text.lines[0].spans[1].X, tabWidth)
+	test.Float(t, text.lines[0].spans[2].X, 2.0*tabWidth)
+
+	rt.SetTabSize(4.0)
+	text = rt.ToText(100.0, 0.0, Left, Top, 0.0, 0.0)
+	test.Float(t, text.lines[0].spans[1].X, tabWidth/2.0)
+	test.Float(t, text.lines[0].spans[2].X, tabWidth)
+
+	// the line breaker accounts for the advance of tabs so that lines do not overflow
+	rt = NewRichText(face)
+	rt.SetTabStops(TabStop{Pos: 55.0})
+	rt.Add(face, "aaa bbb\tccc")
+	text = rt.ToText(60.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 2)
+	test.That(t, !text.Overflows)
+	for _, line := range text.lines {
+		for _, span := range line.spans {
+			test.That(t, span.X+span.Width <= 60.0+Epsilon, "span must not overflow")
+		}
+	}
+
+	// tabs are not stretched in justified lines
+	rt = NewRichText(face)
+	rt.SetTabStops(TabStop{Pos: 20.0})
+	rt.Add(face, "1\t22 333 4444 55555 666666 7777777 88888888 999999999")
+	text = rt.ToText(60.0, 0.0, Justify, Top, 0.0, 0.0)
+	test.That(t, 1 < len(text.lines))
+	test.T(t, text.lines[0].spans[0].Text, "1\t")
+	test.Float(t, text.lines[0].spans[1].X, 20.0)
+
+	// the lines before tabs to the default tab stops wrap as well
+	rt = NewRichText(face)
+	rt.Add(face, "one two three four five six seven eight nine ten\t1")
+	text = rt.ToText(50.0, 0.0, Left, Top, 0.0, 0.0)
+	test.That(t, 1 < len(text.lines))
+	spans := text.lines[len(text.lines)-1].spans
+	test.T(t, spans[len(spans)-1].Text, "1")
+	prev := spans[len(spans)-2]
+	x := prev.X + face.TextWidth(strings.TrimSuffix(prev.Text, "\t"))
+	test.Float(t, spans[len(spans)-1].X, (math.Floor(x/tabWidth)+1.0)*tabWidth)
+
+	// tab stops of right-to-left paragraphs are measured from the right
+	rt = NewRichText(face)
+	rt.SetTabStops(TabStop{Pos: 20.0})
+	rt.Add(face, "\u05D0\u05D1\t\u05D2\u05D3")
+	text = rt.ToText(100.0, 0.0, Right, Top, 0.0, 0.0)
+	spans = text.lines[0].spans
+	test.T(t, len(spans), 2)
+	for _, span := range spans {
+		if span.Text == "\u05D0\u05D1\t" {
+			test.Float(t, span.X+span.Width, 100.0)
+		} else {
+			test.T(t, span.Text, "\u05D2\u05D3")
+			test.Float(t, span.X+span.Width, 80.0)
+		}
+	}
+
+	// and from the right of wrapped lines
+	rt = NewRichText(face)
+	rt.SetTabStops(TabStop{Pos: 20.0}, TabStop{Pos: 40.0})
+	rt.Add(face, strings.Repeat("\u05D0\u05D1\u05D2 ", 12)+"\u05D3\t\u05D4")
+	text = rt.ToText(50.0, 0.0, Right, Top, 0.0, 0.0)
+	test.That(t, 1 < len(text.lines))
+	spans = text.lines[len(text.lines)-1].spans
+	test.T(t, len(spans), 2)
+	for _, span := range spans {
+		if strings.HasSuffix(span.Text, "\t") {
+			test.Float(t, span.X+span.Width, 50.0)
+			x = face.TextWidth(strings.TrimSuffix(span.Text, "\t"))
+		}
+	}
+	for _, span := range spans {
+		if span.Text == "\u05D4" && x < 20.0 {
+			test.Float(t, span.X+span.Width, 30.0)
+		} else if span.Text == "\u05D4" {
+			test.Float(t, span.X+span.Width, 10.0)
+		}
+	}
+}
+
+func TestRichTextLineBreakOptions(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	s := "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat."
+
+	var tests = []struct {
+		tolerance float64
+		looseness int
+		lines     int
+	}{
+		{canvasText.Tolerance, 0, 16},
+		{canvasText.Tolerance, 1, 17},
+		{10.0, -1, 16},
+		{-1.0, 0, 16}, // clamped to zero
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.tolerance, tt.looseness), func(t *testing.T) {
+			rt := NewRichText(face)
+			rt.SetLineBreakOptions(tt.tolerance, tt.looseness)
+			rt.Add(face, s)
+			text := rt.ToText(40.0, 0.0, Justify, Top, 0.0, 0.0)
+			test.T(t, len(text.lines), tt.lines)
+			test.That(t, !text.Overflows)
+		})
+	}
+
+	// defaults match the current behavior
+	rt := NewRichText(face)
+	rt.Add(face, s)
+	test.T(t, len(rt.ToText(40.0, 0.0, Justify, Top, 0.0, 0.0).lines), 16)
+}
+
+func TestRichTextHyphenate(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	red := family.Face(12.0, Red, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.Add(face, "typesetting ")
+	rt.Add(red, "hyphenation")
+	test.Error(t, rt.Hyphenate("en-US"))
+	test.T(t, rt.String(), "type\u00ADset\u00ADting hy\u00ADphen\u00ADation")
+	test.T(t, rt.locs, indexer{0, 14})
+	test.T(t, rt.Hyphenate("xx") != nil, true)
+
+	// break at a soft hyphen which is shown as a hyphen
+	text := rt.ToText(face.TextWidth("typeset-"), 0.0, Left, Top, 0.0, 0.0)
+	test.That(t, 2 < len(text.lines))
+	spans := text.lines[0].spans
+	test.T(t, spans[len(spans)-1].Text, "set\u00AD-")
+	test.T(t, text.lines[len(text.lines)-1].spans[0].Face, red)
+}
+
+func TestRichTextKinsoku(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.SetWritingMode(VerticalRL)
+	rt.Add(face, strings.Repeat("これは、日本語の文章です。ちょっと（長い）ですね。", 4))
+
+	text := rt.ToText(0.0, 31.0, Justify, Top, 0.0, 0.0)
+	test.That(t, 4 < len(text.lines), "must have multiple columns")
+	for _, l := range text.lines[1:] {
+		r, _ := utf8.DecodeRuneInString(l.spans[0].Text)
+		test.That(t, !strings.ContainsRune("、。）ょっ", r), "column must not start with", string(r))
+	}
+}
+
+func TestRichTextSmartTypography(t *testing.T) {
+	fontDejaVu, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := fontDejaVu.Face(12.0, Black)
+
+	rt := NewRichText(face)
+	rt.Add(face, `He said "hi"--really...`)
+	test.String(t, rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0).String(), `He said "hi"--really...`)
+
+	rt = NewRichText(face)
+	rt.SetSmartTypography(true)
+	rt.Add(face, `He said "hi`)
+	rt.Add(fontDejaVu.Face(12.0, Red), `"--really...`) // closing quote follows the previous span
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.String(t, text.String(), "He said “hi”—really…")
+	test.T(t, len(text.lines[0].spans), 2)
+	test.String(t, text.lines[0].spans[1].Text, "”—really…")
+}
+
+func TestRichTextFeatures(t *testing.T) {
+	font, err := LoadFontFile("resources/EBGaramond12-Regular.otf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+	dlig := font.Face(12.0, Black)
+	dlig.Features = "dlig"
+	noCalt := font.Face(12.0, Black)
+	noCalt.Features = "-calt"
+
+	rt := NewRichText(face)
+	rt.Add(face, "Th ")
+	rt.Add(dlig, "Th ")
+	rt.Add(face, "Quick ")
+	rt.Add(noCalt, "Quick")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	spans := text.lines[0].spans
+	test.T(t, len(spans), 4)
+	test.T(t, spans[0].Glyphs[0].ID, font.GlyphIndex('T'))
+	test.T(t, spans[1].Glyphs[0].ID != font.GlyphIndex('T'), true) // discretionary Th ligature
+	test.T(t, spans[1].Glyphs[1].Text, ' ')
+	test.T(t, spans[2].Glyphs[0].ID != font.GlyphIndex('Q'), true) // contextual Q with a long tail
+	test.T(t, spans[3].Glyphs[0].ID, font.GlyphIndex('Q'))
+}
+
+func TestRichTextAddWithLang(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	rt := NewRichText(face)
+	rt.Add(face, "fi")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines[0].spans[0].Glyphs), 1) // fi ligature
+
+	// Turkish disables the fi ligature to keep the dotted i
+	rt = NewRichText(face)
+	rt.AddWithLang(face, "fi", "tr", canvasText.ScriptInvalid)
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines[0].spans[0].Glyphs), 2)
+	test.T(t, face.Language, "")
+
+	// Serbian uses a localized form of the Cyrillic be
+	ru := font.Face(12.0, Black)
+	ru.Language = "ru"
+	rt = NewRichText(ru)
+	rt.Add(ru, "б ")
+	rt.AddWithLang(ru, "б", "sr", canvasText.Cyrillic)
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	spans := text.lines[0].spans
+	test.T(t, len(spans), 2)
+	test.T(t, spans[0].Glyphs[0].ID, font.GlyphIndex('б'))
+	test.That(t, spans[1].Glyphs[0].ID != font.GlyphIndex('б'), "locl must substitute the glyph for Serbian")
+}
+
+func TestRichTextDefaultLanguage(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	DefaultLanguage = "tr"
+	defer func() {
+		DefaultLanguage = ""
+	}()
+
+	// Turkish disables the fi ligature to keep the dotted i
+	rt := NewRichText(face)
+	rt.Add(face, "fi")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines[0].spans[0].Glyphs), 2)
+
+	// the face's language takes precedence
+	en := font.Face(12.0, Black)
+	en.Language = "en"
+	rt = NewRichText(en)
+	rt.Add(en, "fi")
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines[0].spans[0].Glyphs), 1)
+}
+
+func TestTextWordBounds(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	text := NewTextLine(face, "hello world", Left)
+	start, end := text.WordBounds(3)
+	test.T(t, text.String()[start:end], "hello")
+	start, end = text.WordBounds(8)
+	test.T(t, text.String()[start:end], "world")
+	start, end = text.GraphemeBounds(4)
+	test.T(t, text.String()[start:end], "o")
+}
+
+func TestRichTextDirection(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+	red := font.Face(12.0, Red)
+
+	// the paragraph starts with a Hebrew letter and is right-to-left
+	rt := NewRichText(face)
+	rt.Add(face, "שלום ")
+	rt.Add(red, "hello")
+	rt.Add(face, " world")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	spans := text.lines[0].spans
+	test.T(t, len(spans), 3)
+	test.T(t, spans[0].Direction, canvasText.RightToLeft)
+	test.Float(t, spans[1].X, 0.0)
+	test.That(t, spans[1].X < spans[2].X, "hello must be at the left of world")
+	test.That(t, spans[2].X < spans[0].X, "world must be at the left of שלום")
+
+	// force left-to-right
+	rt.SetDirection(canvasText.LeftToRight, canvasText.LeftToRight)
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	spans = text.lines[0].spans
+	test.Float(t, spans[0].X, 0.0)
+	test.That(t, spans[0].X < spans[1].X, "hello must be at the right of שלום")
+	test.That(t, spans[1].X < spans[2].X, "world must be at the right of hello")
+
+	// neutral paragraphs use the fallback direction, the last line of a justified right-to-left paragraph is at the right
+	rt = NewRichText(face)
+	rt.SetDirection(canvasText.DirectionInvalid, canvasText.RightToLeft)
+	rt.Add(face, "123 ")
+	rt.Add(red, "456")
+	text = rt.ToText(100.0, 0.0, Justify, Top, 0.0, 0.0)
+	spans = text.lines[0].spans
+	test.T(t, len(spans), 3)
+	test.String(t, spans[0].Text, "123")
+	test.String(t, spans[2].Text, "456")
+	test.That(t, spans[2].X < spans[0].X, "456 must be at the left of 123")
+	test.Float(t, spans[0].X+spans[0].Width, 100.0)
+}
+
+func TestRichTextExtraLeading(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	rt := NewRichText(face)
+	rt.Add(face, "a\nb\nc")
+	text := rt.ToText(100.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 3)
+	y1, y2 := text.lines[1].y, text.lines[2].y
+	_, height := text.Heights()
+
+	rt.SetExtraLeading(func(line int) float64 {
+		if line == 2 {
+			return 5.0
+		}
+		return 0.0
+	})
+	text = rt.ToText(100.0, 0.0, Left, Top, 0.0, 0.0)
+	test.Float(t, text.lines[1].y, y1)
+	test.Float(t, text.lines[2].y, y2+5.0)
+
+	// the extra space is taken into account for fitting lines in the box
+	text = rt.ToText(100.0, height+1.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 2)
+
+	// vertical justification places the last line at the bottom
+	text = rt.ToText(100.0, height+10.0, Left, Justify, 0.0, 0.0)
+	test.T(t, len(text.lines), 3)
+	test.Float(t, text.lines[2].y-text.lines[1].y-(text.lines[1].y-text.lines[0].y), 5.0)
+	test.Float(t, text.lines[2].y, y2+10.0)
+}
+
+func TestTextRenderRange(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = "line " + strconv.Itoa(i)
+	}
+	text := NewTextBox(face, strings.Join(lines, "\n"), 0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 100)
+
+	r := &recordingRenderer{}
+	text.RenderAsPath(r, Identity, DefaultResolution)
+	test.T(t, len(r.ops), 100)
+
+	// render the third to fifth lines
+	r = &recordingRenderer{}
+	y0, y1 := -text.lines[2].y, -text.lines[4].y
+	text.RenderRange(r, Identity, DefaultResolution, y1, y0)
+	test.T(t, len(r.ops), 3)
+}
+
+func TestTextSubpixelGrid(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(11.0, Black, FontRegular, FontNormal)
+	face.Hinting = font.NoHinting
+	face.SubpixelGrid = 1.0 / 3.0
+	glyph, _, err := face.ToPath("l")
+	test.Error(t, err)
+	lsb := glyph.Bounds().X
+
+	resolution := DPMM(5.0)
+	c := New(100.0, 100.0)
+	text := NewTextLine(face, "llll", Left)
+	text.RenderAsPath(c, Identity.Translate(1.234, 0.0), resolution)
+	test.T(t, len(c.layers[0]), 1)
+	p := c.layers[0][0].path.Transform(c.layers[0][0].m)
+
+	// each glyph origin is on a third of a pixel
+	ps := p.Split()
+	test.T(t, len(ps), 4)
+	for _, q := range ps {
+		x := (q.Bounds().X - lsb) * resolution.DPMM() * 3.0
+		test.Float(t, x, math.Round(x))
+	}
+}
+
+func TestTextBytecodeHinting(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(11.0, Black, FontRegular, FontNormal)
+	text := NewTextLine(face, "l", Left)
+
+	render := func(hinting font.Hinting, m Matrix) *Path {
+		face.Hinting = hinting
+		c := New(100.0, 100.0)
+		text.RenderAsPath(c, m, DPMM(5.0))
+		test.T(t, len(c.layers[0]), 1)
+		return c.layers[0][0].path
+	}
+
+	// grid-fit the outline only when the text is not scaled or skewed
+	test.That(t, !render(font.BytecodeHinting, Identity).Equals(render(font.VerticalHinting, Identity)), "translated text must be grid-fitted")
+	test.That(t, render(font.BytecodeHinting, Identity.Scale(2.0, 2.0)).Equals(render(font.VerticalHinting, Identity.Scale(2.0, 2.0))), "scaled text must not be grid-fitted")
+	test.That(t, render(font.BytecodeHinting, Identity.Shear(0.2, 0.0)).Equals(render(font.VerticalHinting, Identity.Shear(0.2, 0.0))), "skewed text must not be grid-fitted")
+}
+
+func TestTextOnCircle(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	radius := 20.0
+
+	text := NewTextOnCircle(face, "STAMP", radius, 90.0, true, false)
+	test.T(t, len(text.lines), 1)
+	spans := text.lines[0].spans
+	test.T(t, len(spans), 5)
+	test.T(t, spans[0].Text, "S")
+
+	// center angle of each glyph in degrees, walking clockwise from the top
+	x := 0.0
+	angles := []float64{}
+	for _, span := range spans {
+		angles = append(angles, 90.0-(x+span.Width/2.0)/radius*180.0/math.Pi)
+		x += span.Width
+	}
+	test.Float(t, float64(spans[0].Rotation), angles[0]-90.0)
+	test.Float(t, float64(spans[2].Rotation), angles[2]-90.0)
+	for _, span := range spans {
+		// the glyph's baseline center is on the circle
+		center := Point{span.X, span.Y}.Add(Identity.Rotate(float64(span.Rotation)).Dot(Point{span.Width / 2.0, 0.0}))
+		test.Float(t, center.Length(), radius)
+	}
+
+	// counter clockwise, the glyphs stand inside the circle
+	text = NewTextOnCircle(face, "STAMP", radius, 270.0, false, false)
+	spans = text.lines[0].spans
+	test.Float(t, float64(spans[0].Rotation), 270.0+spans[0].Width/2.0/radius*180.0/math.Pi+90.0)
+
+	// upright glyphs are not rotated
+	text = NewTextOnCircle(face, "STAMP", radius, 90.0, true, true)
+	spans = text.lines[0].spans
+	test.Float(t, float64(spans[2].Rotation), 0.0)
+	center := Point{spans[2].X + spans[2].Width/2.0, spans[2].Y + face.Metrics().XHeight/2.0}
+	test.Float(t, center.Length(), radius)
+	test.Float(t, center.Angle()*180.0/math.Pi, angles[2])
+}
+
+func TestTextClusterToByteRange(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	text := NewTextLine(face, "a fine day", Left)
+	glyphs := text.lines[0].spans[0].Glyphs
+	test.T(t, len(glyphs), 9) // fi ligature
+	test.T(t, glyphs[2].Cluster, uint32(2))
+	test.T(t, glyphs[3].Cluster, uint32(4))
+
+	start, end := text.ClusterToByteRange(glyphs[2].Cluster)
+	test.T(t, text.String()[start:end], "fi")
+	start, end = text.ClusterToByteRange(3) // inside the ligature
+	test.T(t, text.String()[start:end], "fi")
+	start, end = text.ClusterToByteRange(glyphs[3].Cluster)
+	test.T(t, text.String()[start:end], "n")
+	start, end = text.ClusterToByteRange(100)
+	test.T(t, start, len(text.String()))
+	test.T(t, end, len(text.String()))
+
+	// the space at the line break has no glyph
+	text = NewTextBox(face, "ab cd", 5.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 2)
+	start, end = text.ClusterToByteRange(1)
+	test.T(t, text.String()[start:end], "b")
+	start, end = text.ClusterToByteRange(2)
+	test.T(t, text.String()[start:end], " ")
+
+	// clusters of later lines index into the whole text
+	text = NewTextLine(face, "ab\ncd", Left)
+	test.T(t, text.lines[1].spans[0].Glyphs[0].Cluster, uint32(3))
+	start, end = text.ClusterToByteRange(4)
+	test.T(t, text.String()[start:end], "d")
+}
+
+func TestTextSelectionRects(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+	bold := font.Face(12.0, Red)
+
+	// highlight a word that is its own span
+	rt := NewRichText(face)
+	rt.Add(face, "a ")
+	rt.Add(bold, "word")
+	rt.Add(face, " here")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	i := strings.Index(text.String(), "word")
+	rects := text.SelectionRects(i, i+len("word"))
+	test.T(t, len(rects), 1)
+
+	var span TextSpan
+	for _, span = range text.lines[0].spans {
+		if span.Text == "word" {
+			break
+		}
+	}
+	test.T(t, span.Text, "word")
+	_, ascent, descent, _ := text.lines[0].Heights(text.WritingMode)
+	test.Float(t, rects[0].X, span.X)
+	test.Float(t, rects[0].W, span.Width)
+	test.Float(t, rects[0].Y, -text.lines[0].y-descent)
+	test.Float(t, rects[0].H, ascent+descent)
+	test.T(t, text.SelectionRects(i+len("word"), i), rects)
+	test.T(t, len(text.SelectionRects(i, i)), 0)
+
+	// spans outside the selection are skipped
+	text = NewTextBox(face, "abc def ghi", face.TextWidth("abc")+1.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 3)
+	rects = text.SelectionRects(len("ab"), len("abc de"))
+	test.T(t, len(rects), 2)
+	test.Float(t, rects[0].W, face.TextWidth("c"))
+	test.Float(t, rects[1].W, face.TextWidth("de"))
+}
+
+func TestPreparedText(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.Add(face, canvasText.FairyTales[:200])
+	rt.Add(face, " שלום עולם")
+	prepared := rt.Prepare()
+	for i := 0; i < 20; i++ {
+		width := 40.0 + 5.0*float64(i)
+		text := prepared.Layout(width, 0.0, Justify, Top, 0.0, 0.0)
+		expected := rt.ToText(width, 0.0, Justify, Top, 0.0, 0.0)
+		test.T(t, len(text.lines), len(expected.lines))
+		for j := range text.lines {
+			test.T(t, len(text.lines[j].spans), len(expected.lines[j].spans))
+			for k, span := range text.lines[j].spans {
+				test.String(t, span.Text, expected.lines[j].spans[k].Text)
+				test.Float(t, span.X, expected.lines[j].spans[k].X)
+				test.T(t, span.Glyphs, expected.lines[j].spans[k].Glyphs)
+			}
+		}
+	}
+}
+
+func BenchmarkPreparedTextLayout(b *testing.B) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		b.Fatal(err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.Add(face, canvasText.FairyTales)
+	prepared := rt.Prepare()
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < 20; i++ {
+			prepared.Layout(40.0+5.0*float64(i), 0.0, Justify, Top, 0.0, 0.0)
+		}
+	}
+}
+
+func BenchmarkRichTextToText(b *testing.B) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		b.Fatal(err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(face)
+	rt.Add(face, canvasText.FairyTales)
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < 20; i++ {
+			rt.ToText(40.0+5.0*float64(i), 0.0, Justify, Top, 0.0, 0.0)
+		}
+	}
+}
+
+func BenchmarkTextClusterToByteRange(b *testing.B) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		b.Fatal(err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	text := NewTextBox(face, canvasText.FairyTales, 100.0, 0.0, Justify, Top, 0.0, 0.0)
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < len(canvasText.FairyTales); i += 100 {
+			text.ClusterToByteRange(uint32(i))
+		}
+	}
+}
+
+func BenchmarkTextSelectionRects(b *testing.B) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		b.Fatal(err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	text := NewTextBox(face, canvasText.FairyTales, 100.0, 0.0, Justify, Top, 0.0, 0.0)
+	for n := 0; n < b.N; n++ {
+		text.SelectionRects(len(canvasText.FairyTales)/4, len(canvasText.FairyTales)/2)
+	}
+}
+
+func BenchmarkTextCursorAt(b *testing.B) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		b.Fatal(err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	text := NewTextBox(face, canvasText.FairyTales, 100.0, 0.0, Justify, Top, 0.0, 0.0)
+	for n := 0; n < b.N; n++ {
+		text.CursorAt(len(canvasText.FairyTales) / 2)
+	}
+}
+
+func BenchmarkTextIndexAt(b *testing.B) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		b.Fatal(err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	text := NewTextBox(face, canvasText.FairyTales, 100.0, 0.0, Justify, Top, 0.0, 0.0)
+	_, _, y, _ := text.CursorAt(len(canvasText.FairyTales) / 2)
+	for n := 0; n < b.N; n++ {
+		text.IndexAt(50.0, y)
+	}
+}
+
+func BenchmarkRichTextPrepareFastASCII(b *testing.B) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		b.Fatal(err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal)
+	face.Features = "-ccmp,-kern,-liga,-locl,-mark,-mkmk"
+	log := strings.Repeat("2024-01-01 12:00:00 INFO server: request GET /index.html took 12ms (status=200)\n", 200)
+
+	for _, fast := range []bool{false, true} {
+		b.Run(fmt.Sprint("fast=", fast), func(b *testing.B) {
+			face := *face
+			face.FastASCII = fast
+			for n := 0; n < b.N; n++ {
+				rt := NewRichText(&face)
+				rt.Add(&face, log)
+				rt.Prepare()
+			}
+		})
+	}
+}
+
+func TestTextCursorAt(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	text := NewTextBox(face, "abc déf", face.TextWidth("abc")+1.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 2)
+	span := text.lines[1].spans[0]
+	positions := span.GlyphPositions()
+
+	j, x, y, ok := text.CursorAt(1)
+	test.That(t, ok)
+	test.T(t, j, 0)
+	test.Float(t, x, text.lines[0].spans[0].X+face.TextWidth("a"))
+	test.Float(t, y, -text.lines[0].y)
+
+	j, x, y, ok = text.CursorAt(len("abc d"))
+	test.That(t, ok)
+	test.T(t, j, 1)
+	test.Float(t, x, span.X+positions[1])
+	test.Float(t, y, -text.lines[1].y)
+
+	_, x2, _, _ := text.CursorAt(len("abc d") + 1) // inside the two-byte é
+	test.Float(t, x2, x)
+	_, x, _, ok = text.CursorAt(len("abc déf"))
+	test.That(t, ok)
+	test.Float(t, x, span.X+span.Width)
+	_, _, _, ok = text.CursorAt(len("abc déf") + 1)
+	test.That(t, !ok)
+
+	// right-to-left clusters start at their right edge
+	text = NewTextLine(face, "שלום", Left)
+	span = text.lines[0].spans[0]
+	test.T(t, span.Direction, canvasText.RightToLeft)
+	_, x, _, _ = text.CursorAt(0)
+	test.Float(t, x, span.X+span.Width)
+	_, x2, _, _ = text.CursorAt(1)
+	test.Float(t, x2, x)
+	_, x, _, _ = text.CursorAt(len("שלום"))
+	test.Float(t, x, span.X)
+}
+
+func TestTextIndexAt(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	s := "abc def"
+	text := NewTextBox(face, s, face.TextWidth("abc")+1.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 2)
+	for _, offset := range []int{0, 1, 2, 4, 5, 6, 7} {
+		_, x, y, ok := text.CursorAt(offset)
+		test.That(t, ok)
+		index, ok := text.IndexAt(x+0.1, y+1.0)
+		test.That(t, ok)
+		test.T(t, index, offset)
+	}
+
+	// clamp to the first and last line
+	index, ok := text.IndexAt(-10.0, 100.0)
+	test.That(t, ok)
+	test.T(t, index, 0)
+	index, ok = text.IndexAt(100.0, -100.0)
+	test.That(t, ok)
+	test.T(t, index, len(s))
+
+	// right-to-left text starts at the right
+	text = NewTextLine(face, "שלום", Left)
+	span := text.lines[0].spans[0]
+	index, _ = text.IndexAt(span.X+span.Width-0.1, 0.0)
+	test.T(t, index, 0)
+	index, _ = text.IndexAt(span.X+0.1, 0.0)
+	test.T(t, index, len("שלום"))
+
+	_, ok = NewTextLine(face, "", Left).IndexAt(0.0, 0.0)
+	test.That(t, !ok)
+}
+
+func TestTextStyledRuns(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+	bold := font.Face(12.0, Red)
+
+	rt := NewRichText(face)
+	rt.Add(face, "plain text ")
+	rt.Add(bold, "red words that wrap")
+	rt.Add(face, " and more\nplain text")
+	text := rt.ToText(face.TextWidth("plain text")+1.0, 0.0, Justify, Top, 0.0, 0.0)
+	test.That(t, 3 < len(text.lines))
+	test.T(t, text.StyledRuns(), []StyledRun{
+		{"plain text ", face},
+		{"red words that wrap", bold},
+		{" and more\nplain text", face}, // whitespace at line breaks has no glyphs but keeps its face
+	})
+
+	rt = NewRichText(face)
+	rt.Add(face, "a ")
+	rt.AddPath(Rectangle(2.0, 2.0), Black, Baseline)
+	rt.Add(face, " b")
+	runs := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0).StyledRuns()
+	test.T(t, len(runs), 3)
+	test.T(t, runs[0], StyledRun{"a ", face})
+	test.T(t, runs[1].Face, (*FontFace)(nil))
+	test.T(t, runs[2], StyledRun{" b", face})
+
+	// text that was not laid out from rich text uses the faces of the spans
+	test.T(t, NewTextLine(face, "a b", Left).StyledRuns(), []StyledRun{{"a b", face}})
+	test.T(t, len(NewTextLine(face, "", Left).StyledRuns()), 0)
+}
+
+func TestTextDecorationObjects(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, Black, FontRegular, FontNormal, FontUnderline)
+	plain := family.Face(12.0, Black, FontRegular, FontNormal)
+
+	rt := NewRichText(plain)
+	rt.Add(face, "ab ")
+	rt.AddPath(Rectangle(5.0, 5.0), Black, Baseline)
+	rt.Add(face, " cd")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+
+	n := 0
+	text.WalkDecorations(func(fill Paint, deco *Path) {
+		test.T(t, len(deco.Split()), 1) // continuous underline
+		bounds := deco.Bounds()
+		spans := text.lines[0].spans
+		test.Float(t, bounds.X, 0.0)
+		test.Float(t, bounds.W, spans[len(spans)-1].X+spans[len(spans)-1].Width)
+		n++
+	})
+	test.T(t, n, 1)
+
+	// objects at the start of a line inherit the face of the preceding text
+	rt = NewRichText(plain)
+	rt.Add(face, "ab\n")
+	rt.AddPath(Rectangle(5.0, 5.0), Black, Baseline)
+	rt.Add(face, " cd")
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines), 2)
+	test.T(t, text.lines[1].spans[0].Face, face)
+}
+
+func TestTextUsedGlyphs(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	rt := NewRichText(face)
+	rt.Add(face, "abba ")
+	rt.AddPath(Rectangle(5.0, 5.0), Black, Baseline)
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+
+	used := text.UsedGlyphs()
+	test.T(t, len(used), 1)
+	test.T(t, used[font], []uint16{font.GlyphIndex(' '), font.GlyphIndex('a'), font.GlyphIndex('b')})
+}
+
+func TestTextMergeSpans(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+	bigFace := font.Face(16.0, Black)
+
+	rt := NewRichText(face)
+	for _, s := range []string{"ab", "cd", "ef", "gh"} {
+		faceCopy := *face
+		rt.Add(&faceCopy, s)
+	}
+	rt.Add(bigFace, "ij")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines[0].spans), 5)
+	width := text.lines[0].spans[4].X
+
+	text.MergeSpans()
+	test.T(t, len(text.lines[0].spans), 2)
+	test.String(t, text.lines[0].spans[0].Text, "abcdefgh")
+	test.T(t, len(text.lines[0].spans[0].Glyphs), 8)
+	test.Float(t, text.lines[0].spans[0].Width, width)
+	test.Float(t, text.lines[0].spans[0].Width, face.TextWidth("ab")+face.TextWidth("cd")+face.TextWidth("ef")+face.TextWidth("gh"))
+	test.String(t, text.lines[0].spans[1].Text, "ij")
+	test.T(t, text.lines[0].spans[1].Glyphs[0].Text, 'i') // backing array was not overwritten
+
+	// right-to-left spans are not merged
+	rt = NewRichText(face)
+	for _, s := range []string{"אב", "גד"} {
+		faceCopy := *face
+		rt.Add(&faceCopy, s)
+	}
+	text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+	test.T(t, len(text.lines[0].spans), 2)
+	text.MergeSpans()
+	test.T(t, len(text.lines[0].spans), 2)
+}
+
+func TestTextVisualSpans(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+
+	rt := NewRichText(face)
+	rt.SetDirection(canvasText.RightToLeft, canvasText.RightToLeft)
+	rt.Add(face, "abc ")
+	rt.Add(font.Face(12.0, Red), "אבג דהו")
+	rt.Add(face, " def")
+	text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+
+	test.That(t, text.lines[0].spans[1].X < text.lines[0].spans[0].X, "spans are in logical order")
+	spans := text.VisualSpans(0)
+	test.That(t, 2 < len(spans))
+	for i := 1; i < len(spans); i++ {
+		test.That(t, spans[i-1].X <= spans[i].X, "spans must be sorted by X")
+	}
+	test.T(t, spans[len(spans)-1].Direction, canvasText.LeftToRight) // first logical span is rightmost
+	test.T(t, text.VisualSpans(1), []TextSpan(nil))
+	test.T(t, text.VisualSpans(-1), []TextSpan(nil))
+}
+
+func TestRichTextEmojiPresentation(t *testing.T) {
+	font, err := LoadFontFile("resources/DejaVuSerif.ttf", FontRegular)
+	test.Error(t, err)
+	emojiFont, err := LoadFontFile("resources/EBGaramond12-Regular.otf", FontRegular)
+	test.Error(t, err)
+	face := font.Face(12.0, Black)
+	face.EmojiFace = emojiFont.Face(12.0, Black)
+
+	var tests = []struct {
+		s     string
+		faces []*FontFace
+	}{
+		{"\u2603\uFE0E", []*FontFace{face}},                                       // text presentation
+		{"\u2603\uFE0F", []*FontFace{face.EmojiFace}},                             // emoji presentation
+		{"\u2603", []*FontFace{face}},                                             // text by default
+		{"a\u231Ab", []*FontFace{face, face.EmojiFace, face}},                     // emoji by default
+		{"\u231A\uFE0E", []*FontFace{face}},                                       // text presentation
+		{"1\uFE0F\u20E3", []*FontFace{face.EmojiFace}},                            // keycap
+		{"\U0001F44B\U0001F3FD!", []*FontFace{face.EmojiFace, face}},              // skin tone
+		{"\U0001F1F3\U0001F1F1\U0001F1E7\U0001F1EA", []*FontFace{face.EmojiFace}}, // flags
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			rt := NewRichText(face)
+			rt.Add(face, tt.s)
+			text := rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+			text.MergeSpans()
+			faces := []*FontFace{}
+			for _, span := range text.lines[0].spans {
+				faces = append(faces, span.Face)
+			}
+			test.T(t, faces, tt.faces)
+			for _, span := range text.lines[0].spans {
+				test.T(t, span.Glyphs[0].SFNT, span.Face.Font.SFNT)
+			}
+		})
+	}
+
+	test.That(t, canvasText.HasEmojiPresentation('\u231A'))
+	test.That(t, !canvasText.HasEmojiPresentation('\u2603'))
+	test.T(t, canvasText.EmojiSequence([]rune("\U0001F468\u200D\U0001F469\u200D\U0001F467 ")), 5) // family
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"image/color"
 	"math"
+	"strconv"
 	"strings"
 
 	"github.com/tdewolff/minify/v2"
@@ -98,6 +99,31 @@ func (f dec) String() string {
 	return s
 }
 
+// decimal formats a number with a fixed number of decimal places, trailing zeros are removed.
+type decimal struct {
+	f        float64
+	decimals int
+}
+
+func (f decimal) String() string {
+	if f.decimals < 0 {
+		f.decimals = 0
+	}
+	s := strconv.FormatFloat(f.f, 'f', f.decimals, 64)
+	if strings.IndexByte(s, '.') != -1 {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if s == "-0" {
+		s = "0"
+	} else if strings.HasPrefix(s, "0.") {
+		s = s[1:]
+	} else if strings.HasPrefix(s, "-0.") {
+		s = "-" + s[2:]
+	}
+	return s
+}
+
 // CSSColor is a string formatter to convert a color.RGBA to a CSS color (hexadecimal or using rgba()).
 type CSSColor color.RGBA
 